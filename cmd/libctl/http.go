@@ -0,0 +1,531 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"library/internal/catalog"
+	"library/internal/models"
+	"library/internal/services"
+)
+
+// apiError is a non-2xx response from the server, decoded from the standard
+// { "error": "...", "code": "..." } body.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("server returned %d: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("%s (%s, HTTP %d)", e.Message, e.Code, e.Status)
+}
+
+// importTimeout bounds a books import or whole-catalogue export request.
+const importTimeout = 30 * time.Minute
+
+// importContentTypes are the Content-Types books import sends.
+var importContentTypes = map[catalog.Format]string{
+	catalog.FormatCSV:     "text/csv",
+	catalog.FormatJSONL:   "application/x-ndjson",
+	catalog.FormatMARC:    "application/marc",
+	catalog.FormatMARCXML: "application/marcxml+xml",
+}
+
+// httpBackend implements backend against a running server's REST API.
+type httpBackend struct {
+	baseURL string
+	client  *http.Client
+	ifMatch string // If-Match header to send, if any
+}
+
+func newHTTPBackend(baseURL string) *httpBackend {
+	return &httpBackend{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do sends a JSON request and decodes a successful JSON response into out.
+func (b *httpBackend) do(method, path string, body, out interface{}) error {
+	if body == nil {
+		return b.send(method, path, "", nil, out)
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return b.send(method, path, "application/json", bytes.NewReader(raw), out)
+}
+
+// send sends body with the given content type and decodes a successful JSON
+// response into out.
+func (b *httpBackend) send(method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, b.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	// Each command runs right after the previous one's writes, which a
+	// lagging replica may not have yet.
+	req.Header.Set("X-Consistent-Read", "true")
+	if b.ifMatch != "" {
+		req.Header.Set("If-Match", b.ifMatch)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return responseError(resp.StatusCode, raw)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("bad JSON from %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// stream sends a GET request and copies a successful response body to w.
+func (b *httpBackend) stream(path string, w io.Writer) error {
+	resp, err := b.client.Get(b.baseURL + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		raw, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return responseError(resp.StatusCode, raw)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// responseError decodes the error body of a non-2xx response.
+func responseError(status int, raw []byte) error {
+	apiErr := &apiError{Status: status}
+	var parsed struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	if json.Unmarshal(raw, &parsed) == nil && parsed.Error != "" {
+		apiErr.Message, apiErr.Code = parsed.Error, parsed.Code
+	} else {
+		apiErr.Message = strings.TrimSpace(string(raw))
+	}
+	return apiErr
+}
+
+func (b *httpBackend) CreateUser(name string, role models.UserRole) (*models.User, error) {
+	var user models.User
+	err := b.do(http.MethodPost, "/users", map[string]string{"name": name, "role": string(role)}, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (b *httpBackend) GetUser(userID uuid.UUID) (*models.User, error) {
+	var user models.User
+	if err := b.do(http.MethodGet, "/users/"+userID.String(), nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (b *httpBackend) ListUsers() ([]models.User, error) {
+	var users []models.User
+	if err := b.do(http.MethodGet, "/users", nil, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (b *httpBackend) CreateBook(title, author string, totalCopies int) (*models.Book, error) {
+	var book models.Book
+	body := map[string]interface{}{"title": title, "author": author, "total_copies": totalCopies}
+	if err := b.do(http.MethodPost, "/books", body, &book); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func (b *httpBackend) AddBookCopies(bookID uuid.UUID, count int) ([]models.BookCopy, error) {
+	var copies []models.BookCopy
+	path := "/books/" + bookID.String() + "/copies/bulk"
+	if err := b.do(http.MethodPost, path, map[string]int{"count": count}, &copies); err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+func (b *httpBackend) ImportBooks(format catalog.Format, r io.Reader) (*services.ImportReport, error) {
+	var report services.ImportReport
+	if err := b.slow().send(http.MethodPost, "/books/import", importContentTypes[format], r, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (b *httpBackend) ExportBookMARC(bookID uuid.UUID, format catalog.Format, w io.Writer) error {
+	return b.stream(fmt.Sprintf("/books/%s/marc?format=%s", bookID, format), w)
+}
+
+func (b *httpBackend) ExportCatalogue(format catalog.Format, w io.Writer) error {
+	return b.slow().stream("/books/export?format="+string(format), w)
+}
+
+// slow returns a copy of b for requests that move a whole catalogue, which
+// take far longer than an ordinary request.
+func (b *httpBackend) slow() *httpBackend {
+	return &httpBackend{baseURL: b.baseURL, client: &http.Client{Timeout: importTimeout}, ifMatch: b.ifMatch}
+}
+
+// ifVersion returns a copy of b whose requests only apply to a record still at
+// version, or to any version for 0.
+func (b *httpBackend) ifVersion(version int) *httpBackend {
+	ifMatch := "*"
+	if version != 0 {
+		ifMatch = fmt.Sprintf(`"%d"`, version)
+	}
+	return &httpBackend{baseURL: b.baseURL, client: b.client, ifMatch: ifMatch}
+}
+
+func (b *httpBackend) ListBooks() ([]models.Book, error) {
+	var books []models.Book
+	if err := b.do(http.MethodGet, "/books", nil, &books); err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+func (b *httpBackend) SetBookLoanType(bookID uuid.UUID, loanType models.LoanType, loanHours, ifVersion int) (*models.Book, error) {
+	var book models.Book
+	body := map[string]interface{}{"loan_type": loanType, "loan_hours": loanHours}
+	if err := b.ifVersion(ifVersion).do(http.MethodPut, "/books/"+bookID.String()+"/loan-type", body, &book); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func (b *httpBackend) UpdateBook(bookID uuid.UUID, changes services.BookChanges, ifVersion int) (*models.Book, error) {
+	var book models.Book
+	body := map[string]interface{}{}
+	for name, value := range map[string]*string{
+		"title": changes.Title, "author": changes.Author, "isbn": changes.ISBN,
+		"edition": changes.Edition, "publisher": changes.Publisher, "published": changes.Published,
+	} {
+		if value != nil {
+			body[name] = *value
+		}
+	}
+	if changes.Subjects != nil {
+		body["subjects"] = *changes.Subjects
+	}
+	if err := b.ifVersion(ifVersion).do(http.MethodPatch, "/books/"+bookID.String(), body, &book); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func (b *httpBackend) DeleteBook(bookID uuid.UUID, purge bool, ifVersion int) (*services.BookDeletion, error) {
+	var deletion services.BookDeletion
+	path := "/books/" + bookID.String() + "?purge=" + strconv.FormatBool(purge)
+	if err := b.ifVersion(ifVersion).do(http.MethodDelete, path, nil, &deletion); err != nil {
+		return nil, err
+	}
+	return &deletion, nil
+}
+
+func (b *httpBackend) RestoreBook(bookID uuid.UUID) (*models.Book, error) {
+	var book models.Book
+	if err := b.do(http.MethodPost, "/books/"+bookID.String()+"/restore", nil, &book); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func (b *httpBackend) CheckoutBook(bookID, userID uuid.UUID) (*models.Checkout, *services.QueuedReservation, error) {
+	var resp struct {
+		Type        string                      `json:"type"`
+		Checkout    *models.Checkout            `json:"checkout"`
+		Reservation *services.QueuedReservation `json:"reservation"`
+	}
+	path := "/books/" + bookID.String() + "/checkout"
+	if err := b.do(http.MethodPost, path, map[string]string{"user_id": userID.String()}, &resp); err != nil {
+		return nil, nil, err
+	}
+	return resp.Checkout, resp.Reservation, nil
+}
+
+func (b *httpBackend) ReturnCheckout(checkoutID uuid.UUID) (*models.Checkout, error) {
+	var checkout models.Checkout
+	if err := b.do(http.MethodPost, "/checkouts/"+checkoutID.String()+"/return", nil, &checkout); err != nil {
+		return nil, err
+	}
+	return &checkout, nil
+}
+
+func (b *httpBackend) RenewCheckout(checkoutID uuid.UUID) (*models.Checkout, error) {
+	var checkout models.Checkout
+	if err := b.do(http.MethodPost, "/checkouts/"+checkoutID.String()+"/renew", nil, &checkout); err != nil {
+		return nil, err
+	}
+	return &checkout, nil
+}
+
+func (b *httpBackend) ListUserCheckouts(userID uuid.UUID) ([]models.Checkout, error) {
+	var checkouts []models.Checkout
+	if err := b.do(http.MethodGet, "/users/"+userID.String()+"/checkouts", nil, &checkouts); err != nil {
+		return nil, err
+	}
+	return checkouts, nil
+}
+
+func (b *httpBackend) ListReservationsForBook(bookID uuid.UUID) ([]services.QueuedReservation, error) {
+	var reservations []services.QueuedReservation
+	if err := b.do(http.MethodGet, "/books/"+bookID.String()+"/reservations", nil, &reservations); err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+func (b *httpBackend) ListUserReservations(userID uuid.UUID) ([]services.UserReservation, error) {
+	var reservations []services.UserReservation
+	if err := b.do(http.MethodGet, "/users/"+userID.String()+"/reservations", nil, &reservations); err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+func (b *httpBackend) CancelReservation(reservationID uuid.UUID) error {
+	return b.do(http.MethodDelete, "/reservations/"+reservationID.String(), nil, nil)
+}
+
+func (b *httpBackend) ListOverdueCheckouts() ([]services.OverdueCheckout, error) {
+	var report []services.OverdueCheckout
+	if err := b.do(http.MethodGet, "/reports/overdue", nil, &report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (b *httpBackend) RecomputeFines(scope services.FineScope) (*services.FineRecompute, error) {
+	q := url.Values{}
+	if scope.CheckoutID != nil {
+		q.Set("checkout_id", scope.CheckoutID.String())
+	}
+	if scope.UserID != nil {
+		q.Set("user_id", scope.UserID.String())
+	}
+	if scope.ReturnedSince != nil {
+		q.Set("returned_since", scope.ReturnedSince.UTC().Format("2006-01-02"))
+	}
+	if scope.DryRun {
+		q.Set("dry_run", "true")
+	}
+	path := "/fines/recompute"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var result services.FineRecompute
+	if err := b.do(http.MethodPost, path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *httpBackend) ReconcileAvailability() (int, error) {
+	var resp struct {
+		Corrected int `json:"corrected"`
+	}
+	if err := b.do(http.MethodPost, "/books/availability/reconcile", nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Corrected, nil
+}
+
+func (b *httpBackend) CheckIntegrity(repair bool) (*services.IntegrityReport, error) {
+	var report services.IntegrityReport
+	method, path := http.MethodGet, "/reports/integrity"
+	if repair {
+		method, path = http.MethodPost, "/integrity/repair"
+	}
+	if err := b.do(method, path, nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (b *httpBackend) CreateBranch(name, timezone string) (*models.Branch, error) {
+	var branch models.Branch
+	err := b.do(http.MethodPost, "/branches", map[string]string{"name": name, "timezone": timezone}, &branch)
+	if err != nil {
+		return nil, err
+	}
+	return &branch, nil
+}
+
+func (b *httpBackend) ListBranches() ([]models.Branch, error) {
+	var branches []models.Branch
+	if err := b.do(http.MethodGet, "/branches", nil, &branches); err != nil {
+		return nil, err
+	}
+	return branches, nil
+}
+
+func (b *httpBackend) ImportClosures(branchID uuid.UUID, ical io.Reader) (int, error) {
+	var resp struct {
+		Added int `json:"added"`
+	}
+	path := "/branches/" + branchID.String() + "/closures/import"
+	if err := b.send(http.MethodPost, path, "text/calendar", ical, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Added, nil
+}
+
+func (b *httpBackend) AssignCopyBranch(copyID uuid.UUID, branchID *uuid.UUID, ifVersion int) (*models.BookCopy, error) {
+	var copy models.BookCopy
+	body := map[string]*uuid.UUID{"branch_id": branchID}
+	if err := b.ifVersion(ifVersion).do(http.MethodPut, "/copies/"+copyID.String()+"/branch", body, &copy); err != nil {
+		return nil, err
+	}
+	return &copy, nil
+}
+
+func (b *httpBackend) CreateTerm(name string, start, end time.Time) (*models.Term, error) {
+	var term models.Term
+	body := map[string]string{
+		"name":       name,
+		"start_date": start.Format("2006-01-02"),
+		"end_date":   end.Format("2006-01-02"),
+	}
+	if err := b.do(http.MethodPost, "/terms", body, &term); err != nil {
+		return nil, err
+	}
+	return &term, nil
+}
+
+func (b *httpBackend) ListTerms() ([]models.Term, error) {
+	var terms []models.Term
+	if err := b.do(http.MethodGet, "/terms", nil, &terms); err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
+
+func (b *httpBackend) TermEndReport(termID *uuid.UUID) (*services.TermEndReport, error) {
+	var report services.TermEndReport
+	path := "/reports/term-end"
+	if termID != nil {
+		path += "?term_id=" + termID.String()
+	}
+	if err := b.do(http.MethodGet, path, nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (b *httpBackend) CreateCourse(code, title string, termID *uuid.UUID) (*models.Course, error) {
+	var course models.Course
+	body := map[string]string{"code": code, "title": title}
+	if termID != nil {
+		body["term_id"] = termID.String()
+	}
+	if err := b.do(http.MethodPost, "/courses", body, &course); err != nil {
+		return nil, err
+	}
+	return &course, nil
+}
+
+func (b *httpBackend) ListCourses() ([]models.Course, error) {
+	var courses []models.Course
+	if err := b.do(http.MethodGet, "/courses", nil, &courses); err != nil {
+		return nil, err
+	}
+	return courses, nil
+}
+
+func (b *httpBackend) CreateReadingList(courseID uuid.UUID, title string) (*models.ReadingList, error) {
+	var list models.ReadingList
+	body := map[string]string{"title": title}
+	if err := b.do(http.MethodPost, "/courses/"+courseID.String()+"/reading-lists", body, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (b *httpBackend) ListReadingLists(courseID uuid.UUID) ([]models.ReadingList, error) {
+	var lists []models.ReadingList
+	if err := b.do(http.MethodGet, "/courses/"+courseID.String()+"/reading-lists", nil, &lists); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (b *httpBackend) SetReadingListEntries(listID uuid.UUID, entries []models.ReadingListEntry) (*services.ReadingListDetail, error) {
+	type entry struct {
+		BookID   uuid.UUID `json:"book_id"`
+		Required bool      `json:"required"`
+		Note     string    `json:"note"`
+	}
+	body := struct {
+		Entries []entry `json:"entries"`
+	}{Entries: make([]entry, 0, len(entries))}
+	for _, e := range entries {
+		body.Entries = append(body.Entries, entry{BookID: e.BookID, Required: e.Required, Note: e.Note})
+	}
+	var detail services.ReadingListDetail
+	if err := b.do(http.MethodPut, "/reading-lists/"+listID.String()+"/entries", body, &detail); err != nil {
+		return nil, err
+	}
+	return &detail, nil
+}
+
+func (b *httpBackend) ReadingListAvailability(listID uuid.UUID) (*services.ReadingListAvailability, error) {
+	var availability services.ReadingListAvailability
+	if err := b.do(http.MethodGet, "/reading-lists/"+listID.String()+"/availability", nil, &availability); err != nil {
+		return nil, err
+	}
+	return &availability, nil
+}
+
+func (b *httpBackend) ReserveReadingList(listID uuid.UUID, loanType models.LoanType, loanHours int) (*services.CourseReserveResult, error) {
+	var result services.CourseReserveResult
+	body := map[string]interface{}{"loan_type": loanType, "loan_hours": loanHours}
+	if err := b.do(http.MethodPost, "/reading-lists/"+listID.String()+"/reserve", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
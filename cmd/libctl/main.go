@@ -0,0 +1,1118 @@
+// Command libctl is the administration tool for librarians and operators.
+//
+// It performs routine tasks — creating users, bulk-adding copies, returning
+// checkouts, recomputing fines and printing reports — either directly against
+// the database through LibraryService (the default) or through a running
+// server's HTTP API (-api URL).
+//
+// Usage:
+//
+//	libctl [-config FILE] [-api URL] [-o table|json] [-v] <resource> <action> [flags] [args]
+//
+// Exit codes:
+//
+//	0  success
+//	1  unexpected failure
+//	2  usage error
+//	3  referenced user, book or checkout not found
+//	4  business rule violation (already returned, duplicate reservation, ...)
+//	5  invalid input rejected by the service
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"library/internal/bootstrap"
+	"library/internal/catalog"
+	"library/internal/clock"
+	"library/internal/config"
+	"library/internal/models"
+	"library/internal/services"
+)
+
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsage    = 2
+	exitNotFound = 3
+	exitConflict = 4
+	exitInvalid  = 5
+)
+
+// backend is the subset of services.LibraryService that libctl uses. The
+// service satisfies it directly; httpBackend implements it over the REST API.
+type backend interface {
+	CreateUser(name string, role models.UserRole) (*models.User, error)
+	GetUser(userID uuid.UUID) (*models.User, error)
+	ListUsers() ([]models.User, error)
+
+	CreateBook(title, author string, totalCopies int) (*models.Book, error)
+	AddBookCopies(bookID uuid.UUID, count int) ([]models.BookCopy, error)
+	ListBooks() ([]models.Book, error)
+	SetBookLoanType(bookID uuid.UUID, loanType models.LoanType, loanHours, ifVersion int) (*models.Book, error)
+	UpdateBook(bookID uuid.UUID, changes services.BookChanges, ifVersion int) (*models.Book, error)
+	DeleteBook(bookID uuid.UUID, purge bool, ifVersion int) (*services.BookDeletion, error)
+	RestoreBook(bookID uuid.UUID) (*models.Book, error)
+	ImportBooks(format catalog.Format, r io.Reader) (*services.ImportReport, error)
+	ExportBookMARC(bookID uuid.UUID, format catalog.Format, w io.Writer) error
+	ExportCatalogue(format catalog.Format, w io.Writer) error
+
+	CheckoutBook(bookID, userID uuid.UUID) (*models.Checkout, *services.QueuedReservation, error)
+	ReturnCheckout(checkoutID uuid.UUID) (*models.Checkout, error)
+	RenewCheckout(checkoutID uuid.UUID) (*models.Checkout, error)
+	ListUserCheckouts(userID uuid.UUID) ([]models.Checkout, error)
+	ListReservationsForBook(bookID uuid.UUID) ([]services.QueuedReservation, error)
+	ListUserReservations(userID uuid.UUID) ([]services.UserReservation, error)
+	CancelReservation(reservationID uuid.UUID) error
+
+	ListOverdueCheckouts() ([]services.OverdueCheckout, error)
+	RecomputeFines(scope services.FineScope) (*services.FineRecompute, error)
+	CheckIntegrity(repair bool) (*services.IntegrityReport, error)
+	ReconcileAvailability() (int, error)
+
+	CreateBranch(name, timezone string) (*models.Branch, error)
+	ListBranches() ([]models.Branch, error)
+	ImportClosures(branchID uuid.UUID, ical io.Reader) (int, error)
+	AssignCopyBranch(copyID uuid.UUID, branchID *uuid.UUID, ifVersion int) (*models.BookCopy, error)
+
+	CreateTerm(name string, start, end time.Time) (*models.Term, error)
+	ListTerms() ([]models.Term, error)
+	TermEndReport(termID *uuid.UUID) (*services.TermEndReport, error)
+
+	CreateCourse(code, title string, termID *uuid.UUID) (*models.Course, error)
+	ListCourses() ([]models.Course, error)
+	CreateReadingList(courseID uuid.UUID, title string) (*models.ReadingList, error)
+	ListReadingLists(courseID uuid.UUID) ([]models.ReadingList, error)
+	SetReadingListEntries(listID uuid.UUID, entries []models.ReadingListEntry) (*services.ReadingListDetail, error)
+	ReadingListAvailability(listID uuid.UUID) (*services.ReadingListAvailability, error)
+	ReserveReadingList(listID uuid.UUID, loanType models.LoanType, loanHours int) (*services.CourseReserveResult, error)
+}
+
+// cli carries the global options and the selected backend into commands.
+type cli struct {
+	backend backend
+	out     *printer
+}
+
+type command struct {
+	usage string
+	run   func(c *cli, args []string) error
+}
+
+// commands maps "<resource> <action>" to its implementation.
+var commands = map[string]command{
+	"users create":               {"users create -name NAME [-role STUDENT|LIBRARIAN]", cmdUsersCreate},
+	"users list":                 {"users list", cmdUsersList},
+	"users get":                  {"users get USER_ID", cmdUsersGet},
+	"books create":               {"books create -title TITLE -author AUTHOR [-copies N]", cmdBooksCreate},
+	"books list":                 {"books list", cmdBooksList},
+	"books import":               {"books import [-format csv|jsonl|marc|marcxml] FILE", cmdBooksImport},
+	"books marc":                 {"books marc [-format marc|marcxml] [-file FILE] [BOOK_ID]", cmdBooksMARC},
+	"books export":               {"books export [-format csv|jsonl|dc|marc|marcxml] [-file FILE]", cmdBooksExport},
+	"books loan-type":            {"books loan-type -type STANDARD|SHORT|OVERNIGHT [-hours N] [-if-version N] BOOK_ID", cmdBooksLoanType},
+	"books reconcile":            {"books reconcile", cmdBooksReconcile},
+	"books update":               {"books update [-title T] [-author A] [-isbn ISBN] [-edition E] [-publisher P] [-published DATE] [-subjects 'S1; S2'] [-if-version N] BOOK_ID", cmdBooksUpdate},
+	"books delete":               {"books delete [-purge] [-if-version N] BOOK_ID", cmdBooksDelete},
+	"books restore":              {"books restore BOOK_ID", cmdBooksRestore},
+	"copies add":                 {"copies add [-count N] BOOK_ID", cmdCopiesAdd},
+	"copies branch":              {"copies branch (-branch BRANCH_ID | -none) [-if-version N] COPY_ID", cmdCopiesBranch},
+	"branches create":            {"branches create -name NAME [-timezone ZONE]", cmdBranchesCreate},
+	"branches list":              {"branches list", cmdBranchesList},
+	"closures import":            {"closures import -branch BRANCH_ID FILE.ics", cmdClosuresImport},
+	"checkouts create":           {"checkouts create -book BOOK_ID -user USER_ID", cmdCheckoutsCreate},
+	"checkouts return":           {"checkouts return CHECKOUT_ID", cmdCheckoutsReturn},
+	"checkouts renew":            {"checkouts renew CHECKOUT_ID", cmdCheckoutsRenew},
+	"checkouts list":             {"checkouts list -user USER_ID", cmdCheckoutsList},
+	"reservations list":          {"reservations list BOOK_ID", cmdReservationsList},
+	"reservations user":          {"reservations user USER_ID", cmdReservationsUser},
+	"reservations cancel":        {"reservations cancel RESERVATION_ID", cmdReservationsCancel},
+	"reports overdue":            {"reports overdue", cmdReportsOverdue},
+	"reports term-end":           {"reports term-end [-term TERM_ID]", cmdReportsTermEnd},
+	"terms create":               {"terms create -name NAME -start YYYY-MM-DD -end YYYY-MM-DD", cmdTermsCreate},
+	"terms list":                 {"terms list", cmdTermsList},
+	"courses create":             {"courses create -code CODE -title TITLE [-term TERM_ID]", cmdCoursesCreate},
+	"courses list":               {"courses list", cmdCoursesList},
+	"reading-lists create":       {"reading-lists create -course COURSE_ID -title TITLE", cmdReadingListsCreate},
+	"reading-lists list":         {"reading-lists list -course COURSE_ID", cmdReadingListsList},
+	"reading-lists entries":      {"reading-lists entries LIST_ID FILE.json", cmdReadingListsEntries},
+	"reading-lists availability": {"reading-lists availability LIST_ID", cmdReadingListsAvailability},
+	"reading-lists reserve":      {"reading-lists reserve -type SHORT|OVERNIGHT [-hours N] LIST_ID", cmdReadingListsReserve},
+	"fines recompute":            {"fines recompute [-checkout ID] [-user ID] [-since YYYY-MM-DD] [-dry-run]", cmdFinesRecompute},
+	"integrity check":            {"integrity check [-repair]", cmdIntegrityCheck},
+}
+
+// errUsage marks errors caused by a malformed command line.
+var errUsage = errors.New("usage error")
+
+// errRecordsFailed is returned by books import when the service rejected
+// some records; the report has already been printed.
+var errRecordsFailed = errors.New("some records were not imported")
+
+// errIntegrityIssues is returned by integrity check when it found issues
+// and was not asked to repair them; the report has already been printed.
+var errIntegrityIssues = errors.New("integrity issues found")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("libctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", os.Getenv("LIBRARY_CONFIG"), "path to a YAML or TOML configuration file (direct mode)")
+	apiURL := fs.String("api", os.Getenv("LIBCTL_API"), "base URL of a running server, e.g. http://localhost:8080 (API mode)")
+	format := fs.String("o", "table", "output format: table or json")
+	verbose := fs.Bool("v", false, "show service logs (direct mode)")
+	fs.Usage = func() { printUsage(stderr, fs) }
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	rest := fs.Args()
+	if len(rest) < 2 {
+		fs.Usage()
+		return exitUsage
+	}
+	cmd, ok := commands[rest[0]+" "+rest[1]]
+	if !ok {
+		fmt.Fprintf(stderr, "libctl: unknown command %q\n\n", strings.Join(rest[:2], " "))
+		fs.Usage()
+		return exitUsage
+	}
+
+	out, err := newPrinter(stdout, *format)
+	if err != nil {
+		fmt.Fprintf(stderr, "libctl: %v\n", err)
+		return exitUsage
+	}
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	var b backend
+	if *apiURL != "" {
+		b = newHTTPBackend(*apiURL)
+	} else {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "libctl: %v\n", err)
+			return exitUsage
+		}
+		if cfg.Storage == config.StorageMemory {
+			fmt.Fprintln(stderr, "libctl: memory storage lives inside the server process; use -api to reach it")
+			return exitUsage
+		}
+		repos, err := bootstrap.OpenRepositories(cfg)
+		if err != nil {
+			fmt.Fprintf(stderr, "libctl: %v\n", err)
+			return exitFailure
+		}
+		// Each run is a separate process, so a replica could still be
+		// missing what the previous command wrote.
+		b = bootstrap.NewLibraryService(cfg, repos, clock.System()).WithConsistentReads()
+	}
+
+	if err := cmd.run(&cli{backend: b, out: out}, rest[2:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(stderr, "libctl: %v\nusage: libctl %s\n", err, cmd.usage)
+		} else {
+			fmt.Fprintf(stderr, "libctl: %v\n", err)
+		}
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+func printUsage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: libctl [global flags] <resource> <action> [flags] [args]")
+	fmt.Fprintln(w, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(w, "\nGlobal flags:")
+	fs.PrintDefaults()
+}
+
+// exitCode maps service sentinel errors (direct mode) and HTTP statuses (API
+// mode) to the documented exit codes.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, services.ErrBookNotFound),
+		errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrCheckoutNotFound),
+		errors.Is(err, services.ErrReservationNotFound),
+		errors.Is(err, services.ErrCopyNotFound),
+		errors.Is(err, services.ErrBranchNotFound),
+		errors.Is(err, services.ErrTermNotFound),
+		errors.Is(err, services.ErrNoCurrentTerm),
+		errors.Is(err, services.ErrCourseNotFound),
+		errors.Is(err, services.ErrReadingListNotFound):
+		return exitNotFound
+	case errors.Is(err, services.ErrCheckoutAlreadyReturned),
+		errors.Is(err, services.ErrDuplicateReservation),
+		errors.Is(err, services.ErrAlreadyCheckedOut),
+		errors.Is(err, services.ErrCopyOnHold),
+		errors.Is(err, services.ErrReservationsDisabled),
+		errors.Is(err, services.ErrClosureExists),
+		errors.Is(err, services.ErrTermOverlap),
+		errors.Is(err, services.ErrCheckoutOverdue),
+		errors.Is(err, services.ErrRenewalLimitReached),
+		errors.Is(err, services.ErrRenewalBlocked),
+		errors.Is(err, services.ErrRenewalNotExtended),
+		errors.Is(err, services.ErrCourseExists),
+		errors.Is(err, services.ErrTermEnded),
+		errors.Is(err, services.ErrVersionMismatch),
+		errors.Is(err, services.ErrISBNTaken),
+		errors.Is(err, services.ErrBookOnLoan),
+		errors.Is(err, services.ErrBookHasFines),
+		errors.Is(err, services.ErrOverpayment),
+		errors.Is(err, errIntegrityIssues):
+		return exitConflict
+	case errors.Is(err, errRecordsFailed),
+		errors.Is(err, services.ErrInvalidImport),
+		errors.Is(err, services.ErrUnknownImportFormat),
+		errors.Is(err, services.ErrUnknownExportFormat),
+		errors.Is(err, services.ErrMARCRecordTooLong),
+		errors.Is(err, services.ErrInvalidRole),
+		errors.Is(err, services.ErrInvalidCopyCount),
+		errors.Is(err, services.ErrInvalidTimezone),
+		errors.Is(err, services.ErrInvalidICal),
+		errors.Is(err, services.ErrInvalidOpeningHours),
+		errors.Is(err, services.ErrInvalidClosure),
+		errors.Is(err, services.ErrInvalidDateRange),
+		errors.Is(err, services.ErrInvalidTerm),
+		errors.Is(err, services.ErrInvalidLoanType),
+		errors.Is(err, services.ErrInvalidBook),
+		errors.Is(err, services.ErrInvalidCourse),
+		errors.Is(err, services.ErrInvalidReadingList),
+		errors.Is(err, services.ErrInvalidPayment):
+		return exitInvalid
+	}
+
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Status == 404:
+			return exitNotFound
+		case apiErr.Status == 409, apiErr.Status == 412:
+			return exitConflict
+		case apiErr.Status == 400, apiErr.Status == 406:
+			return exitInvalid
+		}
+	}
+	return exitFailure
+}
+
+// ─── Commands ─────────────────────────────────────────────────────────────────
+
+func cmdUsersCreate(c *cli, args []string) error {
+	fs := newFlagSet("users create")
+	name := fs.String("name", "", "full name")
+	role := fs.String("role", string(models.UserRoleStudent), "STUDENT or LIBRARIAN")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *name == "" {
+		return fmt.Errorf("%w: -name is required", errUsage)
+	}
+	user, err := c.backend.CreateUser(*name, models.UserRole(strings.ToUpper(*role)))
+	if err != nil {
+		return err
+	}
+	return c.out.users([]models.User{*user})
+}
+
+func cmdUsersList(c *cli, args []string) error {
+	if err := parseFlags(newFlagSet("users list"), args, 0); err != nil {
+		return err
+	}
+	users, err := c.backend.ListUsers()
+	if err != nil {
+		return err
+	}
+	return c.out.users(users)
+}
+
+func cmdUsersGet(c *cli, args []string) error {
+	ids, err := parseIDs(newFlagSet("users get"), args, "USER_ID")
+	if err != nil {
+		return err
+	}
+	user, err := c.backend.GetUser(ids[0])
+	if err != nil {
+		return err
+	}
+	return c.out.users([]models.User{*user})
+}
+
+func cmdBooksCreate(c *cli, args []string) error {
+	fs := newFlagSet("books create")
+	title := fs.String("title", "", "book title")
+	author := fs.String("author", "", "book author")
+	copies := fs.Int("copies", 1, "number of physical copies to create")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *title == "" || *author == "" {
+		return fmt.Errorf("%w: -title and -author are required", errUsage)
+	}
+	if *copies < 0 {
+		return fmt.Errorf("%w: -copies must not be negative", errUsage)
+	}
+	book, err := c.backend.CreateBook(*title, *author, *copies)
+	if err != nil {
+		return err
+	}
+	return c.out.books([]models.Book{*book})
+}
+
+func cmdBooksList(c *cli, args []string) error {
+	if err := parseFlags(newFlagSet("books list"), args, 0); err != nil {
+		return err
+	}
+	books, err := c.backend.ListBooks()
+	if err != nil {
+		return err
+	}
+	return c.out.books(books)
+}
+
+func cmdBooksLoanType(c *cli, args []string) error {
+	fs := newFlagSet("books loan-type")
+	loanType := fs.String("type", "", "STANDARD, SHORT or OVERNIGHT")
+	hours := fs.Int("hours", 0, "length of a SHORT loan in hours")
+	ifVersion := fs.Int("if-version", 0, "only change the book if it is still at this version")
+	ids, err := parseIDs(fs, args, "BOOK_ID")
+	if err != nil {
+		return err
+	}
+	if *loanType == "" {
+		return fmt.Errorf("%w: -type is required", errUsage)
+	}
+	book, err := c.backend.SetBookLoanType(ids[0], models.LoanType(strings.ToUpper(*loanType)), *hours, *ifVersion)
+	if err != nil {
+		return err
+	}
+	return c.out.books([]models.Book{*book})
+}
+
+func cmdBooksUpdate(c *cli, args []string) error {
+	fs := newFlagSet("books update")
+	title := fs.String("title", "", "new title")
+	author := fs.String("author", "", "new author")
+	isbn := fs.String("isbn", "", `new ISBN, or "" to remove it`)
+	edition := fs.String("edition", "", "new edition")
+	publisher := fs.String("publisher", "", "new publisher")
+	published := fs.String("published", "", "new publication date, e.g. 2019")
+	subjects := fs.String("subjects", "", "new subject headings, separated by ;")
+	ifVersion := fs.Int("if-version", 0, "only change the book if it is still at this version")
+	ids, err := parseIDs(fs, args, "BOOK_ID")
+	if err != nil {
+		return err
+	}
+
+	// Only the flags given are changed.
+	var changes services.BookChanges
+	fields := map[string]**string{
+		"title": &changes.Title, "author": &changes.Author, "isbn": &changes.ISBN,
+		"edition": &changes.Edition, "publisher": &changes.Publisher, "published": &changes.Published,
+	}
+	values := map[string]*string{
+		"title": title, "author": author, "isbn": isbn,
+		"edition": edition, "publisher": publisher, "published": published,
+	}
+	given := 0
+	fs.Visit(func(f *flag.Flag) {
+		if field, ok := fields[f.Name]; ok {
+			*field = values[f.Name]
+			given++
+		}
+		if f.Name == "subjects" {
+			list := strings.Split(*subjects, ";")
+			changes.Subjects = &list
+			given++
+		}
+	})
+	if given == 0 {
+		return fmt.Errorf("%w: nothing to change", errUsage)
+	}
+	book, err := c.backend.UpdateBook(ids[0], changes, *ifVersion)
+	if err != nil {
+		return err
+	}
+	return c.out.books([]models.Book{*book})
+}
+
+func cmdBooksDelete(c *cli, args []string) error {
+	fs := newFlagSet("books delete")
+	purge := fs.Bool("purge", false, "delete the book for good instead of withdrawing it")
+	ifVersion := fs.Int("if-version", 0, "only delete the book if it is still at this version")
+	ids, err := parseIDs(fs, args, "BOOK_ID")
+	if err != nil {
+		return err
+	}
+	deletion, err := c.backend.DeleteBook(ids[0], *purge, *ifVersion)
+	if err != nil {
+		return err
+	}
+	return c.out.deletion(deletion)
+}
+
+func cmdBooksRestore(c *cli, args []string) error {
+	ids, err := parseIDs(newFlagSet("books restore"), args, "BOOK_ID")
+	if err != nil {
+		return err
+	}
+	book, err := c.backend.RestoreBook(ids[0])
+	if err != nil {
+		return err
+	}
+	return c.out.books([]models.Book{*book})
+}
+
+func cmdBooksImport(c *cli, args []string) error {
+	fs := newFlagSet("books import")
+	formatFlag := fs.String("format", "", "csv, jsonl, marc or marcxml (default: from the file extension)")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	path := fs.Arg(0)
+	name := *formatFlag
+	if name == "" {
+		name = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	format, err := catalog.ParseFormat(name)
+	if err != nil {
+		return fmt.Errorf("%w: %v; pass -format", errUsage, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	report, err := c.backend.ImportBooks(format, f)
+	if err != nil {
+		return err
+	}
+	if err := c.out.importReport(report); err != nil {
+		return err
+	}
+	if report.Error != "" {
+		return fmt.Errorf("import stopped early: %s", report.Error)
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%w: %d of %d failed", errRecordsFailed, report.Failed, report.Rows)
+	}
+	return nil
+}
+
+// cmdBooksMARC writes one book, or the whole catalogue when no BOOK_ID is
+// given, as MARC to standard output or a file.
+func cmdBooksMARC(c *cli, args []string) error {
+	fs := newFlagSet("books marc")
+	formatFlag := fs.String("format", "marcxml", "marc (ISO 2709) or marcxml")
+	file := fs.String("file", "", "write to FILE instead of standard output")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("%w: expected at most one BOOK_ID, got %d arguments", errUsage, fs.NArg())
+	}
+	format, err := catalog.ParseFormat(*formatFlag)
+	if err != nil || (format != catalog.FormatMARC && format != catalog.FormatMARCXML) {
+		return fmt.Errorf("%w: -format must be marc or marcxml", errUsage)
+	}
+	var bookID uuid.UUID
+	if fs.NArg() == 1 {
+		if bookID, err = parseUUID("BOOK_ID", fs.Arg(0)); err != nil {
+			return err
+		}
+	}
+
+	w := c.out.w
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if bookID == uuid.Nil {
+		return c.backend.ExportCatalogue(format, w)
+	}
+	return c.backend.ExportBookMARC(bookID, format, w)
+}
+
+// cmdBooksExport writes the whole catalogue to standard output or a file. The
+// format defaults to the file extension, then to CSV.
+func cmdBooksExport(c *cli, args []string) error {
+	fs := newFlagSet("books export")
+	formatFlag := fs.String("format", "", "csv, jsonl, dc, marc or marcxml (default: from the file extension, else csv)")
+	file := fs.String("file", "", "write to FILE instead of standard output")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	name := *formatFlag
+	if name == "" {
+		name = strings.TrimPrefix(filepath.Ext(*file), ".")
+	}
+	format := catalog.FormatCSV
+	if name != "" {
+		var err error
+		if format, err = catalog.ParseFormat(name); err != nil {
+			return fmt.Errorf("%w: %v; pass -format", errUsage, err)
+		}
+	}
+
+	w := c.out.w
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return c.backend.ExportCatalogue(format, w)
+}
+
+func cmdCopiesAdd(c *cli, args []string) error {
+	fs := newFlagSet("copies add")
+	count := fs.Int("count", 1, "number of copies to add")
+	ids, err := parseIDs(fs, args, "BOOK_ID")
+	if err != nil {
+		return err
+	}
+	copies, err := c.backend.AddBookCopies(ids[0], *count)
+	if err != nil {
+		return err
+	}
+	return c.out.copies(copies)
+}
+
+func cmdCopiesBranch(c *cli, args []string) error {
+	fs := newFlagSet("copies branch")
+	branchFlag := fs.String("branch", "", "branch ID")
+	none := fs.Bool("none", false, "detach the copy from its branch")
+	ifVersion := fs.Int("if-version", 0, "only move the copy if it is still at this version")
+	ids, err := parseIDs(fs, args, "COPY_ID")
+	if err != nil {
+		return err
+	}
+	var branchID *uuid.UUID
+	switch {
+	case *none && *branchFlag != "":
+		return fmt.Errorf("%w: -branch and -none are mutually exclusive", errUsage)
+	case !*none:
+		id, err := parseUUID("-branch", *branchFlag)
+		if err != nil {
+			return err
+		}
+		branchID = &id
+	}
+	copy, err := c.backend.AssignCopyBranch(ids[0], branchID, *ifVersion)
+	if err != nil {
+		return err
+	}
+	return c.out.copies([]models.BookCopy{*copy})
+}
+
+func cmdBranchesCreate(c *cli, args []string) error {
+	fs := newFlagSet("branches create")
+	name := fs.String("name", "", "branch name")
+	timezone := fs.String("timezone", "UTC", "IANA time zone of the branch")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *name == "" {
+		return fmt.Errorf("%w: -name is required", errUsage)
+	}
+	branch, err := c.backend.CreateBranch(*name, *timezone)
+	if err != nil {
+		return err
+	}
+	return c.out.branches([]models.Branch{*branch})
+}
+
+func cmdBranchesList(c *cli, args []string) error {
+	if err := parseFlags(newFlagSet("branches list"), args, 0); err != nil {
+		return err
+	}
+	branches, err := c.backend.ListBranches()
+	if err != nil {
+		return err
+	}
+	return c.out.branches(branches)
+}
+
+func cmdClosuresImport(c *cli, args []string) error {
+	fs := newFlagSet("closures import")
+	branchFlag := fs.String("branch", "", "branch ID")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	branchID, err := parseUUID("-branch", *branchFlag)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	added, err := c.backend.ImportClosures(branchID, f)
+	if err != nil {
+		return err
+	}
+	return c.out.count("added", added)
+}
+
+func cmdCheckoutsCreate(c *cli, args []string) error {
+	fs := newFlagSet("checkouts create")
+	bookFlag := fs.String("book", "", "book ID")
+	userFlag := fs.String("user", "", "user ID")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	bookID, err := parseUUID("-book", *bookFlag)
+	if err != nil {
+		return err
+	}
+	userID, err := parseUUID("-user", *userFlag)
+	if err != nil {
+		return err
+	}
+	checkout, reservation, err := c.backend.CheckoutBook(bookID, userID)
+	if err != nil {
+		return err
+	}
+	if checkout != nil {
+		return c.out.checkouts([]models.Checkout{*checkout})
+	}
+	return c.out.reservations([]services.QueuedReservation{*reservation})
+}
+
+func cmdCheckoutsReturn(c *cli, args []string) error {
+	ids, err := parseIDs(newFlagSet("checkouts return"), args, "CHECKOUT_ID")
+	if err != nil {
+		return err
+	}
+	checkout, err := c.backend.ReturnCheckout(ids[0])
+	if err != nil {
+		return err
+	}
+	return c.out.checkouts([]models.Checkout{*checkout})
+}
+
+func cmdCheckoutsRenew(c *cli, args []string) error {
+	ids, err := parseIDs(newFlagSet("checkouts renew"), args, "CHECKOUT_ID")
+	if err != nil {
+		return err
+	}
+	checkout, err := c.backend.RenewCheckout(ids[0])
+	if err != nil {
+		return err
+	}
+	return c.out.checkouts([]models.Checkout{*checkout})
+}
+
+func cmdCheckoutsList(c *cli, args []string) error {
+	fs := newFlagSet("checkouts list")
+	userFlag := fs.String("user", "", "user ID")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	userID, err := parseUUID("-user", *userFlag)
+	if err != nil {
+		return err
+	}
+	checkouts, err := c.backend.ListUserCheckouts(userID)
+	if err != nil {
+		return err
+	}
+	return c.out.checkouts(checkouts)
+}
+
+func cmdReservationsList(c *cli, args []string) error {
+	ids, err := parseIDs(newFlagSet("reservations list"), args, "BOOK_ID")
+	if err != nil {
+		return err
+	}
+	reservations, err := c.backend.ListReservationsForBook(ids[0])
+	if err != nil {
+		return err
+	}
+	return c.out.reservations(reservations)
+}
+
+func cmdReservationsUser(c *cli, args []string) error {
+	ids, err := parseIDs(newFlagSet("reservations user"), args, "USER_ID")
+	if err != nil {
+		return err
+	}
+	reservations, err := c.backend.ListUserReservations(ids[0])
+	if err != nil {
+		return err
+	}
+	return c.out.userReservations(reservations)
+}
+
+func cmdReservationsCancel(c *cli, args []string) error {
+	ids, err := parseIDs(newFlagSet("reservations cancel"), args, "RESERVATION_ID")
+	if err != nil {
+		return err
+	}
+	if err := c.backend.CancelReservation(ids[0]); err != nil {
+		return err
+	}
+	return c.out.count("cancelled", 1)
+}
+
+func cmdReportsOverdue(c *cli, args []string) error {
+	if err := parseFlags(newFlagSet("reports overdue"), args, 0); err != nil {
+		return err
+	}
+	report, err := c.backend.ListOverdueCheckouts()
+	if err != nil {
+		return err
+	}
+	return c.out.overdue(report)
+}
+
+func cmdReportsTermEnd(c *cli, args []string) error {
+	fs := newFlagSet("reports term-end")
+	termFlag := fs.String("term", "", "term ID (default: the term in progress)")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	var termID *uuid.UUID
+	if *termFlag != "" {
+		id, err := parseUUID("-term", *termFlag)
+		if err != nil {
+			return err
+		}
+		termID = &id
+	}
+	report, err := c.backend.TermEndReport(termID)
+	if err != nil {
+		return err
+	}
+	return c.out.termEnd(report)
+}
+
+func cmdTermsCreate(c *cli, args []string) error {
+	fs := newFlagSet("terms create")
+	name := fs.String("name", "", "term name")
+	startFlag := fs.String("start", "", "first day of term (YYYY-MM-DD)")
+	endFlag := fs.String("end", "", "last day of term (YYYY-MM-DD)")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *name == "" {
+		return fmt.Errorf("%w: -name is required", errUsage)
+	}
+	start, err := parseDate("-start", *startFlag)
+	if err != nil {
+		return err
+	}
+	end, err := parseDate("-end", *endFlag)
+	if err != nil {
+		return err
+	}
+	term, err := c.backend.CreateTerm(*name, start, end)
+	if err != nil {
+		return err
+	}
+	return c.out.terms([]models.Term{*term})
+}
+
+func cmdTermsList(c *cli, args []string) error {
+	if err := parseFlags(newFlagSet("terms list"), args, 0); err != nil {
+		return err
+	}
+	terms, err := c.backend.ListTerms()
+	if err != nil {
+		return err
+	}
+	return c.out.terms(terms)
+}
+
+func cmdCoursesCreate(c *cli, args []string) error {
+	fs := newFlagSet("courses create")
+	code := fs.String("code", "", "course code, e.g. CS101")
+	title := fs.String("title", "", "course title")
+	termFlag := fs.String("term", "", "term ID the course is taught in")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *code == "" || *title == "" {
+		return fmt.Errorf("%w: -code and -title are required", errUsage)
+	}
+	var termID *uuid.UUID
+	if *termFlag != "" {
+		id, err := parseUUID("-term", *termFlag)
+		if err != nil {
+			return err
+		}
+		termID = &id
+	}
+	course, err := c.backend.CreateCourse(*code, *title, termID)
+	if err != nil {
+		return err
+	}
+	return c.out.courses([]models.Course{*course})
+}
+
+func cmdCoursesList(c *cli, args []string) error {
+	if err := parseFlags(newFlagSet("courses list"), args, 0); err != nil {
+		return err
+	}
+	courses, err := c.backend.ListCourses()
+	if err != nil {
+		return err
+	}
+	return c.out.courses(courses)
+}
+
+func cmdReadingListsCreate(c *cli, args []string) error {
+	fs := newFlagSet("reading-lists create")
+	courseFlag := fs.String("course", "", "course ID")
+	title := fs.String("title", "", "reading list title")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	courseID, err := parseUUID("-course", *courseFlag)
+	if err != nil {
+		return err
+	}
+	if *title == "" {
+		return fmt.Errorf("%w: -title is required", errUsage)
+	}
+	list, err := c.backend.CreateReadingList(courseID, *title)
+	if err != nil {
+		return err
+	}
+	return c.out.readingLists([]models.ReadingList{*list})
+}
+
+func cmdReadingListsList(c *cli, args []string) error {
+	fs := newFlagSet("reading-lists list")
+	courseFlag := fs.String("course", "", "course ID")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	courseID, err := parseUUID("-course", *courseFlag)
+	if err != nil {
+		return err
+	}
+	lists, err := c.backend.ListReadingLists(courseID)
+	if err != nil {
+		return err
+	}
+	return c.out.readingLists(lists)
+}
+
+// cmdReadingListsEntries replaces a list's entries with those in a JSON file
+// shaped like the body of PUT /reading-lists/:id/entries.
+func cmdReadingListsEntries(c *cli, args []string) error {
+	fs := newFlagSet("reading-lists entries")
+	if err := parseFlags(fs, args, 2); err != nil {
+		return err
+	}
+	listID, err := parseUUID("LIST_ID", fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	raw, err := os.ReadFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	var body struct {
+		Entries []models.ReadingListEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return fmt.Errorf("%w: %s: %v", errUsage, fs.Arg(1), err)
+	}
+	detail, err := c.backend.SetReadingListEntries(listID, body.Entries)
+	if err != nil {
+		return err
+	}
+	return c.out.readingListEntries(detail)
+}
+
+func cmdReadingListsAvailability(c *cli, args []string) error {
+	ids, err := parseIDs(newFlagSet("reading-lists availability"), args, "LIST_ID")
+	if err != nil {
+		return err
+	}
+	availability, err := c.backend.ReadingListAvailability(ids[0])
+	if err != nil {
+		return err
+	}
+	return c.out.availability(availability)
+}
+
+func cmdReadingListsReserve(c *cli, args []string) error {
+	fs := newFlagSet("reading-lists reserve")
+	loanType := fs.String("type", "", "SHORT or OVERNIGHT")
+	hours := fs.Int("hours", 0, "length of a SHORT loan in hours")
+	ids, err := parseIDs(fs, args, "LIST_ID")
+	if err != nil {
+		return err
+	}
+	if *loanType == "" {
+		return fmt.Errorf("%w: -type is required", errUsage)
+	}
+	result, err := c.backend.ReserveReadingList(ids[0], models.LoanType(strings.ToUpper(*loanType)), *hours)
+	if err != nil {
+		return err
+	}
+	return c.out.courseReserve(result)
+}
+
+func cmdFinesRecompute(c *cli, args []string) error {
+	fs := newFlagSet("fines recompute")
+	checkoutFlag := fs.String("checkout", "", "only this checkout")
+	userFlag := fs.String("user", "", "only this user's checkouts")
+	sinceFlag := fs.String("since", "", "only checkouts returned on or after this date (YYYY-MM-DD)")
+	dryRun := fs.Bool("dry-run", false, "report the changes without storing them")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	scope := services.FineScope{DryRun: *dryRun}
+	if *checkoutFlag != "" {
+		id, err := parseUUID("-checkout", *checkoutFlag)
+		if err != nil {
+			return err
+		}
+		scope.CheckoutID = &id
+	}
+	if *userFlag != "" {
+		id, err := parseUUID("-user", *userFlag)
+		if err != nil {
+			return err
+		}
+		scope.UserID = &id
+	}
+	if *sinceFlag != "" {
+		since, err := parseDate("-since", *sinceFlag)
+		if err != nil {
+			return err
+		}
+		scope.ReturnedSince = &since
+	}
+	result, err := c.backend.RecomputeFines(scope)
+	if err != nil {
+		return err
+	}
+	return c.out.fineRecompute(result)
+}
+
+func cmdBooksReconcile(c *cli, args []string) error {
+	if err := parseFlags(newFlagSet("books reconcile"), args, 0); err != nil {
+		return err
+	}
+	corrected, err := c.backend.ReconcileAvailability()
+	if err != nil {
+		return err
+	}
+	return c.out.count("corrected", corrected)
+}
+
+func cmdIntegrityCheck(c *cli, args []string) error {
+	fs := newFlagSet("integrity check")
+	repair := fs.Bool("repair", false, "fix every issue found, in one transaction")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	report, err := c.backend.CheckIntegrity(*repair)
+	if err != nil {
+		return err
+	}
+	if err := c.out.integrity(report); err != nil {
+		return err
+	}
+	if !*repair && len(report.Issues) > 0 {
+		return fmt.Errorf("%w: %d; rerun with -repair to fix them", errIntegrityIssues, len(report.Issues))
+	}
+	return nil
+}
+
+// ─── Argument Helpers ─────────────────────────────────────────────────────────
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseFlags parses args and checks that exactly nArgs positional arguments remain.
+func parseFlags(fs *flag.FlagSet, args []string, nArgs int) error {
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if fs.NArg() != nArgs {
+		return fmt.Errorf("%w: expected %d argument(s), got %d", errUsage, nArgs, fs.NArg())
+	}
+	return nil
+}
+
+// parseIDs parses flags followed by one UUID positional argument per name.
+func parseIDs(fs *flag.FlagSet, args []string, names ...string) ([]uuid.UUID, error) {
+	if err := parseFlags(fs, args, len(names)); err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(names))
+	for i, name := range names {
+		id, err := parseUUID(name, fs.Arg(i))
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func parseDate(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("%w: %s is required", errUsage, name)
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s must be a date (YYYY-MM-DD)", errUsage, name)
+	}
+	return t, nil
+}
+
+func parseUUID(name, value string) (uuid.UUID, error) {
+	if value == "" {
+		return uuid.Nil, fmt.Errorf("%w: %s is required", errUsage, name)
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: %s must be a UUID", errUsage, name)
+	}
+	return id, nil
+}
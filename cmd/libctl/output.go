@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"library/internal/models"
+	"library/internal/services"
+)
+
+// printer renders command results as an aligned table or as indented JSON.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	switch format {
+	case "table":
+		return &printer{w: w}, nil
+	case "json":
+		return &printer{w: w, json: true}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q (want table or json)", format)
+	}
+}
+
+// table writes a header and rows, or v as JSON when JSON output is selected.
+func (p *printer) table(v interface{}, header []string, rows [][]string) error {
+	if p.json {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) users(users []models.User) error {
+	rows := make([][]string, 0, len(users))
+	for _, u := range users {
+		rows = append(rows, []string{u.ID.String(), string(u.Role), u.Name})
+	}
+	return p.table(users, []string{"ID", "ROLE", "NAME"}, rows)
+}
+
+func (p *printer) books(books []models.Book) error {
+	rows := make([][]string, 0, len(books))
+	for _, b := range books {
+		loan := loanLabel(b.LoanType, b.LoanHours)
+		if b.LoanTypeUntil != nil {
+			loan += " until " + formatDate(*b.LoanTypeUntil)
+		}
+		available := fmt.Sprintf("%d of %d", b.AvailableCopies, b.TotalCopies)
+		rows = append(rows, []string{b.ID.String(), available, fmt.Sprint(b.Holds), loan, b.Title, b.Author})
+	}
+	return p.table(books, []string{"ID", "AVAILABLE", "HOLDS", "LOAN", "TITLE", "AUTHOR"}, rows)
+}
+
+func (p *printer) copies(copies []models.BookCopy) error {
+	rows := make([][]string, 0, len(copies))
+	for _, c := range copies {
+		branch := "-"
+		if c.BranchID != nil {
+			branch = c.BranchID.String()
+		}
+		rows = append(rows, []string{c.ID.String(), c.BookID.String(), string(c.Status), branch})
+	}
+	return p.table(copies, []string{"ID", "BOOK", "STATUS", "BRANCH"}, rows)
+}
+
+func (p *printer) branches(branches []models.Branch) error {
+	rows := make([][]string, 0, len(branches))
+	for _, b := range branches {
+		rows = append(rows, []string{b.ID.String(), b.Timezone, b.Name})
+	}
+	return p.table(branches, []string{"ID", "TIMEZONE", "NAME"}, rows)
+}
+
+func (p *printer) checkouts(checkouts []models.Checkout) error {
+	rows := make([][]string, 0, len(checkouts))
+	for _, c := range checkouts {
+		returned := "-"
+		if c.ReturnedAt != nil {
+			returned = formatTime(*c.ReturnedAt)
+		}
+		rows = append(rows, []string{
+			c.ID.String(), c.UserID.String(), c.BookCopyID.String(),
+			formatTime(c.DueDate), returned, fmt.Sprint(c.FineAmount),
+		})
+	}
+	return p.table(checkouts, []string{"ID", "USER", "COPY", "DUE", "RETURNED", "FINE"}, rows)
+}
+
+func (p *printer) reservations(reservations []services.QueuedReservation) error {
+	rows := make([][]string, 0, len(reservations))
+	for _, r := range reservations {
+		rows = append(rows, []string{
+			r.ID.String(), r.BookID.String(), r.UserID.String(),
+			fmt.Sprint(r.QueuePosition), formatTime(r.CreatedAt), estimateLabel(r.EstimatedAvailableAt),
+		})
+	}
+	return p.table(reservations, []string{"ID", "BOOK", "USER", "POSITION", "CREATED", "ESTIMATED"}, rows)
+}
+
+func (p *printer) userReservations(reservations []services.UserReservation) error {
+	rows := make([][]string, 0, len(reservations))
+	for _, r := range reservations {
+		rows = append(rows, []string{
+			r.ID.String(), r.BookID.String(),
+			fmt.Sprintf("%d/%d", r.PlaceInLine, r.QueueLength), formatTime(r.CreatedAt),
+			estimateLabel(r.EstimatedAvailableAt), r.Title,
+		})
+	}
+	return p.table(reservations, []string{"ID", "BOOK", "PLACE", "CREATED", "ESTIMATED", "TITLE"}, rows)
+}
+
+func (p *printer) overdue(report []services.OverdueCheckout) error {
+	rows := make([][]string, 0, len(report))
+	for _, o := range report {
+		late := fmt.Sprintf("%dd", o.DaysOverdue)
+		if o.HoursOverdue > 0 {
+			late = fmt.Sprintf("%dh", o.HoursOverdue)
+		}
+		rows = append(rows, []string{
+			o.ID.String(), o.UserID.String(), o.BookCopyID.String(),
+			formatTime(o.DueDate), late, fmt.Sprint(o.AccruedFine),
+		})
+	}
+	return p.table(report, []string{"CHECKOUT", "USER", "COPY", "DUE", "OVERDUE", "ACCRUED_FINE"}, rows)
+}
+
+func (p *printer) terms(terms []models.Term) error {
+	rows := make([][]string, 0, len(terms))
+	for _, t := range terms {
+		rows = append(rows, []string{t.ID.String(), formatDate(t.StartDate), formatDate(t.EndDate), t.Name})
+	}
+	return p.table(terms, []string{"ID", "START", "END", "NAME"}, rows)
+}
+
+func (p *printer) termEnd(report *services.TermEndReport) error {
+	rows := make([][]string, 0, len(report.Loans))
+	for _, l := range report.Loans {
+		after := ""
+		if l.DueAfterTermEnd {
+			after = "after term"
+		}
+		rows = append(rows, []string{
+			l.ID.String(), l.UserName, string(l.UserRole), l.BookTitle, formatTime(l.DueDate), after,
+		})
+	}
+	return p.table(report, []string{"CHECKOUT", "USER", "ROLE", "TITLE", "DUE", "NOTE"}, rows)
+}
+
+func (p *printer) courses(courses []models.Course) error {
+	rows := make([][]string, 0, len(courses))
+	for _, c := range courses {
+		term := "-"
+		if c.TermID != nil {
+			term = c.TermID.String()
+		}
+		rows = append(rows, []string{c.ID.String(), c.Code, term, c.Title})
+	}
+	return p.table(courses, []string{"ID", "CODE", "TERM", "TITLE"}, rows)
+}
+
+func (p *printer) readingLists(lists []models.ReadingList) error {
+	rows := make([][]string, 0, len(lists))
+	for _, l := range lists {
+		rows = append(rows, []string{l.ID.String(), l.CourseID.String(), l.Title})
+	}
+	return p.table(lists, []string{"ID", "COURSE", "TITLE"}, rows)
+}
+
+func (p *printer) readingListEntries(list *services.ReadingListDetail) error {
+	rows := make([][]string, 0, len(list.Entries))
+	for _, e := range list.Entries {
+		rows = append(rows, []string{
+			fmt.Sprint(e.Position), e.BookID.String(), requiredLabel(e.Required), e.Book.Title, e.Note,
+		})
+	}
+	return p.table(list, []string{"POS", "BOOK", "REQUIRED", "TITLE", "NOTE"}, rows)
+}
+
+func (p *printer) availability(a *services.ReadingListAvailability) error {
+	rows := make([][]string, 0, len(a.Entries))
+	for _, e := range a.Entries {
+		rows = append(rows, []string{
+			fmt.Sprint(e.Position), e.BookID.String(), requiredLabel(e.Required), loanLabel(e.LoanType, e.LoanHours),
+			fmt.Sprintf("%d/%d", e.Available, e.TotalCopies), fmt.Sprint(e.Reservations), e.Title,
+		})
+	}
+	return p.table(a, []string{"POS", "BOOK", "REQUIRED", "LOAN", "AVAILABLE", "QUEUE", "TITLE"}, rows)
+}
+
+func (p *printer) courseReserve(result *services.CourseReserveResult) error {
+	rows := make([][]string, 0, len(result.Reserved)+len(result.Skipped))
+	for _, b := range result.Reserved {
+		rows = append(rows, []string{b.ID.String(), loanLabel(b.LoanType, b.LoanHours), formatDate(result.Until), b.Title})
+	}
+	for _, b := range result.Skipped {
+		rows = append(rows, []string{b.ID.String(), loanLabel(b.LoanType, b.LoanHours), "skipped", b.Title})
+	}
+	return p.table(result, []string{"BOOK", "LOAN", "UNTIL", "TITLE"}, rows)
+}
+
+func (p *printer) importReport(report *services.ImportReport) error {
+	rows := make([][]string, 0, len(report.Results))
+	for _, r := range report.Results {
+		book := "-"
+		if r.BookID != nil {
+			book = r.BookID.String()
+		}
+		rows = append(rows, []string{fmt.Sprint(r.Line), string(r.Status), book, r.Title, r.Reason})
+	}
+	if err := p.table(report, []string{"LINE", "STATUS", "BOOK", "TITLE", "REASON"}, rows); err != nil || p.json {
+		return err
+	}
+	_, err := fmt.Fprintf(p.w, "\n%d rows: %d created, %d skipped, %d failed\n", report.Rows, report.Created, report.Skipped, report.Failed)
+	return err
+}
+
+func (p *printer) integrity(report *services.IntegrityReport) error {
+	rows := make([][]string, 0, len(report.Issues))
+	for _, i := range report.Issues {
+		subject := "-"
+		switch {
+		case i.CopyID != nil:
+			subject = "copy " + i.CopyID.String()
+		case i.ReservationID != nil:
+			subject = "reservation " + i.ReservationID.String()
+		}
+		rows = append(rows, []string{string(i.Kind), i.BookID.String(), subject, requiredLabel(i.Repaired), i.Detail})
+	}
+	if err := p.table(report, []string{"KIND", "BOOK", "SUBJECT", "REPAIRED", "DETAIL"}, rows); err != nil || p.json {
+		return err
+	}
+	if report.Repair {
+		_, err := fmt.Fprintf(p.w, "\n%d issues found and repaired\n", len(report.Issues))
+		return err
+	}
+	_, err := fmt.Fprintf(p.w, "\n%d issues found\n", len(report.Issues))
+	return err
+}
+
+func (p *printer) fineRecompute(result *services.FineRecompute) error {
+	rows := make([][]string, 0, len(result.Changes))
+	for _, ch := range result.Changes {
+		rows = append(rows, []string{ch.CheckoutID.String(), ch.UserID.String(), fmt.Sprint(ch.OldFine), fmt.Sprint(ch.NewFine), fmt.Sprintf("%+d", ch.Delta), requiredLabel(ch.Settled)})
+	}
+	if err := p.table(result, []string{"CHECKOUT", "USER", "OLD", "NEW", "DELTA", "SETTLED"}, rows); err != nil || p.json {
+		return err
+	}
+	if result.DryRun {
+		_, err := fmt.Fprintf(p.w, "\n%d changes (dry run, nothing stored), %d settled\n", len(result.Changes), result.Settled)
+		return err
+	}
+	_, err := fmt.Fprintf(p.w, "\n%d updated, %d settled left unchanged\n", result.Updated, result.Settled)
+	return err
+}
+
+func (p *printer) deletion(d *services.BookDeletion) error {
+	rows := make([][]string, 0, len(d.Cancelled))
+	for _, r := range d.Cancelled {
+		rows = append(rows, []string{r.ID.String(), r.UserID.String(), fmt.Sprint(r.QueuePosition)})
+	}
+	if err := p.table(d, []string{"CANCELLED RESERVATION", "USER", "POSITION"}, rows); err != nil || p.json {
+		return err
+	}
+	state := "withdrawn; restore it with books restore"
+	if d.Purged {
+		state = "deleted for good"
+	}
+	_, err := fmt.Fprintf(p.w, "\nbook %s %s, %d reservations cancelled\n", d.BookID, state, len(d.Cancelled))
+	return err
+}
+
+func (p *printer) count(label string, n int) error {
+	return p.table(map[string]int{label: n}, []string{strings.ToUpper(label)}, [][]string{{fmt.Sprint(n)}})
+}
+
+// loanLabel renders a loan type, with the length of SHORT loans.
+func loanLabel(lt models.LoanType, hours int) string {
+	if lt == models.LoanTypeShort {
+		return fmt.Sprintf("SHORT %dh", hours)
+	}
+	return string(lt)
+}
+
+func requiredLabel(required bool) string {
+	if required {
+		return "yes"
+	}
+	return "no"
+}
+
+func formatDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04")
+}
+
+// estimateLabel renders an estimated availability, which is unknown for a
+// book without copies.
+func estimateLabel(t *time.Time) string {
+	if t == nil {
+		return "unknown"
+	}
+	return formatTime(*t)
+}
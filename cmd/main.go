@@ -1,70 +1,192 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 
+	"library/internal/bootstrap"
+	"library/internal/clock"
+	"library/internal/config"
 	"library/internal/handlers"
-	"library/internal/models"
-	"library/internal/repositories"
+	"library/internal/oai"
 	"library/internal/services"
+	"library/internal/sip2"
+	"library/internal/sru"
 )
 
+const usage = `Usage:
+  library [-config FILE] [-storage postgres|sqlite|memory]   start the HTTP server
+  library [-config FILE] config show                        print the effective configuration (secrets redacted)
+
+-storage=sqlite keeps all data in the single file named by database.sqlite_path
+(SQLITE_PATH, default library.db), creating it and applying migrations as needed.
+-storage=memory keeps all data in process and starts with demo users and books;
+nothing is persisted when the server stops.
+
+The configuration file may be YAML (.yaml, .yml) or TOML (.toml). Environment
+variables such as DATABASE_URL and SERVER_ADDR override values from the file.
+LIBRARY_CONFIG may be used instead of -config.
+`
+
 func main() {
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		log.Fatal("DATABASE_URL environment variable is required")
-	}
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	configPath := flag.String("config", os.Getenv("LIBRARY_CONFIG"), "path to a YAML or TOML configuration file")
+	storage := flag.String("storage", "", "storage backend: postgres, sqlite or memory (overrides config)")
+	flag.Parse()
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	cfg, err := config.Load(*configPath, func(c *config.Config) {
+		if *storage != "" {
+			c.Storage = *storage
+		}
+	})
 	if err != nil {
-		log.Fatalf("failed to connect database: %v", err)
+		log.Fatal(err)
 	}
 
-	sqlDB, err := db.DB()
-	if err != nil {
-		log.Fatalf("failed to get generic DB: %v", err)
+	switch args := flag.Args(); {
+	case len(args) == 0:
+		runServer(cfg)
+	case len(args) == 2 && args[0] == "config" && args[1] == "show":
+		out, err := cfg.Redacted().YAML()
+		if err != nil {
+			log.Fatalf("failed to render config: %v", err)
+		}
+		os.Stdout.Write(out)
+	default:
+		flag.Usage()
+		os.Exit(2)
 	}
-	sqlDB.SetMaxOpenConns(20)
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetConnMaxLifetime(time.Hour)
+}
 
-	// Ensure enums and models are in sync for GORM metadata (no auto-migration).
-	db.Config.DisableAutomaticPing = false
+func runServer(cfg *config.Config) {
+	repos, err := bootstrap.OpenRepositories(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch cfg.Storage {
+	case config.StorageMemory:
+		log.Printf("[WARN] Using in-memory storage: demo data only, nothing is persisted")
+	case config.StorageSQLite:
+		log.Printf("[INFO] Using SQLite database %s", cfg.Database.SQLitePath)
+	}
 
-	userRepo := repositories.NewUserRepository(db)
-	bookRepo := repositories.NewBookRepository(db)
-	bookCopyRepo := repositories.NewBookCopyRepository(db)
-	checkoutRepo := repositories.NewCheckoutRepository(db)
-	reservationRepo := repositories.NewReservationRepository(db)
+	var clk clock.Clock = clock.System()
+	var travel *clock.Offset
+	if cfg.Features.TimeTravel {
+		travel = clock.NewOffset(clk)
+		clk = travel
+		log.Printf("[WARN] Time travel enabled: admins can move the service clock via /admin/clock")
+	}
 
-	libraryService := services.NewLibraryService(db, userRepo, bookRepo, bookCopyRepo, checkoutRepo, reservationRepo)
+	libraryService := bootstrap.NewLibraryService(cfg, repos, clk)
 
-	router := gin.Default()
+	router := gin.New()
+	if cfg.Features.RequestLogging {
+		router.Use(gin.Logger())
+	}
+	router.Use(gin.Recovery())
 
 	handlers.RegisterRoutes(router, libraryService)
+	if cfg.Admin.Token != "" {
+		handlers.RegisterAdminRoutes(router, cfg.Admin.Token, travel, libraryService)
+	}
+	if cfg.OAI.AdminEmail != "" {
+		provider := &oai.Provider{
+			Repository: oai.Repository{
+				Name:       cfg.OAI.RepositoryName,
+				Identifier: cfg.OAI.RepositoryIdentifier,
+				AdminEmail: cfg.OAI.AdminEmail,
+			},
+			Books: libraryService,
+		}
+		handlers.RegisterOAIRoutes(router, provider, cfg.OAI.BaseURL)
+	}
+	handlers.RegisterSRURoutes(router, &sru.Provider{Title: cfg.OAI.RepositoryName, Books: libraryService})
 
-	serverAddr := os.Getenv("SERVER_ADDR")
-	if serverAddr == "" {
-		serverAddr = ":8080"
+	var kiosks *sip2.Server
+	if cfg.SIP2.Addr != "" {
+		kiosks = sip2.NewServer(libraryService, clk, sip2.Config{
+			LoginUser:     cfg.SIP2.LoginUser,
+			LoginPassword: cfg.SIP2.LoginPassword,
+			InstitutionID: cfg.SIP2.InstitutionID,
+			Currency:      cfg.SIP2.Currency,
+			IdleTimeout:   cfg.SIP2.IdleTimeout.Std(),
+		})
+		ln, err := net.Listen("tcp", cfg.SIP2.Addr)
+		if err != nil {
+			log.Fatalf("sip2 listener error: %v", err)
+		}
+		log.Printf("Starting SIP2 listener on %s", cfg.SIP2.Addr)
+		go func() {
+			if err := kiosks.Serve(ln); err != nil && !errors.Is(err, sip2.ErrServerClosed) {
+				log.Fatalf("sip2 server error: %v", err)
+			}
+		}()
 	}
 
 	srv := &http.Server{
-		Addr:         serverAddr,
-		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+		Addr:              cfg.Server.Addr,
+		Handler:           router,
+		ReadTimeout:       cfg.Server.ReadTimeout.Std(),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.Std(),
+		WriteTimeout:      cfg.Server.WriteTimeout.Std(),
+		IdleTimeout:       cfg.Server.IdleTimeout.Std(),
 	}
 
-	log.Printf("Starting server on %s", serverAddr)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	// Drain in-flight requests on SIGINT/SIGTERM before exiting.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if interval := cfg.Circulation.ReconcileInterval.Std(); interval > 0 {
+		go reconcileAvailability(ctx, libraryService, interval)
+	}
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down server (timeout %s)", cfg.Server.ShutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Std())
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("server shutdown error: %v", err)
+		}
+		if kiosks != nil {
+			kiosks.Close()
+		}
+	}()
+
+	log.Printf("Starting server on %s", cfg.Server.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("server error: %v", err)
 	}
 }
 
+// reconcileAvailability corrects drifted per-book availability counts every
+// interval until ctx is cancelled.
+func reconcileAvailability(ctx context.Context, svc services.LibraryService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			corrected, err := svc.ReconcileAvailability()
+			if err != nil {
+				log.Printf("[ERROR] reconcileAvailability: %v", err)
+				continue
+			}
+			if corrected > 0 {
+				log.Printf("[WARN] reconcileAvailability: corrected counts on %d books", corrected)
+			}
+		}
+	}
+}
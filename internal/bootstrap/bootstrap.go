@@ -0,0 +1,268 @@
+// Package bootstrap wires configuration, storage and service layer together so
+// that the HTTP server and the libctl admin tool build the service identically.
+package bootstrap
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"library/internal/cache"
+	"library/internal/clock"
+	"library/internal/config"
+	"library/internal/repositories"
+	"library/internal/services"
+	"library/migrations"
+)
+
+// gormConfig is shared by both databases. Timestamps GORM fills in, such as
+// books.updated_at, are UTC so that they compare correctly both in
+// PostgreSQL's zone-less TIMESTAMP columns and as SQLite text.
+func gormConfig() *gorm.Config {
+	return &gorm.Config{NowFunc: func() time.Time { return time.Now().UTC() }}
+}
+
+// OpenDatabase connects to PostgreSQL and applies the connection pool settings.
+func OpenDatabase(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(cfg.URL), gormConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect database: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get generic DB: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime.Std())
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime.Std())
+
+	// Ensure enums and models are in sync for GORM metadata (no auto-migration).
+	db.Config.DisableAutomaticPing = false
+
+	return db, nil
+}
+
+// OpenSQLite opens (creating if necessary) the SQLite database file at
+// cfg.SQLitePath and applies any pending migrations from migrations/sqlite.
+//
+// SQLite has no row-level locks, so the connection is set up to serialise
+// writers instead: every transaction starts with BEGIN IMMEDIATE, taking the
+// database write lock before its first read, and concurrent writers wait up
+// to the busy timeout for it. A checkout transaction therefore can never read
+// a copy as AVAILABLE while another transaction is about to check it out —
+// the guarantee PostgreSQL gets from SELECT … FOR UPDATE.
+func OpenSQLite(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	sep := "?"
+	if strings.Contains(cfg.SQLitePath, "?") {
+		sep = "&"
+	}
+	dsn := cfg.SQLitePath + sep + "_txlock=immediate&_busy_timeout=10000&_foreign_keys=on&_journal_mode=WAL"
+
+	db, err := gorm.Open(sqlite.Open(dsn), gormConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database %s: %w", cfg.SQLitePath, err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get generic DB: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime.Std())
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime.Std())
+
+	// SQLite has no uuid_generate_v4(); IDs are generated before insert.
+	if err := db.Callback().Create().Before("gorm:create").Register("library:assign_uuid", assignUUID); err != nil {
+		return nil, err
+	}
+
+	if err := migrateSQLite(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// assignUUID gives every record being created a random UUID primary key when
+// it does not already have one.
+func assignUUID(db *gorm.DB) {
+	if db.Statement.Schema == nil {
+		return
+	}
+	field := db.Statement.Schema.PrioritizedPrimaryField
+	if field == nil || field.FieldType != reflect.TypeOf(uuid.UUID{}) {
+		return
+	}
+
+	ctx := db.Statement.Context
+	assign := func(rv reflect.Value) {
+		if _, zero := field.ValueOf(ctx, rv); zero {
+			if err := field.Set(ctx, rv, uuid.New()); err != nil {
+				db.AddError(err)
+			}
+		}
+	}
+	switch rv := db.Statement.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			assign(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		assign(rv)
+	}
+}
+
+// migrateSQLite applies the embedded SQLite migrations that have not been
+// applied yet, each in its own transaction, recording them in
+// schema_migrations.
+func migrateSQLite(db *gorm.DB) error {
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`).Error; err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	entries, err := fs.ReadDir(migrations.SQLite, "sqlite")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries { // ReadDir returns entries sorted by name
+		version := entry.Name()
+		var applied int64
+		if err := db.Table("schema_migrations").Where("version = ?", version).Count(&applied).Error; err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		script, err := fs.ReadFile(migrations.SQLite, path.Join("sqlite", version))
+		if err != nil {
+			return err
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(string(script)).Error; err != nil {
+				return err
+			}
+			return tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", version, err)
+		}
+		log.Printf("[INFO] migrateSQLite: applied %s", version)
+	}
+	return nil
+}
+
+// openReplicas connects to every database.replica_urls entry with the
+// primary's pool settings.
+func openReplicas(cfg config.DatabaseConfig) ([]*gorm.DB, error) {
+	var replicas []*gorm.DB
+	for i, url := range cfg.ReplicaURLs {
+		replicaCfg := cfg
+		replicaCfg.URL = url
+		db, err := OpenDatabase(replicaCfg)
+		if err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		replicas = append(replicas, db)
+	}
+	if len(replicas) > 0 {
+		log.Printf("[INFO] Routing list and report queries to %d read replica(s)", len(replicas))
+	}
+	return replicas, nil
+}
+
+// OpenRepositories returns the repository set selected by cfg.Storage. Memory
+// storage starts pre-populated with the demo data from SeedDemoData.
+func OpenRepositories(cfg *config.Config) (*repositories.Repositories, error) {
+	switch cfg.Storage {
+	case config.StorageMemory:
+		repos := repositories.NewMemoryRepositories()
+		if err := SeedDemoData(repos); err != nil {
+			return nil, fmt.Errorf("failed to seed demo data: %w", err)
+		}
+		return repos, nil
+	case config.StorageSQLite:
+		db, err := OpenSQLite(cfg.Database)
+		if err != nil {
+			return nil, err
+		}
+		return repositories.NewGormRepositories(db), nil
+	case config.StoragePostgres:
+		db, err := OpenDatabase(cfg.Database)
+		if err != nil {
+			return nil, err
+		}
+		replicas, err := openReplicas(cfg.Database)
+		if err != nil {
+			return nil, err
+		}
+		return repositories.NewGormRepositories(db, replicas...), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage %q", cfg.Storage)
+	}
+}
+
+// Policy translates the circulation and feature settings into a service policy.
+func Policy(cfg *config.Config) services.Policy {
+	return services.Policy{
+		LoanPeriodDays:       cfg.Circulation.LoanPeriodDays,
+		FinePerDay:           cfg.Circulation.FinePerDay,
+		FinePerHour:          cfg.Circulation.FinePerHour,
+		ReservationsEnabled:  cfg.Features.Reservations,
+		AutoCheckoutOnReturn: cfg.Features.AutoCheckoutOnReturn,
+		SkipLockedAllocation: cfg.Features.SkipLockedAllocation,
+		MaxRenewals:          cfg.Circulation.MaxRenewals,
+		CapAtTermEnd:         cfg.Circulation.CapAtTermEnd,
+		CirculationIsolation: isolation(cfg.Database.Isolation),
+		TxRetry: repositories.RetryPolicy{
+			MaxAttempts: cfg.Database.TxMaxAttempts,
+			BaseDelay:   cfg.Database.TxRetryBaseDelay.Std(),
+			MaxDelay:    cfg.Database.TxRetryMaxDelay.Std(),
+		},
+	}
+}
+
+// isolation maps the validated database.isolation setting to its level.
+func isolation(name string) repositories.Isolation {
+	if name == config.IsolationSerializable {
+		return repositories.IsolationSerializable
+	}
+	return repositories.IsolationReadCommitted
+}
+
+// NewLibraryService builds the service on top of repos, reading time from clk,
+// with its catalogue reads cached unless cache.max_entries is 0.
+func NewLibraryService(cfg *config.Config, repos *repositories.Repositories, clk clock.Clock) services.LibraryService {
+	svc := services.NewLibraryService(
+		repos.Transactor,
+		clk,
+		Policy(cfg),
+		repos.Users,
+		repos.Books,
+		repos.BookCopies,
+		repos.Checkouts,
+		repos.Reservations,
+		repos.Branches,
+		repos.Terms,
+		repos.Courses,
+		repos.Payments,
+	)
+	if cfg.Cache.MaxEntries == 0 {
+		return svc
+	}
+	return services.NewCachingService(svc, cache.NewLRU(cfg.Cache.MaxEntries), cfg.Cache.TTL.Std())
+}
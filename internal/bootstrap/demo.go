@@ -0,0 +1,86 @@
+package bootstrap
+
+import (
+	"github.com/google/uuid"
+
+	"library/internal/models"
+	"library/internal/repositories"
+)
+
+// demoUsers match the sample users from the README setup guide, so the curl
+// examples and scripts/concurrency_test.go work unchanged in memory mode.
+var demoUsers = []models.User{
+	{ID: uuid.MustParse("00000000-0000-0000-0000-000000000001"), Name: "Alice Librarian", Role: models.UserRoleLibrarian},
+	{ID: uuid.MustParse("00000000-0000-0000-0000-000000000002"), Name: "Bob Student", Role: models.UserRoleStudent},
+	{ID: uuid.MustParse("00000000-0000-0000-0000-000000000003"), Name: "Carol Student", Role: models.UserRoleStudent},
+	{ID: uuid.MustParse("00000000-0000-0000-0000-000000000004"), Name: "Dave Student", Role: models.UserRoleStudent},
+}
+
+var demoBooks = []struct {
+	id     string
+	title  string
+	author string
+	copies int
+}{
+	{"10000000-0000-0000-0000-000000000001", "The Go Programming Language", "Donovan & Kernighan", 1},
+	{"10000000-0000-0000-0000-000000000002", "Clean Architecture", "Robert C. Martin", 3},
+	{"10000000-0000-0000-0000-000000000003", "Designing Data-Intensive Applications", "Martin Kleppmann", 2},
+}
+
+// demoBranch holds every demo copy. It opens Monday to Saturday, so due dates
+// falling on a Sunday roll forward to Monday.
+var demoBranch = models.Branch{
+	ID:       uuid.MustParse("20000000-0000-0000-0000-000000000001"),
+	Name:     "Main Library",
+	Timezone: "UTC",
+}
+
+func demoOpeningHours() []models.OpeningHours {
+	hours := make([]models.OpeningHours, 0, 6)
+	for day := 1; day <= 6; day++ {
+		closes := "20:00"
+		if day == 6 {
+			closes = "14:00"
+		}
+		hours = append(hours, models.OpeningHours{BranchID: demoBranch.ID, Weekday: day, Opens: "09:00", Closes: closes})
+	}
+	return hours
+}
+
+// SeedDemoData inserts the demo branch, users and books in a single transaction.
+func SeedDemoData(repos *repositories.Repositories) error {
+	return repos.Transactor.Transaction(func(tx repositories.Tx) error {
+		branch := demoBranch
+		if err := repos.Branches.Create(tx, &branch); err != nil {
+			return err
+		}
+		if err := repos.Branches.ReplaceOpeningHours(tx, branch.ID, demoOpeningHours()); err != nil {
+			return err
+		}
+		for i := range demoUsers {
+			user := demoUsers[i]
+			if err := repos.Users.Create(tx, &user); err != nil {
+				return err
+			}
+		}
+		for _, b := range demoBooks {
+			book := &models.Book{ID: uuid.MustParse(b.id), Title: b.title, Author: b.author}
+			if err := repos.Books.Create(tx, book); err != nil {
+				return err
+			}
+			for i := 0; i < b.copies; i++ {
+				copy := &models.BookCopy{BookID: book.ID, Status: models.BookCopyStatusAvailable, BranchID: &branch.ID}
+				if err := repos.BookCopies.Create(tx, copy); err != nil {
+					return err
+				}
+			}
+			if err := repos.Books.IncrementTotalCopies(tx, book.ID, b.copies); err != nil {
+				return err
+			}
+			if err := repos.Books.AdjustAvailability(tx, book.ID, repositories.Availability{Available: b.copies}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
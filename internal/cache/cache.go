@@ -0,0 +1,109 @@
+// Package cache stores encoded values under string keys for the service's
+// catalogue reads.
+//
+//   - LRU is the in-process implementation: a bounded map that evicts the
+//     least recently used entry when full.
+//   - A cache shared between server instances, such as Redis or memcached,
+//     plugs in by implementing Cache; values are opaque bytes so that they
+//     can cross the network as they are.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is a key-value store whose entries may disappear at any time, through
+// expiry, eviction or a restart. Implementations must be safe for concurrent
+// use.
+type Cache interface {
+	// Get returns the value stored under key, if there is one that has not
+	// expired.
+	Get(key string) ([]byte, bool)
+	// Set stores value under key, replacing any previous value. A positive
+	// ttl makes the entry expire after that long; 0 keeps it until it is
+	// evicted or deleted.
+	Set(key string, value []byte, ttl time.Duration)
+	// Delete removes key; deleting a missing key is not an error.
+	Delete(key string)
+}
+
+// LRU is an in-process Cache holding at most a fixed number of entries.
+type LRU struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time // zero for no expiry
+}
+
+// NewLRU returns an empty LRU cache that holds up to maxEntries values.
+func NewLRU(maxEntries int) *LRU {
+	return &LRU{
+		max:     max(maxEntries, 1),
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *LRU) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if !e.expires.IsZero() && !time.Now().Before(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *LRU) Set(key string, value []byte, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.max {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRU) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Len returns the number of entries held, including expired ones not yet
+// removed.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).key)
+}
@@ -0,0 +1,288 @@
+// Package calendar answers "is the library open on this day?" for a branch and
+// derives due dates and chargeable overdue days (or hours) from the answer.
+//
+// A Calendar is built from a branch's weekly opening hours and its closure
+// dates. All day arithmetic happens in the branch's time zone, so "Sunday"
+// and "24 December" mean the local calendar day regardless of where the
+// server runs.
+package calendar
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata" // branches may name any IANA zone, even on hosts without zoneinfo
+
+	"library/internal/models"
+)
+
+// dateLayout is the format of closure dates and of Day keys.
+const dateLayout = "2006-01-02"
+
+// maxSearchDays bounds the search for the next open day. A branch that is
+// closed for longer than this is treated as having no usable calendar.
+const maxSearchDays = 366
+
+// Hours is one day's opening interval in minutes after local midnight.
+type Hours struct {
+	Opens  int
+	Closes int
+}
+
+// Calendar is the opening calendar of one branch.
+//
+// A Calendar with no weekly hours treats every day as open except explicit
+// closures; due times then keep the checkout's time of day. Once any weekly
+// hours are set, weekdays without hours are closed and loans fall due at
+// closing time.
+type Calendar struct {
+	loc      *time.Location
+	hours    map[time.Weekday]Hours
+	closures map[string]bool
+}
+
+// New builds the calendar for branch. Malformed opening hours are rejected;
+// the service validates them on the way in, so this only fails on corrupt data.
+func New(branch models.Branch, hours []models.OpeningHours, closures []models.Closure) (*Calendar, error) {
+	loc, err := time.LoadLocation(branch.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("branch %s: %w", branch.ID, err)
+	}
+	c := &Calendar{
+		loc:      loc,
+		hours:    make(map[time.Weekday]Hours, len(hours)),
+		closures: make(map[string]bool, len(closures)),
+	}
+	for _, h := range hours {
+		opens, err := ParseClock(h.Opens)
+		if err != nil {
+			return nil, err
+		}
+		closes, err := ParseClock(h.Closes)
+		if err != nil {
+			return nil, err
+		}
+		c.hours[time.Weekday(h.Weekday)] = Hours{Opens: opens, Closes: closes}
+	}
+	for _, cl := range closures {
+		c.closures[cl.Date.Format(dateLayout)] = true
+	}
+	return c, nil
+}
+
+// Location returns the branch time zone.
+func (c *Calendar) Location() *time.Location {
+	return c.loc
+}
+
+// IsOpen reports whether the library is open at any time on the local day
+// containing t.
+func (c *Calendar) IsOpen(t time.Time) bool {
+	day := t.In(c.loc)
+	if c.closures[day.Format(dateLayout)] {
+		return false
+	}
+	if len(c.hours) == 0 {
+		return true
+	}
+	_, ok := c.hours[day.Weekday()]
+	return ok
+}
+
+// DueDate returns the due time of a loan of loanDays starting at from: the
+// same local day loanDays later, rolled forward to the next open day, at that
+// day's closing time (or at from's time of day when no weekly hours are set).
+// If no open day is found within a year, the unadjusted date is returned.
+func (c *Calendar) DueDate(from time.Time, loanDays int) time.Time {
+	local := from.In(c.loc)
+	naive := local.AddDate(0, 0, loanDays)
+
+	day := naive
+	for i := 0; !c.IsOpen(day); i++ {
+		if i == maxSearchDays {
+			return naive
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+
+	if len(c.hours) == 0 {
+		return day
+	}
+	closes := c.hours[day.Weekday()].Closes
+	y, m, d := day.Date()
+	return time.Date(y, m, d, closes/60, closes%60, 0, 0, c.loc)
+}
+
+// LastDueBy returns the latest due time no later than deadline: the closing
+// time of the last open day on or before deadline's local day (or deadline
+// itself when no weekly hours are set and that day is open). It reports false
+// if no open day is found within a year before deadline.
+func (c *Calendar) LastDueBy(deadline time.Time) (time.Time, bool) {
+	day := deadline.In(c.loc)
+	for i := 0; !c.IsOpen(day); i++ {
+		if i == maxSearchDays {
+			return time.Time{}, false
+		}
+		day = day.AddDate(0, 0, -1)
+	}
+	if len(c.hours) == 0 {
+		if day.Equal(deadline) {
+			return deadline, true
+		}
+		y, m, d := day.Date()
+		return time.Date(y, m, d, 23, 59, 59, 0, c.loc), true
+	}
+	closes := c.hours[day.Weekday()].Closes
+	y, m, d := day.Date()
+	due := time.Date(y, m, d, closes/60, closes%60, 0, 0, c.loc)
+	if due.After(deadline) {
+		due = deadline
+	}
+	return due, true
+}
+
+// NextOpening returns when the library next opens on a day after from's local
+// day: that day's opening time, or from's time of day when no weekly hours are
+// set. If no open day is found within a year, from plus one day is returned.
+func (c *Calendar) NextOpening(from time.Time) time.Time {
+	local := from.In(c.loc)
+	day := local.AddDate(0, 0, 1)
+	for i := 0; !c.IsOpen(day); i++ {
+		if i == maxSearchDays {
+			return local.AddDate(0, 0, 1)
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	if len(c.hours) == 0 {
+		return day
+	}
+	return at(day, c.hours[day.Weekday()].Opens)
+}
+
+// ShortLoanDue returns the due time of a loan of length d starting at from.
+// Once weekly hours are set, a short loan never runs past closing time: it
+// ends at from+d or at that day's closing time, whichever comes first. A loan
+// made before opening starts counting at opening time, and one made after
+// closing (or on a closed day) at the next opening.
+func (c *Calendar) ShortLoanDue(from time.Time, d time.Duration) time.Time {
+	if len(c.hours) == 0 {
+		return from.Add(d)
+	}
+	start := from
+	opens, closes, ok := c.openInterval(from)
+	switch {
+	case ok && from.Before(opens):
+		start = opens
+	case !ok || !from.Before(closes):
+		start = c.NextOpening(from)
+		_, closes, ok = c.openInterval(start)
+	}
+	due := start.Add(d)
+	if ok && due.After(closes) {
+		due = closes
+	}
+	return due
+}
+
+// OpenHoursLate returns the number of started hours during which the library
+// was open between due and returned. Time the library is closed is not
+// counted, so an item put through the returns slot after closing costs
+// nothing extra overnight. Without weekly hours every hour of an open day
+// counts.
+func (c *Calendar) OpenHoursLate(due, returned time.Time) int {
+	if !returned.After(due) {
+		return 0
+	}
+	var late time.Duration
+	for day := midnight(due.In(c.loc)); day.Before(returned); day = day.AddDate(0, 0, 1) {
+		opens, closes, ok := c.openInterval(day)
+		if !ok {
+			continue
+		}
+		if opens.Before(due) {
+			opens = due
+		}
+		if closes.After(returned) {
+			closes = returned
+		}
+		if closes.After(opens) {
+			late += closes.Sub(opens)
+		}
+	}
+	return CeilHours(late)
+}
+
+// CeilHours returns d in hours, rounding any started hour up.
+func CeilHours(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Hour - 1) / time.Hour)
+}
+
+// OpenDaysLate returns the number of open days for which a loan due at due
+// and returned at returned is overdue: the open days after the due day, up to
+// and including the return day. A late return on the due day itself counts as
+// one day, matching the one-day minimum of the calendar-free rule.
+func (c *Calendar) OpenDaysLate(due, returned time.Time) int {
+	if !returned.After(due) {
+		return 0
+	}
+	dueDay := midnight(due.In(c.loc))
+	retDay := midnight(returned.In(c.loc))
+	if !retDay.After(dueDay) {
+		return 1
+	}
+
+	n := 0
+	for day := dueDay.AddDate(0, 0, 1); !day.After(retDay); day = day.AddDate(0, 0, 1) {
+		if c.IsOpen(day) {
+			n++
+		}
+	}
+	return n
+}
+
+// openInterval returns the opening and closing time of the local day
+// containing t, or false if the library is closed that day. Without weekly
+// hours an open day runs from midnight to midnight.
+func (c *Calendar) openInterval(t time.Time) (opens, closes time.Time, ok bool) {
+	if !c.IsOpen(t) {
+		return time.Time{}, time.Time{}, false
+	}
+	day := midnight(t.In(c.loc))
+	if len(c.hours) == 0 {
+		return day, day.AddDate(0, 0, 1), true
+	}
+	h := c.hours[day.Weekday()]
+	return at(day, h.Opens), at(day, h.Closes), true
+}
+
+// at returns minutes after midnight on day's local date.
+func at(day time.Time, minutes int) time.Time {
+	y, m, d := day.Date()
+	return time.Date(y, m, d, minutes/60, minutes%60, 0, 0, day.Location())
+}
+
+func midnight(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// ParseClock parses "HH:MM" (24-hour) into minutes after midnight.
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil || len(s) != 5 {
+		return 0, fmt.Errorf("invalid time of day %q: want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ParseDate parses a closure date ("YYYY-MM-DD") as midnight UTC, the form in
+// which closure dates are stored.
+func ParseDate(s string) (time.Time, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: want YYYY-MM-DD", s)
+	}
+	return t, nil
+}
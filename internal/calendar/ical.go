@@ -0,0 +1,299 @@
+package calendar
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClosureEvent is one closed day read from an iCalendar file.
+type ClosureEvent struct {
+	Date    time.Time // midnight UTC of the closed local date
+	Summary string
+	UID     string
+}
+
+// maxImportDays caps how many closed days a single file may produce, so a
+// runaway recurrence cannot fill the closures table.
+const maxImportDays = 20000
+
+// ErrInvalidICal wraps every problem found while reading an iCalendar file.
+var ErrInvalidICal = errors.New("invalid iCalendar data")
+
+// ParseICal reads the VEVENTs of an iCalendar (RFC 5545) file as closed days.
+//
+// All-day events close each date from DTSTART up to, not including, DTEND.
+// Timed events close every local day (in loc) they touch. Events with
+// STATUS:CANCELLED are ignored. Yearly recurrences (RRULE:FREQ=YEARLY with
+// optional INTERVAL, COUNT and UNTIL) are expanded up to expandUntil; any
+// other recurrence rule is rejected rather than silently imported once.
+func ParseICal(r io.Reader, loc *time.Location, expandUntil time.Time) ([]ClosureEvent, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidICal, err)
+	}
+
+	var (
+		out     []ClosureEvent
+		ev      *vevent
+		inEvent bool
+	)
+	for _, line := range lines {
+		name, params, value, ok := splitProperty(line.text)
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d: malformed property %q", ErrInvalidICal, line.number, line.text)
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			ev, inEvent = &vevent{line: line.number}, true
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if !inEvent {
+				return nil, fmt.Errorf("%w: line %d: END:VEVENT without BEGIN", ErrInvalidICal, line.number)
+			}
+			days, err := ev.days(loc, expandUntil)
+			if err != nil {
+				return nil, fmt.Errorf("%w: event at line %d: %v", ErrInvalidICal, ev.line, err)
+			}
+			out = append(out, days...)
+			if len(out) > maxImportDays {
+				return nil, fmt.Errorf("%w: more than %d closed days", ErrInvalidICal, maxImportDays)
+			}
+			ev, inEvent = nil, false
+		case inEvent:
+			if err := ev.set(name, params, value, loc); err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidICal, line.number, err)
+			}
+		}
+	}
+	if inEvent {
+		return nil, fmt.Errorf("%w: unterminated VEVENT starting at line %d", ErrInvalidICal, ev.line)
+	}
+	return out, nil
+}
+
+// ─── Parsing ──────────────────────────────────────────────────────────────────
+
+type icalLine struct {
+	number int
+	text   string
+}
+
+// unfold joins folded continuation lines (RFC 5545 §3.1).
+func unfold(r io.Reader) ([]icalLine, error) {
+	var lines []icalLine
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	for sc.Scan() {
+		n++
+		text := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1].text += text[1:]
+			continue
+		}
+		if text == "" {
+			continue
+		}
+		lines = append(lines, icalLine{number: n, text: text})
+	}
+	return lines, sc.Err()
+}
+
+// splitProperty splits "NAME;P1=a;P2=b:value", ignoring colons inside quoted
+// parameter values.
+func splitProperty(line string) (name string, params map[string]string, value string, ok bool) {
+	inQuote := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			inQuote = !inQuote
+		} else if r == ':' && !inQuote {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return "", nil, "", false
+	}
+	parts := strings.Split(line[:colon], ";")
+	params = make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:], true
+}
+
+type vevent struct {
+	line      int
+	uid       string
+	summary   string
+	cancelled bool
+
+	start, end time.Time
+	allDay     bool
+	hasEnd     bool
+
+	rrule string
+}
+
+func (e *vevent) set(name string, params map[string]string, value string, loc *time.Location) error {
+	var err error
+	switch name {
+	case "UID":
+		e.uid = value
+	case "SUMMARY":
+		e.summary = unescapeText(value)
+	case "STATUS":
+		e.cancelled = strings.EqualFold(value, "CANCELLED")
+	case "DTSTART":
+		e.start, e.allDay, err = parseICalTime(value, params, loc)
+	case "DTEND":
+		e.end, _, err = parseICalTime(value, params, loc)
+		e.hasEnd = true
+	case "RRULE":
+		e.rrule = value
+	}
+	return err
+}
+
+func parseICalTime(value string, params map[string]string, loc *time.Location) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("bad date %q", value)
+		}
+		return t, true, nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("bad date-time %q", value)
+		}
+		return t, false, nil
+	}
+	in := loc
+	if tzid := params["TZID"]; tzid != "" {
+		l, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("unknown TZID %q", tzid)
+		}
+		in = l
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, in)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("bad date-time %q", value)
+	}
+	return t, false, nil
+}
+
+func unescapeText(s string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// ─── Expansion ────────────────────────────────────────────────────────────────
+
+// days returns the closed days of the event, expanding a yearly recurrence.
+func (e *vevent) days(loc *time.Location, expandUntil time.Time) ([]ClosureEvent, error) {
+	if e.start.IsZero() {
+		return nil, errors.New("missing DTSTART")
+	}
+	if e.cancelled {
+		return nil, nil
+	}
+
+	// An all-day event without DTEND lasts one day; a timed one is instantaneous.
+	length := e.end.Sub(e.start)
+	if !e.hasEnd {
+		length = 0
+		if e.allDay {
+			length = 24 * time.Hour
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("DTEND before DTSTART")
+	}
+
+	starts := []time.Time{e.start}
+	if e.rrule != "" {
+		var err error
+		if starts, err = expandYearly(e.start, e.rrule, expandUntil); err != nil {
+			return nil, err
+		}
+	}
+
+	var out []ClosureEvent
+	for _, start := range starts {
+		first := midnight(start.In(loc))
+		last := first
+		if length > 0 {
+			// DTEND is exclusive: an event ending at midnight does not close that day.
+			last = midnight(start.Add(length - time.Nanosecond).In(loc))
+		}
+		for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+			y, m, d := day.Date()
+			out = append(out, ClosureEvent{
+				Date:    time.Date(y, m, d, 0, 0, 0, 0, time.UTC),
+				Summary: e.summary,
+				UID:     e.uid,
+			})
+			if len(out) > maxImportDays {
+				return nil, fmt.Errorf("more than %d closed days", maxImportDays)
+			}
+		}
+	}
+	return out, nil
+}
+
+// expandYearly returns the occurrence start times of a FREQ=YEARLY rule.
+func expandYearly(start time.Time, rule string, expandUntil time.Time) ([]time.Time, error) {
+	interval, count := 1, -1
+	until := expandUntil
+	for _, part := range strings.Split(rule, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			if !strings.EqualFold(v, "YEARLY") {
+				return nil, fmt.Errorf("unsupported recurrence FREQ=%s (only YEARLY is supported)", v)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("bad INTERVAL %q", v)
+			}
+			interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("bad COUNT %q", v)
+			}
+			count = n
+		case "UNTIL":
+			t, _, err := parseICalTime(v, nil, start.Location())
+			if err != nil {
+				return nil, err
+			}
+			if t.Before(until) {
+				until = t
+			}
+		case "BYMONTH", "BYMONTHDAY", "WKST":
+			// Redundant with DTSTART for the simple yearly rules holidays use.
+		default:
+			return nil, fmt.Errorf("unsupported recurrence rule part %s", k)
+		}
+	}
+
+	var out []time.Time
+	for i := 0; count < 0 || i < count; i++ {
+		t := start.AddDate(i*interval, 0, 0)
+		if t.After(until) {
+			break
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
@@ -0,0 +1,135 @@
+// Package catalog reads and writes bulk catalogue files. It turns CSV, JSON
+// Lines and MARC records into Records, and books back into MARC, without
+// touching storage; validating records against the catalogue and creating
+// books is left to the service.
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"library/internal/marc"
+)
+
+// Format is a bulk catalogue file format.
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatJSONL   Format = "jsonl"
+	FormatMARC    Format = "marc"    // MARC 21 in ISO 2709 transmission format
+	FormatMARCXML Format = "marcxml" // MARC 21 XML
+	FormatDC      Format = "dc"      // OAI Dublin Core; export only
+)
+
+// ErrInvalidFile is returned for a file that cannot be read at all, such as a
+// CSV file without a title or author column. Problems confined to one record
+// are reported as a *RowError instead.
+var ErrInvalidFile = errors.New("invalid catalogue file")
+
+// ErrUnknownFormat is returned by ParseFormat for a format it does not know.
+var ErrUnknownFormat = errors.New("unknown catalogue format")
+
+// Record is one book read from a catalogue file. Line is the line number for
+// CSV and JSON Lines and the record number for MARC. Copies is nil when the
+// file does not say how many copies to create; Holdings describe the first
+// copies.
+type Record struct {
+	Line      int
+	Title     string
+	Author    string
+	ISBN      string
+	Edition   string
+	Publisher string
+	Published string
+	Subjects  []string
+	Copies    *int
+	Holdings  []Holding
+}
+
+// Holding describes one copy: its barcode and the name of its branch, either
+// of which may be empty.
+type Holding struct {
+	Barcode string
+	Branch  string
+}
+
+// RowError reports a record that could not be read. The reader can continue
+// with the next record.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error { return e.Err }
+
+// Reader returns the records of a catalogue file one at a time.
+type Reader interface {
+	// Next returns the next record, a *RowError for a record that could not
+	// be read, io.EOF at the end of the file, or any other error when reading
+	// cannot continue.
+	Next() (Record, error)
+}
+
+// ParseFormat accepts a format name as used in file extensions and query
+// strings, in any case: csv, jsonl or ndjson, marc, mrc or iso2709, and
+// marcxml or xml, and dc, oai_dc or dublincore.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "csv":
+		return FormatCSV, nil
+	case "jsonl", "ndjson":
+		return FormatJSONL, nil
+	case "marc", "mrc", "iso2709":
+		return FormatMARC, nil
+	case "marcxml", "xml":
+		return FormatMARCXML, nil
+	case "dc", "oai_dc", "dublincore":
+		return FormatDC, nil
+	}
+	return "", fmt.Errorf("%w %q (want csv, jsonl, dc, marc or marcxml)", ErrUnknownFormat, s)
+}
+
+// NewReader returns a Reader for r in the given format. CSV files must start
+// with a header row naming at least the title and author columns.
+func NewReader(r io.Reader, format Format) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatJSONL:
+		return newJSONLReader(r), nil
+	case FormatMARC:
+		return &marcReader{r: marc.NewReader(r)}, nil
+	case FormatMARCXML:
+		return &marcReader{r: marc.NewXMLReader(r)}, nil
+	}
+	return nil, fmt.Errorf("%w %q (want csv, jsonl, marc or marcxml)", ErrUnknownFormat, format)
+}
+
+// splitList splits a CSV list field on semicolons, dropping blanks.
+func splitList(s string) []string {
+	var out []string
+	for _, b := range strings.Split(s, ";") {
+		if b = strings.TrimSpace(b); b != "" {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// barcodeHoldings returns one Holding per barcode.
+func barcodeHoldings(barcodes []string) []Holding {
+	var out []Holding
+	for _, b := range barcodes {
+		if b = strings.TrimSpace(b); b != "" {
+			out = append(out, Holding{Barcode: b})
+		}
+	}
+	return out
+}
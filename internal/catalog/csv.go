@@ -0,0 +1,117 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// csvColumns are the header names the CSV reader understands. Other columns
+// are ignored, so exports from another system can be imported as they are.
+var csvColumns = []string{
+	"title", "author", "isbn", "edition", "publisher", "published", "subjects", "copies", "barcodes",
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidFile, err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		for _, known := range csvColumns {
+			if name != known {
+				continue
+			}
+			if _, dup := columns[name]; dup {
+				return nil, fmt.Errorf("%w: header: column %q appears twice", ErrInvalidFile, name)
+			}
+			columns[name] = i
+		}
+	}
+	for _, required := range []string{"title", "author"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: header: no %q column", ErrInvalidFile, required)
+		}
+	}
+	return &csvReader{r: cr, columns: columns}, nil
+}
+
+func (c *csvReader) Next() (Record, error) {
+	for {
+		fields, err := c.r.Read()
+		if err == io.EOF {
+			return Record{}, io.EOF
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return Record{}, &RowError{Line: perr.StartLine, Err: perr.Err}
+		}
+		if err != nil {
+			return Record{}, err
+		}
+		line, _ := c.r.FieldPos(0)
+		if blank(fields) {
+			continue
+		}
+
+		rec := Record{
+			Line:      line,
+			Title:     c.field(fields, "title"),
+			Author:    c.field(fields, "author"),
+			ISBN:      c.field(fields, "isbn"),
+			Edition:   c.field(fields, "edition"),
+			Publisher: c.field(fields, "publisher"),
+			Published: c.field(fields, "published"),
+			Subjects:  splitList(c.field(fields, "subjects")),
+			Holdings:  barcodeHoldings(splitList(c.field(fields, "barcodes"))),
+		}
+		if s := c.field(fields, "copies"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return Record{}, &RowError{Line: line, Err: fmt.Errorf("copies %q is not a whole number", s)}
+			}
+			rec.Copies = &n
+		}
+		return rec, nil
+	}
+}
+
+// field returns the trimmed value of a column, or "" when the column is
+// missing from the header or the row is short.
+func (c *csvReader) field(fields []string, name string) string {
+	i, ok := c.columns[name]
+	if !ok || i >= len(fields) {
+		return ""
+	}
+	return strings.TrimSpace(fields[i])
+}
+
+func blank(fields []string) bool {
+	for _, f := range fields {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,240 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"library/internal/marc"
+	"library/internal/models"
+)
+
+// Writer writes books with their copies to a catalogue file.
+type Writer interface {
+	Write(book models.Book, copies []models.BookCopy) error
+	// Close finishes the file; it does not close the underlying writer.
+	Close() error
+}
+
+// NewWriter returns a Writer for w in the given format. branches maps branch
+// IDs to the names MARC holdings carry; the other formats ignore it.
+//
+// CSV and JSON Lines exports use the column names and keys the import reads,
+// plus id and available, so an export can be imported elsewhere as it is.
+func NewWriter(w io.Writer, format Format, branches map[uuid.UUID]string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatJSONL:
+		return &jsonlWriter{enc: json.NewEncoder(w)}, nil
+	case FormatDC:
+		return &dcWriter{w: w}, nil
+	case FormatMARC:
+		return &marcWriter{w: marc.NewWriter(w), branches: branches}, nil
+	case FormatMARCXML:
+		return &marcWriter{w: marc.NewXMLWriter(w), branches: branches}, nil
+	}
+	return nil, fmt.Errorf("%w %q (want csv, jsonl, dc, marc or marcxml)", ErrUnknownFormat, format)
+}
+
+// Available counts the copies on the shelf.
+func Available(copies []models.BookCopy) int {
+	n := 0
+	for _, c := range copies {
+		if c.Status == models.BookCopyStatusAvailable {
+			n++
+		}
+	}
+	return n
+}
+
+func barcodes(copies []models.BookCopy) []string {
+	var out []string
+	for _, c := range copies {
+		if c.Barcode != nil {
+			out = append(out, *c.Barcode)
+		}
+	}
+	return out
+}
+
+// ─── CSV ──────────────────────────────────────────────────────────────────────
+
+var csvExportColumns = []string{
+	"id", "title", "author", "isbn", "edition", "publisher", "published", "subjects", "copies", "available", "barcodes",
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (c *csvWriter) header() error {
+	if c.started {
+		return nil
+	}
+	c.started = true
+	return c.w.Write(csvExportColumns)
+}
+
+func (c *csvWriter) Write(book models.Book, copies []models.BookCopy) error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	var isbn string
+	if book.ISBN != nil {
+		isbn = *book.ISBN
+	}
+	return c.w.Write([]string{
+		book.ID.String(), book.Title, book.Author, isbn, book.Edition, book.Publisher, book.Published,
+		strings.Join(book.Subjects, "; "), strconv.Itoa(len(copies)), strconv.Itoa(Available(copies)),
+		strings.Join(barcodes(copies), ";"),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// ─── JSON Lines ───────────────────────────────────────────────────────────────
+
+// jsonExport is the shape of one exported JSON Lines record.
+type jsonExport struct {
+	ID        uuid.UUID `json:"id"`
+	Title     string    `json:"title"`
+	Author    string    `json:"author"`
+	ISBN      *string   `json:"isbn,omitempty"`
+	Edition   string    `json:"edition,omitempty"`
+	Publisher string    `json:"publisher,omitempty"`
+	Published string    `json:"published,omitempty"`
+	Subjects  []string  `json:"subjects,omitempty"`
+	Copies    int       `json:"copies"`
+	Available int       `json:"available"`
+	Barcodes  []string  `json:"barcodes,omitempty"`
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) Write(book models.Book, copies []models.BookCopy) error {
+	return j.enc.Encode(jsonExport{
+		ID: book.ID, Title: book.Title, Author: book.Author, ISBN: book.ISBN,
+		Edition: book.Edition, Publisher: book.Publisher, Published: book.Published, Subjects: book.Subjects,
+		Copies: len(copies), Available: Available(copies), Barcodes: barcodes(copies),
+	})
+}
+
+func (j *jsonlWriter) Close() error { return nil }
+
+// ─── Dublin Core ──────────────────────────────────────────────────────────────
+
+const (
+	oaiDCNamespace = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+	dcNamespace    = "http://purl.org/dc/elements/1.1/"
+	oaiDCSchema    = "http://www.openarchives.org/OAI/2.0/oai_dc.xsd"
+	srwDCNamespace = "info:srw/schema/1/dc-schema"
+)
+
+// WriteDublinCore writes a book as a self-contained oai_dc:dc element: title,
+// creator, subjects, the edition and any further notes as descriptions,
+// publisher, date, type, and the book's URN and ISBN as identifiers. Every
+// line is prefixed with indent.
+func WriteDublinCore(w io.Writer, book models.Book, indent string, notes ...string) error {
+	open := `<oai_dc:dc xmlns:oai_dc="` + oaiDCNamespace + `" xmlns:dc="` + dcNamespace +
+		`" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="` + oaiDCNamespace + " " + oaiDCSchema + `">`
+	return writeDublinCore(w, book, indent, open, "</oai_dc:dc>", notes)
+}
+
+// WriteSRUDublinCore writes a book as WriteDublinCore does, in the srw_dc:dc
+// element SRU uses for its Dublin Core record schema.
+func WriteSRUDublinCore(w io.Writer, book models.Book, indent string) error {
+	open := `<srw_dc:dc xmlns:srw_dc="` + srwDCNamespace + `" xmlns:dc="` + dcNamespace + `">`
+	return writeDublinCore(w, book, indent, open, "</srw_dc:dc>", nil)
+}
+
+func writeDublinCore(w io.Writer, book models.Book, indent, open, close string, notes []string) error {
+	var b strings.Builder
+	b.WriteString(indent + open + "\n")
+	element := func(name, value string) {
+		if value == "" {
+			return
+		}
+		b.WriteString(indent + "  <dc:" + name + ">")
+		xml.EscapeText(&b, []byte(value))
+		b.WriteString("</dc:" + name + ">\n")
+	}
+	element("title", book.Title)
+	element("creator", book.Author)
+	for _, s := range book.Subjects {
+		element("subject", s)
+	}
+	element("description", book.Edition)
+	for _, note := range notes {
+		element("description", note)
+	}
+	element("publisher", book.Publisher)
+	element("date", book.Published)
+	element("type", "Text")
+	element("identifier", "urn:uuid:"+book.ID.String())
+	if book.ISBN != nil {
+		element("identifier", "urn:isbn:"+*book.ISBN)
+	}
+	b.WriteString(indent + close + "\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dcWriter writes one oai_dc:dc element per book inside a collection element.
+type dcWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (d *dcWriter) start() error {
+	if d.started {
+		return nil
+	}
+	d.started = true
+	_, err := io.WriteString(d.w, xml.Header+"<collection>\n")
+	return err
+}
+
+func (d *dcWriter) Write(book models.Book, copies []models.BookCopy) error {
+	if err := d.start(); err != nil {
+		return err
+	}
+	availability := fmt.Sprintf("%d of %d copies available", Available(copies), len(copies))
+	return WriteDublinCore(d.w, book, "  ", availability)
+}
+
+func (d *dcWriter) Close() error {
+	if err := d.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(d.w, "</collection>\n")
+	return err
+}
+
+// ─── MARC ─────────────────────────────────────────────────────────────────────
+
+type marcWriter struct {
+	w        marc.Writer
+	branches map[uuid.UUID]string
+}
+
+func (m *marcWriter) Write(book models.Book, copies []models.BookCopy) error {
+	return m.w.Write(MARCRecord(book, copies, m.branches))
+}
+
+func (m *marcWriter) Close() error { return m.w.Close() }
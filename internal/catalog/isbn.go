@@ -0,0 +1,66 @@
+package catalog
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidISBN is returned by NormalizeISBN for anything that is not a valid
+// ISBN-10 or ISBN-13.
+var ErrInvalidISBN = errors.New("invalid ISBN")
+
+// NormalizeISBN returns the 13-digit form of an ISBN-10 or ISBN-13, without
+// hyphens or spaces, so that the same book is recognised however it was
+// written. Check digits are verified.
+func NormalizeISBN(s string) (string, error) {
+	s = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(s))
+	switch len(s) {
+	case 10:
+		sum := 0
+		for i := 0; i < 10; i++ {
+			c := s[i]
+			var d int
+			switch {
+			case c >= '0' && c <= '9':
+				d = int(c - '0')
+			case c == 'X' && i == 9:
+				d = 10
+			default:
+				return "", ErrInvalidISBN
+			}
+			sum += (10 - i) * d
+		}
+		if sum%11 != 0 {
+			return "", ErrInvalidISBN
+		}
+		body := "978" + s[:9]
+		return body + string(rune('0'+isbn13Check(body))), nil
+	case 13:
+		for i := 0; i < 13; i++ {
+			if s[i] < '0' || s[i] > '9' {
+				return "", ErrInvalidISBN
+			}
+		}
+		if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+			return "", ErrInvalidISBN
+		}
+		if int(s[12]-'0') != isbn13Check(s[:12]) {
+			return "", ErrInvalidISBN
+		}
+		return s, nil
+	}
+	return "", ErrInvalidISBN
+}
+
+// isbn13Check returns the check digit for the first 12 digits of an ISBN-13.
+func isbn13Check(body string) int {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(body[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
@@ -0,0 +1,79 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxJSONLine caps the length of one JSON Lines record.
+const maxJSONLine = 1 << 20
+
+// jsonRecord is the shape of one JSON Lines record. Unknown keys are ignored.
+type jsonRecord struct {
+	Title     string   `json:"title"`
+	Author    string   `json:"author"`
+	ISBN      string   `json:"isbn"`
+	Edition   string   `json:"edition"`
+	Publisher string   `json:"publisher"`
+	Published string   `json:"published"`
+	Subjects  []string `json:"subjects"`
+	Copies    *int     `json:"copies"`
+	Barcodes  []string `json:"barcodes"`
+}
+
+type jsonlReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newJSONLReader(r io.Reader) *jsonlReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxJSONLine)
+	return &jsonlReader{s: s}
+}
+
+func (j *jsonlReader) Next() (Record, error) {
+	for j.s.Scan() {
+		j.line++
+		raw := bytes.TrimSpace(j.s.Bytes())
+		if j.line == 1 {
+			raw = bytes.TrimPrefix(raw, []byte("\ufeff"))
+		}
+		if len(raw) == 0 {
+			continue
+		}
+		var v jsonRecord
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return Record{}, &RowError{Line: j.line, Err: fmt.Errorf("malformed JSON: %v", err)}
+		}
+		rec := Record{
+			Line:      j.line,
+			Title:     strings.TrimSpace(v.Title),
+			Author:    strings.TrimSpace(v.Author),
+			ISBN:      strings.TrimSpace(v.ISBN),
+			Edition:   strings.TrimSpace(v.Edition),
+			Publisher: strings.TrimSpace(v.Publisher),
+			Published: strings.TrimSpace(v.Published),
+			Copies:    v.Copies,
+			Holdings:  barcodeHoldings(v.Barcodes),
+		}
+		for _, s := range v.Subjects {
+			if s = strings.TrimSpace(s); s != "" {
+				rec.Subjects = append(rec.Subjects, s)
+			}
+		}
+		return rec, nil
+	}
+	if err := j.s.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return Record{}, fmt.Errorf("%w: line %d is longer than %d bytes", ErrInvalidFile, j.line+1, maxJSONLine)
+		}
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
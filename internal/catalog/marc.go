@@ -0,0 +1,253 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	"library/internal/marc"
+	"library/internal/models"
+)
+
+// ─── MARC 21 Mapping ──────────────────────────────────────────────────────────
+//
+//	020 $a        ISBN (the first that is valid)
+//	100 $a        author; 110 or 111 $a when there is no 100
+//	245 $a $b     title and subtitle, joined with ": "
+//	250 $a        edition
+//	264 _1 $b $c  publisher and publication date; 260 when there is no 264 _1
+//	650 $a $v $x $y $z  subject, subdivisions joined with "--"
+//	852 $b $p     holding: branch name and barcode
+//	876 $a $j $p  item: copy ID, status and barcode; $8 links it to an 852
+//
+// Each 876 is one copy, taking its branch from the 852 with the same $8 link
+// number, or from the first 852. A record without 876 fields has one copy
+// per 852.
+
+// marcSource is satisfied by marc.Reader and marc.XMLReader.
+type marcSource interface {
+	Next() (marc.Record, error)
+}
+
+type marcReader struct {
+	r marcSource
+	n int
+}
+
+func (m *marcReader) Next() (Record, error) {
+	rec, err := m.r.Next()
+	if err == io.EOF {
+		return Record{}, io.EOF
+	}
+	if err != nil && !errors.Is(err, marc.ErrInvalidRecord) {
+		return Record{}, fmt.Errorf("%w: after record %d: %v", ErrInvalidFile, m.n, err)
+	}
+	m.n++
+	if err != nil {
+		return Record{}, &RowError{Line: m.n, Err: err}
+	}
+	return fromMARC(rec, m.n), nil
+}
+
+func fromMARC(rec marc.Record, n int) Record {
+	out := Record{Line: n}
+
+	for _, f := range rec.FieldsByTag("020") {
+		isbn := firstWord(f.First('a'))
+		if isbn == "" {
+			continue
+		}
+		if out.ISBN == "" {
+			out.ISBN = isbn
+		}
+		if _, err := NormalizeISBN(isbn); err == nil {
+			out.ISBN = isbn
+			break
+		}
+	}
+
+	for _, tag := range []string{"100", "110", "111"} {
+		if fields := rec.FieldsByTag(tag); len(fields) > 0 {
+			out.Author = trimPeriod(fields[0].First('a'))
+			if tag == "100" && fields[0].Ind1 == '1' {
+				out.Author = directOrder(out.Author)
+			}
+			break
+		}
+	}
+
+	if fields := rec.FieldsByTag("245"); len(fields) > 0 {
+		out.Title = trimISBD(fields[0].First('a'))
+		if sub := trimISBD(fields[0].First('b')); sub != "" {
+			out.Title += ": " + sub
+		}
+		out.Title = trimPeriod(out.Title)
+	}
+
+	if fields := rec.FieldsByTag("250"); len(fields) > 0 {
+		out.Edition = trimISBD(fields[0].First('a'))
+	}
+
+	if imprint, ok := imprintField(rec); ok {
+		out.Publisher = trimISBD(imprint.First('b'))
+		out.Published = trimPeriod(imprint.First('c'))
+	}
+
+	seen := map[string]bool{}
+	for _, f := range rec.FieldsByTag("650") {
+		var parts []string
+		for _, sf := range f.Subfields {
+			switch sf.Code {
+			case 'a', 'v', 'x', 'y', 'z':
+				if p := trimPeriod(sf.Value); p != "" {
+					parts = append(parts, p)
+				}
+			}
+		}
+		if subject := strings.Join(parts, "--"); subject != "" && !seen[subject] {
+			seen[subject] = true
+			out.Subjects = append(out.Subjects, subject)
+		}
+	}
+
+	out.Holdings = holdings(rec)
+	return out
+}
+
+// imprintField returns the 264 publication statement, or the 260 imprint of
+// older records.
+func imprintField(rec marc.Record) (marc.Field, bool) {
+	for _, f := range rec.FieldsByTag("264") {
+		if f.Ind2 == '1' {
+			return f, true
+		}
+	}
+	if fields := rec.FieldsByTag("260"); len(fields) > 0 {
+		return fields[0], true
+	}
+	if fields := rec.FieldsByTag("264"); len(fields) > 0 {
+		return fields[0], true
+	}
+	return marc.Field{}, false
+}
+
+func holdings(rec marc.Record) []Holding {
+	locations := rec.FieldsByTag("852")
+	items := rec.FieldsByTag("876")
+	if len(items) == 0 {
+		var out []Holding
+		for _, f := range locations {
+			out = append(out, Holding{Barcode: strings.TrimSpace(f.First('p')), Branch: strings.TrimSpace(f.First('b'))})
+		}
+		return out
+	}
+
+	branches := map[string]string{}
+	for _, f := range locations {
+		if link := linkNumber(f); link != "" {
+			branches[link] = strings.TrimSpace(f.First('b'))
+		}
+	}
+	out := make([]Holding, 0, len(items))
+	for _, f := range items {
+		branch, ok := branches[linkNumber(f)]
+		if !ok && len(locations) > 0 {
+			branch = strings.TrimSpace(locations[0].First('b'))
+		}
+		out = append(out, Holding{Barcode: strings.TrimSpace(f.First('p')), Branch: branch})
+	}
+	return out
+}
+
+// linkNumber returns the link number of a field's $8, the part before the
+// first full stop ("1" for "1.2\c").
+func linkNumber(f marc.Field) string {
+	link, _, _ := strings.Cut(strings.TrimSpace(f.First('8')), ".")
+	return link
+}
+
+// MARCRecord describes a book and its copies as a MARC 21 record. branches
+// maps branch IDs to the names written in 852 $b.
+func MARCRecord(book models.Book, copies []models.BookCopy, branches map[uuid.UUID]string) marc.Record {
+	rec := marc.Record{Leader: marc.DefaultLeader}
+	rec.Add(marc.ControlField("001", book.ID.String()))
+	if book.ISBN != nil {
+		rec.Add(marc.DataField("020", ' ', ' ', marc.Sub('a', *book.ISBN)))
+	}
+	// Authors are stored in display order, so the name is in direct order.
+	rec.Add(marc.DataField("100", '0', ' ', marc.Sub('a', book.Author)))
+	rec.Add(marc.DataField("245", '1', '0', marc.Sub('a', book.Title)))
+	rec.Add(marc.DataField("250", ' ', ' ', marc.Sub('a', book.Edition)))
+	rec.Add(marc.DataField("264", ' ', '1', marc.Sub('b', book.Publisher), marc.Sub('c', book.Published)))
+	for _, subject := range book.Subjects {
+		parts := strings.Split(subject, "--")
+		subs := []marc.Subfield{marc.Sub('a', parts[0])}
+		for _, p := range parts[1:] {
+			subs = append(subs, marc.Sub('x', p))
+		}
+		rec.Add(marc.DataField("650", ' ', '4', subs...))
+	}
+	// One 852 and one 876 per copy, linked by $8; fields stay in tag order.
+	for i, c := range copies {
+		var branch string
+		if c.BranchID != nil {
+			branch = branches[*c.BranchID]
+		}
+		rec.Add(marc.DataField("852", ' ', ' ', marc.Sub('8', strconv.Itoa(i+1)), marc.Sub('b', branch), marc.Sub('p', barcodeOf(c))))
+	}
+	for i, c := range copies {
+		rec.Add(marc.DataField("876", ' ', ' ', marc.Sub('8', strconv.Itoa(i+1)),
+			marc.Sub('a', c.ID.String()), marc.Sub('j', string(c.Status)), marc.Sub('p', barcodeOf(c))))
+	}
+	return rec
+}
+
+// ─── Helpers ──────────────────────────────────────────────────────────────────
+
+// trimISBD strips the ISBD punctuation cataloguers end subfields with.
+func trimISBD(s string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(s), " /:;,="))
+}
+
+// trimPeriod strips ISBD punctuation and a final full stop, keeping the stop
+// after an initial ("Martin, Robert C.") and an ellipsis.
+func trimPeriod(s string) string {
+	s = trimISBD(s)
+	if !strings.HasSuffix(s, ".") || strings.HasSuffix(s, "...") {
+		return s
+	}
+	word := s[strings.LastIndexAny(s, " ,")+1:]
+	if r := []rune(word); len(r) == 2 && unicode.IsUpper(r[0]) {
+		return s
+	}
+	return trimISBD(strings.TrimSuffix(s, "."))
+}
+
+// directOrder turns an inverted personal name, "Surname, Forenames", into
+// "Forenames Surname". Names with more parts are left alone.
+func directOrder(name string) string {
+	parts := strings.Split(name, ", ")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return name
+	}
+	return parts[1] + " " + parts[0]
+}
+
+func barcodeOf(c models.BookCopy) string {
+	if c.Barcode == nil {
+		return ""
+	}
+	return *c.Barcode
+}
+
+func firstWord(s string) string {
+	if fields := strings.Fields(s); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
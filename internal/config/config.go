@@ -0,0 +1,565 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ─── Configuration Model ──────────────────────────────────────────────────────
+
+// Config is the complete, effective configuration of the library server.
+//
+// Values are layered in this order, later layers winning:
+//  1. Built-in defaults (see Default).
+//  2. An optional YAML or TOML file (selected by file extension).
+//  3. Environment variables named by the `env` struct tags below.
+//
+// Fields tagged `secret:"true"` are redacted by Redacted before being printed.
+type Config struct {
+	// Storage selects the persistence backend: StoragePostgres (default),
+	// StorageSQLite, a single database file for small installations, or
+	// StorageMemory, which keeps everything in process for demos and starts
+	// with a small set of sample records.
+	Storage string `yaml:"storage" toml:"storage" env:"STORAGE"`
+
+	Database    DatabaseConfig    `yaml:"database" toml:"database"`
+	Server      ServerConfig      `yaml:"server" toml:"server"`
+	Circulation CirculationConfig `yaml:"circulation" toml:"circulation"`
+	Features    FeatureConfig     `yaml:"features" toml:"features"`
+	Cache       CacheConfig       `yaml:"cache" toml:"cache"`
+	Admin       AdminConfig       `yaml:"admin" toml:"admin"`
+	OAI         OAIConfig         `yaml:"oai" toml:"oai"`
+	SIP2        SIP2Config        `yaml:"sip2" toml:"sip2"`
+}
+
+// Supported values of Config.Storage.
+const (
+	StoragePostgres = "postgres"
+	StorageSQLite   = "sqlite"
+	StorageMemory   = "memory"
+)
+
+// DatabaseConfig holds the connection string and connection pool settings.
+// URL is used by PostgreSQL storage and SQLitePath by SQLite storage.
+type DatabaseConfig struct {
+	URL             string   `yaml:"url" toml:"url" env:"DATABASE_URL" secret:"true"`
+	SQLitePath      string   `yaml:"sqlite_path" toml:"sqlite_path" env:"SQLITE_PATH"`
+	MaxOpenConns    int      `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int      `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+
+	// ReplicaURLs are PostgreSQL read replicas of URL. List and report
+	// queries take turns among them; everything else, and any read a client
+	// asks to be consistent, uses URL. In the environment they are
+	// separated by commas.
+	ReplicaURLs []string `yaml:"replica_urls" toml:"replica_urls" env:"DATABASE_REPLICA_URLS" secret:"true"`
+
+	// Isolation is the isolation level of checkout and return transactions:
+	// "read_committed" (default), relying on row locks, or "serializable".
+	// It only changes behaviour on PostgreSQL; SQLite and memory storage
+	// serialise every transaction anyway.
+	Isolation string `yaml:"isolation" toml:"isolation" env:"DB_ISOLATION"`
+
+	// TxMaxAttempts is how many times a checkout or return is run before a
+	// serialization failure or deadlock is reported to the caller; 1 disables
+	// retries. Each retry waits a random time below a ceiling that starts at
+	// TxRetryBaseDelay and doubles up to TxRetryMaxDelay.
+	TxMaxAttempts    int      `yaml:"tx_max_attempts" toml:"tx_max_attempts" env:"DB_TX_MAX_ATTEMPTS"`
+	TxRetryBaseDelay Duration `yaml:"tx_retry_base_delay" toml:"tx_retry_base_delay" env:"DB_TX_RETRY_BASE_DELAY"`
+	TxRetryMaxDelay  Duration `yaml:"tx_retry_max_delay" toml:"tx_retry_max_delay" env:"DB_TX_RETRY_MAX_DELAY"`
+}
+
+// Supported values of DatabaseConfig.Isolation.
+const (
+	IsolationReadCommitted = "read_committed"
+	IsolationSerializable  = "serializable"
+)
+
+// ServerConfig holds the HTTP listener settings.
+type ServerConfig struct {
+	Addr              string   `yaml:"addr" toml:"addr" env:"SERVER_ADDR"`
+	ReadTimeout       Duration `yaml:"read_timeout" toml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      Duration `yaml:"write_timeout" toml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout   Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+}
+
+// CirculationConfig holds the loan and fine rules applied by the service layer.
+type CirculationConfig struct {
+	LoanPeriodDays int `yaml:"loan_period_days" toml:"loan_period_days" env:"LOAN_PERIOD_DAYS"`
+	FinePerDay     int `yaml:"fine_per_day" toml:"fine_per_day" env:"FINE_PER_DAY"`
+	FinePerHour    int `yaml:"fine_per_hour" toml:"fine_per_hour" env:"FINE_PER_HOUR"`
+	MaxRenewals    int `yaml:"max_renewals" toml:"max_renewals" env:"MAX_RENEWALS"`
+
+	// CapAtTermEnd keeps students' due dates within the current academic term.
+	CapAtTermEnd bool `yaml:"cap_at_term_end" toml:"cap_at_term_end" env:"CAP_AT_TERM_END"`
+
+	// ReconcileInterval is how often the server recounts every book's
+	// availability counts and corrects any drift; 0 disables the job.
+	ReconcileInterval Duration `yaml:"reconcile_interval" toml:"reconcile_interval" env:"AVAILABILITY_RECONCILE_INTERVAL"`
+}
+
+// FeatureConfig holds on/off switches for optional behaviour.
+type FeatureConfig struct {
+	// Reservations enables queueing a reservation when no copy is available.
+	// When disabled, a checkout with no copy on the shelf is rejected with 409.
+	Reservations bool `yaml:"reservations" toml:"reservations" env:"FEATURE_RESERVATIONS"`
+
+	// AutoCheckoutOnReturn hands a returned copy straight to the head of the
+	// reservation queue. When disabled, the copy goes back on the shelf.
+	AutoCheckoutOnReturn bool `yaml:"auto_checkout_on_return" toml:"auto_checkout_on_return" env:"FEATURE_AUTO_CHECKOUT_ON_RETURN"`
+
+	// SkipLockedAllocation lets a checkout take any available copy that no
+	// concurrent checkout has locked, instead of waiting for the first one.
+	// Disable it only to compare against the old behaviour.
+	SkipLockedAllocation bool `yaml:"skip_locked_allocation" toml:"skip_locked_allocation" env:"FEATURE_SKIP_LOCKED_ALLOCATION"`
+
+	// RequestLogging enables Gin's per-request access log.
+	RequestLogging bool `yaml:"request_logging" toml:"request_logging" env:"FEATURE_REQUEST_LOGGING"`
+
+	// TimeTravel lets holders of the admin token shift the service clock
+	// forward through /admin/clock. Intended for staging and QA only; it
+	// requires admin.token to be set.
+	TimeTravel bool `yaml:"time_travel" toml:"time_travel" env:"FEATURE_TIME_TRAVEL"`
+}
+
+// CacheConfig sizes the in-process cache of catalogue reads: the book list,
+// book details and search results.
+type CacheConfig struct {
+	// MaxEntries is how many responses are kept; 0 disables the cache.
+	MaxEntries int `yaml:"max_entries" toml:"max_entries" env:"CACHE_MAX_ENTRIES"`
+
+	// TTL is the longest a response is served from the cache. Writes through
+	// this server invalidate it at once; TTL bounds how long a write made
+	// through another server, or directly in the database, can go unseen.
+	TTL Duration `yaml:"ttl" toml:"ttl" env:"CACHE_TTL"`
+}
+
+// AdminConfig holds the credentials for the /admin endpoints.
+type AdminConfig struct {
+	// Token must be presented as "Authorization: Bearer <token>". The admin
+	// endpoints are not registered at all while it is empty.
+	Token string `yaml:"token" toml:"token" env:"ADMIN_TOKEN" secret:"true"`
+}
+
+// OAIConfig describes the repository to OAI-PMH harvesters. The /oai endpoint
+// is not registered at all while AdminEmail is empty.
+type OAIConfig struct {
+	RepositoryName string `yaml:"repository_name" toml:"repository_name" env:"OAI_REPOSITORY_NAME"`
+	// RepositoryIdentifier is the domain name in record identifiers,
+	// oai:<repository_identifier>:<book id>.
+	RepositoryIdentifier string `yaml:"repository_identifier" toml:"repository_identifier" env:"OAI_REPOSITORY_IDENTIFIER"`
+	AdminEmail           string `yaml:"admin_email" toml:"admin_email" env:"OAI_ADMIN_EMAIL"`
+	// BaseURL is the public URL of the endpoint; empty means the URL the
+	// request arrived on.
+	BaseURL string `yaml:"base_url" toml:"base_url" env:"OAI_BASE_URL"`
+}
+
+// SIP2Config configures the SIP2 listener for self-checkout kiosks. The
+// listener is not started at all while Addr is empty.
+type SIP2Config struct {
+	Addr string `yaml:"addr" toml:"addr" env:"SIP2_ADDR"`
+	// LoginUser and LoginPassword are the credentials kiosks send in their
+	// Login message.
+	LoginUser     string `yaml:"login_user" toml:"login_user" env:"SIP2_LOGIN_USER"`
+	LoginPassword string `yaml:"login_password" toml:"login_password" env:"SIP2_LOGIN_PASSWORD" secret:"true"`
+	// InstitutionID is the AO field of every response.
+	InstitutionID string `yaml:"institution_id" toml:"institution_id" env:"SIP2_INSTITUTION_ID"`
+	// Currency is the ISO 4217 code fines are reported and paid in.
+	Currency    string   `yaml:"currency" toml:"currency" env:"SIP2_CURRENCY"`
+	IdleTimeout Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"SIP2_IDLE_TIMEOUT"`
+}
+
+// Default returns the built-in configuration. These values match the constants
+// the service used before configuration was introduced.
+func Default() Config {
+	return Config{
+		Storage: StoragePostgres,
+		Database: DatabaseConfig{
+			SQLitePath:       "library.db",
+			MaxOpenConns:     20,
+			MaxIdleConns:     10,
+			ConnMaxLifetime:  Duration(time.Hour),
+			Isolation:        IsolationReadCommitted,
+			TxMaxAttempts:    5,
+			TxRetryBaseDelay: Duration(10 * time.Millisecond),
+			TxRetryMaxDelay:  Duration(500 * time.Millisecond),
+		},
+		Server: ServerConfig{
+			Addr:              ":8080",
+			ReadTimeout:       Duration(15 * time.Second),
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			WriteTimeout:      Duration(15 * time.Second),
+			IdleTimeout:       Duration(60 * time.Second),
+			ShutdownTimeout:   Duration(10 * time.Second),
+		},
+		Circulation: CirculationConfig{
+			LoanPeriodDays:    14,
+			FinePerDay:        10,
+			FinePerHour:       5,
+			MaxRenewals:       2,
+			CapAtTermEnd:      true,
+			ReconcileInterval: Duration(time.Hour),
+		},
+		Features: FeatureConfig{
+			Reservations:         true,
+			AutoCheckoutOnReturn: true,
+			SkipLockedAllocation: true,
+			RequestLogging:       true,
+		},
+		Cache: CacheConfig{
+			MaxEntries: 10000,
+			TTL:        Duration(30 * time.Second),
+		},
+		OAI: OAIConfig{
+			RepositoryName: "Library",
+		},
+		SIP2: SIP2Config{
+			InstitutionID: "library",
+			Currency:      "USD",
+			IdleTimeout:   Duration(10 * time.Minute),
+		},
+	}
+}
+
+// ─── Loading ──────────────────────────────────────────────────────────────────
+
+// Load builds the effective configuration from defaults, the optional file at
+// path (empty means "no file") and the process environment, then validates it.
+// Overrides, typically from command-line flags, are applied last.
+func Load(path string, overrides ...func(*Config)) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem(), os.LookupEnv); err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		override(&cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// loadFile decodes a YAML (.yaml, .yml) or TOML (.toml) file over cfg. Keys
+// absent from the file keep their current values; unknown keys are rejected so
+// that typos surface at startup instead of being silently ignored.
+func loadFile(path string, cfg *Config) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: read %s: %w", path, err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("config: parse %s: %w", path, err)
+		}
+	case ".toml":
+		dec := toml.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return fmt.Errorf("config: parse %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("config: unsupported file extension %q (want .yaml, .yml or .toml)", ext)
+	}
+	return nil
+}
+
+// applyEnv walks the config struct and overrides every field that carries an
+// `env` tag whose variable is set in the environment.
+func applyEnv(v reflect.Value, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnv(fv, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		raw, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setFromString(fv, strings.TrimSpace(raw)); err != nil {
+			return fmt.Errorf("config: env %s=%q: %w", name, raw, err)
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+func setFromString(fv reflect.Value, raw string) error {
+	if fv.Type() == durationType {
+		var d Duration
+		if err := d.UnmarshalText([]byte(raw)); err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("not an integer")
+		}
+		fv.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("not a boolean")
+		}
+		fv.SetBool(b)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field kind %s", fv.Kind())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field kind %s", fv.Kind())
+	}
+	return nil
+}
+
+// ─── Validation ───────────────────────────────────────────────────────────────
+
+// Validate checks that every setting is present and within a sane range.
+// All problems are reported together rather than one at a time.
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Storage == StoragePostgres || c.Storage == StorageSQLite || c.Storage == StorageMemory,
+		"storage must be %q, %q or %q, got %q", StoragePostgres, StorageSQLite, StorageMemory, c.Storage)
+	check(c.Storage != StoragePostgres || c.Database.URL != "", "database.url is required (or set DATABASE_URL)")
+	check(c.Storage == StoragePostgres || len(c.Database.ReplicaURLs) == 0,
+		"database.replica_urls is only supported with %q storage", StoragePostgres)
+	check(!slices.Contains(c.Database.ReplicaURLs, ""), "database.replica_urls must not contain empty entries")
+	check(c.Storage != StorageSQLite || c.Database.SQLitePath != "", "database.sqlite_path is required for sqlite storage (or set SQLITE_PATH)")
+	check(c.Database.MaxOpenConns >= 1 && c.Database.MaxOpenConns <= 1000,
+		"database.max_open_conns must be between 1 and 1000, got %d", c.Database.MaxOpenConns)
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns must be between 0 and max_open_conns (%d), got %d", c.Database.MaxOpenConns, c.Database.MaxIdleConns)
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time must not be negative")
+	check(c.Database.Isolation == IsolationReadCommitted || c.Database.Isolation == IsolationSerializable,
+		"database.isolation must be %q or %q, got %q", IsolationReadCommitted, IsolationSerializable, c.Database.Isolation)
+	check(c.Database.TxMaxAttempts >= 1 && c.Database.TxMaxAttempts <= 20,
+		"database.tx_max_attempts must be between 1 and 20, got %d", c.Database.TxMaxAttempts)
+	check(c.Database.TxRetryBaseDelay >= 0 && c.Database.TxRetryBaseDelay <= c.Database.TxRetryMaxDelay,
+		"database.tx_retry_base_delay must be between 0 and tx_retry_max_delay (%s), got %s", c.Database.TxRetryMaxDelay, c.Database.TxRetryBaseDelay)
+	check(c.Database.TxRetryMaxDelay <= Duration(10*time.Second),
+		"database.tx_retry_max_delay must be at most 10s, got %s", c.Database.TxRetryMaxDelay)
+
+	check(c.Server.Addr != "", "server.addr is required")
+	for name, d := range map[string]Duration{
+		"server.read_timeout":        c.Server.ReadTimeout,
+		"server.read_header_timeout": c.Server.ReadHeaderTimeout,
+		"server.write_timeout":       c.Server.WriteTimeout,
+		"server.idle_timeout":        c.Server.IdleTimeout,
+		"server.shutdown_timeout":    c.Server.ShutdownTimeout,
+	} {
+		check(d > 0 && d <= Duration(10*time.Minute), "%s must be between 1ns and 10m, got %s", name, d)
+	}
+
+	check(c.Circulation.LoanPeriodDays >= 1 && c.Circulation.LoanPeriodDays <= 365,
+		"circulation.loan_period_days must be between 1 and 365, got %d", c.Circulation.LoanPeriodDays)
+	check(c.Circulation.FinePerDay >= 0 && c.Circulation.FinePerDay <= 10000,
+		"circulation.fine_per_day must be between 0 and 10000, got %d", c.Circulation.FinePerDay)
+	check(c.Circulation.FinePerHour >= 0 && c.Circulation.FinePerHour <= 10000,
+		"circulation.fine_per_hour must be between 0 and 10000, got %d", c.Circulation.FinePerHour)
+	check(c.Circulation.MaxRenewals >= 0 && c.Circulation.MaxRenewals <= 20,
+		"circulation.max_renewals must be between 0 and 20, got %d", c.Circulation.MaxRenewals)
+	check(c.Circulation.ReconcileInterval == 0 ||
+		(c.Circulation.ReconcileInterval >= Duration(time.Minute) && c.Circulation.ReconcileInterval <= Duration(24*time.Hour)),
+		"circulation.reconcile_interval must be 0 or between 1m and 24h, got %s", c.Circulation.ReconcileInterval)
+
+	check(c.Cache.MaxEntries >= 0 && c.Cache.MaxEntries <= 1000000,
+		"cache.max_entries must be between 0 and 1000000, got %d", c.Cache.MaxEntries)
+	check(c.Cache.TTL >= Duration(time.Second) && c.Cache.TTL <= Duration(time.Hour),
+		"cache.ttl must be between 1s and 1h, got %s", c.Cache.TTL)
+
+	check(c.Admin.Token == "" || len(c.Admin.Token) >= 16, "admin.token must be at least 16 characters")
+	check(!c.Features.TimeTravel || c.Admin.Token != "", "features.time_travel requires admin.token (or set ADMIN_TOKEN)")
+
+	if c.OAI.AdminEmail != "" {
+		check(strings.Contains(c.OAI.AdminEmail, "@"), "oai.admin_email must be an e-mail address, got %q", c.OAI.AdminEmail)
+		check(c.OAI.RepositoryName != "", "oai.repository_name is required when oai.admin_email is set")
+		check(oaiIdentifierRe.MatchString(c.OAI.RepositoryIdentifier),
+			"oai.repository_identifier must be a domain name such as library.example.edu, got %q", c.OAI.RepositoryIdentifier)
+		if c.OAI.BaseURL != "" {
+			u, err := url.Parse(c.OAI.BaseURL)
+			check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+				"oai.base_url must be an http or https URL, got %q", c.OAI.BaseURL)
+		}
+	}
+
+	if c.SIP2.Addr != "" {
+		check(c.SIP2.Addr != c.Server.Addr, "sip2.addr must differ from server.addr")
+		check(c.SIP2.LoginUser != "", "sip2.login_user is required when sip2.addr is set")
+		check(len(c.SIP2.LoginPassword) >= 8, "sip2.login_password must be at least 8 characters")
+		check(c.SIP2.InstitutionID != "" && !strings.ContainsAny(c.SIP2.InstitutionID, "|\r\n"),
+			"sip2.institution_id is required and must not contain | or line breaks")
+		check(currencyRe.MatchString(c.SIP2.Currency), "sip2.currency must be an ISO 4217 code such as USD, got %q", c.SIP2.Currency)
+		check(c.SIP2.IdleTimeout >= Duration(time.Second) && c.SIP2.IdleTimeout <= Duration(24*time.Hour),
+			"sip2.idle_timeout must be between 1s and 24h, got %s", c.SIP2.IdleTimeout)
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("config: invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// oaiIdentifierRe is the repositoryIdentifier syntax of the OAI identifier
+// scheme: a domain name with at least two labels.
+var oaiIdentifierRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]*(\.[a-zA-Z][a-zA-Z0-9-]*)+$`)
+
+// currencyRe is the syntax of an ISO 4217 alphabetic currency code.
+var currencyRe = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// ─── Presentation ─────────────────────────────────────────────────────────────
+
+const redacted = "REDACTED"
+
+// Redacted returns a copy of the configuration that is safe to print: every
+// field tagged `secret:"true"` has its credentials masked. URLs keep their
+// scheme, host and path so operators can still tell which database is in use.
+func (c Config) Redacted() Config {
+	out := c
+	redact(reflect.ValueOf(&out).Elem())
+	return out
+}
+
+func redact(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			redact(fv)
+			continue
+		}
+		if field.Tag.Get("secret") != "true" {
+			continue
+		}
+		switch {
+		case fv.Kind() == reflect.String && fv.String() != "":
+			fv.SetString(redactSecret(fv.String()))
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String:
+			// A fresh slice: the copy shares its backing array with c.
+			masked := make([]string, fv.Len())
+			for j := range masked {
+				masked[j] = redactSecret(fv.Index(j).String())
+			}
+			fv.Set(reflect.ValueOf(masked))
+		}
+	}
+}
+
+var dsnPasswordRe = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+// redactSecret masks the password of a URL-style DSN, the password=… pair of a
+// key/value DSN, or the whole value when it is neither.
+func redactSecret(s string) string {
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" && u.Host != "" {
+		if u.User != nil {
+			if _, has := u.User.Password(); has {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+			}
+		}
+		q := u.Query()
+		for key := range q {
+			if strings.EqualFold(key, "password") {
+				q.Set(key, redacted)
+			}
+		}
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	if dsnPasswordRe.MatchString(s) {
+		return dsnPasswordRe.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return redacted
+}
+
+// YAML renders the configuration as YAML.
+func (c Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// ─── Duration ─────────────────────────────────────────────────────────────────
+
+// Duration is a time.Duration that reads and writes as a Go duration string
+// ("15s", "1h30m") in YAML, TOML and environment variables.
+type Duration time.Duration
+
+// Std returns the value as a time.Duration.
+func (d Duration) Std() time.Duration { return time.Duration(d) }
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", text)
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -0,0 +1,374 @@
+// Package cql parses the Contextual Query Language (CQL 1.2), the query
+// syntax of SRU. It builds a syntax tree and leaves the meaning of indexes,
+// relations and terms to the caller.
+//
+// Terms are returned as written, without their quotes: backslash escapes
+// such as \" and \* are kept so the caller can tell masking characters from
+// literal ones. Prefix assignments are parsed and dropped.
+package cql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Node is a Boolean or a Clause.
+type Node interface {
+	node()
+}
+
+// Boolean combines two subqueries with and, or, not or prox. "a not b"
+// matches what a matches and b does not.
+type Boolean struct {
+	// Op is the lower-case operator.
+	Op          string
+	Modifiers   []Modifier
+	Left, Right Node
+}
+
+// Clause is a search clause. A bare term is given the index
+// cql.serverChoice and the relation "=".
+type Clause struct {
+	Index    string
+	Relation Relation
+	Term     string
+}
+
+// Relation is a comparison symbol or a lower-case named relation such as
+// "any" or "exact", with its modifiers.
+type Relation struct {
+	Name      string
+	Modifiers []Modifier
+}
+
+// Modifier is a relation, boolean or sort modifier: "/name" or
+// "/name comparison value".
+type Modifier struct {
+	Name       string
+	Comparison string
+	Value      string
+}
+
+// SortKey is one key of a sortBy clause.
+type SortKey struct {
+	Index     string
+	Modifiers []Modifier
+}
+
+// Query is a parsed query.
+type Query struct {
+	Root   Node
+	SortBy []SortKey
+}
+
+func (*Boolean) node() {}
+func (*Clause) node()  {}
+
+// ServerChoice is the index of a clause given as a bare term.
+const ServerChoice = "cql.serverChoice"
+
+// SyntaxError reports a query that is not valid CQL. Pos is the byte offset
+// of the offending token.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("cql: %s at position %d", e.Msg, e.Pos)
+}
+
+// ─── Lexer ────────────────────────────────────────────────────────────────────
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokSymbol
+	tokLParen
+	tokRParen
+	tokSlash
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// symbols are the comparison symbols, longest first.
+var symbols = []string{"<>", "<=", ">=", "==", "=", "<", ">"}
+
+func lex(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case c == '/':
+			toks = append(toks, token{tokSlash, "/", i})
+			i++
+		case c == '"':
+			start := i
+			i++
+			var b strings.Builder
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					b.WriteByte(s[i])
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, &SyntaxError{Pos: start, Msg: "unterminated string"}
+			}
+			i++
+			toks = append(toks, token{tokString, b.String(), start})
+		case strings.IndexByte("=<>", c) >= 0:
+			for _, sym := range symbols {
+				if strings.HasPrefix(s[i:], sym) {
+					toks = append(toks, token{tokSymbol, sym, i})
+					i += len(sym)
+					break
+				}
+			}
+		default:
+			start := i
+			for i < len(s) && strings.IndexByte(" \t\r\n()/\"=<>", s[i]) < 0 {
+				i++
+			}
+			toks = append(toks, token{tokWord, s[start:i], start})
+		}
+	}
+	return append(toks, token{tokEOF, "", len(s)}), nil
+}
+
+// ─── Parser ───────────────────────────────────────────────────────────────────
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+// Parse parses a CQL query.
+func Parse(s string) (*Query, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	if p.peek().kind == tokEOF {
+		return nil, &SyntaxError{Pos: 0, Msg: "empty query"}
+	}
+	root, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	q := &Query{Root: root}
+	if t := p.peek(); t.kind == tokWord && strings.EqualFold(t.text, "sortBy") {
+		p.next()
+		if q.SortBy, err = p.sortKeys(); err != nil {
+			return nil, err
+		}
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+	return q, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.pos+n]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokEOF {
+		return &SyntaxError{Pos: t.pos, Msg: "unexpected end of query"}
+	}
+	return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %q", t.text)}
+}
+
+// query is prefix assignments followed by a scoped clause.
+func (p *parser) query() (Node, error) {
+	for p.peek().kind == tokSymbol && p.peek().text == ">" {
+		if err := p.prefixAssignment(); err != nil {
+			return nil, err
+		}
+	}
+	return p.scopedClause()
+}
+
+// prefixAssignment is "> prefix = uri" or "> uri".
+func (p *parser) prefixAssignment() error {
+	p.next()
+	if _, err := p.term(); err != nil {
+		return err
+	}
+	if t := p.peek(); t.kind == tokSymbol && t.text == "=" {
+		p.next()
+		if _, err := p.term(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scopedClause is search clauses joined by left-associative booleans.
+func (p *parser) scopedClause() (Node, error) {
+	left, err := p.searchClause()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokWord || !isBoolean(t.text) {
+			return left, nil
+		}
+		p.next()
+		b := &Boolean{Op: strings.ToLower(t.text), Left: left}
+		if b.Modifiers, err = p.modifiers(); err != nil {
+			return nil, err
+		}
+		if b.Right, err = p.searchClause(); err != nil {
+			return nil, err
+		}
+		left = b
+	}
+}
+
+func (p *parser) searchClause() (Node, error) {
+	if p.peek().kind == tokLParen {
+		p.next()
+		n, err := p.query()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, p.unexpected(t)
+		}
+		return n, nil
+	}
+
+	first, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	if !p.atRelation() {
+		return &Clause{Index: ServerChoice, Relation: Relation{Name: "="}, Term: first.text}, nil
+	}
+	if first.kind != tokWord {
+		return nil, &SyntaxError{Pos: first.pos, Msg: "index name must not be quoted"}
+	}
+	rel := p.next()
+	c := &Clause{Index: first.text, Relation: Relation{Name: rel.text}}
+	if rel.kind == tokWord {
+		c.Relation.Name = strings.ToLower(rel.text)
+	}
+	if c.Relation.Modifiers, err = p.modifiers(); err != nil {
+		return nil, err
+	}
+	t, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	c.Term = t.text
+	return c, nil
+}
+
+// atRelation reports whether the next token starts a relation, which makes
+// the term just read an index name. A word is a named relation only when a
+// term follows it.
+func (p *parser) atRelation() bool {
+	t := p.peek()
+	switch t.kind {
+	case tokSymbol:
+		return true
+	case tokWord:
+		if isBoolean(t.text) || strings.EqualFold(t.text, "sortBy") {
+			return false
+		}
+		switch n := p.peekAt(1); n.kind {
+		case tokWord, tokString, tokSlash:
+			return true
+		}
+	}
+	return false
+}
+
+// term reads a search term, index name or other value.
+func (p *parser) term() (token, error) {
+	t := p.next()
+	if t.kind != tokWord && t.kind != tokString {
+		return token{}, p.unexpected(t)
+	}
+	return t, nil
+}
+
+// modifiers reads a possibly empty modifier list.
+func (p *parser) modifiers() ([]Modifier, error) {
+	var mods []Modifier
+	for p.peek().kind == tokSlash {
+		p.next()
+		name, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		m := Modifier{Name: name.text}
+		if t := p.peek(); t.kind == tokSymbol {
+			p.next()
+			value, err := p.term()
+			if err != nil {
+				return nil, err
+			}
+			m.Comparison, m.Value = t.text, value.text
+		}
+		mods = append(mods, m)
+	}
+	return mods, nil
+}
+
+func (p *parser) sortKeys() ([]SortKey, error) {
+	var keys []SortKey
+	for p.peek().kind == tokWord || p.peek().kind == tokString {
+		key := SortKey{Index: p.next().text}
+		var err error
+		if key.Modifiers, err = p.modifiers(); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, p.unexpected(p.peek())
+	}
+	return keys, nil
+}
+
+func isBoolean(word string) bool {
+	switch strings.ToLower(word) {
+	case "and", "or", "not", "prox":
+		return true
+	}
+	return false
+}
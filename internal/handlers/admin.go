@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"library/internal/clock"
+	"library/internal/repositories"
+)
+
+// AdminHandler serves the /admin endpoints. Every route requires the admin
+// bearer token.
+type AdminHandler struct {
+	travel *clock.Offset
+	stats  TransactionMetrics
+}
+
+// TransactionMetrics reports the retry counters of the service's checkout and
+// return transactions. services.LibraryService satisfies it.
+type TransactionMetrics interface {
+	TransactionStats() []repositories.TxStats
+}
+
+// RegisterAdminRoutes wires the /admin routes behind token authentication.
+// travel is the service's time-travel clock; pass nil when time travel is
+// disabled and the /admin/clock routes are left unregistered.
+func RegisterAdminRoutes(r *gin.Engine, token string, travel *clock.Offset, stats TransactionMetrics) {
+	h := &AdminHandler{travel: travel, stats: stats}
+
+	admin := r.Group("/admin", requireAdminToken(token))
+	admin.GET("/metrics/transactions", h.transactionStats)
+	if travel != nil {
+		admin.GET("/clock", h.getClock)
+		admin.POST("/clock/advance", h.advanceClock)
+		admin.POST("/clock/set", h.setClock)
+		admin.POST("/clock/reset", h.resetClock)
+	}
+}
+
+// requireAdminToken rejects requests that do not carry
+// "Authorization: Bearer <token>".
+func requireAdminToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			log.Printf("[WARN] requireAdminToken: rejected %s %s from %s", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			apiError(c, http.StatusUnauthorized, "admin token required", codeUnauthorized)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ─── Request Structs ──────────────────────────────────────────────────────────
+
+type advanceClockRequest struct {
+	// Duration in Go syntax, e.g. "72h" or "30m".
+	Duration string `json:"duration"`
+	Days     int    `json:"days" binding:"min=0,max=3650"`
+}
+
+type setClockRequest struct {
+	Time time.Time `json:"time" binding:"required"`
+}
+
+// ─── Clock Handlers ───────────────────────────────────────────────────────────
+
+func (h *AdminHandler) clockState(c *gin.Context, status int) {
+	c.JSON(status, gin.H{
+		"now":    h.travel.Now().UTC(),
+		"offset": h.travel.Offset().String(),
+	})
+}
+
+func (h *AdminHandler) getClock(c *gin.Context) {
+	h.clockState(c, http.StatusOK)
+}
+
+func (h *AdminHandler) advanceClock(c *gin.Context) {
+	var req advanceClockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+	d := time.Duration(req.Days) * 24 * time.Hour
+	if req.Duration != "" {
+		parsed, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, "duration: "+err.Error(), codeValidation)
+			return
+		}
+		d += parsed
+	}
+	if d <= 0 {
+		apiError(c, http.StatusBadRequest, "provide a positive duration or days", codeValidation)
+		return
+	}
+	h.travel.Advance(d)
+	log.Printf("[WARN] advanceClock: service clock advanced by %s (offset now %s)", d, h.travel.Offset())
+	h.clockState(c, http.StatusOK)
+}
+
+func (h *AdminHandler) setClock(c *gin.Context) {
+	var req setClockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+	if !h.travel.Set(req.Time) {
+		apiError(c, http.StatusConflict, "the clock can only move forward; reset it first", codeBusinessRule)
+		return
+	}
+	log.Printf("[WARN] setClock: service clock set to %s (offset now %s)", req.Time.UTC().Format(time.RFC3339), h.travel.Offset())
+	h.clockState(c, http.StatusOK)
+}
+
+func (h *AdminHandler) resetClock(c *gin.Context) {
+	h.travel.Reset()
+	log.Printf("[WARN] resetClock: service clock back to real time")
+	h.clockState(c, http.StatusOK)
+}
+
+// ─── Metrics Handlers ─────────────────────────────────────────────────────────
+
+func (h *AdminHandler) transactionStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"transactions": h.stats.TransactionStats()})
+}
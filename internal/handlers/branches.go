@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"library/internal/calendar"
+	"library/internal/models"
+)
+
+// maxICalBytes limits the size of an uploaded iCalendar file.
+const maxICalBytes = 1 << 20
+
+// ─── Request Structs ──────────────────────────────────────────────────────────
+
+type createBranchRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Timezone string `json:"timezone"`
+}
+
+type openingHoursRequest struct {
+	Weekday *int   `json:"weekday" binding:"required,min=0,max=6"`
+	Opens   string `json:"opens" binding:"required"`
+	Closes  string `json:"closes" binding:"required"`
+}
+
+type setOpeningHoursRequest struct {
+	Hours []openingHoursRequest `json:"hours" binding:"max=7,dive"`
+}
+
+type addClosureRequest struct {
+	Date   string `json:"date" binding:"required"`
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+type assignCopyBranchRequest struct {
+	// BranchID is the target branch; null detaches the copy from any branch.
+	BranchID *string `json:"branch_id" binding:"omitempty,uuid"`
+}
+
+// ─── Branch Handlers ──────────────────────────────────────────────────────────
+
+func (h *LibraryHandler) createBranch(c *gin.Context) {
+	var req createBranchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+
+	branch, err := h.svc.CreateBranch(req.Name, req.Timezone)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, branch)
+}
+
+func (h *LibraryHandler) listBranches(c *gin.Context) {
+	branches, err := h.reads(c).ListBranches()
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, branches)
+}
+
+func (h *LibraryHandler) getBranchCalendar(c *gin.Context) {
+	branchID, ok := branchIDParam(c)
+	if !ok {
+		return
+	}
+
+	// Default to the next 90 days.
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to := today, today.AddDate(0, 0, 90)
+	var err error
+	if s := c.Query("from"); s != "" {
+		if from, err = calendar.ParseDate(s); err != nil {
+			apiError(c, http.StatusBadRequest, "from: "+err.Error(), codeValidation)
+			return
+		}
+	}
+	if s := c.Query("to"); s != "" {
+		if to, err = calendar.ParseDate(s); err != nil {
+			apiError(c, http.StatusBadRequest, "to: "+err.Error(), codeValidation)
+			return
+		}
+	} else if c.Query("from") != "" {
+		to = from.AddDate(0, 0, 90)
+	}
+
+	cal, err := h.svc.GetBranchCalendar(branchID, from, to)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, cal)
+}
+
+func (h *LibraryHandler) setOpeningHours(c *gin.Context) {
+	branchID, ok := branchIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req setOpeningHoursRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+
+	hours := make([]models.OpeningHours, len(req.Hours))
+	for i, oh := range req.Hours {
+		hours[i] = models.OpeningHours{Weekday: *oh.Weekday, Opens: oh.Opens, Closes: oh.Closes}
+	}
+	stored, err := h.svc.SetOpeningHours(branchID, hours)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stored)
+}
+
+func (h *LibraryHandler) addClosure(c *gin.Context) {
+	branchID, ok := branchIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req addClosureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+	date, err := calendar.ParseDate(req.Date)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "date: "+err.Error(), codeValidation)
+		return
+	}
+
+	closure, err := h.svc.AddClosure(branchID, date, req.Reason)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, closure)
+}
+
+func (h *LibraryHandler) deleteClosure(c *gin.Context) {
+	branchID, ok := branchIDParam(c)
+	if !ok {
+		return
+	}
+	date, err := calendar.ParseDate(c.Param("date"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+
+	if err := h.svc.DeleteClosure(branchID, date); err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *LibraryHandler) importClosures(c *gin.Context) {
+	branchID, ok := branchIDParam(c)
+	if !ok {
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxICalBytes)
+	added, err := h.svc.ImportClosures(branchID, body)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"added": added})
+}
+
+func (h *LibraryHandler) assignCopyBranch(c *gin.Context) {
+	copyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid copy id: must be a UUID", codeValidation)
+		return
+	}
+
+	var req assignCopyBranchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+	var branchID *uuid.UUID
+	if req.BranchID != nil {
+		id := uuid.MustParse(*req.BranchID)
+		branchID = &id
+	}
+
+	version, ok := ifMatch(c, false)
+	if !ok {
+		return
+	}
+
+	copy, err := h.svc.AssignCopyBranch(copyID, branchID, version)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	respondVersioned(c, copy.Version, copy)
+}
+
+func branchIDParam(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid branch id: must be a UUID", codeValidation)
+		return uuid.Nil, false
+	}
+	return id, true
+}
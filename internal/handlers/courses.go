@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"library/internal/models"
+)
+
+// ─── Request Structs ──────────────────────────────────────────────────────────
+
+type createCourseRequest struct {
+	Code   string `json:"code" binding:"required,max=32"`
+	Title  string `json:"title" binding:"required,max=255"`
+	TermID string `json:"term_id" binding:"omitempty,uuid"`
+}
+
+type createReadingListRequest struct {
+	Title string `json:"title" binding:"required,max=255"`
+}
+
+type readingListEntryRequest struct {
+	BookID   string `json:"book_id" binding:"required,uuid"`
+	Required bool   `json:"required"`
+	Note     string `json:"note" binding:"max=1000"`
+}
+
+type setReadingListEntriesRequest struct {
+	Entries []readingListEntryRequest `json:"entries" binding:"max=500,dive"`
+}
+
+type reserveReadingListRequest struct {
+	LoanType  string `json:"loan_type" binding:"required,oneof=SHORT OVERNIGHT"`
+	LoanHours int    `json:"loan_hours" binding:"min=0"`
+}
+
+// ─── Course Handlers ──────────────────────────────────────────────────────────
+
+func (h *LibraryHandler) createCourse(c *gin.Context) {
+	var req createCourseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+	var termID *uuid.UUID
+	if req.TermID != "" {
+		id := uuid.MustParse(req.TermID)
+		termID = &id
+	}
+
+	course, err := h.svc.CreateCourse(req.Code, req.Title, termID)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, course)
+}
+
+func (h *LibraryHandler) listCourses(c *gin.Context) {
+	courses, err := h.reads(c).ListCourses()
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, courses)
+}
+
+func (h *LibraryHandler) deleteCourse(c *gin.Context) {
+	courseID, ok := courseIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.svc.DeleteCourse(courseID); err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ─── Reading List Handlers ────────────────────────────────────────────────────
+
+func (h *LibraryHandler) createReadingList(c *gin.Context) {
+	courseID, ok := courseIDParam(c)
+	if !ok {
+		return
+	}
+	var req createReadingListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+
+	list, err := h.svc.CreateReadingList(courseID, req.Title)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, list)
+}
+
+func (h *LibraryHandler) listReadingLists(c *gin.Context) {
+	courseID, ok := courseIDParam(c)
+	if !ok {
+		return
+	}
+
+	lists, err := h.svc.ListReadingLists(courseID)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, lists)
+}
+
+func (h *LibraryHandler) getReadingList(c *gin.Context) {
+	listID, ok := readingListIDParam(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.svc.GetReadingList(listID)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *LibraryHandler) setReadingListEntries(c *gin.Context) {
+	listID, ok := readingListIDParam(c)
+	if !ok {
+		return
+	}
+	var req setReadingListEntriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+	entries := make([]models.ReadingListEntry, 0, len(req.Entries))
+	for _, e := range req.Entries {
+		entries = append(entries, models.ReadingListEntry{
+			BookID:   uuid.MustParse(e.BookID),
+			Required: e.Required,
+			Note:     e.Note,
+		})
+	}
+
+	list, err := h.svc.SetReadingListEntries(listID, entries)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *LibraryHandler) deleteReadingList(c *gin.Context) {
+	listID, ok := readingListIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.svc.DeleteReadingList(listID); err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *LibraryHandler) readingListAvailability(c *gin.Context) {
+	listID, ok := readingListIDParam(c)
+	if !ok {
+		return
+	}
+
+	availability, err := h.reads(c).ReadingListAvailability(listID)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, availability)
+}
+
+func (h *LibraryHandler) reserveReadingList(c *gin.Context) {
+	listID, ok := readingListIDParam(c)
+	if !ok {
+		return
+	}
+	var req reserveReadingListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+
+	result, err := h.svc.ReserveReadingList(listID, models.LoanType(req.LoanType), req.LoanHours)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func courseIDParam(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid course id: must be a UUID", codeValidation)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func readingListIDParam(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid reading list id: must be a UUID", codeValidation)
+		return uuid.Nil, false
+	}
+	return id, true
+}
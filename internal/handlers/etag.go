@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Conditional GET ──────────────────────────────────────────────────────────
+
+// respondCacheable writes v as a 200 JSON response tagged with an ETag
+// derived from the body, or an empty 304 Not Modified when the request's
+// If-None-Match already names that ETag. Clients are told to revalidate
+// every time, so a 304 is as fresh as a full response.
+func respondCacheable(c *gin.Context, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	respondTagged(c, `"`+bodyHash(body)+`"`, body)
+}
+
+// respondVersioned is respondCacheable for a record with a version. Its ETag
+// starts with the version, "<version>.<body hash>", so that a client can
+// send it back in If-Match to make an edit conditional on the version it
+// read. The hash still changes with fields outside the version, such as a
+// book's available count, so If-None-Match never returns a stale body.
+func respondVersioned(c *gin.Context, version int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	respondTagged(c, fmt.Sprintf(`"%d.%s"`, version, bodyHash(body)), body)
+}
+
+func bodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:16])
+}
+
+func respondTagged(c *gin.Context, etag string, body []byte) {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if c.Request.Method == http.MethodGet && etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing
+// weakly as RFC 9110 requires for it: a W/ prefix is ignored.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ─── Conditional Writes ───────────────────────────────────────────────────────
+
+// ifMatch returns the record version named by the request's If-Match header,
+// for the service's ifVersion parameter: 0 when the header is absent or "*".
+// It accepts an ETag from respondVersioned or a bare quoted version such as
+// "3", and only one of them. Anything else is answered with 412, since it
+// cannot match any version, and a missing header with 428 if required; ok is
+// then false and the handler must return.
+func ifMatch(c *gin.Context, required bool) (version int, ok bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" && required {
+		apiError(c, http.StatusPreconditionRequired, "If-Match is required: send the book's ETag, or * to skip the check", codePreconditionRequired)
+		return 0, false
+	}
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	tag, quoted := strings.CutPrefix(header, `"`)
+	tag, closed := strings.CutSuffix(tag, `"`)
+	tag, _, _ = strings.Cut(tag, ".")
+	version, err := strconv.Atoi(tag)
+	if !quoted || !closed || err != nil || version < 1 {
+		apiError(c, http.StatusPreconditionFailed, "If-Match must be a single version ETag, e.g. \"3\"", codePreconditionFailed)
+		return 0, false
+	}
+	return version, true
+}
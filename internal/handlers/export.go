@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"library/internal/catalog"
+)
+
+// exportMediaTypes maps the media types a client may Accept to export formats.
+var exportMediaTypes = map[string]catalog.Format{
+	"text/csv":                catalog.FormatCSV,
+	"application/csv":         catalog.FormatCSV,
+	"application/jsonl":       catalog.FormatJSONL,
+	"application/x-ndjson":    catalog.FormatJSONL,
+	"application/x-jsonl":     catalog.FormatJSONL,
+	"application/marc":        catalog.FormatMARC,
+	"application/marcxml+xml": catalog.FormatMARCXML,
+	"application/xml":         catalog.FormatDC,
+	"text/xml":                catalog.FormatDC,
+}
+
+// exportContentTypes and exportFilenames give the response Content-Type and
+// attachment name of each export format.
+var (
+	exportContentTypes = map[catalog.Format]string{
+		catalog.FormatCSV:     "text/csv; charset=utf-8",
+		catalog.FormatJSONL:   "application/x-ndjson",
+		catalog.FormatDC:      "application/xml; charset=utf-8",
+		catalog.FormatMARC:    "application/marc",
+		catalog.FormatMARCXML: "application/marcxml+xml; charset=utf-8",
+	}
+	exportFilenames = map[catalog.Format]string{
+		catalog.FormatCSV:     "catalogue.csv",
+		catalog.FormatJSONL:   "catalogue.jsonl",
+		catalog.FormatDC:      "catalogue-dc.xml",
+		catalog.FormatMARC:    "catalogue.mrc",
+		catalog.FormatMARCXML: "catalogue.xml",
+	}
+)
+
+func (h *LibraryHandler) exportBooks(c *gin.Context) {
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+	streamExport(c, exportContentTypes[format], exportFilenames[format], func(w io.Writer) error {
+		return h.reads(c).ExportCatalogue(format, w)
+	})
+}
+
+// exportFormat takes the format from the format query parameter or, failing
+// that, from the Accept header. CSV is the default.
+func exportFormat(c *gin.Context) (catalog.Format, bool) {
+	if q := c.Query("format"); q != "" {
+		format, err := catalog.ParseFormat(q)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, "format must be csv, jsonl, dc, marc or marcxml", codeValidation)
+			return "", false
+		}
+		return format, true
+	}
+	for _, accept := range splitAccept(c.GetHeader("Accept")) {
+		if format, ok := exportMediaTypes[accept]; ok {
+			return format, true
+		}
+	}
+	return catalog.FormatCSV, true
+}
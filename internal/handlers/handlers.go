@@ -2,12 +2,16 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"gorm.io/gorm"
 
+	"library/internal/calendar"
+	"library/internal/models"
+	"library/internal/repositories"
 	"library/internal/services"
 )
 
@@ -16,22 +20,81 @@ type LibraryHandler struct {
 	svc services.LibraryService
 }
 
+// consistentReadHeader, set to true, has a list or report read from the
+// primary database instead of a replica, so that it includes the client's
+// own writes, such as a checkout just made.
+const consistentReadHeader = "X-Consistent-Read"
+
+// reads returns the service that list and report handlers read through.
+func (h *LibraryHandler) reads(c *gin.Context) services.LibraryService {
+	if consistent, _ := strconv.ParseBool(c.GetHeader(consistentReadHeader)); consistent {
+		return h.svc.WithConsistentReads()
+	}
+	return h.svc
+}
+
 // RegisterRoutes wires all HTTP routes to handler methods.
 func RegisterRoutes(r *gin.Engine, svc services.LibraryService) {
 	h := &LibraryHandler{svc: svc}
 
 	// Librarian endpoints
+	r.POST("/users", h.createUser)
+	r.GET("/users", h.listUsers)
 	r.POST("/books", h.createBook)
 	r.POST("/books/:id/copies", h.addBookCopy)
+	r.POST("/books/:id/copies/bulk", h.addBookCopies)
+	r.PUT("/books/:id/loan-type", h.setBookLoanType)
+	r.PATCH("/books/:id", h.updateBook)
+	r.DELETE("/books/:id", h.deleteBook)
+	r.POST("/books/:id/restore", h.restoreBook)
+	r.POST("/books/import", h.importBooks)
+	r.GET("/reports/overdue", h.overdueReport)
+	r.POST("/fines/recompute", h.recomputeFines)
+	r.GET("/reports/integrity", h.integrityReport)
+	r.POST("/integrity/repair", h.repairIntegrity)
+	r.POST("/books/availability/reconcile", h.reconcileAvailability)
+	r.POST("/branches", h.createBranch)
+	r.PUT("/branches/:id/hours", h.setOpeningHours)
+	r.POST("/branches/:id/closures", h.addClosure)
+	r.POST("/branches/:id/closures/import", h.importClosures)
+	r.DELETE("/branches/:id/closures/:date", h.deleteClosure)
+	r.PUT("/copies/:id/branch", h.assignCopyBranch)
+	r.POST("/terms", h.createTerm)
+	r.PUT("/terms/:id", h.updateTerm)
+	r.DELETE("/terms/:id", h.deleteTerm)
+	r.GET("/reports/term-end", h.termEndReport)
+	r.POST("/courses", h.createCourse)
+	r.DELETE("/courses/:id", h.deleteCourse)
+	r.POST("/courses/:id/reading-lists", h.createReadingList)
+	r.PUT("/reading-lists/:id/entries", h.setReadingListEntries)
+	r.DELETE("/reading-lists/:id", h.deleteReadingList)
+	r.POST("/reading-lists/:id/reserve", h.reserveReadingList)
 
 	// Student endpoints
 	r.POST("/books/:id/checkout", h.checkoutBook)
 	r.POST("/checkouts/:id/return", h.returnCheckout)
+	r.POST("/checkouts/:id/renew", h.renewCheckout)
+	r.GET("/users/:id", h.getUser)
 	r.GET("/users/:id/checkouts", h.listUserCheckouts)
+	r.GET("/users/:id/account", h.getPatronAccount)
+	r.GET("/users/:id/reservations", h.listUserReservations)
+	r.DELETE("/reservations/:id", h.cancelReservation)
+	r.POST("/users/:id/payments", h.payFines)
 
 	// General endpoints
 	r.GET("/books", h.listBooks)
+	r.GET("/books/:id", h.getBook)
 	r.GET("/books/:id/reservations", h.listReservationsForBook)
+	r.GET("/books/:id/marc", h.getBookMARC)
+	r.GET("/books/marc", h.exportMARC)
+	r.GET("/books/export", h.exportBooks)
+	r.GET("/branches", h.listBranches)
+	r.GET("/branches/:id/calendar", h.getBranchCalendar)
+	r.GET("/terms", h.listTerms)
+	r.GET("/courses", h.listCourses)
+	r.GET("/courses/:id/reading-lists", h.listReadingLists)
+	r.GET("/reading-lists/:id", h.getReadingList)
+	r.GET("/reading-lists/:id/availability", h.readingListAvailability)
 }
 
 // ─── Error Response Helper ──────────────────────────────────────────────────
@@ -40,10 +103,13 @@ func RegisterRoutes(r *gin.Engine, svc services.LibraryService) {
 type errorCode string
 
 const (
-	codeValidation      errorCode = "VALIDATION_ERROR"
-	codeNotFound        errorCode = "NOT_FOUND"
-	codeBusinessRule    errorCode = "BUSINESS_RULE_VIOLATION"
-	codeInternalError   errorCode = "INTERNAL_ERROR"
+	codeValidation           errorCode = "VALIDATION_ERROR"
+	codeNotFound             errorCode = "NOT_FOUND"
+	codeBusinessRule         errorCode = "BUSINESS_RULE_VIOLATION"
+	codeInternalError        errorCode = "INTERNAL_ERROR"
+	codeUnauthorized         errorCode = "UNAUTHORIZED"
+	codePreconditionFailed   errorCode = "PRECONDITION_FAILED"
+	codePreconditionRequired errorCode = "PRECONDITION_REQUIRED"
 )
 
 // apiError writes a standardised JSON error response:
@@ -59,7 +125,7 @@ func apiError(c *gin.Context, status int, message string, code errorCode) {
 // mapServiceError translates known service/domain errors to HTTP responses.
 func mapServiceError(c *gin.Context, err error) {
 	switch {
-	case errors.Is(err, gorm.ErrRecordNotFound):
+	case errors.Is(err, repositories.ErrNotFound):
 		apiError(c, http.StatusNotFound, "resource not found", codeNotFound)
 	case errors.Is(err, services.ErrBookNotFound):
 		apiError(c, http.StatusNotFound, "book not found", codeNotFound)
@@ -67,12 +133,90 @@ func mapServiceError(c *gin.Context, err error) {
 		apiError(c, http.StatusNotFound, "user not found", codeNotFound)
 	case errors.Is(err, services.ErrCheckoutNotFound):
 		apiError(c, http.StatusNotFound, "checkout not found", codeNotFound)
+	case errors.Is(err, services.ErrReservationNotFound):
+		apiError(c, http.StatusNotFound, "reservation not found", codeNotFound)
+	case errors.Is(err, services.ErrCopyNotFound):
+		apiError(c, http.StatusNotFound, "book copy not found", codeNotFound)
+	case errors.Is(err, services.ErrBranchNotFound):
+		apiError(c, http.StatusNotFound, "branch not found", codeNotFound)
+	case errors.Is(err, services.ErrInvalidTimezone):
+		apiError(c, http.StatusBadRequest, "timezone must be an IANA time zone name, e.g. Europe/Berlin", codeValidation)
+	case errors.Is(err, services.ErrInvalidOpeningHours):
+		apiError(c, http.StatusBadRequest, "opening hours need weekdays 0-6 (0 = Sunday) at most once each and HH:MM times with opens before closes", codeValidation)
+	case errors.Is(err, services.ErrInvalidClosure):
+		apiError(c, http.StatusBadRequest, "closure date is required", codeValidation)
+	case errors.Is(err, services.ErrInvalidDateRange):
+		apiError(c, http.StatusBadRequest, "to must not be before from and the range may span at most one year", codeValidation)
+	case errors.Is(err, services.ErrInvalidICal):
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+	case errors.Is(err, services.ErrClosureExists):
+		apiError(c, http.StatusConflict, "branch is already closed on this date", codeBusinessRule)
+	case errors.Is(err, services.ErrTermNotFound):
+		apiError(c, http.StatusNotFound, "term not found", codeNotFound)
+	case errors.Is(err, services.ErrNoCurrentTerm):
+		apiError(c, http.StatusNotFound, "no academic term is in progress; pass term_id", codeNotFound)
+	case errors.Is(err, services.ErrInvalidTerm):
+		apiError(c, http.StatusBadRequest, "term needs a name and an end_date on or after its start_date", codeValidation)
+	case errors.Is(err, services.ErrTermOverlap):
+		apiError(c, http.StatusConflict, "term overlaps an existing term", codeBusinessRule)
+	case errors.Is(err, services.ErrCourseNotFound):
+		apiError(c, http.StatusNotFound, "course not found", codeNotFound)
+	case errors.Is(err, services.ErrInvalidCourse):
+		apiError(c, http.StatusBadRequest, "course needs a code of at most 32 characters and a title", codeValidation)
+	case errors.Is(err, services.ErrCourseExists):
+		apiError(c, http.StatusConflict, "a course with this code already exists", codeBusinessRule)
+	case errors.Is(err, services.ErrReadingListNotFound):
+		apiError(c, http.StatusNotFound, "reading list not found", codeNotFound)
+	case errors.Is(err, services.ErrInvalidReadingList):
+		apiError(c, http.StatusBadRequest, "reading list needs a title and may list each book only once", codeValidation)
+	case errors.Is(err, services.ErrTermEnded):
+		apiError(c, http.StatusConflict, "the course's term has already ended", codeBusinessRule)
+	case errors.Is(err, services.ErrInvalidImport):
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+	case errors.Is(err, services.ErrUnknownImportFormat):
+		apiError(c, http.StatusBadRequest, "format must be csv, jsonl, marc or marcxml", codeValidation)
+	case errors.Is(err, services.ErrUnknownExportFormat):
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+	case errors.Is(err, services.ErrMARCRecordTooLong):
+		apiError(c, http.StatusNotAcceptable, "book is too large for an ISO 2709 record; request format=marcxml", codeValidation)
+	case errors.Is(err, services.ErrCheckoutOverdue):
+		apiError(c, http.StatusConflict, "checkout is overdue and must be returned", codeBusinessRule)
+	case errors.Is(err, services.ErrRenewalLimitReached):
+		apiError(c, http.StatusConflict, "checkout has reached the renewal limit", codeBusinessRule)
+	case errors.Is(err, services.ErrRenewalBlocked):
+		apiError(c, http.StatusConflict, "other users are waiting for this book", codeBusinessRule)
+	case errors.Is(err, services.ErrRenewalNotExtended):
+		apiError(c, http.StatusConflict, "renewal would not extend the due date (the term ends first)", codeBusinessRule)
+	case errors.Is(err, services.ErrInvalidRole):
+		apiError(c, http.StatusBadRequest, "role must be STUDENT or LIBRARIAN", codeValidation)
+	case errors.Is(err, services.ErrInvalidCopyCount):
+		apiError(c, http.StatusBadRequest, "count must be at least 1", codeValidation)
+	case errors.Is(err, services.ErrInvalidLoanType):
+		apiError(c, http.StatusBadRequest, fmt.Sprintf("loan_type must be STANDARD, OVERNIGHT or SHORT; loan_hours is 1-%d for SHORT and 0 otherwise", services.MaxShortLoanHours), codeValidation)
 	case errors.Is(err, services.ErrCheckoutAlreadyReturned):
 		apiError(c, http.StatusConflict, "checkout has already been returned", codeBusinessRule)
 	case errors.Is(err, services.ErrDuplicateReservation):
 		apiError(c, http.StatusConflict, "user already has an active reservation for this book", codeBusinessRule)
+	case errors.Is(err, services.ErrReservationsDisabled):
+		apiError(c, http.StatusConflict, "no copies are available and reservations are disabled", codeBusinessRule)
 	case errors.Is(err, services.ErrAlreadyCheckedOut):
 		apiError(c, http.StatusConflict, "this book copy is already checked out by this user", codeBusinessRule)
+	case errors.Is(err, services.ErrCopyOnHold):
+		apiError(c, http.StatusConflict, "this book copy is held for another user's reservation", codeBusinessRule)
+	case errors.Is(err, services.ErrInvalidPayment):
+		apiError(c, http.StatusBadRequest, "amount must be positive and reference at most 64 characters", codeValidation)
+	case errors.Is(err, services.ErrOverpayment):
+		apiError(c, http.StatusConflict, "payment exceeds the outstanding fines", codeBusinessRule)
+	case errors.Is(err, services.ErrVersionMismatch):
+		apiError(c, http.StatusPreconditionFailed, "the record has changed since it was read; fetch it again", codePreconditionFailed)
+	case errors.Is(err, services.ErrInvalidBook):
+		apiError(c, http.StatusBadRequest, "book needs a title and an author of at most 255 characters, a valid ISBN if any, edition, publisher and subjects of at most 255 characters and published of at most 64", codeValidation)
+	case errors.Is(err, services.ErrISBNTaken):
+		apiError(c, http.StatusConflict, "another book already has this ISBN", codeBusinessRule)
+	case errors.Is(err, services.ErrBookOnLoan):
+		apiError(c, http.StatusConflict, "a copy of this book is checked out; it must be returned first", codeBusinessRule)
+	case errors.Is(err, services.ErrBookHasFines):
+		apiError(c, http.StatusConflict, "the book's loan history includes fines; withdraw it instead of purging it", codeBusinessRule)
 	default:
 		apiError(c, http.StatusInternalServerError, "an internal error occurred", codeInternalError)
 	}
@@ -86,12 +230,81 @@ type createBookRequest struct {
 	TotalCopies int    `json:"total_copies" binding:"required,min=0"`
 }
 
+type createUserRequest struct {
+	Name string `json:"name" binding:"required"`
+	Role string `json:"role" binding:"required,oneof=STUDENT LIBRARIAN"`
+}
+
+type addBookCopiesRequest struct {
+	Count int `json:"count" binding:"required,min=1,max=1000"`
+}
+
+type payFinesRequest struct {
+	Amount    int    `json:"amount" binding:"required,min=1"`
+	Reference string `json:"reference" binding:"max=64"`
+}
+
+type setBookLoanTypeRequest struct {
+	LoanType  string `json:"loan_type" binding:"required,oneof=STANDARD SHORT OVERNIGHT"`
+	LoanHours int    `json:"loan_hours" binding:"min=0"`
+}
+
+// updateBookRequest is a partial update: absent fields are left alone.
+type updateBookRequest struct {
+	Title     *string   `json:"title" binding:"omitempty,max=255"`
+	Author    *string   `json:"author" binding:"omitempty,max=255"`
+	ISBN      *string   `json:"isbn" binding:"omitempty,max=32"`
+	Edition   *string   `json:"edition" binding:"omitempty,max=255"`
+	Publisher *string   `json:"publisher" binding:"omitempty,max=255"`
+	Published *string   `json:"published" binding:"omitempty,max=64"`
+	Subjects  *[]string `json:"subjects" binding:"omitempty,max=100"`
+}
+
 type checkoutRequest struct {
 	UserID string `json:"user_id" binding:"required,uuid"`
 }
 
 // ─── Handlers ────────────────────────────────────────────────────────────────
 
+func (h *LibraryHandler) createUser(c *gin.Context) {
+	var req createUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+
+	user, err := h.svc.CreateUser(req.Name, models.UserRole(req.Role))
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, user)
+}
+
+func (h *LibraryHandler) listUsers(c *gin.Context) {
+	users, err := h.reads(c).ListUsers()
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+func (h *LibraryHandler) getUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid user id: must be a UUID", codeValidation)
+		return
+	}
+
+	user, err := h.svc.GetUser(userID)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	respondVersioned(c, user.Version, user)
+}
+
 func (h *LibraryHandler) createBook(c *gin.Context) {
 	var req createBookRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -122,6 +335,127 @@ func (h *LibraryHandler) addBookCopy(c *gin.Context) {
 	c.JSON(http.StatusCreated, copy)
 }
 
+func (h *LibraryHandler) addBookCopies(c *gin.Context) {
+	bookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid book id: must be a UUID", codeValidation)
+		return
+	}
+
+	var req addBookCopiesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+
+	copies, err := h.svc.AddBookCopies(bookID, req.Count)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, copies)
+}
+
+func (h *LibraryHandler) setBookLoanType(c *gin.Context) {
+	bookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid book id: must be a UUID", codeValidation)
+		return
+	}
+
+	var req setBookLoanTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+
+	version, ok := ifMatch(c, false)
+	if !ok {
+		return
+	}
+
+	book, err := h.svc.SetBookLoanType(bookID, models.LoanType(req.LoanType), req.LoanHours, version)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	respondVersioned(c, book.Version, book)
+}
+
+func (h *LibraryHandler) updateBook(c *gin.Context) {
+	bookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid book id: must be a UUID", codeValidation)
+		return
+	}
+
+	var req updateBookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+	version, ok := ifMatch(c, true)
+	if !ok {
+		return
+	}
+
+	book, err := h.svc.UpdateBook(bookID, services.BookChanges{
+		Title:     req.Title,
+		Author:    req.Author,
+		ISBN:      req.ISBN,
+		Edition:   req.Edition,
+		Publisher: req.Publisher,
+		Published: req.Published,
+		Subjects:  req.Subjects,
+	}, version)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	respondVersioned(c, book.Version, book)
+}
+
+func (h *LibraryHandler) deleteBook(c *gin.Context) {
+	bookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid book id: must be a UUID", codeValidation)
+		return
+	}
+	purge := false
+	if raw := c.Query("purge"); raw != "" {
+		if purge, err = strconv.ParseBool(raw); err != nil {
+			apiError(c, http.StatusBadRequest, "purge must be true or false", codeValidation)
+			return
+		}
+	}
+	version, ok := ifMatch(c, true)
+	if !ok {
+		return
+	}
+
+	deletion, err := h.svc.DeleteBook(bookID, purge, version)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deletion)
+}
+
+func (h *LibraryHandler) restoreBook(c *gin.Context) {
+	bookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid book id: must be a UUID", codeValidation)
+		return
+	}
+
+	book, err := h.svc.RestoreBook(bookID)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	respondVersioned(c, book.Version, book)
+}
+
 func (h *LibraryHandler) checkoutBook(c *gin.Context) {
 	bookID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -175,6 +509,21 @@ func (h *LibraryHandler) returnCheckout(c *gin.Context) {
 	c.JSON(http.StatusOK, updated)
 }
 
+func (h *LibraryHandler) renewCheckout(c *gin.Context) {
+	checkoutID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid checkout id: must be a UUID", codeValidation)
+		return
+	}
+
+	renewed, err := h.svc.RenewCheckout(checkoutID)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, renewed)
+}
+
 func (h *LibraryHandler) listUserCheckouts(c *gin.Context) {
 	userID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -182,7 +531,7 @@ func (h *LibraryHandler) listUserCheckouts(c *gin.Context) {
 		return
 	}
 
-	checkouts, err := h.svc.ListUserCheckouts(userID)
+	checkouts, err := h.reads(c).ListUserCheckouts(userID)
 	if err != nil {
 		mapServiceError(c, err)
 		return
@@ -190,13 +539,63 @@ func (h *LibraryHandler) listUserCheckouts(c *gin.Context) {
 	c.JSON(http.StatusOK, checkouts)
 }
 
+func (h *LibraryHandler) getPatronAccount(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid user id: must be a UUID", codeValidation)
+		return
+	}
+
+	account, err := h.svc.GetPatronAccount(userID)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+func (h *LibraryHandler) payFines(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid user id: must be a UUID", codeValidation)
+		return
+	}
+	var req payFinesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return
+	}
+
+	payment, err := h.svc.PayFines(userID, req.Amount, req.Reference)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, payment)
+}
+
 func (h *LibraryHandler) listBooks(c *gin.Context) {
-	books, err := h.svc.ListBooks()
+	books, err := h.reads(c).ListBooks()
 	if err != nil {
 		mapServiceError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, books)
+	respondCacheable(c, books)
+}
+
+func (h *LibraryHandler) getBook(c *gin.Context) {
+	bookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid book id: must be a UUID", codeValidation)
+		return
+	}
+
+	book, err := h.reads(c).GetBook(bookID)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	respondVersioned(c, book.Version, book)
 }
 
 func (h *LibraryHandler) listReservationsForBook(c *gin.Context) {
@@ -206,10 +605,123 @@ func (h *LibraryHandler) listReservationsForBook(c *gin.Context) {
 		return
 	}
 
-	reservations, err := h.svc.ListReservationsForBook(bookID)
+	reservations, err := h.reads(c).ListReservationsForBook(bookID)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, reservations)
+}
+
+func (h *LibraryHandler) listUserReservations(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid user id: must be a UUID", codeValidation)
+		return
+	}
+
+	reservations, err := h.reads(c).ListUserReservations(userID)
 	if err != nil {
 		mapServiceError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, reservations)
 }
+
+func (h *LibraryHandler) cancelReservation(c *gin.Context) {
+	reservationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid reservation id: must be a UUID", codeValidation)
+		return
+	}
+
+	if err := h.svc.CancelReservation(reservationID); err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *LibraryHandler) overdueReport(c *gin.Context) {
+	report, err := h.reads(c).ListOverdueCheckouts()
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *LibraryHandler) recomputeFines(c *gin.Context) {
+	var scope services.FineScope
+	var ok bool
+	if scope.CheckoutID, ok = queryUUID(c, "checkout_id"); !ok {
+		return
+	}
+	if scope.UserID, ok = queryUUID(c, "user_id"); !ok {
+		return
+	}
+	if raw := c.Query("returned_since"); raw != "" {
+		since, err := calendar.ParseDate(raw)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, "returned_since: "+err.Error(), codeValidation)
+			return
+		}
+		scope.ReturnedSince = &since
+	}
+	if raw := c.Query("dry_run"); raw != "" {
+		var err error
+		if scope.DryRun, err = strconv.ParseBool(raw); err != nil {
+			apiError(c, http.StatusBadRequest, "dry_run must be true or false", codeValidation)
+			return
+		}
+	}
+
+	result, err := h.svc.RecomputeFines(scope)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// queryUUID parses the optional query parameter name as a UUID, writing a 400
+// and returning false if it is not one.
+func queryUUID(c *gin.Context, name string) (*uuid.UUID, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, true
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid "+name+": must be a UUID", codeValidation)
+		return nil, false
+	}
+	return &id, true
+}
+
+func (h *LibraryHandler) reconcileAvailability(c *gin.Context) {
+	corrected, err := h.svc.ReconcileAvailability()
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"corrected": corrected})
+}
+
+func (h *LibraryHandler) integrityReport(c *gin.Context) {
+	report, err := h.svc.CheckIntegrity(false)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *LibraryHandler) repairIntegrity(c *gin.Context) {
+	report, err := h.svc.CheckIntegrity(true)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
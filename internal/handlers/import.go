@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"library/internal/catalog"
+)
+
+// maxImportBytes caps the size of a catalogue file, comfortably above a
+// 40,000-title CSV export. Reading stops there and the report's error says so.
+const maxImportBytes = 256 << 20
+
+// importFormats maps the accepted Content-Types to catalogue formats.
+var importFormats = map[string]catalog.Format{
+	"text/csv":                catalog.FormatCSV,
+	"application/csv":         catalog.FormatCSV,
+	"application/jsonl":       catalog.FormatJSONL,
+	"application/x-ndjson":    catalog.FormatJSONL,
+	"application/x-jsonl":     catalog.FormatJSONL,
+	"application/marc":        catalog.FormatMARC,
+	"application/marcxml+xml": catalog.FormatMARCXML,
+	"application/xml":         catalog.FormatMARCXML,
+	"text/xml":                catalog.FormatMARCXML,
+}
+
+func (h *LibraryHandler) importBooks(c *gin.Context) {
+	format, ok := importFormat(c)
+	if !ok {
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	report, err := h.svc.ImportBooks(format, body)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// importFormat takes the format from the format query parameter or, failing
+// that, from the Content-Type header.
+func importFormat(c *gin.Context) (catalog.Format, bool) {
+	if q := c.Query("format"); q != "" {
+		format, err := catalog.ParseFormat(q)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, "format must be csv, jsonl, marc or marcxml", codeValidation)
+			return "", false
+		}
+		return format, true
+	}
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if format, ok := importFormats[mediaType]; ok {
+		return format, true
+	}
+	apiError(c, http.StatusUnsupportedMediaType, "send text/csv, application/x-ndjson, application/marc or application/marcxml+xml, or pass ?format=csv|jsonl|marc|marcxml", codeValidation)
+	return "", false
+}
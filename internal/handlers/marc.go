@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"library/internal/catalog"
+)
+
+// marcMediaTypes maps the media types a client may Accept to MARC formats.
+var marcMediaTypes = map[string]catalog.Format{
+	"application/marc":        catalog.FormatMARC,
+	"application/marcxml+xml": catalog.FormatMARCXML,
+	"application/xml":         catalog.FormatMARCXML,
+	"text/xml":                catalog.FormatMARCXML,
+}
+
+// marcContentTypes are the response Content-Types of the MARC formats.
+var marcContentTypes = map[catalog.Format]string{
+	catalog.FormatMARC:    "application/marc",
+	catalog.FormatMARCXML: "application/marcxml+xml; charset=utf-8",
+}
+
+func (h *LibraryHandler) getBookMARC(c *gin.Context) {
+	bookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid book id: must be a UUID", codeValidation)
+		return
+	}
+	format, ok := marcFormat(c)
+	if !ok {
+		return
+	}
+	streamExport(c, marcContentTypes[format], "", func(w io.Writer) error {
+		return h.reads(c).ExportBookMARC(bookID, format, w)
+	})
+}
+
+func (h *LibraryHandler) exportMARC(c *gin.Context) {
+	format, ok := marcFormat(c)
+	if !ok {
+		return
+	}
+	streamExport(c, marcContentTypes[format], exportFilenames[format], func(w io.Writer) error {
+		return h.reads(c).ExportCatalogue(format, w)
+	})
+}
+
+// marcFormat takes the format from the format query parameter or, failing
+// that, from the Accept header. MARCXML is the default.
+func marcFormat(c *gin.Context) (catalog.Format, bool) {
+	if q := c.Query("format"); q != "" {
+		format, err := catalog.ParseFormat(q)
+		if err != nil || marcContentTypes[format] == "" {
+			apiError(c, http.StatusBadRequest, "format must be marc or marcxml", codeValidation)
+			return "", false
+		}
+		return format, true
+	}
+	for _, accept := range splitAccept(c.GetHeader("Accept")) {
+		if format, ok := marcMediaTypes[accept]; ok {
+			return format, true
+		}
+	}
+	return catalog.FormatMARCXML, true
+}
+
+// splitAccept returns the media types of an Accept header in the order given,
+// ignoring quality values.
+func splitAccept(header string) []string {
+	var out []string
+	for _, part := range strings.Split(header, ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil {
+			out = append(out, mediaType)
+		}
+	}
+	return out
+}
+
+// streamExport writes the body produced by write with the given Content-Type
+// and, if filename is set, as an attachment. An error before anything was
+// written becomes an ordinary error response; after that the response can
+// only be cut short, so the error is logged.
+func streamExport(c *gin.Context, contentType, filename string, write func(w io.Writer) error) {
+	c.Header("Content-Type", contentType)
+	if filename != "" {
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	}
+	c.Status(http.StatusOK)
+	err := write(c.Writer)
+	if err == nil {
+		return
+	}
+	if !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		mapServiceError(c, err)
+		return
+	}
+	log.Printf("[ERROR] %s %s: export stopped: %v", c.Request.Method, c.Request.URL.Path, err)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"library/internal/oai"
+)
+
+// OAIHandler serves the OAI-PMH endpoint.
+type OAIHandler struct {
+	provider *oai.Provider
+	baseURL  string
+}
+
+// RegisterOAIRoutes wires GET and POST /oai to provider. baseURL is the
+// endpoint's public URL; when empty it is taken from each request.
+func RegisterOAIRoutes(r *gin.Engine, provider *oai.Provider, baseURL string) {
+	h := &OAIHandler{provider: provider, baseURL: baseURL}
+	r.GET("/oai", h.serve)
+	r.POST("/oai", h.serve)
+}
+
+func (h *OAIHandler) serve(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid query or form body", codeValidation)
+		return
+	}
+	baseURL := h.baseURL
+	if baseURL == "" {
+		baseURL = requestURL(c)
+	}
+	body, err := h.provider.Serve(baseURL, c.Request.Form)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "text/xml; charset=utf-8", body)
+}
+
+// requestURL is the URL a request arrived on, without its query.
+func requestURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + c.Request.URL.Path
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"library/internal/sru"
+)
+
+// SRUHandler serves the SRU endpoint.
+type SRUHandler struct {
+	provider *sru.Provider
+}
+
+// RegisterSRURoutes wires GET and POST /sru to provider.
+func RegisterSRURoutes(r *gin.Engine, provider *sru.Provider) {
+	h := &SRUHandler{provider: provider}
+	r.GET("/sru", h.serve)
+	r.POST("/sru", h.serve)
+}
+
+func (h *SRUHandler) serve(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid query or form body", codeValidation)
+		return
+	}
+	body, err := h.provider.Serve(requestURL(c), c.Request.Form)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "text/xml; charset=utf-8", body)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"library/internal/calendar"
+)
+
+// ─── Request Structs ──────────────────────────────────────────────────────────
+
+type termRequest struct {
+	Name      string `json:"name" binding:"required,max=255"`
+	StartDate string `json:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" binding:"required"`
+}
+
+// ─── Term Handlers ────────────────────────────────────────────────────────────
+
+func (h *LibraryHandler) createTerm(c *gin.Context) {
+	req, ok := bindTermRequest(c)
+	if !ok {
+		return
+	}
+	start, end, ok := termDates(c, req)
+	if !ok {
+		return
+	}
+
+	term, err := h.svc.CreateTerm(req.Name, start, end)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, term)
+}
+
+func (h *LibraryHandler) listTerms(c *gin.Context) {
+	terms, err := h.reads(c).ListTerms()
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, terms)
+}
+
+func (h *LibraryHandler) updateTerm(c *gin.Context) {
+	termID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid term id: must be a UUID", codeValidation)
+		return
+	}
+	req, ok := bindTermRequest(c)
+	if !ok {
+		return
+	}
+	start, end, ok := termDates(c, req)
+	if !ok {
+		return
+	}
+
+	term, err := h.svc.UpdateTerm(termID, req.Name, start, end)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, term)
+}
+
+func (h *LibraryHandler) deleteTerm(c *gin.Context) {
+	termID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "invalid term id: must be a UUID", codeValidation)
+		return
+	}
+
+	if err := h.svc.DeleteTerm(termID); err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *LibraryHandler) termEndReport(c *gin.Context) {
+	var termID *uuid.UUID
+	if s := c.Query("term_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, "invalid term_id: must be a UUID", codeValidation)
+			return
+		}
+		termID = &id
+	}
+
+	report, err := h.reads(c).TermEndReport(termID)
+	if err != nil {
+		mapServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func bindTermRequest(c *gin.Context) (termRequest, bool) {
+	var req termRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error(), codeValidation)
+		return req, false
+	}
+	return req, true
+}
+
+func termDates(c *gin.Context, req termRequest) (start, end time.Time, ok bool) {
+	start, err := calendar.ParseDate(req.StartDate)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "start_date: "+err.Error(), codeValidation)
+		return start, end, false
+	}
+	end, err = calendar.ParseDate(req.EndDate)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "end_date: "+err.Error(), codeValidation)
+		return start, end, false
+	}
+	return start, end, true
+}
@@ -0,0 +1,232 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	recordTerminator  = 0x1D
+	fieldTerminator   = 0x1E
+	subfieldDelimiter = 0x1F
+
+	leaderLength    = 24
+	maxRecordLength = 99999
+	maxFieldLength  = 9999
+)
+
+// DefaultLeader is the leader used for records without one: a new record
+// (n) for language material (a), a monograph (m), encoded in UTF-8 (a). The
+// lengths and base address are filled in when the record is written.
+const DefaultLeader = "00000nam a2200000   4500"
+
+// Writer writes records to a stream.
+type Writer interface {
+	Write(rec Record) error
+	// Close finishes the stream; it does not close the underlying writer.
+	Close() error
+}
+
+// ─── ISO 2709 ─────────────────────────────────────────────────────────────────
+
+// Marshal encodes rec in ISO 2709 form. Values are written as UTF-8 and
+// the leader is marked accordingly; delimiter bytes inside values are dropped.
+func Marshal(rec Record) ([]byte, error) {
+	var dir, data bytes.Buffer
+	for _, f := range rec.Fields {
+		if len(f.Tag) != 3 {
+			return nil, fmt.Errorf("%w: tag %q", ErrInvalidRecord, f.Tag)
+		}
+		start := data.Len()
+		if IsControlTag(f.Tag) {
+			data.WriteString(clean(f.Value))
+		} else {
+			data.WriteByte(indicator(f.Ind1))
+			data.WriteByte(indicator(f.Ind2))
+			for _, sf := range f.Subfields {
+				data.WriteByte(subfieldDelimiter)
+				data.WriteByte(sf.Code)
+				data.WriteString(clean(sf.Value))
+			}
+		}
+		data.WriteByte(fieldTerminator)
+		if data.Len()-start > maxFieldLength || start > maxRecordLength {
+			return nil, fmt.Errorf("%w: field %s", ErrRecordTooLong, f.Tag)
+		}
+		fmt.Fprintf(&dir, "%s%04d%05d", f.Tag, data.Len()-start, start)
+	}
+	dir.WriteByte(fieldTerminator)
+
+	base := leaderLength + dir.Len()
+	total := base + data.Len() + 1
+	if total > maxRecordLength {
+		return nil, ErrRecordTooLong
+	}
+	leader := []byte(normalLeader(rec.Leader))
+	copy(leader[0:5], fmt.Sprintf("%05d", total))
+	leader[9] = 'a'
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+
+	out := make([]byte, 0, total)
+	out = append(out, leader...)
+	out = append(out, dir.Bytes()...)
+	out = append(out, data.Bytes()...)
+	return append(out, recordTerminator), nil
+}
+
+// Unmarshal decodes one ISO 2709 record. Only UTF-8 records, and MARC-8
+// records that are plain ASCII, are accepted.
+func Unmarshal(raw []byte) (Record, error) {
+	raw = bytes.TrimSuffix(raw, []byte{recordTerminator})
+	if len(raw) < leaderLength+1 {
+		return Record{}, fmt.Errorf("%w: shorter than its leader", ErrInvalidRecord)
+	}
+	leader := string(raw[:leaderLength])
+	if raw[9] == 'a' {
+		if !utf8.Valid(raw) {
+			return Record{}, fmt.Errorf("%w: not valid UTF-8", ErrInvalidRecord)
+		}
+	} else if !isASCII(raw) {
+		return Record{}, fmt.Errorf("%w: MARC-8 encoded; only UTF-8 records (leader/09 = a) are supported", ErrInvalidRecord)
+	}
+	base, err := strconv.Atoi(leader[12:17])
+	if err != nil || base <= leaderLength || base > len(raw) || raw[base-1] != fieldTerminator {
+		return Record{}, fmt.Errorf("%w: bad base address %q", ErrInvalidRecord, leader[12:17])
+	}
+	dir := raw[leaderLength : base-1]
+	if len(dir)%12 != 0 {
+		return Record{}, fmt.Errorf("%w: directory length %d is not a multiple of 12", ErrInvalidRecord, len(dir))
+	}
+
+	rec := Record{Leader: leader}
+	for i := 0; i < len(dir); i += 12 {
+		entry := dir[i : i+12]
+		tag := string(entry[:3])
+		length, err1 := strconv.Atoi(string(entry[3:7]))
+		start, err2 := strconv.Atoi(string(entry[7:12]))
+		if err1 != nil || err2 != nil || base+start+length > len(raw) {
+			return Record{}, fmt.Errorf("%w: bad directory entry %q", ErrInvalidRecord, entry)
+		}
+		data := bytes.TrimSuffix(raw[base+start:base+start+length], []byte{fieldTerminator})
+		if IsControlTag(tag) {
+			rec.Fields = append(rec.Fields, ControlField(tag, string(data)))
+			continue
+		}
+		if len(data) < 2 {
+			return Record{}, fmt.Errorf("%w: field %s has no indicators", ErrInvalidRecord, tag)
+		}
+		f := Field{Tag: tag, Ind1: data[0], Ind2: data[1]}
+		for _, chunk := range bytes.Split(data[2:], []byte{subfieldDelimiter})[1:] {
+			if len(chunk) == 0 {
+				continue
+			}
+			f.Subfields = append(f.Subfields, Subfield{Code: chunk[0], Value: string(chunk[1:])})
+		}
+		rec.Fields = append(rec.Fields, f)
+	}
+	return rec, nil
+}
+
+// Reader reads ISO 2709 records from a stream.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a Reader for r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, maxRecordLength+1)}
+}
+
+// Next returns the next record, or io.EOF after the last one. An error
+// wrapping ErrInvalidRecord concerns that record only; the reader has moved
+// past it and Next can be called again. Any other error ends the stream.
+func (r *Reader) Next() (Record, error) {
+	// Some systems put a line break after each record terminator.
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return Record{}, err
+		}
+		if b != '\n' && b != '\r' && b != ' ' && b != '\t' {
+			r.r.UnreadByte()
+			break
+		}
+	}
+
+	raw, err := r.r.ReadSlice(recordTerminator)
+	switch {
+	case err == bufio.ErrBufferFull:
+		for err == bufio.ErrBufferFull {
+			_, err = r.r.ReadSlice(recordTerminator)
+		}
+		if err != nil && err != io.EOF {
+			return Record{}, err
+		}
+		return Record{}, fmt.Errorf("%w: longer than %d bytes", ErrInvalidRecord, maxRecordLength)
+	case err == io.EOF:
+		return Record{}, fmt.Errorf("%w: truncated at end of file", ErrInvalidRecord)
+	case err != nil:
+		return Record{}, err
+	}
+	return Unmarshal(raw)
+}
+
+type isoWriter struct {
+	w io.Writer
+}
+
+// NewWriter returns a Writer that writes ISO 2709 records back to back.
+func NewWriter(w io.Writer) Writer {
+	return &isoWriter{w: w}
+}
+
+func (w *isoWriter) Write(rec Record) error {
+	raw, err := Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(raw)
+	return err
+}
+
+func (w *isoWriter) Close() error { return nil }
+
+func normalLeader(leader string) string {
+	if len(leader) != leaderLength {
+		return DefaultLeader
+	}
+	b := []byte(leader)
+	copy(b[10:12], "22")
+	copy(b[20:24], "4500")
+	return string(b)
+}
+
+func indicator(b byte) byte {
+	if b == 0 {
+		return ' '
+	}
+	return b
+}
+
+func clean(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == recordTerminator || r == fieldTerminator || r == subfieldDelimiter {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+// Package marc reads and writes MARC 21 bibliographic records, in binary
+// ISO 2709 form and as MARCXML. It is a codec only: a Record is a leader and
+// a list of tagged fields, and what the fields mean is left to the caller.
+package marc
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidRecord is returned for a record that is not well-formed MARC.
+var ErrInvalidRecord = errors.New("invalid MARC record")
+
+// ErrRecordTooLong is returned when a record does not fit the five-digit
+// record length, or a field the four-digit field length, of ISO 2709.
+var ErrRecordTooLong = errors.New("MARC record too long for ISO 2709")
+
+// Record is a MARC record. Control fields (tags 001–009) carry a Value; data
+// fields carry indicators and subfields.
+type Record struct {
+	Leader string
+	Fields []Field
+}
+
+// Field is a control field or a data field.
+type Field struct {
+	Tag       string
+	Value     string
+	Ind1      byte
+	Ind2      byte
+	Subfields []Subfield
+}
+
+// Subfield is one coded element of a data field.
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// IsControlTag reports whether tag names a control field (001–009).
+func IsControlTag(tag string) bool {
+	return strings.HasPrefix(tag, "00")
+}
+
+// ControlField returns a control field.
+func ControlField(tag, value string) Field {
+	return Field{Tag: tag, Value: value}
+}
+
+// DataField returns a data field. Subfields with an empty value are dropped.
+func DataField(tag string, ind1, ind2 byte, subfields ...Subfield) Field {
+	f := Field{Tag: tag, Ind1: ind1, Ind2: ind2}
+	for _, sf := range subfields {
+		if sf.Value != "" {
+			f.Subfields = append(f.Subfields, sf)
+		}
+	}
+	return f
+}
+
+// Sub is shorthand for a Subfield.
+func Sub(code byte, value string) Subfield {
+	return Subfield{Code: code, Value: value}
+}
+
+// Add appends f to the record unless it is a data field without subfields.
+func (r *Record) Add(f Field) {
+	if !IsControlTag(f.Tag) && len(f.Subfields) == 0 {
+		return
+	}
+	r.Fields = append(r.Fields, f)
+}
+
+// FieldsByTag returns the fields with the given tag, in record order.
+func (r *Record) FieldsByTag(tag string) []Field {
+	var out []Field
+	for _, f := range r.Fields {
+		if f.Tag == tag {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// First returns the value of the first subfield with the given code, or "".
+func (f Field) First(code byte) string {
+	for _, sf := range f.Subfields {
+		if sf.Code == code {
+			return sf.Value
+		}
+	}
+	return ""
+}
+
+// All returns the values of every subfield with the given code.
+func (f Field) All(code byte) []string {
+	var out []string
+	for _, sf := range f.Subfields {
+		if sf.Code == code {
+			out = append(out, sf.Value)
+		}
+	}
+	return out
+}
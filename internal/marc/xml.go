@@ -0,0 +1,175 @@
+package marc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// XMLNamespace is the MARC 21 XML schema namespace.
+const XMLNamespace = "http://www.loc.gov/MARC21/slim"
+
+// ─── MARCXML ──────────────────────────────────────────────────────────────────
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Namespace     string            `xml:"xmlns,attr,omitempty"` // set when the record stands alone
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+func toXML(rec Record) xmlRecord {
+	x := xmlRecord{Leader: normalLeader(rec.Leader)}
+	for _, f := range rec.Fields {
+		if IsControlTag(f.Tag) {
+			x.ControlFields = append(x.ControlFields, xmlControlField{Tag: f.Tag, Value: f.Value})
+			continue
+		}
+		df := xmlDataField{Tag: f.Tag, Ind1: string(indicator(f.Ind1)), Ind2: string(indicator(f.Ind2))}
+		for _, sf := range f.Subfields {
+			df.Subfields = append(df.Subfields, xmlSubfield{Code: string(sf.Code), Value: sf.Value})
+		}
+		x.DataFields = append(x.DataFields, df)
+	}
+	return x
+}
+
+func (x xmlRecord) record() (Record, error) {
+	rec := Record{Leader: strings.TrimSpace(x.Leader)}
+	if rec.Leader != "" && len(rec.Leader) != leaderLength {
+		rec.Leader = ""
+	}
+	for _, cf := range x.ControlFields {
+		if len(cf.Tag) != 3 {
+			return Record{}, fmt.Errorf("%w: control field tag %q", ErrInvalidRecord, cf.Tag)
+		}
+		rec.Fields = append(rec.Fields, ControlField(cf.Tag, cf.Value))
+	}
+	for _, df := range x.DataFields {
+		if len(df.Tag) != 3 || len(df.Ind1) > 1 || len(df.Ind2) > 1 {
+			return Record{}, fmt.Errorf("%w: data field %q with indicators %q %q", ErrInvalidRecord, df.Tag, df.Ind1, df.Ind2)
+		}
+		f := Field{Tag: df.Tag, Ind1: ' ', Ind2: ' '}
+		if df.Ind1 != "" {
+			f.Ind1 = df.Ind1[0]
+		}
+		if df.Ind2 != "" {
+			f.Ind2 = df.Ind2[0]
+		}
+		for _, sf := range df.Subfields {
+			if len(sf.Code) != 1 {
+				return Record{}, fmt.Errorf("%w: field %s has subfield code %q", ErrInvalidRecord, df.Tag, sf.Code)
+			}
+			f.Subfields = append(f.Subfields, Subfield{Code: sf.Code[0], Value: sf.Value})
+		}
+		rec.Fields = append(rec.Fields, f)
+	}
+	return rec, nil
+}
+
+// XMLReader reads the record elements of a MARCXML document, whether it is
+// a collection or a single record.
+type XMLReader struct {
+	d *xml.Decoder
+}
+
+// NewXMLReader returns an XMLReader for r.
+func NewXMLReader(r io.Reader) *XMLReader {
+	return &XMLReader{d: xml.NewDecoder(r)}
+}
+
+// Next returns the next record, or io.EOF after the last one. As with
+// Reader, an error wrapping ErrInvalidRecord concerns that record only;
+// malformed XML ends the stream.
+func (r *XMLReader) Next() (Record, error) {
+	for {
+		tok, err := r.d.Token()
+		if err != nil {
+			return Record{}, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		var x xmlRecord
+		if err := r.d.DecodeElement(&x, &start); err != nil {
+			return Record{}, err
+		}
+		return x.record()
+	}
+}
+
+// WriteXMLRecord writes rec as a single MARCXML record element declaring the
+// MARC 21 namespace, for embedding in other XML documents. Every line is
+// prefixed with indent.
+func WriteXMLRecord(w io.Writer, rec Record, indent string) error {
+	x := toXML(rec)
+	x.Namespace = XMLNamespace
+	enc := xml.NewEncoder(w)
+	enc.Indent(indent, "  ")
+	if err := enc.Encode(x); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type xmlWriter struct {
+	w       io.Writer
+	enc     *xml.Encoder
+	started bool
+}
+
+// NewXMLWriter returns a Writer that writes a MARCXML collection. Close
+// writes the closing tag.
+func NewXMLWriter(w io.Writer) Writer {
+	enc := xml.NewEncoder(w)
+	enc.Indent("  ", "  ")
+	return &xmlWriter{w: w, enc: enc}
+}
+
+func (w *xmlWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	_, err := io.WriteString(w.w, xml.Header+`<collection xmlns="`+XMLNamespace+`">`)
+	return err
+}
+
+func (w *xmlWriter) Write(rec Record) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w.w, "\n"); err != nil {
+		return err
+	}
+	return w.enc.Encode(toXML(rec))
+}
+
+func (w *xmlWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.w, "\n</collection>\n")
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type UserRole string
@@ -20,10 +21,23 @@ const (
 	BookCopyStatusCheckedOut BookCopyStatus = "CHECKED_OUT"
 )
 
+// LoanType decides how long a book may be kept and how lateness is charged.
+// STANDARD loans run for the loan period in days and are fined per day;
+// SHORT (LoanHours long) and OVERNIGHT loans are fined per hour.
+type LoanType string
+
+const (
+	LoanTypeStandard  LoanType = "STANDARD"
+	LoanTypeShort     LoanType = "SHORT"
+	LoanTypeOvernight LoanType = "OVERNIGHT"
+)
+
 type User struct {
 	ID   uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
 	Name string    `gorm:"size:255;not null" json:"name"`
 	Role UserRole  `gorm:"type:user_role;not null" json:"role"`
+	// Version counts edits to the user, starting at 1; see Book.Version.
+	Version int `gorm:"not null;default:1" json:"version"`
 }
 
 type Book struct {
@@ -31,13 +45,53 @@ type Book struct {
 	Title       string    `gorm:"size:255;not null" json:"title"`
 	Author      string    `gorm:"size:255;not null" json:"author"`
 	TotalCopies int       `gorm:"not null" json:"total_copies"`
+	LoanType    LoanType  `gorm:"type:loan_type;not null;default:'STANDARD'" json:"loan_type"`
+	LoanHours   int       `gorm:"not null;default:0" json:"loan_hours,omitempty"`
+	// LoanTypeUntil, if set, is the last day LoanType applies; the book lends
+	// as STANDARD afterwards. Course reserves set it to the end of the term.
+	LoanTypeUntil *time.Time `gorm:"type:date" json:"loan_type_until,omitempty"`
+	// ISBN is the normalised ISBN-13, if known; no two books share one.
+	ISBN *string `gorm:"size:13;uniqueIndex:uniq_book_isbn" json:"isbn,omitempty"`
+	// Edition, Publisher and Published (the publication date as catalogued,
+	// e.g. "2019" or "[2019?]") are descriptive only.
+	Edition   string `gorm:"size:255;not null;default:''" json:"edition,omitempty"`
+	Publisher string `gorm:"size:255;not null;default:''" json:"publisher,omitempty"`
+	Published string `gorm:"size:64;not null;default:''" json:"published,omitempty"`
+	// Subjects are topical subject headings, subdivisions joined with "--".
+	Subjects []string `gorm:"type:text;serializer:json" json:"subjects,omitempty"`
+	// UpdatedAt is when the catalogue record last changed, in UTC. Copies,
+	// loans and loan types are circulation and leave it alone. OAI-PMH
+	// harvesters select records by it.
+	UpdatedAt time.Time `gorm:"not null;index:idx_books_updated_at,priority:1" json:"updated_at"`
+	// AvailableCopies and CheckedOutCopies count the book's copies by status
+	// and Holds its reservation queue. The service keeps them up to date in
+	// the transaction of every change they count, so that availability can
+	// be shown without counting copies; like TotalCopies, they are
+	// circulation and leave UpdatedAt alone.
+	AvailableCopies  int `gorm:"not null;default:0" json:"available_copies"`
+	CheckedOutCopies int `gorm:"not null;default:0" json:"checked_out_copies"`
+	Holds            int `gorm:"not null;default:0" json:"holds"`
+	// Version starts at 1 and goes up by one with every edit to the record,
+	// loan type included. It is the basis of the record's ETag: an edit
+	// sent with an older version is refused rather than overwriting one made
+	// since. Circulation counts are not edits and leave it alone.
+	Version int `gorm:"not null;default:1" json:"version"`
+	// DeletedAt is set while the book is withdrawn: it is kept with its
+	// copies and loan history, so that it can be restored, but is not found
+	// by any query that does not ask for withdrawn books.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 type BookCopy struct {
-	ID     uuid.UUID      `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
-	BookID uuid.UUID      `gorm:"type:uuid;not null;index" json:"book_id"`
-	Book   Book           `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
-	Status BookCopyStatus `gorm:"type:book_copy_status;not null;index" json:"status"`
+	ID       uuid.UUID      `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	BookID   uuid.UUID      `gorm:"type:uuid;not null;index" json:"book_id"`
+	Book     Book           `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Status   BookCopyStatus `gorm:"type:book_copy_status;not null;index" json:"status"`
+	BranchID *uuid.UUID     `gorm:"type:uuid;index" json:"branch_id"`
+	Barcode  *string        `gorm:"size:64;uniqueIndex:uniq_copy_barcode" json:"barcode,omitempty"`
+	// Version counts edits to the copy, such as a branch move, starting at
+	// 1; checkouts and returns change its status but not its version.
+	Version int `gorm:"not null;default:1" json:"version"`
 }
 
 type Checkout struct {
@@ -50,6 +104,20 @@ type Checkout struct {
 	DueDate     time.Time  `gorm:"not null" json:"due_date"`
 	ReturnedAt  *time.Time `json:"returned_at"`
 	FineAmount  int        `gorm:"not null;default:0" json:"fine_amount"`
+	Renewals    int        `gorm:"not null;default:0" json:"renewals"`
+	LoanType    LoanType   `gorm:"type:loan_type;not null;default:'STANDARD'" json:"loan_type"`
+}
+
+// Payment is money a user paid towards the fines on their account, recorded
+// by a self-checkout kiosk or at the desk. Reference is the payer's
+// transaction ID, if any.
+type Payment struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	User      User      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;" json:"-"`
+	Amount    int       `gorm:"not null" json:"amount"`
+	Reference string    `gorm:"size:64;not null;default:''" json:"reference"`
+	PaidAt    time.Time `gorm:"not null" json:"paid_at"`
 }
 
 type Reservation struct {
@@ -62,3 +130,63 @@ type Reservation struct {
 	CreatedAt     time.Time `gorm:"not null;default:now()" json:"created_at"`
 }
 
+// Branch is a library location with its own opening calendar. Due dates and
+// fines for a copy follow the calendar of the copy's branch.
+type Branch struct {
+	ID       uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	Name     string    `gorm:"size:255;not null" json:"name"`
+	Timezone string    `gorm:"size:64;not null;default:'UTC'" json:"timezone"`
+}
+
+// OpeningHours is a branch's regular opening interval on one weekday
+// (0 = Sunday). Weekdays without a row are closed once any row exists.
+type OpeningHours struct {
+	BranchID uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	Weekday  int       `gorm:"primaryKey" json:"weekday"`
+	Opens    string    `gorm:"size:5;not null" json:"opens"`
+	Closes   string    `gorm:"size:5;not null" json:"closes"`
+}
+
+// Closure is a single local date on which a branch is closed.
+type Closure struct {
+	BranchID uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	Date     time.Time `gorm:"type:date;primaryKey" json:"date"`
+	Reason   string    `gorm:"size:255;not null;default:''" json:"reason"`
+}
+
+// Term is an academic term. StartDate and EndDate are inclusive dates, stored
+// as midnight UTC.
+type Term struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	Name      string    `gorm:"size:255;not null" json:"name"`
+	StartDate time.Time `gorm:"type:date;not null" json:"start_date"`
+	EndDate   time.Time `gorm:"type:date;not null" json:"end_date"`
+}
+
+// Course is a taught course that publishes reading lists. TermID, if set, is
+// the term the course runs in.
+type Course struct {
+	ID     uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	Code   string     `gorm:"size:32;not null;uniqueIndex:uniq_course_code" json:"code"`
+	Title  string     `gorm:"size:255;not null" json:"title"`
+	TermID *uuid.UUID `gorm:"type:uuid;index" json:"term_id"`
+}
+
+// ReadingList is one of a course's reading lists.
+type ReadingList struct {
+	ID       uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	CourseID uuid.UUID `gorm:"type:uuid;not null;index" json:"course_id"`
+	Course   Course    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Title    string    `gorm:"size:255;not null" json:"title"`
+}
+
+// ReadingListEntry is a book on a reading list. Entries are ordered by
+// Position, starting at 1; a book appears at most once per list.
+type ReadingListEntry struct {
+	ReadingListID uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	BookID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"book_id"`
+	Book          Book      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"book"`
+	Position      int       `gorm:"not null" json:"position"`
+	Required      bool      `gorm:"not null" json:"required"`
+	Note          string    `gorm:"size:1000;not null;default:''" json:"note"`
+}
@@ -0,0 +1,509 @@
+// Package oai is an OAI-PMH 2.0 data provider over the book catalogue. It
+// answers the six protocol verbs, with selective harvesting by datestamp and
+// resumption tokens for long lists.
+//
+// A record is a book's bibliographic description, as oai_dc or MARCXML
+// (marc21). Copies and their availability change with every loan without the
+// record changing, so they are not harvested; the datestamp is the book's
+// UpdatedAt. A withdrawn book is a deleted record: its header carries
+// status="deleted" and it has no metadata. Purged books leave no trace, so
+// deletions are kept only transiently.
+package oai
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"library/internal/catalog"
+	"library/internal/marc"
+	"library/internal/models"
+	"library/internal/services"
+)
+
+const (
+	// Namespace is the OAI-PMH 2.0 namespace.
+	Namespace = "http://www.openarchives.org/OAI/2.0/"
+
+	// DefaultPageSize is the number of records or headers per list response.
+	DefaultPageSize = 100
+
+	// granularity is the datestamp layout, YYYY-MM-DDThh:mm:ssZ.
+	granularity = "2006-01-02T15:04:05Z"
+	dayLayout   = "2006-01-02"
+
+	schemaLocation = Namespace + " http://www.openarchives.org/OAI/2.0/OAI-PMH.xsd"
+	xsiNamespace   = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// Protocol error codes.
+const (
+	badArgument             = "badArgument"
+	badResumptionToken      = "badResumptionToken"
+	badVerb                 = "badVerb"
+	cannotDisseminateFormat = "cannotDisseminateFormat"
+	idDoesNotExist          = "idDoesNotExist"
+	noRecordsMatch          = "noRecordsMatch"
+	noSetHierarchy          = "noSetHierarchy"
+)
+
+// Catalogue is the part of the library service the provider reads.
+type Catalogue interface {
+	// GetAnyBook finds withdrawn books too, with DeletedAt set.
+	GetAnyBook(bookID uuid.UUID) (*models.Book, error)
+	ListChangedBooks(from, until *time.Time, after *services.BookCursor, limit int) ([]models.Book, error)
+}
+
+// Repository describes the repository in Identify responses and record
+// identifiers, which are oai:<Identifier>:<book id>.
+type Repository struct {
+	Name       string
+	Identifier string
+	AdminEmail string
+}
+
+// Provider answers OAI-PMH requests.
+type Provider struct {
+	Repository Repository
+	Books      Catalogue
+	// PageSize is the number of items per list response; DefaultPageSize
+	// when zero.
+	PageSize int
+	// Now returns the response date; time.Now when nil.
+	Now func() time.Time
+}
+
+// protocolError is an OAI-PMH error, reported inside a normal response.
+type protocolError struct {
+	code    string
+	message string
+}
+
+func (e *protocolError) Error() string { return e.code + ": " + e.message }
+
+func protocolErrorf(code, format string, args ...interface{}) error {
+	return &protocolError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// ─── Metadata Formats ─────────────────────────────────────────────────────────
+
+type metadataFormat struct {
+	prefix    string
+	schema    string
+	namespace string
+	write     func(w io.Writer, book models.Book, indent string) error
+}
+
+var metadataFormats = []metadataFormat{
+	{
+		prefix:    "oai_dc",
+		schema:    "http://www.openarchives.org/OAI/2.0/oai_dc.xsd",
+		namespace: "http://www.openarchives.org/OAI/2.0/oai_dc/",
+		write: func(w io.Writer, book models.Book, indent string) error {
+			return catalog.WriteDublinCore(w, book, indent)
+		},
+	},
+	{
+		prefix:    "marc21",
+		schema:    "http://www.loc.gov/standards/marcxml/schema/MARC21slim.xsd",
+		namespace: marc.XMLNamespace,
+		write: func(w io.Writer, book models.Book, indent string) error {
+			return marc.WriteXMLRecord(w, catalog.MARCRecord(book, nil, nil), indent)
+		},
+	},
+}
+
+func formatByPrefix(prefix string) (metadataFormat, error) {
+	for _, f := range metadataFormats {
+		if f.prefix == prefix {
+			return f, nil
+		}
+	}
+	return metadataFormat{}, protocolErrorf(cannotDisseminateFormat, "metadataPrefix %q is not supported (want oai_dc or marc21)", prefix)
+}
+
+// ─── Requests ─────────────────────────────────────────────────────────────────
+
+// verbArgs lists the arguments each verb accepts besides verb itself.
+var verbArgs = map[string][]string{
+	"Identify":            nil,
+	"ListMetadataFormats": {"identifier"},
+	"ListSets":            {"resumptionToken"},
+	"GetRecord":           {"identifier", "metadataPrefix"},
+	"ListIdentifiers":     {"metadataPrefix", "from", "until", "set", "resumptionToken"},
+	"ListRecords":         {"metadataPrefix", "from", "until", "set", "resumptionToken"},
+}
+
+// parseRequest checks the verb and its arguments and returns the arguments
+// other than verb.
+func parseRequest(args url.Values) (string, map[string]string, error) {
+	if len(args["verb"]) != 1 {
+		return "", nil, protocolErrorf(badVerb, "verb is missing or repeated")
+	}
+	verb := args.Get("verb")
+	allowed, ok := verbArgs[verb]
+	if !ok {
+		return "", nil, protocolErrorf(badVerb, "unknown verb %q", verb)
+	}
+	out := map[string]string{}
+	for name, values := range args {
+		if name == "verb" {
+			continue
+		}
+		if !slices.Contains(allowed, name) {
+			return "", nil, protocolErrorf(badArgument, "%s does not take the argument %q", verb, name)
+		}
+		if len(values) != 1 {
+			return "", nil, protocolErrorf(badArgument, "argument %q is repeated", name)
+		}
+		out[name] = values[0]
+	}
+
+	switch verb {
+	case "GetRecord":
+		if out["identifier"] == "" || out["metadataPrefix"] == "" {
+			return "", nil, protocolErrorf(badArgument, "GetRecord needs identifier and metadataPrefix")
+		}
+	case "ListIdentifiers", "ListRecords":
+		if _, ok := out["resumptionToken"]; ok && len(out) > 1 {
+			return "", nil, protocolErrorf(badArgument, "resumptionToken is an exclusive argument")
+		}
+		if _, ok := out["resumptionToken"]; !ok && out["metadataPrefix"] == "" {
+			return "", nil, protocolErrorf(badArgument, "%s needs metadataPrefix or resumptionToken", verb)
+		}
+	}
+	return verb, out, nil
+}
+
+// ─── Responses ────────────────────────────────────────────────────────────────
+
+// Serve answers one request. baseURL is the endpoint's public URL and args
+// the request's query or form arguments. Protocol errors are reported in the
+// response; an error is returned only when the catalogue cannot be read.
+func (p *Provider) Serve(baseURL string, args url.Values) ([]byte, error) {
+	now := time.Now
+	if p.Now != nil {
+		now = p.Now
+	}
+
+	var body bytes.Buffer
+	verb, params, err := parseRequest(args)
+	if err == nil {
+		switch verb {
+		case "Identify":
+			err = p.identify(&body, baseURL, now())
+		case "ListMetadataFormats":
+			err = p.listMetadataFormats(&body, params)
+		case "ListSets":
+			err = listSets(params)
+		case "GetRecord":
+			err = p.getRecord(&body, params)
+		case "ListIdentifiers":
+			err = p.list(&body, params, false)
+		case "ListRecords":
+			err = p.list(&body, params, true)
+		}
+	}
+	var perr *protocolError
+	if err != nil && !errors.As(err, &perr) {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	fmt.Fprintf(&out, `<OAI-PMH xmlns="%s" xmlns:xsi="%s" xsi:schemaLocation="%s">`+"\n", Namespace, xsiNamespace, schemaLocation)
+	fmt.Fprintf(&out, "  <responseDate>%s</responseDate>\n", now().UTC().Format(granularity))
+	// The request is echoed with its arguments unless they were at fault.
+	out.WriteString("  <request")
+	if perr == nil || (perr.code != badVerb && perr.code != badArgument) {
+		names := make([]string, 0, len(args))
+		for name := range args {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&out, ` %s="%s"`, name, escape(args.Get(name)))
+		}
+	}
+	fmt.Fprintf(&out, ">%s</request>\n", escape(baseURL))
+	if perr != nil {
+		fmt.Fprintf(&out, "  <error code=\"%s\">%s</error>\n", perr.code, escape(perr.message))
+	} else {
+		fmt.Fprintf(&out, "  <%s>\n", verb)
+		out.Write(body.Bytes())
+		fmt.Fprintf(&out, "  </%s>\n", verb)
+	}
+	out.WriteString("</OAI-PMH>\n")
+	return out.Bytes(), nil
+}
+
+func (p *Provider) identify(w *bytes.Buffer, baseURL string, now time.Time) error {
+	earliest := now
+	books, err := p.Books.ListChangedBooks(nil, nil, nil, 1)
+	if err != nil {
+		return err
+	}
+	if len(books) > 0 {
+		earliest = books[0].UpdatedAt
+	}
+	element(w, "    ", "repositoryName", p.Repository.Name)
+	element(w, "    ", "baseURL", baseURL)
+	element(w, "    ", "protocolVersion", "2.0")
+	element(w, "    ", "adminEmail", p.Repository.AdminEmail)
+	element(w, "    ", "earliestDatestamp", datestamp(earliest))
+	element(w, "    ", "deletedRecord", "transient")
+	element(w, "    ", "granularity", "YYYY-MM-DDThh:mm:ssZ")
+	w.WriteString("    <description>\n")
+	fmt.Fprintf(w, `      <oai-identifier xmlns="http://www.openarchives.org/OAI/2.0/oai-identifier" xmlns:xsi="%s" `+
+		`xsi:schemaLocation="http://www.openarchives.org/OAI/2.0/oai-identifier http://www.openarchives.org/OAI/2.0/oai-identifier.xsd">`+"\n", xsiNamespace)
+	element(w, "        ", "scheme", "oai")
+	element(w, "        ", "repositoryIdentifier", p.Repository.Identifier)
+	element(w, "        ", "delimiter", ":")
+	element(w, "        ", "sampleIdentifier", p.identifier(uuid.UUID{}))
+	w.WriteString("      </oai-identifier>\n")
+	w.WriteString("    </description>\n")
+	return nil
+}
+
+func (p *Provider) listMetadataFormats(w *bytes.Buffer, params map[string]string) error {
+	if id, ok := params["identifier"]; ok {
+		if _, err := p.book(id); err != nil {
+			return err
+		}
+	}
+	for _, f := range metadataFormats {
+		w.WriteString("    <metadataFormat>\n")
+		element(w, "      ", "metadataPrefix", f.prefix)
+		element(w, "      ", "schema", f.schema)
+		element(w, "      ", "metadataNamespace", f.namespace)
+		w.WriteString("    </metadataFormat>\n")
+	}
+	return nil
+}
+
+func listSets(params map[string]string) error {
+	if _, ok := params["resumptionToken"]; ok {
+		return protocolErrorf(badResumptionToken, "this repository issues no resumption tokens for sets")
+	}
+	return protocolErrorf(noSetHierarchy, "this repository does not support sets")
+}
+
+func (p *Provider) getRecord(w *bytes.Buffer, params map[string]string) error {
+	f, err := formatByPrefix(params["metadataPrefix"])
+	if err != nil {
+		return err
+	}
+	book, err := p.book(params["identifier"])
+	if err != nil {
+		return err
+	}
+	return p.writeRecord(w, *book, f)
+}
+
+func (p *Provider) list(w *bytes.Buffer, params map[string]string, records bool) error {
+	var q query
+	if token, ok := params["resumptionToken"]; ok {
+		var err error
+		if q, err = decodeToken(token); err != nil {
+			return err
+		}
+	} else {
+		if _, ok := params["set"]; ok {
+			return protocolErrorf(noSetHierarchy, "this repository does not support sets")
+		}
+		var err error
+		if q, err = newQuery(params); err != nil {
+			return err
+		}
+	}
+	f, err := formatByPrefix(q.Prefix)
+	if err != nil {
+		return err
+	}
+
+	size := p.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	books, err := p.Books.ListChangedBooks(q.From, q.Until, q.After, size+1)
+	if err != nil {
+		return err
+	}
+	if len(books) == 0 && q.After == nil {
+		return protocolErrorf(noRecordsMatch, "no records match the request")
+	}
+	more := len(books) > size
+	if more {
+		books = books[:size]
+	}
+	for _, book := range books {
+		if records {
+			err = p.writeRecord(w, book, f)
+		} else {
+			p.writeHeader(w, "    ", book)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// A list continued by a token ends with an empty token.
+	switch {
+	case more:
+		next := q
+		last := books[len(books)-1]
+		next.After = &services.BookCursor{UpdatedAt: last.UpdatedAt, ID: last.ID}
+		next.Cursor = q.Cursor + len(books)
+		fmt.Fprintf(w, "    <resumptionToken cursor=\"%d\">%s</resumptionToken>\n", q.Cursor, next.encode())
+	case q.After != nil:
+		fmt.Fprintf(w, "    <resumptionToken cursor=\"%d\"/>\n", q.Cursor)
+	}
+	return nil
+}
+
+func (p *Provider) writeHeader(w *bytes.Buffer, indent string, book models.Book) {
+	if book.DeletedAt.Valid {
+		w.WriteString(indent + "<header status=\"deleted\">\n")
+	} else {
+		w.WriteString(indent + "<header>\n")
+	}
+	element(w, indent+"  ", "identifier", p.identifier(book.ID))
+	element(w, indent+"  ", "datestamp", datestamp(book.UpdatedAt))
+	w.WriteString(indent + "</header>\n")
+}
+
+func (p *Provider) writeRecord(w *bytes.Buffer, book models.Book, f metadataFormat) error {
+	w.WriteString("    <record>\n")
+	p.writeHeader(w, "      ", book)
+	if book.DeletedAt.Valid {
+		w.WriteString("    </record>\n")
+		return nil
+	}
+	w.WriteString("      <metadata>\n")
+	if err := f.write(w, book, "        "); err != nil {
+		return err
+	}
+	w.WriteString("      </metadata>\n")
+	w.WriteString("    </record>\n")
+	return nil
+}
+
+// ─── Identifiers and Datestamps ───────────────────────────────────────────────
+
+func (p *Provider) identifier(bookID uuid.UUID) string {
+	return "oai:" + p.Repository.Identifier + ":" + bookID.String()
+}
+
+// book returns the book an identifier names.
+func (p *Provider) book(identifier string) (*models.Book, error) {
+	rest, ok := strings.CutPrefix(identifier, "oai:"+p.Repository.Identifier+":")
+	id, err := uuid.Parse(rest)
+	if !ok || err != nil {
+		return nil, protocolErrorf(idDoesNotExist, "unknown identifier %q", identifier)
+	}
+	book, err := p.Books.GetAnyBook(id)
+	if errors.Is(err, services.ErrBookNotFound) {
+		return nil, protocolErrorf(idDoesNotExist, "unknown identifier %q", identifier)
+	}
+	return book, err
+}
+
+func datestamp(t time.Time) string {
+	return t.UTC().Format(granularity)
+}
+
+// parseDatestamp reads a from or until argument, at day or second
+// granularity.
+func parseDatestamp(name, s string) (t time.Time, day bool, err error) {
+	if t, err := time.Parse(granularity, s); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.Parse(dayLayout, s); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, protocolErrorf(badArgument, "%s must be YYYY-MM-DD or YYYY-MM-DDThh:mm:ssZ, got %q", name, s)
+}
+
+// ─── Resumption Tokens ────────────────────────────────────────────────────────
+
+// query is a list request: the format, the datestamp range as From <= t <
+// Until, and, when continuing, the last book sent and how many came before.
+// Resumption tokens carry it, so they never expire and need no server state.
+type query struct {
+	Prefix string               `json:"p"`
+	From   *time.Time           `json:"f,omitempty"`
+	Until  *time.Time           `json:"u,omitempty"`
+	After  *services.BookCursor `json:"a,omitempty"`
+	Cursor int                  `json:"c,omitempty"`
+}
+
+func newQuery(params map[string]string) (query, error) {
+	q := query{Prefix: params["metadataPrefix"]}
+	var fromDay, untilDay bool
+	if s, ok := params["from"]; ok {
+		t, day, err := parseDatestamp("from", s)
+		if err != nil {
+			return query{}, err
+		}
+		q.From, fromDay = &t, day
+	}
+	if s, ok := params["until"]; ok {
+		t, day, err := parseDatestamp("until", s)
+		if err != nil {
+			return query{}, err
+		}
+		// until is inclusive at its own granularity.
+		if day {
+			t = t.AddDate(0, 0, 1)
+		} else {
+			t = t.Add(time.Second)
+		}
+		q.Until, untilDay = &t, day
+	}
+	if q.From != nil && q.Until != nil {
+		if fromDay != untilDay {
+			return query{}, protocolErrorf(badArgument, "from and until must have the same granularity")
+		}
+		if !q.From.Before(*q.Until) {
+			return query{}, protocolErrorf(badArgument, "from is later than until")
+		}
+	}
+	return q, nil
+}
+
+func (q query) encode() string {
+	raw, _ := json.Marshal(q)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeToken(token string) (query, error) {
+	var q query
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || json.Unmarshal(raw, &q) != nil || q.Prefix == "" || q.After == nil || q.Cursor < 0 {
+		return query{}, protocolErrorf(badResumptionToken, "resumption token is not valid")
+	}
+	return q, nil
+}
+
+// ─── Helpers ──────────────────────────────────────────────────────────────────
+
+func element(w *bytes.Buffer, indent, name, value string) {
+	fmt.Fprintf(w, "%s<%s>%s</%s>\n", indent, name, escape(value), name)
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,1790 @@
+package repositories
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"library/internal/models"
+)
+
+// ─── In-Memory Store ──────────────────────────────────────────────────────────
+
+// MemoryStore keeps every table in process memory. It backs the memory
+// repositories used for demo mode and for fast service-level tests, and
+// honours the same contracts as the GORM repositories (see repotest):
+//
+//   - Transactions are fully serialised: a transaction holds the store's write
+//     lock from start to finish, which trivially provides the guarantees the
+//     PostgreSQL implementation gets from SELECT … FOR UPDATE.
+//   - Writes inside a transaction go to a private copy of the data that replaces
+//     the committed state only when the transaction succeeds.
+//   - The unique indexes from migrations/0001_init.sql are enforced and
+//     reported as ErrUniqueViolation.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data *memoryData
+}
+
+type memoryData struct {
+	users        map[uuid.UUID]models.User
+	books        map[uuid.UUID]models.Book
+	copies       map[uuid.UUID]models.BookCopy
+	checkouts    map[uuid.UUID]models.Checkout
+	reservations map[uuid.UUID]models.Reservation
+	branches     map[uuid.UUID]models.Branch
+	hours        map[hoursKey]models.OpeningHours
+	closures     map[closureKey]models.Closure
+	terms        map[uuid.UUID]models.Term
+	courses      map[uuid.UUID]models.Course
+	readingLists map[uuid.UUID]models.ReadingList
+	entries      map[entryKey]models.ReadingListEntry
+	payments     map[uuid.UUID]models.Payment
+
+	// withdrawn holds soft-deleted books apart from books, so that reads
+	// skip them without having to check.
+	withdrawn map[uuid.UUID]models.Book
+
+	// isbns and barcodes index uniq_book_isbn and uniq_copy_barcode.
+	isbns    map[string]uuid.UUID
+	barcodes map[string]uuid.UUID
+}
+
+// hoursKey and closureKey mirror the composite primary keys of opening_hours
+// and closures.
+type hoursKey struct {
+	branchID uuid.UUID
+	weekday  int
+}
+
+type closureKey struct {
+	branchID uuid.UUID
+	date     string
+}
+
+// entryKey mirrors the composite primary key of reading_list_entries.
+type entryKey struct {
+	listID uuid.UUID
+	bookID uuid.UUID
+}
+
+func newClosureKey(branchID uuid.UUID, date time.Time) closureKey {
+	return closureKey{branchID: branchID, date: date.Format("2006-01-02")}
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		users:        map[uuid.UUID]models.User{},
+		books:        map[uuid.UUID]models.Book{},
+		copies:       map[uuid.UUID]models.BookCopy{},
+		checkouts:    map[uuid.UUID]models.Checkout{},
+		reservations: map[uuid.UUID]models.Reservation{},
+		branches:     map[uuid.UUID]models.Branch{},
+		hours:        map[hoursKey]models.OpeningHours{},
+		closures:     map[closureKey]models.Closure{},
+		terms:        map[uuid.UUID]models.Term{},
+		courses:      map[uuid.UUID]models.Course{},
+		readingLists: map[uuid.UUID]models.ReadingList{},
+		entries:      map[entryKey]models.ReadingListEntry{},
+		payments:     map[uuid.UUID]models.Payment{},
+		withdrawn:    map[uuid.UUID]models.Book{},
+		isbns:        map[string]uuid.UUID{},
+		barcodes:     map[string]uuid.UUID{},
+	}
+}
+
+// clone copies every table. Rows are stored by value, so a shallow map copy is
+// enough for writes to the clone not to leak into the original.
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		users:        maps.Clone(d.users),
+		books:        maps.Clone(d.books),
+		copies:       maps.Clone(d.copies),
+		checkouts:    maps.Clone(d.checkouts),
+		reservations: maps.Clone(d.reservations),
+		branches:     maps.Clone(d.branches),
+		hours:        maps.Clone(d.hours),
+		closures:     maps.Clone(d.closures),
+		terms:        maps.Clone(d.terms),
+		courses:      maps.Clone(d.courses),
+		readingLists: maps.Clone(d.readingLists),
+		entries:      maps.Clone(d.entries),
+		payments:     maps.Clone(d.payments),
+		withdrawn:    maps.Clone(d.withdrawn),
+		isbns:        maps.Clone(d.isbns),
+		barcodes:     maps.Clone(d.barcodes),
+	}
+}
+
+// NewMemoryStore returns an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: newMemoryData()}
+}
+
+type memoryTx struct {
+	store *MemoryStore
+	data  *memoryData
+}
+
+func (*memoryTx) isTx() {}
+
+// Transaction implements Transactor.
+func (s *MemoryStore) Transaction(fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memoryTx{store: s, data: s.data.clone()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.data = tx.data
+	return nil
+}
+
+// TransactionWith implements Transactor. Memory transactions run one at a
+// time, so every isolation level is already satisfied.
+func (s *MemoryStore) TransactionWith(_ TxOptions, fn func(tx Tx) error) error {
+	return s.Transaction(fn)
+}
+
+// ReadOnly returns nil: a memory store has no replicas.
+func (s *MemoryStore) ReadOnly() Tx {
+	return nil
+}
+
+// read runs fn against the data visible to tx: the transaction's working copy,
+// or the committed state under a read lock when tx is nil.
+func (s *MemoryStore) read(tx Tx, fn func(d *memoryData) error) error {
+	if tx != nil {
+		return fn(s.txData(tx))
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(s.data)
+}
+
+// write runs fn against the data visible to tx. With a nil tx the write is
+// applied directly to the committed state under the write lock, like an
+// auto-committed SQL statement; every write function validates before it
+// mutates, so a failed statement leaves nothing behind.
+func (s *MemoryStore) write(tx Tx, fn func(d *memoryData) error) error {
+	if tx != nil {
+		return fn(s.txData(tx))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(s.data)
+}
+
+func (s *MemoryStore) txData(tx Tx) *memoryData {
+	mtx, ok := tx.(*memoryTx)
+	if !ok || mtx.store != s {
+		panic(fmt.Sprintf("repositories: memory repository used with foreign transaction %T", tx))
+	}
+	return mtx.data
+}
+
+// NewMemoryRepositories returns a fresh, empty MemoryStore wrapped as a full
+// repository set.
+func NewMemoryRepositories() *Repositories {
+	store := NewMemoryStore()
+	return &Repositories{
+		Transactor:   store,
+		Users:        NewMemoryUserRepository(store),
+		Books:        NewMemoryBookRepository(store),
+		BookCopies:   NewMemoryBookCopyRepository(store),
+		Checkouts:    NewMemoryCheckoutRepository(store),
+		Reservations: NewMemoryReservationRepository(store),
+		Branches:     NewMemoryBranchRepository(store),
+		Terms:        NewMemoryTermRepository(store),
+		Courses:      NewMemoryCourseRepository(store),
+		Payments:     NewMemoryPaymentRepository(store),
+	}
+}
+
+func ensureID(id *uuid.UUID) {
+	if *id == uuid.Nil {
+		*id = uuid.New()
+	}
+}
+
+func uniqueViolation(index string) error {
+	return fmt.Errorf("%w: %s", ErrUniqueViolation, index)
+}
+
+// ─── Users ────────────────────────────────────────────────────────────────────
+
+type memoryUserRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryUserRepository(store *MemoryStore) UserRepository {
+	return &memoryUserRepository{store: store}
+}
+
+func (r *memoryUserRepository) Create(tx Tx, user *models.User) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		ensureID(&user.ID)
+		if _, exists := d.users[user.ID]; exists {
+			return uniqueViolation("users_pkey")
+		}
+		if user.Version == 0 {
+			user.Version = 1
+		}
+		d.users[user.ID] = *user
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) GetByID(tx Tx, id uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := r.store.read(tx, func(d *memoryData) error {
+		u, ok := d.users[id]
+		if !ok {
+			return ErrNotFound
+		}
+		user = u
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *memoryUserRepository) GetByIDForUpdate(tx Tx, id uuid.UUID) (*models.User, error) {
+	return r.GetByID(tx, id)
+}
+
+func (r *memoryUserRepository) List(tx Tx) ([]models.User, error) {
+	var users []models.User
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, u := range d.users {
+			users = append(users, u)
+		}
+		return nil
+	})
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Name != users[j].Name {
+			return users[i].Name < users[j].Name
+		}
+		return users[i].ID.String() < users[j].ID.String()
+	})
+	return users, err
+}
+
+// ─── Books ────────────────────────────────────────────────────────────────────
+
+type memoryBookRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryBookRepository(store *MemoryStore) BookRepository {
+	return &memoryBookRepository{store: store}
+}
+
+func (r *memoryBookRepository) Create(tx Tx, book *models.Book) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		ensureID(&book.ID)
+		if _, exists := d.books[book.ID]; exists {
+			return uniqueViolation("books_pkey")
+		}
+		if _, exists := d.withdrawn[book.ID]; exists {
+			return uniqueViolation("books_pkey")
+		}
+		if book.ISBN != nil {
+			if _, exists := d.isbns[*book.ISBN]; exists {
+				return uniqueViolation("uniq_book_isbn")
+			}
+		}
+		if book.LoanType == "" {
+			book.LoanType = models.LoanTypeStandard
+		}
+		if book.Version == 0 {
+			book.Version = 1
+		}
+		if book.UpdatedAt.IsZero() {
+			book.UpdatedAt = time.Now().UTC()
+		}
+		stored := *book
+		stored.Subjects = slices.Clone(book.Subjects)
+		if book.ISBN != nil {
+			isbn := *book.ISBN
+			stored.ISBN = &isbn
+			d.isbns[isbn] = book.ID
+		}
+		d.books[book.ID] = stored
+		return nil
+	})
+}
+
+func (r *memoryBookRepository) List(tx Tx) ([]models.Book, error) {
+	var books []models.Book
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, b := range d.books {
+			books = append(books, b)
+		}
+		return nil
+	})
+	sort.Slice(books, func(i, j int) bool { return books[i].ID.String() < books[j].ID.String() })
+	return books, err
+}
+
+func (r *memoryBookRepository) EachWithCopies(tx Tx, fn func(book models.Book, copies []models.BookCopy) error) error {
+	// The store is in memory already; take a snapshot so fn runs unlocked.
+	var books []models.Book
+	copies := map[uuid.UUID][]models.BookCopy{}
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, b := range d.books {
+			books = append(books, b)
+		}
+		for _, c := range d.copies {
+			copies[c.BookID] = append(copies[c.BookID], c)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(books, func(i, j int) bool {
+		if books[i].Title != books[j].Title {
+			return books[i].Title < books[j].Title
+		}
+		return books[i].ID.String() < books[j].ID.String()
+	})
+	for _, b := range books {
+		list := copies[b.ID]
+		sort.Slice(list, func(i, j int) bool { return list[i].ID.String() < list[j].ID.String() })
+		if err := fn(b, list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryBookRepository) ListChanged(tx Tx, from, until *time.Time, after *BookCursor, limit int) ([]models.Book, error) {
+	var books []models.Book
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, set := range []map[uuid.UUID]models.Book{d.books, d.withdrawn} {
+			for _, b := range set {
+				switch {
+				case from != nil && b.UpdatedAt.Before(*from):
+				case until != nil && !b.UpdatedAt.Before(*until):
+				case after != nil && (b.UpdatedAt.Before(after.UpdatedAt) ||
+					b.UpdatedAt.Equal(after.UpdatedAt) && b.ID.String() <= after.ID.String()):
+				default:
+					books = append(books, b)
+				}
+			}
+		}
+		return nil
+	})
+	sort.Slice(books, func(i, j int) bool {
+		if !books[i].UpdatedAt.Equal(books[j].UpdatedAt) {
+			return books[i].UpdatedAt.Before(books[j].UpdatedAt)
+		}
+		return books[i].ID.String() < books[j].ID.String()
+	})
+	if len(books) > limit {
+		books = books[:limit]
+	}
+	return books, err
+}
+
+func (r *memoryBookRepository) Search(tx Tx, q *BookQuery, offset, limit int) ([]models.Book, int64, error) {
+	match := func(models.Book) bool { return true }
+	if q != nil {
+		var err error
+		if match, err = compileBookQuery(q); err != nil {
+			return nil, 0, err
+		}
+	}
+	var books []models.Book
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, b := range d.books {
+			if match(b) {
+				books = append(books, b)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(books, func(i, j int) bool {
+		if books[i].Title != books[j].Title {
+			return books[i].Title < books[j].Title
+		}
+		return books[i].ID.String() < books[j].ID.String()
+	})
+	total := int64(len(books))
+	books = books[min(max(offset, 0), len(books)):]
+	return books[:min(max(limit, 0), len(books))], total, nil
+}
+
+// compileBookQuery turns q into a predicate, with the semantics of the
+// LIKE conditions the GORM repository builds.
+func compileBookQuery(q *BookQuery) (func(models.Book) bool, error) {
+	switch q.Op {
+	case QueryAnd, QueryOr:
+		left, err := compileBookQuery(q.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := compileBookQuery(q.Right)
+		if err != nil {
+			return nil, err
+		}
+		if q.Op == QueryAnd {
+			return func(b models.Book) bool { return left(b) && right(b) }, nil
+		}
+		return func(b models.Book) bool { return left(b) || right(b) }, nil
+	case QueryNot:
+		operand, err := compileBookQuery(q.Left)
+		if err != nil {
+			return nil, err
+		}
+		return func(b models.Book) bool { return !operand(b) }, nil
+	case QueryMatch:
+	default:
+		return nil, fmt.Errorf("repositories: unknown book query operator %q", q.Op)
+	}
+
+	var expr strings.Builder
+	expr.WriteString("(?s)^")
+	if !q.Whole {
+		expr.WriteString(".*")
+	}
+	escaped := false
+	for _, r := range strings.ToLower(q.Pattern) {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+			continue
+		case r == '*':
+			expr.WriteString(".*")
+			continue
+		case r == '?':
+			expr.WriteString(".")
+			continue
+		}
+		expr.WriteString(regexp.QuoteMeta(string(r)))
+	}
+	if !q.Whole {
+		expr.WriteString(".*")
+	}
+	expr.WriteString("$")
+	re := regexp.MustCompile(expr.String())
+	matches := func(value string) bool { return re.MatchString(strings.ToLower(value)) }
+
+	switch q.Field {
+	case BookFieldTitle:
+		return func(b models.Book) bool { return matches(b.Title) }, nil
+	case BookFieldAuthor:
+		return func(b models.Book) bool { return matches(b.Author) }, nil
+	case BookFieldISBN:
+		return func(b models.Book) bool {
+			isbn := ""
+			if b.ISBN != nil {
+				isbn = *b.ISBN
+			}
+			return matches(isbn)
+		}, nil
+	case BookFieldSubject:
+		return func(b models.Book) bool { return slices.ContainsFunc(b.Subjects, matches) }, nil
+	}
+	return nil, fmt.Errorf("repositories: unknown book query field %q", q.Field)
+}
+
+func (r *memoryBookRepository) GetByID(tx Tx, id uuid.UUID) (*models.Book, error) {
+	var book models.Book
+	err := r.store.read(tx, func(d *memoryData) error {
+		b, ok := d.books[id]
+		if !ok {
+			return ErrNotFound
+		}
+		book = b
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func (r *memoryBookRepository) IncrementTotalCopies(tx Tx, bookID uuid.UUID, delta int) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		if b, ok := d.books[bookID]; ok {
+			b.TotalCopies += delta
+			d.books[bookID] = b
+		}
+		return nil
+	})
+}
+
+// GetByIDForUpdate is GetByID: memory transactions run one at a time.
+func (r *memoryBookRepository) GetByIDForUpdate(tx Tx, id uuid.UUID) (*models.Book, error) {
+	return r.GetByID(tx, id)
+}
+
+func (r *memoryBookRepository) AdjustAvailability(tx Tx, bookID uuid.UUID, delta Availability) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		b, ok := d.books[bookID]
+		if !ok {
+			return ErrNotFound
+		}
+		b.AvailableCopies += delta.Available
+		b.CheckedOutCopies += delta.CheckedOut
+		b.Holds += delta.Holds
+		d.books[bookID] = b
+		return nil
+	})
+}
+
+func (r *memoryBookRepository) SetAvailability(tx Tx, bookID uuid.UUID, counts Availability) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		if b, ok := d.books[bookID]; ok {
+			b.AvailableCopies = counts.Available
+			b.CheckedOutCopies = counts.CheckedOut
+			b.Holds = counts.Holds
+			d.books[bookID] = b
+		}
+		return nil
+	})
+}
+
+func (r *memoryBookRepository) FindByISBNs(tx Tx, isbns []string) ([]models.Book, error) {
+	var books []models.Book
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, isbn := range isbns {
+			if id, ok := d.isbns[isbn]; ok {
+				if b, ok := d.books[id]; ok {
+					books = append(books, b)
+				} else {
+					books = append(books, d.withdrawn[id])
+				}
+			}
+		}
+		return nil
+	})
+	return books, err
+}
+
+func (r *memoryBookRepository) SetLoanType(tx Tx, bookID uuid.UUID, loanType models.LoanType, loanHours int, until *time.Time) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		if b, ok := d.books[bookID]; ok {
+			if until != nil {
+				u := *until
+				until = &u
+			}
+			b.LoanType = loanType
+			b.LoanHours = loanHours
+			b.LoanTypeUntil = until
+			b.Version++
+			d.books[bookID] = b
+		}
+		return nil
+	})
+}
+
+func (r *memoryBookRepository) UpdateDetails(tx Tx, book *models.Book) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		b, ok := d.books[book.ID]
+		if !ok {
+			return nil
+		}
+		if book.ISBN != nil {
+			if id, exists := d.isbns[*book.ISBN]; exists && id != book.ID {
+				return uniqueViolation("uniq_book_isbn")
+			}
+		}
+		if b.ISBN != nil {
+			delete(d.isbns, *b.ISBN)
+		}
+		b.ISBN = nil
+		if book.ISBN != nil {
+			isbn := *book.ISBN
+			b.ISBN = &isbn
+			d.isbns[isbn] = book.ID
+		}
+		b.Title = book.Title
+		b.Author = book.Author
+		b.Edition = book.Edition
+		b.Publisher = book.Publisher
+		b.Published = book.Published
+		b.Subjects = slices.Clone(book.Subjects)
+		b.UpdatedAt = time.Now().UTC()
+		b.Version++
+		book.UpdatedAt = b.UpdatedAt
+		d.books[book.ID] = b
+		return nil
+	})
+}
+
+func (r *memoryBookRepository) GetAnyForUpdate(tx Tx, id uuid.UUID) (*models.Book, error) {
+	return r.GetAny(tx, id)
+}
+
+func (r *memoryBookRepository) GetAny(tx Tx, id uuid.UUID) (*models.Book, error) {
+	var book models.Book
+	err := r.store.read(tx, func(d *memoryData) error {
+		b, ok := d.books[id]
+		if !ok {
+			if b, ok = d.withdrawn[id]; !ok {
+				return ErrNotFound
+			}
+		}
+		book = b
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func (r *memoryBookRepository) Withdraw(tx Tx, id uuid.UUID, at time.Time) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		if b, ok := d.books[id]; ok {
+			b.DeletedAt = gorm.DeletedAt{Time: at.UTC(), Valid: true}
+			b.UpdatedAt = at.UTC()
+			b.Version++
+			delete(d.books, id)
+			d.withdrawn[id] = b
+		}
+		return nil
+	})
+}
+
+func (r *memoryBookRepository) Restore(tx Tx, id uuid.UUID, at time.Time) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		if b, ok := d.withdrawn[id]; ok {
+			b.DeletedAt = gorm.DeletedAt{}
+			b.UpdatedAt = at.UTC()
+			b.Version++
+			delete(d.withdrawn, id)
+			d.books[id] = b
+		}
+		return nil
+	})
+}
+
+// Delete cascades as the foreign keys do, and refuses, as checkouts'
+// ON DELETE RESTRICT does, while a copy still has checkouts.
+func (r *memoryBookRepository) Delete(tx Tx, id uuid.UUID) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		b, ok := d.books[id]
+		if !ok {
+			if b, ok = d.withdrawn[id]; !ok {
+				return ErrNotFound
+			}
+		}
+		for _, c := range d.checkouts {
+			if d.copies[c.BookCopyID].BookID == id {
+				return fmt.Errorf("repositories: book %s: copy %s has checkouts", id, c.BookCopyID)
+			}
+		}
+		for cid, c := range d.copies {
+			if c.BookID != id {
+				continue
+			}
+			if c.Barcode != nil {
+				delete(d.barcodes, *c.Barcode)
+			}
+			delete(d.copies, cid)
+		}
+		for rid, res := range d.reservations {
+			if res.BookID == id {
+				delete(d.reservations, rid)
+			}
+		}
+		for k := range d.entries {
+			if k.bookID == id {
+				delete(d.entries, k)
+			}
+		}
+		if b.ISBN != nil {
+			delete(d.isbns, *b.ISBN)
+		}
+		delete(d.books, id)
+		delete(d.withdrawn, id)
+		return nil
+	})
+}
+
+// ─── Book Copies ──────────────────────────────────────────────────────────────
+
+type memoryBookCopyRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryBookCopyRepository(store *MemoryStore) BookCopyRepository {
+	return &memoryBookCopyRepository{store: store}
+}
+
+func (r *memoryBookCopyRepository) Create(tx Tx, copy *models.BookCopy) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		ensureID(&copy.ID)
+		if _, exists := d.copies[copy.ID]; exists {
+			return uniqueViolation("book_copies_pkey")
+		}
+		if copy.Version == 0 {
+			copy.Version = 1
+		}
+		stored := *copy
+		if copy.Barcode != nil {
+			if _, exists := d.barcodes[*copy.Barcode]; exists {
+				return uniqueViolation("uniq_copy_barcode")
+			}
+			barcode := *copy.Barcode
+			stored.Barcode = &barcode
+			d.barcodes[barcode] = copy.ID
+		}
+		d.copies[copy.ID] = stored
+		return nil
+	})
+}
+
+// FindAvailableForUpdate returns the available copy with the lowest ID, matching
+// the ORDER BY id of the SQL implementation. Serialised transactions make the
+// row lock implicit.
+func (r *memoryBookCopyRepository) FindAvailableForUpdate(tx Tx, bookID uuid.UUID) (*models.BookCopy, error) {
+	var found *models.BookCopy
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, c := range d.copies {
+			if c.BookID != bookID || c.Status != models.BookCopyStatusAvailable {
+				continue
+			}
+			if found == nil || c.ID.String() < found.ID.String() {
+				c := c
+				found = &c
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+// FindAvailableSkipLocked is FindAvailableForUpdate: with transactions
+// serialised no other transaction can hold a lock to skip.
+func (r *memoryBookCopyRepository) FindAvailableSkipLocked(tx Tx, bookID uuid.UUID) (*models.BookCopy, error) {
+	return r.FindAvailableForUpdate(tx, bookID)
+}
+
+func (r *memoryBookCopyRepository) UpdateStatus(tx Tx, id uuid.UUID, status models.BookCopyStatus) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		if c, ok := d.copies[id]; ok {
+			c.Status = status
+			d.copies[id] = c
+		}
+		return nil
+	})
+}
+
+func (r *memoryBookCopyRepository) GetByID(tx Tx, id uuid.UUID) (*models.BookCopy, error) {
+	var copy models.BookCopy
+	err := r.store.read(tx, func(d *memoryData) error {
+		c, ok := d.copies[id]
+		if !ok {
+			return ErrNotFound
+		}
+		copy = c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &copy, nil
+}
+
+func (r *memoryBookCopyRepository) GetByIDForUpdate(tx Tx, id uuid.UUID) (*models.BookCopy, error) {
+	return r.GetByID(tx, id)
+}
+
+func (r *memoryBookCopyRepository) SetBranch(tx Tx, id uuid.UUID, branchID *uuid.UUID) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		if c, ok := d.copies[id]; ok {
+			if branchID != nil {
+				b := *branchID
+				branchID = &b
+			}
+			c.BranchID = branchID
+			c.Version++
+			d.copies[id] = c
+		}
+		return nil
+	})
+}
+
+func (r *memoryBookCopyRepository) FindByBarcodes(tx Tx, barcodes []string) ([]models.BookCopy, error) {
+	var copies []models.BookCopy
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, barcode := range barcodes {
+			if id, ok := d.barcodes[barcode]; ok {
+				copies = append(copies, d.copies[id])
+			}
+		}
+		return nil
+	})
+	return copies, err
+}
+
+func (r *memoryBookCopyRepository) List(tx Tx) ([]models.BookCopy, error) {
+	var copies []models.BookCopy
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, c := range d.copies {
+			copies = append(copies, c)
+		}
+		return nil
+	})
+	sort.Slice(copies, func(i, j int) bool {
+		if copies[i].BookID != copies[j].BookID {
+			return copies[i].BookID.String() < copies[j].BookID.String()
+		}
+		return copies[i].ID.String() < copies[j].ID.String()
+	})
+	return copies, err
+}
+
+func (r *memoryBookCopyRepository) ListByBooks(tx Tx, bookIDs []uuid.UUID) ([]models.BookCopy, error) {
+	wanted := make(map[uuid.UUID]bool, len(bookIDs))
+	for _, id := range bookIDs {
+		wanted[id] = true
+	}
+	var copies []models.BookCopy
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, c := range d.copies {
+			if wanted[c.BookID] {
+				copies = append(copies, c)
+			}
+		}
+		return nil
+	})
+	sort.Slice(copies, func(i, j int) bool {
+		if copies[i].BookID != copies[j].BookID {
+			return copies[i].BookID.String() < copies[j].BookID.String()
+		}
+		return copies[i].ID.String() < copies[j].ID.String()
+	})
+	return copies, err
+}
+
+// ─── Checkouts ────────────────────────────────────────────────────────────────
+
+type memoryCheckoutRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryCheckoutRepository(store *MemoryStore) CheckoutRepository {
+	return &memoryCheckoutRepository{store: store}
+}
+
+func (r *memoryCheckoutRepository) Create(tx Tx, checkout *models.Checkout) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		ensureID(&checkout.ID)
+		if _, exists := d.checkouts[checkout.ID]; exists {
+			return uniqueViolation("checkouts_pkey")
+		}
+		if checkout.ReturnedAt == nil {
+			for _, c := range d.checkouts {
+				if c.BookCopyID == checkout.BookCopyID && c.ReturnedAt == nil {
+					return uniqueViolation("uniq_active_checkout")
+				}
+			}
+		}
+		if checkout.LoanType == "" {
+			checkout.LoanType = models.LoanTypeStandard
+		}
+		stored := *checkout
+		stored.BookCopy = models.BookCopy{}
+		stored.User = models.User{}
+		d.checkouts[checkout.ID] = stored
+		return nil
+	})
+}
+
+func (r *memoryCheckoutRepository) MarkReturned(tx Tx, checkoutID uuid.UUID, returnedAt time.Time, fineAmount int) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		c, ok := d.checkouts[checkoutID]
+		if !ok || c.ReturnedAt != nil {
+			return nil
+		}
+		c.ReturnedAt = &returnedAt
+		c.FineAmount = fineAmount
+		d.checkouts[checkoutID] = c
+		return nil
+	})
+}
+
+// GetByIDForUpdate returns the checkout with its BookCopy populated, like the
+// Preload("BookCopy") of the SQL implementation.
+func (r *memoryCheckoutRepository) GetByIDForUpdate(tx Tx, id uuid.UUID) (*models.Checkout, error) {
+	var checkout models.Checkout
+	err := r.store.read(tx, func(d *memoryData) error {
+		c, ok := d.checkouts[id]
+		if !ok {
+			return ErrNotFound
+		}
+		c.BookCopy = d.copies[c.BookCopyID]
+		checkout = c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &checkout, nil
+}
+
+func (r *memoryCheckoutRepository) GetActiveByCopy(tx Tx, copyID uuid.UUID) (*models.Checkout, error) {
+	var checkout *models.Checkout
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, c := range d.checkouts {
+			if c.BookCopyID == copyID && c.ReturnedAt == nil {
+				c.BookCopy = d.copies[c.BookCopyID]
+				checkout = &c
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return checkout, nil
+}
+
+func (r *memoryCheckoutRepository) ListByUser(tx Tx, userID uuid.UUID) ([]models.Checkout, error) {
+	return r.filter(tx, func(c models.Checkout) bool { return c.UserID == userID }, func(a, b models.Checkout) bool {
+		return a.CheckoutAt.Before(b.CheckoutAt)
+	})
+}
+
+func (r *memoryCheckoutRepository) ListByBook(tx Tx, bookID uuid.UUID) ([]models.Checkout, error) {
+	var out []models.Checkout
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, c := range d.checkouts {
+			if copy := d.copies[c.BookCopyID]; copy.BookID == bookID {
+				c.BookCopy = copy
+				out = append(out, c)
+			}
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CheckoutAt.Equal(out[j].CheckoutAt) {
+			return out[i].CheckoutAt.Before(out[j].CheckoutAt)
+		}
+		return out[i].ID.String() < out[j].ID.String()
+	})
+	return out, err
+}
+
+func (r *memoryCheckoutRepository) ListOverdue(tx Tx, now time.Time) ([]models.Checkout, error) {
+	return r.filter(tx, func(c models.Checkout) bool {
+		return c.ReturnedAt == nil && c.DueDate.Before(now)
+	}, func(a, b models.Checkout) bool {
+		return a.DueDate.Before(b.DueDate)
+	})
+}
+
+func (r *memoryCheckoutRepository) ListReturned(tx Tx, filter ReturnedFilter, after uuid.UUID, limit int) ([]models.Checkout, error) {
+	out, err := r.filter(tx, func(c models.Checkout) bool {
+		switch {
+		case c.ReturnedAt == nil || c.ID.String() <= after.String():
+			return false
+		case filter.CheckoutID != nil && c.ID != *filter.CheckoutID:
+			return false
+		case filter.UserID != nil && c.UserID != *filter.UserID:
+			return false
+		case filter.Since != nil && c.ReturnedAt.Before(*filter.Since):
+			return false
+		}
+		return true
+	}, func(a, b models.Checkout) bool {
+		return a.ID.String() < b.ID.String()
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, err
+}
+
+// ListActive populates User and BookCopy.Book, like the preloads of the SQL
+// implementation.
+func (r *memoryCheckoutRepository) ListActive(tx Tx) ([]models.Checkout, error) {
+	var out []models.Checkout
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, c := range d.checkouts {
+			if c.ReturnedAt != nil {
+				continue
+			}
+			c.User = d.users[c.UserID]
+			c.BookCopy = d.copies[c.BookCopyID]
+			c.BookCopy.Book = d.books[c.BookCopy.BookID]
+			out = append(out, c)
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].DueDate.Before(out[j].DueDate) })
+	return out, err
+}
+
+func (r *memoryCheckoutRepository) Renew(tx Tx, checkoutID uuid.UUID, dueDate time.Time, loanType models.LoanType) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		if c, ok := d.checkouts[checkoutID]; ok {
+			c.DueDate = dueDate
+			c.LoanType = loanType
+			c.Renewals++
+			d.checkouts[checkoutID] = c
+		}
+		return nil
+	})
+}
+
+func (r *memoryCheckoutRepository) UpdateFine(tx Tx, checkoutID uuid.UUID, fineAmount int) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		if c, ok := d.checkouts[checkoutID]; ok {
+			c.FineAmount = fineAmount
+			d.checkouts[checkoutID] = c
+		}
+		return nil
+	})
+}
+
+func (r *memoryCheckoutRepository) DeleteByBook(tx Tx, bookID uuid.UUID) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		for id, c := range d.checkouts {
+			if d.copies[c.BookCopyID].BookID == bookID {
+				delete(d.checkouts, id)
+			}
+		}
+		return nil
+	})
+}
+
+// filter returns the matching checkouts with BookCopy populated. The SQL
+// implementation only preloads it for the overdue and returned lists, but the
+// field is never serialised, so filling it in everywhere is harmless.
+func (r *memoryCheckoutRepository) filter(tx Tx, keep func(models.Checkout) bool, less func(a, b models.Checkout) bool) ([]models.Checkout, error) {
+	var out []models.Checkout
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, c := range d.checkouts {
+			if keep(c) {
+				c.BookCopy = d.copies[c.BookCopyID]
+				out = append(out, c)
+			}
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return less(out[i], out[j]) })
+	return out, err
+}
+
+// ─── Reservations ─────────────────────────────────────────────────────────────
+
+type memoryReservationRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryReservationRepository(store *MemoryStore) ReservationRepository {
+	return &memoryReservationRepository{store: store}
+}
+
+func (r *memoryReservationRepository) Create(tx Tx, reservation *models.Reservation) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		ensureID(&reservation.ID)
+		if _, exists := d.reservations[reservation.ID]; exists {
+			return uniqueViolation("reservations_pkey")
+		}
+		for _, res := range d.reservations {
+			if res.BookID != reservation.BookID {
+				continue
+			}
+			if res.UserID == reservation.UserID {
+				return uniqueViolation("uniq_user_book_reservation")
+			}
+			if res.QueuePosition == reservation.QueuePosition {
+				return uniqueViolation("uniq_book_queue_position")
+			}
+		}
+		if reservation.CreatedAt.IsZero() {
+			reservation.CreatedAt = time.Now().UTC()
+		}
+		stored := *reservation
+		stored.Book = models.Book{}
+		stored.User = models.User{}
+		d.reservations[reservation.ID] = stored
+		return nil
+	})
+}
+
+func (r *memoryReservationRepository) GetNextForBook(tx Tx, bookID uuid.UUID) (*models.Reservation, error) {
+	queue, err := r.ListByBook(tx, bookID)
+	if err != nil {
+		return nil, err
+	}
+	if len(queue) == 0 {
+		return nil, ErrNotFound
+	}
+	return &queue[0], nil
+}
+
+func (r *memoryReservationRepository) GetByBookAndUser(tx Tx, bookID, userID uuid.UUID) (*models.Reservation, error) {
+	var found *models.Reservation
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, res := range d.reservations {
+			if res.BookID == bookID && res.UserID == userID {
+				res := res
+				found = &res
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func (r *memoryReservationRepository) GetByID(tx Tx, id uuid.UUID) (*models.Reservation, error) {
+	var found models.Reservation
+	err := r.store.read(tx, func(d *memoryData) error {
+		res, ok := d.reservations[id]
+		if !ok {
+			return ErrNotFound
+		}
+		found = res
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
+
+func (r *memoryReservationRepository) Delete(tx Tx, id uuid.UUID) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		delete(d.reservations, id)
+		return nil
+	})
+}
+
+func (r *memoryReservationRepository) GetNextQueuePosition(tx Tx, bookID uuid.UUID) (int, error) {
+	maxPos := 0
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, res := range d.reservations {
+			if res.BookID == bookID && res.QueuePosition > maxPos {
+				maxPos = res.QueuePosition
+			}
+		}
+		return nil
+	})
+	return maxPos + 1, err
+}
+
+func (r *memoryReservationRepository) List(tx Tx) ([]models.Reservation, error) {
+	var out []models.Reservation
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, res := range d.reservations {
+			out = append(out, res)
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].BookID != out[j].BookID {
+			return out[i].BookID.String() < out[j].BookID.String()
+		}
+		return out[i].QueuePosition < out[j].QueuePosition
+	})
+	return out, err
+}
+
+func (r *memoryReservationRepository) ListByUser(tx Tx, userID uuid.UUID) ([]models.Reservation, error) {
+	var out []models.Reservation
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, res := range d.reservations {
+			if res.UserID == userID {
+				out = append(out, res)
+			}
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID.String() < out[j].ID.String()
+	})
+	return out, err
+}
+
+func (r *memoryReservationRepository) Dequeue(tx Tx, id uuid.UUID) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		res, ok := d.reservations[id]
+		if !ok {
+			return ErrNotFound
+		}
+		delete(d.reservations, id)
+		return compactQueue(d.queue(res.BookID), d.moveInQueue)
+	})
+}
+
+func (r *memoryReservationRepository) CompactQueue(tx Tx, bookID uuid.UUID) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		return compactQueue(d.queue(bookID), d.moveInQueue)
+	})
+}
+
+// ListByBook returns the queue ordered by queue_position, then created_at.
+func (r *memoryReservationRepository) ListByBook(tx Tx, bookID uuid.UUID) ([]models.Reservation, error) {
+	var out []models.Reservation
+	err := r.store.read(tx, func(d *memoryData) error {
+		out = d.queue(bookID)
+		return nil
+	})
+	return out, err
+}
+
+func (r *memoryReservationRepository) CountByBooks(tx Tx, bookIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	wanted := make(map[uuid.UUID]bool, len(bookIDs))
+	for _, id := range bookIDs {
+		wanted[id] = true
+	}
+	counts := map[uuid.UUID]int{}
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, res := range d.reservations {
+			if wanted[res.BookID] {
+				counts[res.BookID]++
+			}
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// queue returns a book's reservations ordered by queue_position, then
+// created_at.
+func (d *memoryData) queue(bookID uuid.UUID) []models.Reservation {
+	var out []models.Reservation
+	for _, res := range d.reservations {
+		if res.BookID == bookID {
+			out = append(out, res)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].QueuePosition != out[j].QueuePosition {
+			return out[i].QueuePosition < out[j].QueuePosition
+		}
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out
+}
+
+func (d *memoryData) moveInQueue(id uuid.UUID, position int) error {
+	res := d.reservations[id]
+	res.QueuePosition = position
+	d.reservations[id] = res
+	return nil
+}
+
+// ─── Branches ─────────────────────────────────────────────────────────────────
+
+type memoryBranchRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryBranchRepository(store *MemoryStore) BranchRepository {
+	return &memoryBranchRepository{store: store}
+}
+
+func (r *memoryBranchRepository) Create(tx Tx, branch *models.Branch) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		ensureID(&branch.ID)
+		if _, exists := d.branches[branch.ID]; exists {
+			return uniqueViolation("branches_pkey")
+		}
+		if branch.Timezone == "" {
+			branch.Timezone = "UTC"
+		}
+		d.branches[branch.ID] = *branch
+		return nil
+	})
+}
+
+func (r *memoryBranchRepository) GetByID(tx Tx, id uuid.UUID) (*models.Branch, error) {
+	var branch models.Branch
+	err := r.store.read(tx, func(d *memoryData) error {
+		b, ok := d.branches[id]
+		if !ok {
+			return ErrNotFound
+		}
+		branch = b
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &branch, nil
+}
+
+func (r *memoryBranchRepository) List(tx Tx) ([]models.Branch, error) {
+	var branches []models.Branch
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, b := range d.branches {
+			branches = append(branches, b)
+		}
+		return nil
+	})
+	sort.Slice(branches, func(i, j int) bool {
+		if branches[i].Name != branches[j].Name {
+			return branches[i].Name < branches[j].Name
+		}
+		return branches[i].ID.String() < branches[j].ID.String()
+	})
+	return branches, err
+}
+
+func (r *memoryBranchRepository) ListOpeningHours(tx Tx, branchID uuid.UUID) ([]models.OpeningHours, error) {
+	var hours []models.OpeningHours
+	err := r.store.read(tx, func(d *memoryData) error {
+		for k, h := range d.hours {
+			if k.branchID == branchID {
+				hours = append(hours, h)
+			}
+		}
+		return nil
+	})
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Weekday < hours[j].Weekday })
+	return hours, err
+}
+
+func (r *memoryBranchRepository) ReplaceOpeningHours(tx Tx, branchID uuid.UUID, hours []models.OpeningHours) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		seen := map[int]bool{}
+		for _, h := range hours {
+			if seen[h.Weekday] {
+				return uniqueViolation("opening_hours_pkey")
+			}
+			seen[h.Weekday] = true
+		}
+		for k := range d.hours {
+			if k.branchID == branchID {
+				delete(d.hours, k)
+			}
+		}
+		for _, h := range hours {
+			d.hours[hoursKey{branchID: h.BranchID, weekday: h.Weekday}] = h
+		}
+		return nil
+	})
+}
+
+func (r *memoryBranchRepository) ListClosures(tx Tx, branchID uuid.UUID, from, to time.Time) ([]models.Closure, error) {
+	var closures []models.Closure
+	err := r.store.read(tx, func(d *memoryData) error {
+		for k, c := range d.closures {
+			if k.branchID == branchID && !c.Date.Before(from) && !c.Date.After(to) {
+				closures = append(closures, c)
+			}
+		}
+		return nil
+	})
+	sort.Slice(closures, func(i, j int) bool { return closures[i].Date.Before(closures[j].Date) })
+	return closures, err
+}
+
+func (r *memoryBranchRepository) AddClosures(tx Tx, closures []models.Closure) (int, error) {
+	added := 0
+	err := r.store.write(tx, func(d *memoryData) error {
+		for _, c := range closures {
+			key := newClosureKey(c.BranchID, c.Date)
+			if _, exists := d.closures[key]; exists {
+				continue
+			}
+			d.closures[key] = c
+			added++
+		}
+		return nil
+	})
+	return added, err
+}
+
+func (r *memoryBranchRepository) DeleteClosure(tx Tx, branchID uuid.UUID, date time.Time) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		key := newClosureKey(branchID, date)
+		if _, ok := d.closures[key]; !ok {
+			return ErrNotFound
+		}
+		delete(d.closures, key)
+		return nil
+	})
+}
+
+// ─── Terms ────────────────────────────────────────────────────────────────────
+
+type memoryTermRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryTermRepository(store *MemoryStore) TermRepository {
+	return &memoryTermRepository{store: store}
+}
+
+func (r *memoryTermRepository) Create(tx Tx, term *models.Term) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		ensureID(&term.ID)
+		if _, exists := d.terms[term.ID]; exists {
+			return uniqueViolation("terms_pkey")
+		}
+		d.terms[term.ID] = *term
+		return nil
+	})
+}
+
+func (r *memoryTermRepository) GetByID(tx Tx, id uuid.UUID) (*models.Term, error) {
+	var term models.Term
+	err := r.store.read(tx, func(d *memoryData) error {
+		t, ok := d.terms[id]
+		if !ok {
+			return ErrNotFound
+		}
+		term = t
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &term, nil
+}
+
+func (r *memoryTermRepository) List(tx Tx) ([]models.Term, error) {
+	var terms []models.Term
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, t := range d.terms {
+			terms = append(terms, t)
+		}
+		return nil
+	})
+	sortTerms(terms)
+	return terms, err
+}
+
+func (r *memoryTermRepository) Update(tx Tx, term *models.Term) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		if _, ok := d.terms[term.ID]; !ok {
+			return ErrNotFound
+		}
+		d.terms[term.ID] = *term
+		return nil
+	})
+}
+
+func (r *memoryTermRepository) Delete(tx Tx, id uuid.UUID) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		if _, ok := d.terms[id]; !ok {
+			return ErrNotFound
+		}
+		delete(d.terms, id)
+		// courses.term_id is ON DELETE SET NULL.
+		for cid, c := range d.courses {
+			if c.TermID != nil && *c.TermID == id {
+				c.TermID = nil
+				d.courses[cid] = c
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoryTermRepository) FindByDate(tx Tx, date time.Time) (*models.Term, error) {
+	var matches []models.Term
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, t := range d.terms {
+			if !t.StartDate.After(date) && !t.EndDate.Before(date) {
+				matches = append(matches, t)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, ErrNotFound
+	}
+	sortTerms(matches)
+	return &matches[0], nil
+}
+
+func sortTerms(terms []models.Term) {
+	sort.Slice(terms, func(i, j int) bool {
+		if !terms[i].StartDate.Equal(terms[j].StartDate) {
+			return terms[i].StartDate.Before(terms[j].StartDate)
+		}
+		return terms[i].ID.String() < terms[j].ID.String()
+	})
+}
+
+// ─── Courses ──────────────────────────────────────────────────────────────────
+
+type memoryCourseRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryCourseRepository(store *MemoryStore) CourseRepository {
+	return &memoryCourseRepository{store: store}
+}
+
+func (r *memoryCourseRepository) Create(tx Tx, course *models.Course) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		ensureID(&course.ID)
+		if _, exists := d.courses[course.ID]; exists {
+			return uniqueViolation("courses_pkey")
+		}
+		for _, c := range d.courses {
+			if c.Code == course.Code {
+				return uniqueViolation("uniq_course_code")
+			}
+		}
+		d.courses[course.ID] = *course
+		return nil
+	})
+}
+
+func (r *memoryCourseRepository) GetByID(tx Tx, id uuid.UUID) (*models.Course, error) {
+	var course models.Course
+	err := r.store.read(tx, func(d *memoryData) error {
+		c, ok := d.courses[id]
+		if !ok {
+			return ErrNotFound
+		}
+		course = c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &course, nil
+}
+
+func (r *memoryCourseRepository) List(tx Tx) ([]models.Course, error) {
+	var courses []models.Course
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, c := range d.courses {
+			courses = append(courses, c)
+		}
+		return nil
+	})
+	sort.Slice(courses, func(i, j int) bool { return courses[i].Code < courses[j].Code })
+	return courses, err
+}
+
+// Delete cascades to the course's reading lists and their entries, like the
+// foreign keys in migrations/0005_courses.sql.
+func (r *memoryCourseRepository) Delete(tx Tx, id uuid.UUID) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		if _, ok := d.courses[id]; !ok {
+			return ErrNotFound
+		}
+		delete(d.courses, id)
+		for lid, l := range d.readingLists {
+			if l.CourseID == id {
+				deleteReadingList(d, lid)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoryCourseRepository) CreateReadingList(tx Tx, list *models.ReadingList) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		ensureID(&list.ID)
+		if _, exists := d.readingLists[list.ID]; exists {
+			return uniqueViolation("reading_lists_pkey")
+		}
+		stored := *list
+		stored.Course = models.Course{}
+		d.readingLists[list.ID] = stored
+		return nil
+	})
+}
+
+func (r *memoryCourseRepository) GetReadingList(tx Tx, id uuid.UUID) (*models.ReadingList, error) {
+	var list models.ReadingList
+	err := r.store.read(tx, func(d *memoryData) error {
+		l, ok := d.readingLists[id]
+		if !ok {
+			return ErrNotFound
+		}
+		list = l
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (r *memoryCourseRepository) ListReadingLists(tx Tx, courseID uuid.UUID) ([]models.ReadingList, error) {
+	var lists []models.ReadingList
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, l := range d.readingLists {
+			if l.CourseID == courseID {
+				lists = append(lists, l)
+			}
+		}
+		return nil
+	})
+	sort.Slice(lists, func(i, j int) bool {
+		if lists[i].Title != lists[j].Title {
+			return lists[i].Title < lists[j].Title
+		}
+		return lists[i].ID.String() < lists[j].ID.String()
+	})
+	return lists, err
+}
+
+func (r *memoryCourseRepository) DeleteReadingList(tx Tx, id uuid.UUID) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		if _, ok := d.readingLists[id]; !ok {
+			return ErrNotFound
+		}
+		deleteReadingList(d, id)
+		return nil
+	})
+}
+
+func deleteReadingList(d *memoryData, id uuid.UUID) {
+	delete(d.readingLists, id)
+	for k := range d.entries {
+		if k.listID == id {
+			delete(d.entries, k)
+		}
+	}
+}
+
+func (r *memoryCourseRepository) ListEntries(tx Tx, listID uuid.UUID) ([]models.ReadingListEntry, error) {
+	var entries []models.ReadingListEntry
+	err := r.store.read(tx, func(d *memoryData) error {
+		for k, e := range d.entries {
+			if k.listID != listID {
+				continue
+			}
+			b, ok := d.books[e.BookID]
+			if !ok {
+				continue
+			}
+			e.Book = b
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Position < entries[j].Position })
+	return entries, err
+}
+
+// ReplaceEntries enforces the primary key and uniq_reading_list_position
+// before touching the stored entries.
+func (r *memoryCourseRepository) ReplaceEntries(tx Tx, listID uuid.UUID, entries []models.ReadingListEntry) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		books := map[uuid.UUID]bool{}
+		positions := map[int]bool{}
+		for _, e := range entries {
+			if books[e.BookID] {
+				return uniqueViolation("reading_list_entries_pkey")
+			}
+			if positions[e.Position] {
+				return uniqueViolation("uniq_reading_list_position")
+			}
+			books[e.BookID] = true
+			positions[e.Position] = true
+		}
+		for k := range d.entries {
+			if k.listID == listID {
+				delete(d.entries, k)
+			}
+		}
+		for _, e := range entries {
+			e.ReadingListID = listID
+			e.Book = models.Book{}
+			d.entries[entryKey{listID: listID, bookID: e.BookID}] = e
+		}
+		return nil
+	})
+}
+
+// ─── Payments ─────────────────────────────────────────────────────────────────
+
+type memoryPaymentRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryPaymentRepository(store *MemoryStore) PaymentRepository {
+	return &memoryPaymentRepository{store: store}
+}
+
+func (r *memoryPaymentRepository) Create(tx Tx, payment *models.Payment) error {
+	return r.store.write(tx, func(d *memoryData) error {
+		ensureID(&payment.ID)
+		if _, exists := d.payments[payment.ID]; exists {
+			return uniqueViolation("payments_pkey")
+		}
+		stored := *payment
+		stored.User = models.User{}
+		d.payments[payment.ID] = stored
+		return nil
+	})
+}
+
+func (r *memoryPaymentRepository) ListByUser(tx Tx, userID uuid.UUID) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, p := range d.payments {
+			if p.UserID == userID {
+				payments = append(payments, p)
+			}
+		}
+		return nil
+	})
+	sort.Slice(payments, func(i, j int) bool {
+		if !payments[i].PaidAt.Equal(payments[j].PaidAt) {
+			return payments[i].PaidAt.Before(payments[j].PaidAt)
+		}
+		return payments[i].ID.String() < payments[j].ID.String()
+	})
+	return payments, err
+}
+
+func (r *memoryPaymentRepository) LastPaidAt(tx Tx, userIDs []uuid.UUID) (map[uuid.UUID]time.Time, error) {
+	wanted := make(map[uuid.UUID]bool, len(userIDs))
+	for _, id := range userIDs {
+		wanted[id] = true
+	}
+	last := map[uuid.UUID]time.Time{}
+	err := r.store.read(tx, func(d *memoryData) error {
+		for _, p := range d.payments {
+			if wanted[p.UserID] && p.PaidAt.After(last[p.UserID]) {
+				last[p.UserID] = p.PaidAt
+			}
+		}
+		return nil
+	})
+	return last, err
+}
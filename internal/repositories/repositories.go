@@ -1,6 +1,10 @@
 package repositories
 
 import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,36 +15,264 @@ import (
 )
 
 type UserRepository interface {
-	GetByID(db *gorm.DB, id uuid.UUID) (*models.User, error)
+	Create(tx Tx, user *models.User) error
+	GetByID(tx Tx, id uuid.UUID) (*models.User, error)
+	// GetByIDForUpdate is GetByID with the row locked until the transaction ends.
+	GetByIDForUpdate(tx Tx, id uuid.UUID) (*models.User, error)
+	List(tx Tx) ([]models.User, error)
 }
 
 type BookRepository interface {
-	Create(db *gorm.DB, book *models.Book) error
-	List(db *gorm.DB) ([]models.Book, error)
-	GetByID(db *gorm.DB, id uuid.UUID) (*models.Book, error)
-	IncrementTotalCopies(db *gorm.DB, bookID uuid.UUID, delta int) error
+	Create(tx Tx, book *models.Book) error
+	List(tx Tx) ([]models.Book, error)
+	GetByID(tx Tx, id uuid.UUID) (*models.Book, error)
+	IncrementTotalCopies(tx Tx, bookID uuid.UUID, delta int) error
+	// GetByIDForUpdate is GetByID with the row locked until the transaction ends.
+	GetByIDForUpdate(tx Tx, id uuid.UUID) (*models.Book, error)
+	// AdjustAvailability adds delta to a book's AvailableCopies,
+	// CheckedOutCopies and Holds in one atomic update, so concurrent
+	// adjustments never lose each other. It returns ErrNotFound for a
+	// withdrawn book: a checkout or reservation racing the withdrawal waits
+	// here for its row lock and then finds the book gone.
+	AdjustAvailability(tx Tx, bookID uuid.UUID, delta Availability) error
+	// SetAvailability overwrites a book's counts. Lock the book with
+	// GetByIDForUpdate before counting what to set.
+	SetAvailability(tx Tx, bookID uuid.UUID, counts Availability) error
+	// FindByISBNs returns the books with any of the given ISBNs, withdrawn
+	// ones included: a withdrawn book keeps its ISBN.
+	FindByISBNs(tx Tx, isbns []string) ([]models.Book, error)
+	// SetLoanType sets a book's loan type, its hours and the last day it
+	// applies (nil = indefinitely), and increments the book's version.
+	SetLoanType(tx Tx, bookID uuid.UUID, loanType models.LoanType, loanHours int, until *time.Time) error
+	// UpdateDetails writes a book's descriptive fields, Title, Author, ISBN,
+	// Edition, Publisher, Published and Subjects, stamps UpdatedAt and
+	// increments the book's version.
+	UpdateDetails(tx Tx, book *models.Book) error
+	// GetAny and GetAnyForUpdate are GetByID and GetByIDForUpdate that also
+	// find a withdrawn book, whose DeletedAt is then set. Every other read
+	// but ListChanged skips withdrawn books.
+	GetAny(tx Tx, id uuid.UUID) (*models.Book, error)
+	GetAnyForUpdate(tx Tx, id uuid.UUID) (*models.Book, error)
+	// Withdraw soft-deletes a book as of at and Restore undoes it; both stamp
+	// UpdatedAt with at, so that harvesters see the change, and increment the
+	// book's version. Copies, checkouts and reading list entries are left in
+	// place.
+	Withdraw(tx Tx, id uuid.UUID, at time.Time) error
+	Restore(tx Tx, id uuid.UUID, at time.Time) error
+	// Delete removes a book, withdrawn or not, together with its copies,
+	// reservations and reading list entries. Checkouts of its copies must be
+	// deleted first. ErrNotFound if there is no such book.
+	Delete(tx Tx, id uuid.UUID) error
+	// EachWithCopies calls fn for every book in title order, with its copies
+	// in ID order. Books are read from one query as fn consumes them, so the
+	// catalogue is never held in memory; fn must not use the repositories,
+	// and an error from fn stops the iteration and is returned.
+	EachWithCopies(tx Tx, fn func(book models.Book, copies []models.BookCopy) error) error
+	// ListChanged returns up to limit books with from <= UpdatedAt < until,
+	// in order of UpdatedAt then ID, starting after the cursor, withdrawn
+	// ones included with DeletedAt set. Nil bounds and a nil cursor are
+	// unbounded.
+	ListChanged(tx Tx, from, until *time.Time, after *BookCursor, limit int) ([]models.Book, error)
+	// Search returns the books matching q in order of title then ID, skipping
+	// offset of them and returning at most limit, together with the number
+	// of books that match in all. A nil query matches every book.
+	Search(tx Tx, q *BookQuery, offset, limit int) ([]models.Book, int64, error)
 }
 
+// Availability is a book's materialised circulation counts, or a change to
+// them.
+type Availability struct {
+	Available  int
+	CheckedOut int
+	Holds      int
+}
+
+// BookCursor is a position in ListChanged order: the UpdatedAt and ID of the
+// last book returned.
+type BookCursor struct {
+	UpdatedAt time.Time
+	ID        uuid.UUID
+}
+
+// BookQuery is a boolean search over the catalogue. A match node compares one
+// field with Pattern, case-insensitively; and, or and not nodes combine their
+// operands, not taking Left only.
+type BookQuery struct {
+	Op          BookQueryOp
+	Left, Right *BookQuery
+
+	Field BookField
+	// Pattern is the text to look for, in which "*" stands for any run of
+	// characters, "?" for any one character and a backslash makes the next
+	// character literal.
+	Pattern string
+	// Whole requires Pattern to match the whole value (of one subject, for
+	// BookFieldSubject) rather than any part of it.
+	Whole bool
+}
+
+type BookQueryOp string
+
+const (
+	QueryMatch BookQueryOp = "match"
+	QueryAnd   BookQueryOp = "and"
+	QueryOr    BookQueryOp = "or"
+	QueryNot   BookQueryOp = "not"
+)
+
+type BookField string
+
+const (
+	BookFieldTitle   BookField = "title"
+	BookFieldAuthor  BookField = "author"
+	BookFieldISBN    BookField = "isbn"
+	BookFieldSubject BookField = "subject"
+)
+
 type BookCopyRepository interface {
-	Create(db *gorm.DB, copy *models.BookCopy) error
-	FindAvailableForUpdate(db *gorm.DB, bookID uuid.UUID) (*models.BookCopy, error)
-	UpdateStatus(db *gorm.DB, id uuid.UUID, status models.BookCopyStatus) error
+	Create(tx Tx, copy *models.BookCopy) error
+	FindAvailableForUpdate(tx Tx, bookID uuid.UUID) (*models.BookCopy, error)
+	// FindAvailableSkipLocked is FindAvailableForUpdate without the wait: copies
+	// other transactions have locked are passed over, so ErrNotFound means no
+	// copy was both available and unlocked, not that none is available.
+	FindAvailableSkipLocked(tx Tx, bookID uuid.UUID) (*models.BookCopy, error)
+	UpdateStatus(tx Tx, id uuid.UUID, status models.BookCopyStatus) error
+	GetByID(tx Tx, id uuid.UUID) (*models.BookCopy, error)
+	// GetByIDForUpdate is GetByID with the row locked until the transaction ends.
+	GetByIDForUpdate(tx Tx, id uuid.UUID) (*models.BookCopy, error)
+	// SetBranch moves a copy to a branch (nil = none) and increments its
+	// version.
+	SetBranch(tx Tx, id uuid.UUID, branchID *uuid.UUID) error
+	// FindByBarcodes returns the copies with any of the given barcodes.
+	FindByBarcodes(tx Tx, barcodes []string) ([]models.BookCopy, error)
+	// ListByBooks returns every copy of the given books.
+	ListByBooks(tx Tx, bookIDs []uuid.UUID) ([]models.BookCopy, error)
+	// List returns every copy, ordered by book then ID.
+	List(tx Tx) ([]models.BookCopy, error)
 }
 
 type CheckoutRepository interface {
-	Create(db *gorm.DB, checkout *models.Checkout) error
-	MarkReturned(db *gorm.DB, checkoutID uuid.UUID, returnedAt time.Time, fineAmount int) error
-	GetByIDForUpdate(db *gorm.DB, id uuid.UUID) (*models.Checkout, error)
-	ListByUser(db *gorm.DB, userID uuid.UUID) ([]models.Checkout, error)
+	Create(tx Tx, checkout *models.Checkout) error
+	MarkReturned(tx Tx, checkoutID uuid.UUID, returnedAt time.Time, fineAmount int) error
+	GetByIDForUpdate(tx Tx, id uuid.UUID) (*models.Checkout, error)
+	// GetActiveByCopy returns the copy's checkout that has not been returned,
+	// locked and with BookCopy populated.
+	GetActiveByCopy(tx Tx, copyID uuid.UUID) (*models.Checkout, error)
+	ListByUser(tx Tx, userID uuid.UUID) ([]models.Checkout, error)
+	// ListByBook returns every checkout of the book's copies, active and
+	// returned, oldest first, with BookCopy populated.
+	ListByBook(tx Tx, bookID uuid.UUID) ([]models.Checkout, error)
+	ListOverdue(tx Tx, now time.Time) ([]models.Checkout, error)
+	// ListReturned returns up to limit returned checkouts matching filter
+	// whose ID sorts after after (uuid.Nil for the first page), in ID order,
+	// with BookCopy populated.
+	ListReturned(tx Tx, filter ReturnedFilter, after uuid.UUID, limit int) ([]models.Checkout, error)
+	// ListActive returns every checkout not yet returned, oldest due date
+	// first, with User and BookCopy.Book populated.
+	ListActive(tx Tx) ([]models.Checkout, error)
+	// Renew sets a new due date and loan type and increments the renewal count.
+	Renew(tx Tx, checkoutID uuid.UUID, dueDate time.Time, loanType models.LoanType) error
+	UpdateFine(tx Tx, checkoutID uuid.UUID, fineAmount int) error
+	// DeleteByBook deletes every checkout of the book's copies, so that the
+	// book can be deleted.
+	DeleteByBook(tx Tx, bookID uuid.UUID) error
+}
+
+// ReturnedFilter narrows ListReturned; unset fields match every checkout.
+type ReturnedFilter struct {
+	CheckoutID *uuid.UUID
+	UserID     *uuid.UUID
+	// Since keeps the checkouts returned at or after it.
+	Since *time.Time
 }
 
 type ReservationRepository interface {
-	Create(db *gorm.DB, reservation *models.Reservation) error
-	GetNextForBook(db *gorm.DB, bookID uuid.UUID) (*models.Reservation, error)
-	GetByBookAndUser(db *gorm.DB, bookID, userID uuid.UUID) (*models.Reservation, error)
-	Delete(db *gorm.DB, id uuid.UUID) error
-	GetNextQueuePosition(db *gorm.DB, bookID uuid.UUID) (int, error)
-	ListByBook(db *gorm.DB, bookID uuid.UUID) ([]models.Reservation, error)
+	Create(tx Tx, reservation *models.Reservation) error
+	GetNextForBook(tx Tx, bookID uuid.UUID) (*models.Reservation, error)
+	GetByBookAndUser(tx Tx, bookID, userID uuid.UUID) (*models.Reservation, error)
+	GetByID(tx Tx, id uuid.UUID) (*models.Reservation, error)
+	Delete(tx Tx, id uuid.UUID) error
+	// Dequeue deletes a reservation that has been fulfilled or cancelled and
+	// moves everyone behind it up one place. The whole queue is locked first,
+	// in queue order, so concurrent dequeues from one book wait for each
+	// other rather than deadlock.
+	Dequeue(tx Tx, id uuid.UUID) error
+	GetNextQueuePosition(tx Tx, bookID uuid.UUID) (int, error)
+	ListByBook(tx Tx, bookID uuid.UUID) ([]models.Reservation, error)
+	// CountByBooks returns the length of each book's queue; books with no
+	// reservations are left out.
+	CountByBooks(tx Tx, bookIDs []uuid.UUID) (map[uuid.UUID]int, error)
+	// ListByUser returns a user's reservations, oldest first.
+	ListByUser(tx Tx, userID uuid.UUID) ([]models.Reservation, error)
+	// List returns every reservation, ordered by book then queue position.
+	List(tx Tx) ([]models.Reservation, error)
+	// CompactQueue locks a book's queue and renumbers it 1…n, keeping its
+	// order, so that queue_position is each reservation's place in line.
+	CompactQueue(tx Tx, bookID uuid.UUID) error
+}
+
+// BranchRepository stores branches together with their weekly opening hours
+// and closure dates.
+type BranchRepository interface {
+	Create(tx Tx, branch *models.Branch) error
+	GetByID(tx Tx, id uuid.UUID) (*models.Branch, error)
+	List(tx Tx) ([]models.Branch, error)
+
+	ListOpeningHours(tx Tx, branchID uuid.UUID) ([]models.OpeningHours, error)
+	// ReplaceOpeningHours replaces the whole weekly schedule of a branch.
+	ReplaceOpeningHours(tx Tx, branchID uuid.UUID, hours []models.OpeningHours) error
+
+	// ListClosures returns closures dated from..to inclusive, ordered by date.
+	ListClosures(tx Tx, branchID uuid.UUID, from, to time.Time) ([]models.Closure, error)
+	// AddClosures inserts closures, skipping dates the branch already has, and
+	// returns the number inserted.
+	AddClosures(tx Tx, closures []models.Closure) (int, error)
+	DeleteClosure(tx Tx, branchID uuid.UUID, date time.Time) error
+}
+
+// TermRepository stores academic terms.
+type TermRepository interface {
+	Create(tx Tx, term *models.Term) error
+	GetByID(tx Tx, id uuid.UUID) (*models.Term, error)
+	// List returns all terms ordered by start date.
+	List(tx Tx) ([]models.Term, error)
+	Update(tx Tx, term *models.Term) error
+	Delete(tx Tx, id uuid.UUID) error
+	// FindByDate returns the term whose start..end range contains date.
+	FindByDate(tx Tx, date time.Time) (*models.Term, error)
+}
+
+// CourseRepository stores courses together with their reading lists and
+// reading list entries.
+type CourseRepository interface {
+	Create(tx Tx, course *models.Course) error
+	GetByID(tx Tx, id uuid.UUID) (*models.Course, error)
+	// List returns all courses ordered by code.
+	List(tx Tx) ([]models.Course, error)
+	// Delete removes a course together with its reading lists.
+	Delete(tx Tx, id uuid.UUID) error
+
+	CreateReadingList(tx Tx, list *models.ReadingList) error
+	GetReadingList(tx Tx, id uuid.UUID) (*models.ReadingList, error)
+	// ListReadingLists returns a course's reading lists ordered by title.
+	ListReadingLists(tx Tx, courseID uuid.UUID) ([]models.ReadingList, error)
+	DeleteReadingList(tx Tx, id uuid.UUID) error
+
+	// ListEntries returns a reading list's entries ordered by position, with
+	// Book populated. Entries for withdrawn books are left out.
+	ListEntries(tx Tx, listID uuid.UUID) ([]models.ReadingListEntry, error)
+	// ReplaceEntries replaces every entry of a reading list.
+	ReplaceEntries(tx Tx, listID uuid.UUID, entries []models.ReadingListEntry) error
+}
+
+// PaymentRepository stores the fine payments users make.
+type PaymentRepository interface {
+	Create(tx Tx, payment *models.Payment) error
+	// ListByUser returns a user's payments, oldest first.
+	ListByUser(tx Tx, userID uuid.UUID) ([]models.Payment, error)
+	// LastPaidAt returns when each of the users last paid; users who never
+	// paid are left out.
+	LastPaidAt(tx Tx, userIDs []uuid.UUID) (map[uuid.UUID]time.Time, error)
 }
 
 // concrete implementations
@@ -53,10 +285,13 @@ func NewUserRepository(db *gorm.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
-func (r *userRepository) GetByID(db *gorm.DB, id uuid.UUID) (*models.User, error) {
-	if db == nil {
-		db = r.db
-	}
+func (r *userRepository) Create(tx Tx, user *models.User) error {
+	db := conn(tx, r.db)
+	return db.Create(user).Error
+}
+
+func (r *userRepository) GetByID(tx Tx, id uuid.UUID) (*models.User, error) {
+	db := conn(tx, r.db)
 	var user models.User
 	if err := db.First(&user, "id = ?", id).Error; err != nil {
 		return nil, err
@@ -64,6 +299,24 @@ func (r *userRepository) GetByID(db *gorm.DB, id uuid.UUID) (*models.User, error
 	return &user, nil
 }
 
+func (r *userRepository) GetByIDForUpdate(tx Tx, id uuid.UUID) (*models.User, error) {
+	db := conn(tx, r.db)
+	var user models.User
+	if err := db.Scopes(forUpdate).First(&user, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *userRepository) List(tx Tx) ([]models.User, error) {
+	db := conn(tx, r.db)
+	var users []models.User
+	if err := db.Order("name, id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 type bookRepository struct {
 	db *gorm.DB
 }
@@ -72,17 +325,13 @@ func NewBookRepository(db *gorm.DB) BookRepository {
 	return &bookRepository{db: db}
 }
 
-func (r *bookRepository) Create(db *gorm.DB, book *models.Book) error {
-	if db == nil {
-		db = r.db
-	}
-	return db.Create(book).Error
+func (r *bookRepository) Create(tx Tx, book *models.Book) error {
+	db := conn(tx, r.db)
+	return translateError(db, db.Create(book).Error)
 }
 
-func (r *bookRepository) List(db *gorm.DB) ([]models.Book, error) {
-	if db == nil {
-		db = r.db
-	}
+func (r *bookRepository) List(tx Tx) ([]models.Book, error) {
+	db := conn(tx, r.db)
 	var books []models.Book
 	if err := db.Find(&books).Error; err != nil {
 		return nil, err
@@ -90,10 +339,8 @@ func (r *bookRepository) List(db *gorm.DB) ([]models.Book, error) {
 	return books, nil
 }
 
-func (r *bookRepository) GetByID(db *gorm.DB, id uuid.UUID) (*models.Book, error) {
-	if db == nil {
-		db = r.db
-	}
+func (r *bookRepository) GetByID(tx Tx, id uuid.UUID) (*models.Book, error) {
+	db := conn(tx, r.db)
 	var book models.Book
 	if err := db.First(&book, "id = ?", id).Error; err != nil {
 		return nil, err
@@ -101,16 +348,351 @@ func (r *bookRepository) GetByID(db *gorm.DB, id uuid.UUID) (*models.Book, error
 	return &book, nil
 }
 
-func (r *bookRepository) IncrementTotalCopies(db *gorm.DB, bookID uuid.UUID, delta int) error {
-	if db == nil {
-		db = r.db
-	}
+func (r *bookRepository) IncrementTotalCopies(tx Tx, bookID uuid.UUID, delta int) error {
+	db := conn(tx, r.db)
 	return db.Model(&models.Book{}).
 		Where("id = ?", bookID).
 		UpdateColumn("total_copies", gorm.Expr("total_copies + ?", delta)).
 		Error
 }
 
+func (r *bookRepository) GetByIDForUpdate(tx Tx, id uuid.UUID) (*models.Book, error) {
+	db := conn(tx, r.db)
+	var book models.Book
+	if err := db.Scopes(forUpdate).First(&book, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func (r *bookRepository) AdjustAvailability(tx Tx, bookID uuid.UUID, delta Availability) error {
+	db := conn(tx, r.db)
+	res := db.Model(&models.Book{}).
+		Where("id = ?", bookID).
+		UpdateColumns(map[string]interface{}{
+			"available_copies":   gorm.Expr("available_copies + ?", delta.Available),
+			"checked_out_copies": gorm.Expr("checked_out_copies + ?", delta.CheckedOut),
+			"holds":              gorm.Expr("holds + ?", delta.Holds),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *bookRepository) SetAvailability(tx Tx, bookID uuid.UUID, counts Availability) error {
+	db := conn(tx, r.db)
+	return db.Model(&models.Book{}).
+		Where("id = ?", bookID).
+		UpdateColumns(map[string]interface{}{
+			"available_copies":   counts.Available,
+			"checked_out_copies": counts.CheckedOut,
+			"holds":              counts.Holds,
+		}).
+		Error
+}
+
+func (r *bookRepository) FindByISBNs(tx Tx, isbns []string) ([]models.Book, error) {
+	if len(isbns) == 0 {
+		return nil, nil
+	}
+	db := conn(tx, r.db)
+	var books []models.Book
+	if err := db.Unscoped().Where("isbn IN ?", isbns).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+func (r *bookRepository) SetLoanType(tx Tx, bookID uuid.UUID, loanType models.LoanType, loanHours int, until *time.Time) error {
+	db := conn(tx, r.db)
+	return db.Model(&models.Book{}).
+		Where("id = ?", bookID).
+		UpdateColumns(map[string]interface{}{
+			"loan_type":       loanType,
+			"loan_hours":      loanHours,
+			"loan_type_until": until,
+			"version":         gorm.Expr("version + 1"),
+		}).
+		Error
+}
+
+// UpdateDetails updates from the struct rather than a map so that Subjects
+// goes through its JSON serializer; GORM stamps updated_at itself.
+func (r *bookRepository) UpdateDetails(tx Tx, book *models.Book) error {
+	db := conn(tx, r.db)
+	err := db.Model(&models.Book{ID: book.ID}).
+		Select("title", "author", "isbn", "edition", "publisher", "published", "subjects", "updated_at").
+		Updates(book).
+		Error
+	if err != nil {
+		return translateError(db, err)
+	}
+	return db.Model(&models.Book{}).
+		Where("id = ?", book.ID).
+		UpdateColumn("version", gorm.Expr("version + 1")).
+		Error
+}
+
+func (r *bookRepository) GetAny(tx Tx, id uuid.UUID) (*models.Book, error) {
+	db := conn(tx, r.db)
+	var book models.Book
+	if err := db.Unscoped().First(&book, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func (r *bookRepository) GetAnyForUpdate(tx Tx, id uuid.UUID) (*models.Book, error) {
+	db := conn(tx, r.db)
+	var book models.Book
+	if err := db.Unscoped().Scopes(forUpdate).First(&book, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func (r *bookRepository) Withdraw(tx Tx, id uuid.UUID, at time.Time) error {
+	db := conn(tx, r.db)
+	return db.Model(&models.Book{}).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{
+			"deleted_at": at.UTC(),
+			"updated_at": at.UTC(),
+			"version":    gorm.Expr("version + 1"),
+		}).
+		Error
+}
+
+func (r *bookRepository) Restore(tx Tx, id uuid.UUID, at time.Time) error {
+	db := conn(tx, r.db)
+	return db.Unscoped().Model(&models.Book{}).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{
+			"deleted_at": nil,
+			"updated_at": at.UTC(),
+			"version":    gorm.Expr("version + 1"),
+		}).
+		Error
+}
+
+// Delete relies on the ON DELETE CASCADE foreign keys of book_copies,
+// reservations and reading_list_entries.
+func (r *bookRepository) Delete(tx Tx, id uuid.UUID) error {
+	db := conn(tx, r.db)
+	res := db.Unscoped().Delete(&models.Book{}, "id = ?", id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *bookRepository) ListChanged(tx Tx, from, until *time.Time, after *BookCursor, limit int) ([]models.Book, error) {
+	db := conn(tx, r.db)
+	q := db.Unscoped().Order("updated_at, id").Limit(limit)
+	// Times are stored in UTC; SQLite compares them as text.
+	if from != nil {
+		q = q.Where("updated_at >= ?", from.UTC())
+	}
+	if until != nil {
+		q = q.Where("updated_at < ?", until.UTC())
+	}
+	if after != nil {
+		at := after.UpdatedAt.UTC()
+		q = q.Where("updated_at > ? OR (updated_at = ? AND id > ?)", at, at, after.ID)
+	}
+	var books []models.Book
+	if err := q.Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+func (r *bookRepository) Search(tx Tx, q *BookQuery, offset, limit int) ([]models.Book, int64, error) {
+	db := conn(tx, r.db)
+	base := db.Model(&models.Book{})
+	if q != nil {
+		where, args, err := bookQuerySQL(q)
+		if err != nil {
+			return nil, 0, err
+		}
+		base = base.Where(where, args...)
+	}
+	var total int64
+	if err := base.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var books []models.Book
+	if limit <= 0 {
+		return books, total, nil
+	}
+	if err := base.Order("title, id").Offset(offset).Limit(limit).Find(&books).Error; err != nil {
+		return nil, 0, err
+	}
+	return books, total, nil
+}
+
+// bookQueryColumns maps the searchable fields to their columns.
+var bookQueryColumns = map[BookField]string{
+	BookFieldTitle:   "title",
+	BookFieldAuthor:  "author",
+	BookFieldISBN:    "isbn",
+	BookFieldSubject: "subjects",
+}
+
+// bookQuerySQL translates q into a WHERE condition and its arguments.
+func bookQuerySQL(q *BookQuery) (string, []interface{}, error) {
+	switch q.Op {
+	case QueryAnd, QueryOr:
+		left, largs, err := bookQuerySQL(q.Left)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rargs, err := bookQuerySQL(q.Right)
+		if err != nil {
+			return "", nil, err
+		}
+		return "(" + left + " " + strings.ToUpper(string(q.Op)) + " " + right + ")", append(largs, rargs...), nil
+	case QueryNot:
+		cond, args, err := bookQuerySQL(q.Left)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT " + cond, args, nil
+	case QueryMatch:
+		col, ok := bookQueryColumns[q.Field]
+		if !ok {
+			return "", nil, fmt.Errorf("repositories: unknown book query field %q", q.Field)
+		}
+		// NULL would make NOT of a failed match unknown rather than true.
+		return "LOWER(COALESCE(" + col + ", '')) LIKE ? ESCAPE '\\'", []interface{}{likePattern(q)}, nil
+	}
+	return "", nil, fmt.Errorf("repositories: unknown book query operator %q", q.Op)
+}
+
+// likePattern translates a match node's pattern into a lower-case LIKE
+// pattern. Subjects are stored as a JSON array, so they are matched in its
+// text: a whole subject is the pattern in quotes, and every character of the
+// pattern is written as encoding/json writes it, which escapes quotes,
+// backslashes and control characters and turns &, < and > into \u escapes.
+func likePattern(q *BookQuery) string {
+	var b strings.Builder
+	literal := func(r rune) {
+		if r == '%' || r == '_' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	open, close := "%", "%"
+	switch {
+	case q.Field == BookFieldSubject && q.Whole:
+		open, close = `%"`, `"%`
+	case q.Whole:
+		open, close = "", ""
+	}
+
+	b.WriteString(open)
+	escaped := false
+	for _, r := range strings.ToLower(q.Pattern) {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+			continue
+		case r == '*':
+			b.WriteByte('%')
+			continue
+		case r == '?':
+			b.WriteByte('_')
+			continue
+		}
+		if q.Field == BookFieldSubject {
+			for _, c := range jsonText(r) {
+				literal(c)
+			}
+			continue
+		}
+		literal(r)
+	}
+	b.WriteString(close)
+	return b.String()
+}
+
+// jsonText returns r as json.Marshal writes it inside a string, the form the
+// JSON serializer stores subjects in.
+func jsonText(r rune) string {
+	out, _ := json.Marshal(string(r))
+	return string(out[1 : len(out)-1])
+}
+
+// bookCopyRow is one row of the books ⟕ book_copies join read by
+// EachWithCopies. The copy columns are NULL for a book without copies.
+type bookCopyRow struct {
+	models.Book
+	CopyID       *uuid.UUID
+	CopyStatus   *models.BookCopyStatus
+	CopyBranchID *uuid.UUID
+	CopyBarcode  *string
+}
+
+func (r *bookRepository) EachWithCopies(tx Tx, fn func(book models.Book, copies []models.BookCopy) error) error {
+	db := conn(tx, r.db)
+	rows, err := db.Model(&models.Book{}).
+		Select("books.*, book_copies.id AS copy_id, book_copies.status AS copy_status, " +
+			"book_copies.branch_id AS copy_branch_id, book_copies.barcode AS copy_barcode").
+		Joins("LEFT JOIN book_copies ON book_copies.book_id = books.id").
+		Order("books.title, books.id, book_copies.id").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Rows arrive grouped by book; hand each book over once its last copy
+	// has been read.
+	var current *models.Book
+	var copies []models.BookCopy
+	for rows.Next() {
+		var row bookCopyRow
+		if err := db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if current != nil && current.ID != row.ID {
+			if err := fn(*current, copies); err != nil {
+				return err
+			}
+			current, copies = nil, nil
+		}
+		if current == nil {
+			book := row.Book
+			current = &book
+		}
+		if row.CopyID != nil {
+			copies = append(copies, models.BookCopy{
+				ID:       *row.CopyID,
+				BookID:   row.ID,
+				Status:   *row.CopyStatus,
+				BranchID: row.CopyBranchID,
+				Barcode:  row.CopyBarcode,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if current != nil {
+		return fn(*current, copies)
+	}
+	return nil
+}
+
 type bookCopyRepository struct {
 	db *gorm.DB
 }
@@ -119,20 +701,16 @@ func NewBookCopyRepository(db *gorm.DB) BookCopyRepository {
 	return &bookCopyRepository{db: db}
 }
 
-func (r *bookCopyRepository) Create(db *gorm.DB, copy *models.BookCopy) error {
-	if db == nil {
-		db = r.db
-	}
-	return db.Create(copy).Error
+func (r *bookCopyRepository) Create(tx Tx, copy *models.BookCopy) error {
+	db := conn(tx, r.db)
+	return translateError(db, db.Create(copy).Error)
 }
 
-func (r *bookCopyRepository) FindAvailableForUpdate(db *gorm.DB, bookID uuid.UUID) (*models.BookCopy, error) {
-	if db == nil {
-		db = r.db
-	}
+func (r *bookCopyRepository) FindAvailableForUpdate(tx Tx, bookID uuid.UUID) (*models.BookCopy, error) {
+	db := conn(tx, r.db)
 	var copy models.BookCopy
 	err := db.
-		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Scopes(forUpdate).
 		Where("book_id = ? AND status = ?", bookID, models.BookCopyStatusAvailable).
 		Order("id").
 		First(&copy).Error
@@ -142,16 +720,90 @@ func (r *bookCopyRepository) FindAvailableForUpdate(db *gorm.DB, bookID uuid.UUI
 	return &copy, nil
 }
 
-func (r *bookCopyRepository) UpdateStatus(db *gorm.DB, id uuid.UUID, status models.BookCopyStatus) error {
-	if db == nil {
-		db = r.db
+func (r *bookCopyRepository) FindAvailableSkipLocked(tx Tx, bookID uuid.UUID) (*models.BookCopy, error) {
+	db := conn(tx, r.db)
+	var copy models.BookCopy
+	err := db.
+		Scopes(skipLocked).
+		Where("book_id = ? AND status = ?", bookID, models.BookCopyStatusAvailable).
+		Order("id").
+		First(&copy).Error
+	if err != nil {
+		return nil, err
 	}
+	return &copy, nil
+}
+
+func (r *bookCopyRepository) UpdateStatus(tx Tx, id uuid.UUID, status models.BookCopyStatus) error {
+	db := conn(tx, r.db)
 	return db.Model(&models.BookCopy{}).
 		Where("id = ?", id).
 		Update("status", status).
 		Error
 }
 
+func (r *bookCopyRepository) GetByID(tx Tx, id uuid.UUID) (*models.BookCopy, error) {
+	db := conn(tx, r.db)
+	var copy models.BookCopy
+	if err := db.First(&copy, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &copy, nil
+}
+
+func (r *bookCopyRepository) GetByIDForUpdate(tx Tx, id uuid.UUID) (*models.BookCopy, error) {
+	db := conn(tx, r.db)
+	var copy models.BookCopy
+	if err := db.Scopes(forUpdate).First(&copy, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &copy, nil
+}
+
+func (r *bookCopyRepository) SetBranch(tx Tx, id uuid.UUID, branchID *uuid.UUID) error {
+	db := conn(tx, r.db)
+	return db.Model(&models.BookCopy{}).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{
+			"branch_id": branchID,
+			"version":   gorm.Expr("version + 1"),
+		}).
+		Error
+}
+
+func (r *bookCopyRepository) FindByBarcodes(tx Tx, barcodes []string) ([]models.BookCopy, error) {
+	if len(barcodes) == 0 {
+		return nil, nil
+	}
+	db := conn(tx, r.db)
+	var copies []models.BookCopy
+	if err := db.Where("barcode IN ?", barcodes).Find(&copies).Error; err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+func (r *bookCopyRepository) ListByBooks(tx Tx, bookIDs []uuid.UUID) ([]models.BookCopy, error) {
+	if len(bookIDs) == 0 {
+		return nil, nil
+	}
+	db := conn(tx, r.db)
+	var copies []models.BookCopy
+	if err := db.Where("book_id IN ?", bookIDs).Order("book_id, id").Find(&copies).Error; err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+func (r *bookCopyRepository) List(tx Tx) ([]models.BookCopy, error) {
+	db := conn(tx, r.db)
+	var copies []models.BookCopy
+	if err := db.Order("book_id, id").Find(&copies).Error; err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
 type checkoutRepository struct {
 	db *gorm.DB
 }
@@ -160,17 +812,13 @@ func NewCheckoutRepository(db *gorm.DB) CheckoutRepository {
 	return &checkoutRepository{db: db}
 }
 
-func (r *checkoutRepository) Create(db *gorm.DB, checkout *models.Checkout) error {
-	if db == nil {
-		db = r.db
-	}
-	return db.Create(checkout).Error
+func (r *checkoutRepository) Create(tx Tx, checkout *models.Checkout) error {
+	db := conn(tx, r.db)
+	return translateError(db, db.Create(checkout).Error)
 }
 
-func (r *checkoutRepository) MarkReturned(db *gorm.DB, checkoutID uuid.UUID, returnedAt time.Time, fineAmount int) error {
-	if db == nil {
-		db = r.db
-	}
+func (r *checkoutRepository) MarkReturned(tx Tx, checkoutID uuid.UUID, returnedAt time.Time, fineAmount int) error {
+	db := conn(tx, r.db)
 	return db.Model(&models.Checkout{}).
 		Where("id = ? AND returned_at IS NULL", checkoutID).
 		Updates(map[string]interface{}{
@@ -179,13 +827,11 @@ func (r *checkoutRepository) MarkReturned(db *gorm.DB, checkoutID uuid.UUID, ret
 		}).Error
 }
 
-func (r *checkoutRepository) GetByIDForUpdate(db *gorm.DB, id uuid.UUID) (*models.Checkout, error) {
-	if db == nil {
-		db = r.db
-	}
+func (r *checkoutRepository) GetByIDForUpdate(tx Tx, id uuid.UUID) (*models.Checkout, error) {
+	db := conn(tx, r.db)
 	var checkout models.Checkout
 	err := db.
-		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Scopes(forUpdate).
 		Preload("BookCopy").
 		First(&checkout, "id = ?", id).Error
 	if err != nil {
@@ -194,10 +840,22 @@ func (r *checkoutRepository) GetByIDForUpdate(db *gorm.DB, id uuid.UUID) (*model
 	return &checkout, nil
 }
 
-func (r *checkoutRepository) ListByUser(db *gorm.DB, userID uuid.UUID) ([]models.Checkout, error) {
-	if db == nil {
-		db = r.db
+func (r *checkoutRepository) GetActiveByCopy(tx Tx, copyID uuid.UUID) (*models.Checkout, error) {
+	db := conn(tx, r.db)
+	var checkout models.Checkout
+	err := db.
+		Scopes(forUpdate).
+		Preload("BookCopy").
+		Where("book_copy_id = ? AND returned_at IS NULL", copyID).
+		First(&checkout).Error
+	if err != nil {
+		return nil, err
 	}
+	return &checkout, nil
+}
+
+func (r *checkoutRepository) ListByUser(tx Tx, userID uuid.UUID) ([]models.Checkout, error) {
+	db := conn(tx, r.db)
 	var checkouts []models.Checkout
 	if err := db.Where("user_id = ?", userID).Find(&checkouts).Error; err != nil {
 		return nil, err
@@ -205,6 +863,92 @@ func (r *checkoutRepository) ListByUser(db *gorm.DB, userID uuid.UUID) ([]models
 	return checkouts, nil
 }
 
+func (r *checkoutRepository) ListByBook(tx Tx, bookID uuid.UUID) ([]models.Checkout, error) {
+	db := conn(tx, r.db)
+	var checkouts []models.Checkout
+	if err := db.Preload("BookCopy").
+		Joins("JOIN book_copies ON book_copies.id = checkouts.book_copy_id").
+		Where("book_copies.book_id = ?", bookID).
+		Order("checkouts.checkout_at ASC, checkouts.id ASC").
+		Find(&checkouts).Error; err != nil {
+		return nil, err
+	}
+	return checkouts, nil
+}
+
+func (r *checkoutRepository) ListOverdue(tx Tx, now time.Time) ([]models.Checkout, error) {
+	db := conn(tx, r.db)
+	var checkouts []models.Checkout
+	if err := db.Preload("BookCopy").
+		Where("returned_at IS NULL AND due_date < ?", now).
+		Order("due_date ASC").
+		Find(&checkouts).Error; err != nil {
+		return nil, err
+	}
+	return checkouts, nil
+}
+
+func (r *checkoutRepository) ListReturned(tx Tx, filter ReturnedFilter, after uuid.UUID, limit int) ([]models.Checkout, error) {
+	db := conn(tx, r.db)
+	q := db.Preload("BookCopy").
+		Where("returned_at IS NOT NULL AND id > ?", after).
+		Order("id").
+		Limit(limit)
+	if filter.CheckoutID != nil {
+		q = q.Where("id = ?", *filter.CheckoutID)
+	}
+	if filter.UserID != nil {
+		q = q.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.Since != nil {
+		q = q.Where("returned_at >= ?", filter.Since.UTC())
+	}
+	var checkouts []models.Checkout
+	if err := q.Find(&checkouts).Error; err != nil {
+		return nil, err
+	}
+	return checkouts, nil
+}
+
+func (r *checkoutRepository) ListActive(tx Tx) ([]models.Checkout, error) {
+	db := conn(tx, r.db)
+	var checkouts []models.Checkout
+	if err := db.Preload("User").
+		Preload("BookCopy.Book").
+		Where("returned_at IS NULL").
+		Order("due_date ASC").
+		Find(&checkouts).Error; err != nil {
+		return nil, err
+	}
+	return checkouts, nil
+}
+
+func (r *checkoutRepository) Renew(tx Tx, checkoutID uuid.UUID, dueDate time.Time, loanType models.LoanType) error {
+	db := conn(tx, r.db)
+	return db.Model(&models.Checkout{}).
+		Where("id = ?", checkoutID).
+		Updates(map[string]interface{}{
+			"due_date":  dueDate,
+			"loan_type": loanType,
+			"renewals":  gorm.Expr("renewals + 1"),
+		}).
+		Error
+}
+
+func (r *checkoutRepository) UpdateFine(tx Tx, checkoutID uuid.UUID, fineAmount int) error {
+	db := conn(tx, r.db)
+	return db.Model(&models.Checkout{}).
+		Where("id = ?", checkoutID).
+		Update("fine_amount", fineAmount).
+		Error
+}
+
+func (r *checkoutRepository) DeleteByBook(tx Tx, bookID uuid.UUID) error {
+	db := conn(tx, r.db)
+	copies := db.Model(&models.BookCopy{}).Select("id").Where("book_id = ?", bookID)
+	return db.Where("book_copy_id IN (?)", copies).Delete(&models.Checkout{}).Error
+}
+
 type reservationRepository struct {
 	db *gorm.DB
 }
@@ -213,17 +957,13 @@ func NewReservationRepository(db *gorm.DB) ReservationRepository {
 	return &reservationRepository{db: db}
 }
 
-func (r *reservationRepository) Create(db *gorm.DB, reservation *models.Reservation) error {
-	if db == nil {
-		db = r.db
-	}
-	return db.Create(reservation).Error
+func (r *reservationRepository) Create(tx Tx, reservation *models.Reservation) error {
+	db := conn(tx, r.db)
+	return translateError(db, db.Create(reservation).Error)
 }
 
-func (r *reservationRepository) GetNextForBook(db *gorm.DB, bookID uuid.UUID) (*models.Reservation, error) {
-	if db == nil {
-		db = r.db
-	}
+func (r *reservationRepository) GetNextForBook(tx Tx, bookID uuid.UUID) (*models.Reservation, error) {
+	db := conn(tx, r.db)
 	var res models.Reservation
 	err := db.Where("book_id = ?", bookID).
 		Order("queue_position ASC, created_at ASC").
@@ -234,10 +974,8 @@ func (r *reservationRepository) GetNextForBook(db *gorm.DB, bookID uuid.UUID) (*
 	return &res, nil
 }
 
-func (r *reservationRepository) GetByBookAndUser(db *gorm.DB, bookID, userID uuid.UUID) (*models.Reservation, error) {
-	if db == nil {
-		db = r.db
-	}
+func (r *reservationRepository) GetByBookAndUser(tx Tx, bookID, userID uuid.UUID) (*models.Reservation, error) {
+	db := conn(tx, r.db)
 	var res models.Reservation
 	err := db.Where("book_id = ? AND user_id = ?", bookID, userID).First(&res).Error
 	if err != nil {
@@ -246,22 +984,27 @@ func (r *reservationRepository) GetByBookAndUser(db *gorm.DB, bookID, userID uui
 	return &res, nil
 }
 
-func (r *reservationRepository) Delete(db *gorm.DB, id uuid.UUID) error {
-	if db == nil {
-		db = r.db
+func (r *reservationRepository) GetByID(tx Tx, id uuid.UUID) (*models.Reservation, error) {
+	db := conn(tx, r.db)
+	var res models.Reservation
+	if err := db.First(&res, "id = ?", id).Error; err != nil {
+		return nil, err
 	}
+	return &res, nil
+}
+
+func (r *reservationRepository) Delete(tx Tx, id uuid.UUID) error {
+	db := conn(tx, r.db)
 	return db.Delete(&models.Reservation{}, "id = ?", id).Error
 }
 
-func (r *reservationRepository) GetNextQueuePosition(db *gorm.DB, bookID uuid.UUID) (int, error) {
-	if db == nil {
-		db = r.db
-	}
+func (r *reservationRepository) GetNextQueuePosition(tx Tx, bookID uuid.UUID) (int, error) {
+	db := conn(tx, r.db)
 	// Lock reservation rows for this book so MAX(queue_position) is stable under concurrency.
 	var ids []uuid.UUID
 	if err := db.Model(&models.Reservation{}).
 		Where("book_id = ?", bookID).
-		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Scopes(forUpdate).
 		Pluck("id", &ids).Error; err != nil {
 		return 0, err
 	}
@@ -275,10 +1018,8 @@ func (r *reservationRepository) GetNextQueuePosition(db *gorm.DB, bookID uuid.UU
 	return maxPos + 1, nil
 }
 
-func (r *reservationRepository) ListByBook(db *gorm.DB, bookID uuid.UUID) ([]models.Reservation, error) {
-	if db == nil {
-		db = r.db
-	}
+func (r *reservationRepository) ListByBook(tx Tx, bookID uuid.UUID) ([]models.Reservation, error) {
+	db := conn(tx, r.db)
 	var res []models.Reservation
 	if err := db.Where("book_id = ?", bookID).
 		Order("queue_position ASC").
@@ -288,3 +1029,424 @@ func (r *reservationRepository) ListByBook(db *gorm.DB, bookID uuid.UUID) ([]mod
 	return res, nil
 }
 
+func (r *reservationRepository) CountByBooks(tx Tx, bookIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	counts := map[uuid.UUID]int{}
+	if len(bookIDs) == 0 {
+		return counts, nil
+	}
+	db := conn(tx, r.db)
+	var rows []struct {
+		BookID uuid.UUID
+		Count  int
+	}
+	if err := db.Model(&models.Reservation{}).
+		Select("book_id, COUNT(*) AS count").
+		Where("book_id IN ?", bookIDs).
+		Group("book_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.BookID] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *reservationRepository) ListByUser(tx Tx, userID uuid.UUID) ([]models.Reservation, error) {
+	db := conn(tx, r.db)
+	var res []models.Reservation
+	if err := db.Where("user_id = ?", userID).
+		Order("created_at ASC, id ASC").
+		Find(&res).Error; err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *reservationRepository) List(tx Tx) ([]models.Reservation, error) {
+	db := conn(tx, r.db)
+	var res []models.Reservation
+	if err := db.Order("book_id, queue_position").Find(&res).Error; err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *reservationRepository) Dequeue(tx Tx, id uuid.UUID) error {
+	db := conn(tx, r.db)
+	res, err := r.GetByID(tx, id)
+	if err != nil {
+		return err
+	}
+	queue, err := lockQueue(db, res.BookID)
+	if err != nil {
+		return err
+	}
+	// A concurrent dequeue may have removed it while we waited for the locks.
+	i := slices.IndexFunc(queue, func(q models.Reservation) bool { return q.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	if err := db.Delete(&models.Reservation{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	return compactQueue(slices.Delete(queue, i, i+1), moveInQueue(db))
+}
+
+func (r *reservationRepository) CompactQueue(tx Tx, bookID uuid.UUID) error {
+	db := conn(tx, r.db)
+	queue, err := lockQueue(db, bookID)
+	if err != nil {
+		return err
+	}
+	return compactQueue(queue, moveInQueue(db))
+}
+
+// lockQueue reads a book's queue in order, locking each reservation.
+func lockQueue(db *gorm.DB, bookID uuid.UUID) ([]models.Reservation, error) {
+	var queue []models.Reservation
+	if err := db.Where("book_id = ?", bookID).
+		Order("queue_position ASC, created_at ASC").
+		Scopes(forUpdate).
+		Find(&queue).Error; err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+func moveInQueue(db *gorm.DB) func(id uuid.UUID, position int) error {
+	return func(id uuid.UUID, position int) error {
+		err := db.Model(&models.Reservation{}).
+			Where("id = ?", id).
+			UpdateColumn("queue_position", position).
+			Error
+		return translateError(db, err)
+	}
+}
+
+// compactQueue moves the reservations of one queue, given in order, to
+// positions 1…n. Neither database defers the unique index on
+// (book_id, queue_position), so a reservation may never move onto a place
+// still held by another: every reservation out of place first moves below
+// all positions in use, and only then to its own.
+func compactQueue(queue []models.Reservation, move func(id uuid.UUID, position int) error) error {
+	if len(queue) == 0 {
+		return nil
+	}
+	var misplaced []int
+	for i, res := range queue {
+		if res.QueuePosition != i+1 {
+			misplaced = append(misplaced, i)
+		}
+	}
+	below := min(queue[0].QueuePosition, 1) - len(misplaced)
+	for k, i := range misplaced {
+		if err := move(queue[i].ID, below+k); err != nil {
+			return err
+		}
+	}
+	for _, i := range misplaced {
+		if err := move(queue[i].ID, i+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type branchRepository struct {
+	db *gorm.DB
+}
+
+func NewBranchRepository(db *gorm.DB) BranchRepository {
+	return &branchRepository{db: db}
+}
+
+func (r *branchRepository) Create(tx Tx, branch *models.Branch) error {
+	db := conn(tx, r.db)
+	return db.Create(branch).Error
+}
+
+func (r *branchRepository) GetByID(tx Tx, id uuid.UUID) (*models.Branch, error) {
+	db := conn(tx, r.db)
+	var branch models.Branch
+	if err := db.First(&branch, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &branch, nil
+}
+
+func (r *branchRepository) List(tx Tx) ([]models.Branch, error) {
+	db := conn(tx, r.db)
+	var branches []models.Branch
+	if err := db.Order("name, id").Find(&branches).Error; err != nil {
+		return nil, err
+	}
+	return branches, nil
+}
+
+func (r *branchRepository) ListOpeningHours(tx Tx, branchID uuid.UUID) ([]models.OpeningHours, error) {
+	db := conn(tx, r.db)
+	var hours []models.OpeningHours
+	if err := db.Where("branch_id = ?", branchID).Order("weekday").Find(&hours).Error; err != nil {
+		return nil, err
+	}
+	return hours, nil
+}
+
+func (r *branchRepository) ReplaceOpeningHours(tx Tx, branchID uuid.UUID, hours []models.OpeningHours) error {
+	db := conn(tx, r.db)
+	if err := db.Where("branch_id = ?", branchID).Delete(&models.OpeningHours{}).Error; err != nil {
+		return err
+	}
+	if len(hours) == 0 {
+		return nil
+	}
+	return translateError(db, db.Create(&hours).Error)
+}
+
+func (r *branchRepository) ListClosures(tx Tx, branchID uuid.UUID, from, to time.Time) ([]models.Closure, error) {
+	db := conn(tx, r.db)
+	var closures []models.Closure
+	if err := db.Where("branch_id = ? AND date >= ? AND date <= ?", branchID, from, to).
+		Order("date").
+		Find(&closures).Error; err != nil {
+		return nil, err
+	}
+	return closures, nil
+}
+
+func (r *branchRepository) AddClosures(tx Tx, closures []models.Closure) (int, error) {
+	if len(closures) == 0 {
+		return 0, nil
+	}
+	db := conn(tx, r.db)
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&closures, 500)
+	return int(res.RowsAffected), res.Error
+}
+
+func (r *branchRepository) DeleteClosure(tx Tx, branchID uuid.UUID, date time.Time) error {
+	db := conn(tx, r.db)
+	res := db.Where("branch_id = ? AND date = ?", branchID, date).Delete(&models.Closure{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type termRepository struct {
+	db *gorm.DB
+}
+
+func NewTermRepository(db *gorm.DB) TermRepository {
+	return &termRepository{db: db}
+}
+
+func (r *termRepository) Create(tx Tx, term *models.Term) error {
+	db := conn(tx, r.db)
+	return db.Create(term).Error
+}
+
+func (r *termRepository) GetByID(tx Tx, id uuid.UUID) (*models.Term, error) {
+	db := conn(tx, r.db)
+	var term models.Term
+	if err := db.First(&term, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &term, nil
+}
+
+func (r *termRepository) List(tx Tx) ([]models.Term, error) {
+	db := conn(tx, r.db)
+	var terms []models.Term
+	if err := db.Order("start_date, id").Find(&terms).Error; err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
+
+func (r *termRepository) Update(tx Tx, term *models.Term) error {
+	db := conn(tx, r.db)
+	res := db.Model(&models.Term{}).
+		Where("id = ?", term.ID).
+		Updates(map[string]interface{}{
+			"name":       term.Name,
+			"start_date": term.StartDate,
+			"end_date":   term.EndDate,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *termRepository) Delete(tx Tx, id uuid.UUID) error {
+	db := conn(tx, r.db)
+	res := db.Delete(&models.Term{}, "id = ?", id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *termRepository) FindByDate(tx Tx, date time.Time) (*models.Term, error) {
+	db := conn(tx, r.db)
+	var term models.Term
+	if err := db.Where("start_date <= ? AND end_date >= ?", date, date).
+		Order("start_date").
+		First(&term).Error; err != nil {
+		return nil, err
+	}
+	return &term, nil
+}
+
+type courseRepository struct {
+	db *gorm.DB
+}
+
+func NewCourseRepository(db *gorm.DB) CourseRepository {
+	return &courseRepository{db: db}
+}
+
+func (r *courseRepository) Create(tx Tx, course *models.Course) error {
+	db := conn(tx, r.db)
+	return translateError(db, db.Create(course).Error)
+}
+
+func (r *courseRepository) GetByID(tx Tx, id uuid.UUID) (*models.Course, error) {
+	db := conn(tx, r.db)
+	var course models.Course
+	if err := db.First(&course, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &course, nil
+}
+
+func (r *courseRepository) List(tx Tx) ([]models.Course, error) {
+	db := conn(tx, r.db)
+	var courses []models.Course
+	if err := db.Order("code").Find(&courses).Error; err != nil {
+		return nil, err
+	}
+	return courses, nil
+}
+
+func (r *courseRepository) Delete(tx Tx, id uuid.UUID) error {
+	db := conn(tx, r.db)
+	res := db.Delete(&models.Course{}, "id = ?", id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *courseRepository) CreateReadingList(tx Tx, list *models.ReadingList) error {
+	db := conn(tx, r.db)
+	return db.Omit(clause.Associations).Create(list).Error
+}
+
+func (r *courseRepository) GetReadingList(tx Tx, id uuid.UUID) (*models.ReadingList, error) {
+	db := conn(tx, r.db)
+	var list models.ReadingList
+	if err := db.First(&list, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (r *courseRepository) ListReadingLists(tx Tx, courseID uuid.UUID) ([]models.ReadingList, error) {
+	db := conn(tx, r.db)
+	var lists []models.ReadingList
+	if err := db.Where("course_id = ?", courseID).Order("title, id").Find(&lists).Error; err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (r *courseRepository) DeleteReadingList(tx Tx, id uuid.UUID) error {
+	db := conn(tx, r.db)
+	res := db.Delete(&models.ReadingList{}, "id = ?", id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *courseRepository) ListEntries(tx Tx, listID uuid.UUID) ([]models.ReadingListEntry, error) {
+	db := conn(tx, r.db)
+	var entries []models.ReadingListEntry
+	if err := db.Preload("Book").
+		Joins("JOIN books ON books.id = reading_list_entries.book_id AND books.deleted_at IS NULL").
+		Where("reading_list_entries.reading_list_id = ?", listID).
+		Order("reading_list_entries.position").
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *courseRepository) ReplaceEntries(tx Tx, listID uuid.UUID, entries []models.ReadingListEntry) error {
+	db := conn(tx, r.db)
+	if err := db.Where("reading_list_id = ?", listID).Delete(&models.ReadingListEntry{}).Error; err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return translateError(db, db.Omit(clause.Associations).Create(&entries).Error)
+}
+
+type paymentRepository struct {
+	db *gorm.DB
+}
+
+func NewPaymentRepository(db *gorm.DB) PaymentRepository {
+	return &paymentRepository{db: db}
+}
+
+func (r *paymentRepository) Create(tx Tx, payment *models.Payment) error {
+	db := conn(tx, r.db)
+	return db.Omit(clause.Associations).Create(payment).Error
+}
+
+func (r *paymentRepository) ListByUser(tx Tx, userID uuid.UUID) ([]models.Payment, error) {
+	db := conn(tx, r.db)
+	var payments []models.Payment
+	if err := db.Where("user_id = ?", userID).Order("paid_at, id").Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+func (r *paymentRepository) LastPaidAt(tx Tx, userIDs []uuid.UUID) (map[uuid.UUID]time.Time, error) {
+	last := map[uuid.UUID]time.Time{}
+	if len(userIDs) == 0 {
+		return last, nil
+	}
+	db := conn(tx, r.db)
+	var payments []models.Payment
+	// Reduced here rather than with MAX(paid_at), which SQLite returns as text.
+	if err := db.Select("user_id", "paid_at").Where("user_id IN ?", userIDs).Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range payments {
+		if p.PaidAt.After(last[p.UserID]) {
+			last[p.UserID] = p.PaidAt
+		}
+	}
+	return last, nil
+}
@@ -0,0 +1,3851 @@
+// Package repotest is the conformance suite every repositories backend must
+// pass. It exercises the repository contracts the service layer relies on —
+// not-found errors, unique indexes, transaction rollback, ordering — plus the
+// checkout/return flow of the service itself, so the in-memory and PostgreSQL
+// implementations cannot silently drift apart.
+//
+// Each check creates its own users and books, so the suite can run against a
+// database that already contains data. Run it with:
+//
+//	go run ./scripts/storage_conformance.go
+package repotest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"library/internal/cache"
+	"library/internal/catalog"
+	"library/internal/clock"
+	"library/internal/marc"
+	"library/internal/models"
+	"library/internal/oai"
+	"library/internal/repositories"
+	"library/internal/services"
+	"library/internal/sip2"
+	"library/internal/sru"
+)
+
+// Check is a single named conformance check.
+type Check struct {
+	Name string
+	Run  func(r *repositories.Repositories) error
+}
+
+// Checks lists every conformance check in the order Run executes them.
+var Checks = []Check{
+	{"users/create-get-list", checkUsers},
+	{"books/create-get-increment", checkBooks},
+	{"books/loan-type", checkBookLoanType},
+	{"books/availability", checkBookAvailability},
+	{"copies/find-available", checkFindAvailable},
+	{"copies/find-available-skip-locked", checkFindAvailableSkipLocked},
+	{"checkouts/unique-active", checkUniqueActiveCheckout},
+	{"checkouts/return-and-fines", checkReturnAndFines},
+	{"checkouts/get-for-update-preloads-copy", checkPreloadCopy},
+	{"checkouts/renew-and-list-active", checkRenewAndListActive},
+	{"reservations/queue", checkReservationQueue},
+	{"reservations/unique-user-book", checkUniqueReservation},
+	{"reservations/dequeue-and-compact", checkDequeue},
+	{"branches/hours-and-closures", checkBranchCalendar},
+	{"copies/set-branch", checkCopyBranch},
+	{"terms/find-by-date", checkTerms},
+	{"courses/reading-lists", checkCourses},
+	{"books/isbn-and-barcodes", checkISBNAndBarcodes},
+	{"books/each-with-copies", checkEachWithCopies},
+	{"books/list-changed", checkListChanged},
+	{"books/search", checkBookSearch},
+	{"checkouts/active-by-copy", checkActiveByCopy},
+	{"checkouts/list-by-book", checkCheckoutsByBook},
+	{"payments/list-by-user", checkPayments},
+	{"transactions/commit", checkCommit},
+	{"transactions/rollback", checkRollback},
+	{"transactions/read-only", checkReadOnly},
+	{"service/checkout-reserve-return", checkServiceFlow},
+	{"service/checkout-commits-reservation", checkCheckoutCommitsReservation},
+	{"service/overdue-return", checkOverdueReturn},
+	{"service/branch-calendar", checkBranchDueDatesAndFines},
+	{"service/fine-recompute", checkFineRecompute},
+	{"service/term-end-and-renewals", checkTermEndAndRenewals},
+	{"service/short-and-overnight-loans", checkHourlyLoans},
+	{"service/course-reserves", checkCourseReserves},
+	{"service/bulk-import", checkBulkImport},
+	{"service/marc-import-export", checkMARC},
+	{"service/catalogue-export", checkCatalogueExport},
+	{"service/oai-pmh", checkOAIHarvest},
+	{"service/sip2", checkSIP2},
+	{"service/sru", checkSRU},
+	{"service/integrity", checkIntegrity},
+	{"service/reservation-queue", checkReservationQueueCompaction},
+	{"service/held-copies", checkHeldCopies},
+	{"service/checkout-retry", checkCheckoutRetry},
+	{"service/reservation-estimates", checkReservationEstimates},
+	{"service/availability-counts", checkAvailabilityCounts},
+	{"service/catalogue-cache", checkCatalogueCache},
+	{"service/record-versions", checkRecordVersions},
+	{"service/book-deletion", checkBookDeletion},
+}
+
+// Run executes every check against repos and returns the failures joined
+// together, or nil when the backend conforms. report, if non-nil, is called
+// after each check with its outcome.
+func Run(repos *repositories.Repositories, report func(name string, err error)) error {
+	var errs []error
+	for _, c := range Checks {
+		err := c.Run(repos)
+		if report != nil {
+			report(c.Name, err)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ─── Fixtures ─────────────────────────────────────────────────────────────────
+
+func newUser(r *repositories.Repositories, name string) (*models.User, error) {
+	user := &models.User{Name: "repotest " + name, Role: models.UserRoleStudent}
+	if err := r.Users.Create(nil, user); err != nil {
+		return nil, fmt.Errorf("create user: %w", err)
+	}
+	return user, nil
+}
+
+// newService returns the library service over r with the given clock and
+// policy.
+func newService(r *repositories.Repositories, clk clock.Clock, policy services.Policy) services.LibraryService {
+	return services.NewLibraryService(r.Transactor, clk, policy,
+		r.Users, r.Books, r.BookCopies, r.Checkouts, r.Reservations, r.Branches, r.Terms, r.Courses, r.Payments)
+}
+
+// newBook creates a book with copies AVAILABLE copies.
+func newBook(r *repositories.Repositories, copies int) (*models.Book, []models.BookCopy, error) {
+	book := &models.Book{Title: "repotest " + uuid.NewString(), Author: "repotest", TotalCopies: copies, AvailableCopies: copies}
+	if err := r.Books.Create(nil, book); err != nil {
+		return nil, nil, fmt.Errorf("create book: %w", err)
+	}
+	var out []models.BookCopy
+	for i := 0; i < copies; i++ {
+		c := models.BookCopy{BookID: book.ID, Status: models.BookCopyStatusAvailable}
+		if err := r.BookCopies.Create(nil, &c); err != nil {
+			return nil, nil, fmt.Errorf("create copy: %w", err)
+		}
+		out = append(out, c)
+	}
+	return book, out, nil
+}
+
+// randomISBN returns an ISBN-13 in the 979 range that is unlikely to be in the
+// database already.
+func randomISBN() string {
+	digits := fmt.Sprintf("979%09d", rand.Intn(1000000000))
+	sum := 0
+	for i, d := range digits {
+		w := 1
+		if i%2 == 1 {
+			w = 3
+		}
+		sum += int(d-'0') * w
+	}
+	return fmt.Sprintf("%s%d", digits, (10-sum%10)%10)
+}
+
+func newCheckout(copyID, userID uuid.UUID, due time.Time) *models.Checkout {
+	return &models.Checkout{
+		BookCopyID: copyID,
+		UserID:     userID,
+		CheckoutAt: due.Add(-14 * 24 * time.Hour),
+		DueDate:    due,
+	}
+}
+
+func expectNotFound(what string, err error) error {
+	if !errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("%s: want ErrNotFound, got %v", what, err)
+	}
+	return nil
+}
+
+// ─── Checks ───────────────────────────────────────────────────────────────────
+
+func checkUsers(r *repositories.Repositories) error {
+	user, err := newUser(r, "users")
+	if err != nil {
+		return err
+	}
+	if user.ID == uuid.Nil {
+		return errors.New("Create did not assign an ID")
+	}
+
+	got, err := r.Users.GetByID(nil, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetByID: %w", err)
+	}
+	if got.Name != user.Name || got.Role != user.Role {
+		return fmt.Errorf("GetByID returned %+v, want %+v", got, user)
+	}
+
+	users, err := r.Users.List(nil)
+	if err != nil {
+		return fmt.Errorf("List: %w", err)
+	}
+	found := false
+	for i, u := range users {
+		if i > 0 && users[i-1].Name > u.Name {
+			return errors.New("List is not ordered by name")
+		}
+		found = found || u.ID == user.ID
+	}
+	if !found {
+		return errors.New("List does not include the new user")
+	}
+
+	_, err = r.Users.GetByID(nil, uuid.New())
+	return expectNotFound("GetByID(unknown)", err)
+}
+
+func checkBooks(r *repositories.Repositories) error {
+	book, _, err := newBook(r, 0)
+	if err != nil {
+		return err
+	}
+	if err := r.Books.IncrementTotalCopies(nil, book.ID, 3); err != nil {
+		return fmt.Errorf("IncrementTotalCopies: %w", err)
+	}
+	got, err := r.Books.GetByID(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("GetByID: %w", err)
+	}
+	if got.TotalCopies != 3 {
+		return fmt.Errorf("TotalCopies = %d after +3, want 3", got.TotalCopies)
+	}
+	_, err = r.Books.GetByID(nil, uuid.New())
+	return expectNotFound("GetByID(unknown)", err)
+}
+
+// checkBookAvailability covers relative and absolute updates of the counts
+// and reading them back under a row lock.
+func checkBookAvailability(r *repositories.Repositories) error {
+	book, _, err := newBook(r, 2)
+	if err != nil {
+		return err
+	}
+	err = r.Transactor.Transaction(func(tx repositories.Tx) error {
+		if err := r.Books.AdjustAvailability(tx, book.ID, repositories.Availability{Available: -1, CheckedOut: 1, Holds: 2}); err != nil {
+			return fmt.Errorf("AdjustAvailability: %w", err)
+		}
+		got, err := r.Books.GetByIDForUpdate(tx, book.ID)
+		if err != nil {
+			return fmt.Errorf("GetByIDForUpdate: %w", err)
+		}
+		if got.AvailableCopies != 1 || got.CheckedOutCopies != 1 || got.Holds != 2 {
+			return fmt.Errorf("counts after adjust = %d/%d/%d, want 1/1/2", got.AvailableCopies, got.CheckedOutCopies, got.Holds)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.Books.SetAvailability(nil, book.ID, repositories.Availability{Available: 2}); err != nil {
+		return fmt.Errorf("SetAvailability: %w", err)
+	}
+	got, err := r.Books.GetByID(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("GetByID: %w", err)
+	}
+	if got.AvailableCopies != 2 || got.CheckedOutCopies != 0 || got.Holds != 0 || got.TotalCopies != 2 {
+		return fmt.Errorf("counts after set = %d/%d/%d (total %d), want 2/0/0 (total 2)",
+			got.AvailableCopies, got.CheckedOutCopies, got.Holds, got.TotalCopies)
+	}
+	return nil
+}
+
+// checkBookLoanType covers the STANDARD default and SetLoanType.
+func checkBookLoanType(r *repositories.Repositories) error {
+	book, _, err := newBook(r, 0)
+	if err != nil {
+		return err
+	}
+	got, err := r.Books.GetByID(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("GetByID: %w", err)
+	}
+	if got.LoanType != models.LoanTypeStandard || got.LoanHours != 0 {
+		return fmt.Errorf("new book has loan type %q/%d, want STANDARD/0", got.LoanType, got.LoanHours)
+	}
+	until := time.Date(2030, time.June, 30, 0, 0, 0, 0, time.UTC)
+	if err := r.Books.SetLoanType(nil, book.ID, models.LoanTypeShort, 3, &until); err != nil {
+		return fmt.Errorf("SetLoanType: %w", err)
+	}
+	got, err = r.Books.GetByID(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("GetByID: %w", err)
+	}
+	if got.LoanType != models.LoanTypeShort || got.LoanHours != 3 {
+		return fmt.Errorf("after SetLoanType: %q/%d, want SHORT/3", got.LoanType, got.LoanHours)
+	}
+	if got.LoanTypeUntil == nil || !got.LoanTypeUntil.Equal(until) {
+		return fmt.Errorf("LoanTypeUntil = %v, want %s", got.LoanTypeUntil, until.Format("2006-01-02"))
+	}
+	if err := r.Books.SetLoanType(nil, book.ID, models.LoanTypeOvernight, 0, nil); err != nil {
+		return fmt.Errorf("SetLoanType: %w", err)
+	}
+	got, err = r.Books.GetByID(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("GetByID: %w", err)
+	}
+	if got.LoanType != models.LoanTypeOvernight || got.LoanTypeUntil != nil {
+		return fmt.Errorf("after indefinite SetLoanType: %q until %v, want OVERNIGHT until nil", got.LoanType, got.LoanTypeUntil)
+	}
+	return nil
+}
+
+func checkFindAvailable(r *repositories.Repositories) error {
+	book, copies, err := newBook(r, 2)
+	if err != nil {
+		return err
+	}
+	for range copies {
+		c, err := r.BookCopies.FindAvailableForUpdate(nil, book.ID)
+		if err != nil {
+			return fmt.Errorf("FindAvailableForUpdate: %w", err)
+		}
+		if c.Status != models.BookCopyStatusAvailable {
+			return fmt.Errorf("FindAvailableForUpdate returned a %s copy", c.Status)
+		}
+		if err := r.BookCopies.UpdateStatus(nil, c.ID, models.BookCopyStatusCheckedOut); err != nil {
+			return fmt.Errorf("UpdateStatus: %w", err)
+		}
+	}
+	_, err = r.BookCopies.FindAvailableForUpdate(nil, book.ID)
+	return expectNotFound("FindAvailableForUpdate(all checked out)", err)
+}
+
+// checkFindAvailableSkipLocked runs the FindAvailableForUpdate check against
+// FindAvailableSkipLocked, which with nothing else locking rows must behave
+// the same, including inside a transaction.
+func checkFindAvailableSkipLocked(r *repositories.Repositories) error {
+	book, copies, err := newBook(r, 2)
+	if err != nil {
+		return err
+	}
+	for range copies {
+		err := r.Transactor.Transaction(func(tx repositories.Tx) error {
+			c, err := r.BookCopies.FindAvailableSkipLocked(tx, book.ID)
+			if err != nil {
+				return fmt.Errorf("FindAvailableSkipLocked: %w", err)
+			}
+			if c.Status != models.BookCopyStatusAvailable {
+				return fmt.Errorf("FindAvailableSkipLocked returned a %s copy", c.Status)
+			}
+			return r.BookCopies.UpdateStatus(tx, c.ID, models.BookCopyStatusCheckedOut)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = r.BookCopies.FindAvailableSkipLocked(nil, book.ID)
+	return expectNotFound("FindAvailableSkipLocked(all checked out)", err)
+}
+
+func checkUniqueActiveCheckout(r *repositories.Repositories) error {
+	user, err := newUser(r, "unique-active")
+	if err != nil {
+		return err
+	}
+	_, copies, err := newBook(r, 1)
+	if err != nil {
+		return err
+	}
+	due := time.Now().Add(24 * time.Hour)
+
+	first := newCheckout(copies[0].ID, user.ID, due)
+	if err := r.Checkouts.Create(nil, first); err != nil {
+		return fmt.Errorf("first Create: %w", err)
+	}
+	err = r.Checkouts.Create(nil, newCheckout(copies[0].ID, user.ID, due))
+	if !errors.Is(err, repositories.ErrUniqueViolation) {
+		return fmt.Errorf("second active checkout of one copy: want ErrUniqueViolation, got %v", err)
+	}
+
+	// Once returned, the copy may be checked out again.
+	if err := r.Checkouts.MarkReturned(nil, first.ID, time.Now(), 0); err != nil {
+		return fmt.Errorf("MarkReturned: %w", err)
+	}
+	if err := r.Checkouts.Create(nil, newCheckout(copies[0].ID, user.ID, due)); err != nil {
+		return fmt.Errorf("Create after return: %w", err)
+	}
+	return nil
+}
+
+func checkReturnAndFines(r *repositories.Repositories) error {
+	user, err := newUser(r, "fines")
+	if err != nil {
+		return err
+	}
+	_, copies, err := newBook(r, 2)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	overdue := newCheckout(copies[0].ID, user.ID, now.Add(-72*time.Hour))
+	current := newCheckout(copies[1].ID, user.ID, now.Add(72*time.Hour))
+	for _, c := range []*models.Checkout{overdue, current} {
+		if err := r.Checkouts.Create(nil, c); err != nil {
+			return fmt.Errorf("Create: %w", err)
+		}
+	}
+
+	list, err := r.Checkouts.ListOverdue(nil, now)
+	if err != nil {
+		return fmt.Errorf("ListOverdue: %w", err)
+	}
+	if !containsCheckout(list, overdue.ID) || containsCheckout(list, current.ID) {
+		return errors.New("ListOverdue must include only the overdue checkout")
+	}
+
+	if err := r.Checkouts.MarkReturned(nil, overdue.ID, now, 30); err != nil {
+		return fmt.Errorf("MarkReturned: %w", err)
+	}
+	// A second MarkReturned must not overwrite the original return.
+	if err := r.Checkouts.MarkReturned(nil, overdue.ID, now.Add(time.Hour), 99); err != nil {
+		return fmt.Errorf("second MarkReturned: %w", err)
+	}
+	got, err := r.Checkouts.GetByIDForUpdate(nil, overdue.ID)
+	if err != nil {
+		return fmt.Errorf("GetByIDForUpdate: %w", err)
+	}
+	if got.ReturnedAt == nil || !got.ReturnedAt.Equal(now) || got.FineAmount != 30 {
+		return fmt.Errorf("after MarkReturned: returned_at=%v fine=%d, want %v and 30", got.ReturnedAt, got.FineAmount, now)
+	}
+
+	if err := r.Checkouts.UpdateFine(nil, overdue.ID, 45); err != nil {
+		return fmt.Errorf("UpdateFine: %w", err)
+	}
+	mineOnly := repositories.ReturnedFilter{UserID: &user.ID}
+	returned, err := r.Checkouts.ListReturned(nil, mineOnly, uuid.Nil, 10)
+	if err != nil {
+		return fmt.Errorf("ListReturned: %w", err)
+	}
+	for _, c := range returned {
+		if c.ID == overdue.ID && c.FineAmount != 45 {
+			return fmt.Errorf("fine = %d after UpdateFine, want 45", c.FineAmount)
+		}
+	}
+	if !containsCheckout(returned, overdue.ID) || containsCheckout(returned, current.ID) {
+		return errors.New("ListReturned must include only the returned checkout")
+	}
+	if next, err := r.Checkouts.ListReturned(nil, mineOnly, overdue.ID, 10); err != nil || len(next) != 0 {
+		return fmt.Errorf("ListReturned after the last checkout = %d, %v; want none", len(next), err)
+	}
+	later := now.Add(time.Hour)
+	if got, err := r.Checkouts.ListReturned(nil, repositories.ReturnedFilter{UserID: &user.ID, Since: &later}, uuid.Nil, 10); err != nil || len(got) != 0 {
+		return fmt.Errorf("ListReturned since after the return = %d, %v; want none", len(got), err)
+	}
+	if got, err := r.Checkouts.ListReturned(nil, repositories.ReturnedFilter{CheckoutID: &overdue.ID, Since: &now}, uuid.Nil, 10); err != nil || len(got) != 1 || got[0].BookCopy.ID != copies[0].ID {
+		return fmt.Errorf("ListReturned of one checkout = %+v, %v; want it with its copy", got, err)
+	}
+
+	mine, err := r.Checkouts.ListByUser(nil, user.ID)
+	if err != nil {
+		return fmt.Errorf("ListByUser: %w", err)
+	}
+	if len(mine) != 2 {
+		return fmt.Errorf("ListByUser returned %d checkouts, want 2", len(mine))
+	}
+	return nil
+}
+
+func checkPreloadCopy(r *repositories.Repositories) error {
+	user, err := newUser(r, "preload")
+	if err != nil {
+		return err
+	}
+	_, copies, err := newBook(r, 1)
+	if err != nil {
+		return err
+	}
+	c := newCheckout(copies[0].ID, user.ID, time.Now().Add(time.Hour))
+	if err := r.Checkouts.Create(nil, c); err != nil {
+		return fmt.Errorf("Create: %w", err)
+	}
+	got, err := r.Checkouts.GetByIDForUpdate(nil, c.ID)
+	if err != nil {
+		return fmt.Errorf("GetByIDForUpdate: %w", err)
+	}
+	if got.BookCopy.ID != copies[0].ID || got.BookCopy.BookID != copies[0].BookID {
+		return errors.New("GetByIDForUpdate did not populate BookCopy")
+	}
+	_, err = r.Checkouts.GetByIDForUpdate(nil, uuid.New())
+	return expectNotFound("GetByIDForUpdate(unknown)", err)
+}
+
+func checkReservationQueue(r *repositories.Repositories) error {
+	book, _, err := newBook(r, 0)
+	if err != nil {
+		return err
+	}
+
+	pos, err := r.Reservations.GetNextQueuePosition(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("GetNextQueuePosition: %w", err)
+	}
+	if pos != 1 {
+		return fmt.Errorf("first queue position = %d, want 1", pos)
+	}
+	_, err = r.Reservations.GetNextForBook(nil, book.ID)
+	if err := expectNotFound("GetNextForBook(empty queue)", err); err != nil {
+		return err
+	}
+
+	var ids []uuid.UUID
+	for i := 0; i < 3; i++ {
+		user, err := newUser(r, "queue")
+		if err != nil {
+			return err
+		}
+		pos, err := r.Reservations.GetNextQueuePosition(nil, book.ID)
+		if err != nil {
+			return fmt.Errorf("GetNextQueuePosition: %w", err)
+		}
+		res := &models.Reservation{BookID: book.ID, UserID: user.ID, QueuePosition: pos, CreatedAt: time.Now()}
+		if err := r.Reservations.Create(nil, res); err != nil {
+			return fmt.Errorf("Create: %w", err)
+		}
+		ids = append(ids, res.ID)
+	}
+
+	list, err := r.Reservations.ListByBook(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("ListByBook: %w", err)
+	}
+	if len(list) != 3 {
+		return fmt.Errorf("ListByBook returned %d reservations, want 3", len(list))
+	}
+	for i, res := range list {
+		if res.ID != ids[i] || res.QueuePosition != i+1 {
+			return fmt.Errorf("ListByBook[%d] = position %d, want %d in creation order", i, res.QueuePosition, i+1)
+		}
+	}
+	empty, _, err := newBook(r, 0)
+	if err != nil {
+		return err
+	}
+	counts, err := r.Reservations.CountByBooks(nil, []uuid.UUID{book.ID, empty.ID})
+	if err != nil {
+		return fmt.Errorf("CountByBooks: %w", err)
+	}
+	if len(counts) != 1 || counts[book.ID] != 3 {
+		return fmt.Errorf("CountByBooks = %v, want 3 for the book only", counts)
+	}
+
+	next, err := r.Reservations.GetNextForBook(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("GetNextForBook: %w", err)
+	}
+	if next.ID != ids[0] {
+		return errors.New("GetNextForBook did not return the head of the queue")
+	}
+	if err := r.Reservations.Delete(nil, next.ID); err != nil {
+		return fmt.Errorf("Delete: %w", err)
+	}
+	next, err = r.Reservations.GetNextForBook(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("GetNextForBook after Delete: %w", err)
+	}
+	if next.ID != ids[1] {
+		return errors.New("GetNextForBook after Delete did not advance the queue")
+	}
+	return nil
+}
+
+func checkUniqueReservation(r *repositories.Repositories) error {
+	book, _, err := newBook(r, 0)
+	if err != nil {
+		return err
+	}
+	alice, err := newUser(r, "unique-reservation")
+	if err != nil {
+		return err
+	}
+	bob, err := newUser(r, "unique-reservation")
+	if err != nil {
+		return err
+	}
+
+	first := &models.Reservation{BookID: book.ID, UserID: alice.ID, QueuePosition: 1, CreatedAt: time.Now()}
+	if err := r.Reservations.Create(nil, first); err != nil {
+		return fmt.Errorf("Create: %w", err)
+	}
+	got, err := r.Reservations.GetByBookAndUser(nil, book.ID, alice.ID)
+	if err != nil {
+		return fmt.Errorf("GetByBookAndUser: %w", err)
+	}
+	if got.ID != first.ID {
+		return errors.New("GetByBookAndUser returned the wrong reservation")
+	}
+	_, err = r.Reservations.GetByBookAndUser(nil, book.ID, bob.ID)
+	if err := expectNotFound("GetByBookAndUser(no reservation)", err); err != nil {
+		return err
+	}
+
+	err = r.Reservations.Create(nil, &models.Reservation{BookID: book.ID, UserID: alice.ID, QueuePosition: 2, CreatedAt: time.Now()})
+	if !errors.Is(err, repositories.ErrUniqueViolation) {
+		return fmt.Errorf("duplicate user/book reservation: want ErrUniqueViolation, got %v", err)
+	}
+	err = r.Reservations.Create(nil, &models.Reservation{BookID: book.ID, UserID: bob.ID, QueuePosition: 1, CreatedAt: time.Now()})
+	if !errors.Is(err, repositories.ErrUniqueViolation) {
+		return fmt.Errorf("duplicate queue position: want ErrUniqueViolation, got %v", err)
+	}
+	return nil
+}
+
+func checkDequeue(r *repositories.Repositories) error {
+	book, _, err := newBook(r, 0)
+	if err != nil {
+		return err
+	}
+	var ids []uuid.UUID
+	var first *models.User
+	for pos := 1; pos <= 4; pos++ {
+		user, err := newUser(r, "dequeue")
+		if err != nil {
+			return err
+		}
+		if first == nil {
+			first = user
+		}
+		res := &models.Reservation{BookID: book.ID, UserID: user.ID, QueuePosition: pos, CreatedAt: time.Now()}
+		if err := r.Reservations.Create(nil, res); err != nil {
+			return fmt.Errorf("Create: %w", err)
+		}
+		ids = append(ids, res.ID)
+	}
+
+	// Leaving from the middle moves everyone behind up one place.
+	if err := r.Reservations.Dequeue(nil, ids[1]); err != nil {
+		return fmt.Errorf("Dequeue: %w", err)
+	}
+	if err := expectQueue(r, book.ID, ids[0], ids[2], ids[3]); err != nil {
+		return fmt.Errorf("after Dequeue: %w", err)
+	}
+	_, err = r.Reservations.GetByID(nil, ids[1])
+	if err := expectNotFound("GetByID(dequeued)", err); err != nil {
+		return err
+	}
+	err = r.Reservations.Dequeue(nil, ids[1])
+	if err := expectNotFound("Dequeue(dequeued)", err); err != nil {
+		return err
+	}
+	mine, err := r.Reservations.ListByUser(nil, first.ID)
+	if err != nil {
+		return fmt.Errorf("ListByUser: %w", err)
+	}
+	if len(mine) != 1 || mine[0].ID != ids[0] {
+		return fmt.Errorf("ListByUser returned %d reservations, want the user's one", len(mine))
+	}
+
+	// A queue with gaps and a position below 1 is renumbered in order.
+	gapped, _, err := newBook(r, 0)
+	if err != nil {
+		return err
+	}
+	ids = ids[:0]
+	for _, pos := range []int{0, 2, 6} {
+		user, err := newUser(r, "compact")
+		if err != nil {
+			return err
+		}
+		res := &models.Reservation{BookID: gapped.ID, UserID: user.ID, QueuePosition: pos, CreatedAt: time.Now()}
+		if err := r.Reservations.Create(nil, res); err != nil {
+			return fmt.Errorf("Create: %w", err)
+		}
+		ids = append(ids, res.ID)
+	}
+	if err := r.Reservations.CompactQueue(nil, gapped.ID); err != nil {
+		return fmt.Errorf("CompactQueue: %w", err)
+	}
+	if err := expectQueue(r, gapped.ID, ids...); err != nil {
+		return fmt.Errorf("after CompactQueue: %w", err)
+	}
+	return nil
+}
+
+// expectQueue checks that a book's queue holds exactly ids, at positions 1…n.
+func expectQueue(r *repositories.Repositories, bookID uuid.UUID, ids ...uuid.UUID) error {
+	queue, err := r.Reservations.ListByBook(nil, bookID)
+	if err != nil {
+		return fmt.Errorf("ListByBook: %w", err)
+	}
+	if len(queue) != len(ids) {
+		return fmt.Errorf("queue has %d reservations, want %d", len(queue), len(ids))
+	}
+	for i, res := range queue {
+		if res.ID != ids[i] || res.QueuePosition != i+1 {
+			return fmt.Errorf("queue[%d] is %s at position %d, want %s at %d", i, res.ID, res.QueuePosition, ids[i], i+1)
+		}
+	}
+	return nil
+}
+
+func checkCommit(r *repositories.Repositories) error {
+	book, _, err := newBook(r, 0)
+	if err != nil {
+		return err
+	}
+	err = r.Transactor.Transaction(func(tx repositories.Tx) error {
+		c := models.BookCopy{BookID: book.ID, Status: models.BookCopyStatusAvailable}
+		if err := r.BookCopies.Create(tx, &c); err != nil {
+			return err
+		}
+		// Writes are visible inside the transaction that made them.
+		if _, err := r.BookCopies.FindAvailableForUpdate(tx, book.ID); err != nil {
+			return fmt.Errorf("read own write: %w", err)
+		}
+		return r.Books.IncrementTotalCopies(tx, book.ID, 1)
+	})
+	if err != nil {
+		return fmt.Errorf("Transaction: %w", err)
+	}
+
+	got, err := r.Books.GetByID(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("GetByID: %w", err)
+	}
+	if got.TotalCopies != 1 {
+		return fmt.Errorf("TotalCopies = %d after commit, want 1", got.TotalCopies)
+	}
+	if _, err := r.BookCopies.FindAvailableForUpdate(nil, book.ID); err != nil {
+		return fmt.Errorf("committed copy not found: %w", err)
+	}
+	return nil
+}
+
+func checkRollback(r *repositories.Repositories) error {
+	book, _, err := newBook(r, 0)
+	if err != nil {
+		return err
+	}
+	sentinel := errors.New("abort")
+	err = r.Transactor.Transaction(func(tx repositories.Tx) error {
+		c := models.BookCopy{BookID: book.ID, Status: models.BookCopyStatusAvailable}
+		if err := r.BookCopies.Create(tx, &c); err != nil {
+			return err
+		}
+		if err := r.Books.IncrementTotalCopies(tx, book.ID, 1); err != nil {
+			return err
+		}
+		return sentinel
+	})
+	if !errors.Is(err, sentinel) {
+		return fmt.Errorf("Transaction returned %v, want fn's error", err)
+	}
+
+	got, err := r.Books.GetByID(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("GetByID: %w", err)
+	}
+	if got.TotalCopies != 0 {
+		return fmt.Errorf("TotalCopies = %d after rollback, want 0", got.TotalCopies)
+	}
+	_, err = r.BookCopies.FindAvailableForUpdate(nil, book.ID)
+	return expectNotFound("copy created in rolled-back transaction", err)
+}
+
+// checkRenewAndListActive covers Renew and the preloads of ListActive.
+// checkReadOnly reads committed rows through Transactor.ReadOnly, the handle
+// list and report queries use. Backends without replicas return nil, which
+// is the primary.
+func checkReadOnly(r *repositories.Repositories) error {
+	book, copies, err := newBook(r, 1)
+	if err != nil {
+		return err
+	}
+	user, err := newUser(r, "read-only")
+	if err != nil {
+		return err
+	}
+	if err := r.Checkouts.Create(nil, newCheckout(copies[0].ID, user.ID, time.Now().Add(24*time.Hour))); err != nil {
+		return fmt.Errorf("create checkout: %w", err)
+	}
+
+	rd := r.Transactor.ReadOnly()
+	books, err := r.Books.List(rd)
+	if err != nil {
+		return fmt.Errorf("List: %w", err)
+	}
+	if !slices.ContainsFunc(books, func(b models.Book) bool { return b.ID == book.ID }) {
+		return fmt.Errorf("List through ReadOnly is missing book %s", book.ID)
+	}
+	checkouts, err := r.Checkouts.ListByUser(rd, user.ID)
+	if err != nil {
+		return fmt.Errorf("ListByUser: %w", err)
+	}
+	if len(checkouts) != 1 || checkouts[0].BookCopyID != copies[0].ID {
+		return fmt.Errorf("ListByUser through ReadOnly returned %d checkouts, want the one of copy %s", len(checkouts), copies[0].ID)
+	}
+	return nil
+}
+
+func checkRenewAndListActive(r *repositories.Repositories) error {
+	user, err := newUser(r, "renew")
+	if err != nil {
+		return err
+	}
+	book, copies, err := newBook(r, 1)
+	if err != nil {
+		return err
+	}
+	due := time.Now().UTC().Truncate(time.Second).Add(24 * time.Hour)
+	checkout := newCheckout(copies[0].ID, user.ID, due)
+	if err := r.Checkouts.Create(nil, checkout); err != nil {
+		return fmt.Errorf("Create: %w", err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		due = due.Add(24 * time.Hour)
+		if err := r.Checkouts.Renew(nil, checkout.ID, due, models.LoanTypeOvernight); err != nil {
+			return fmt.Errorf("Renew: %w", err)
+		}
+	}
+	got, err := r.Checkouts.GetByIDForUpdate(nil, checkout.ID)
+	if err != nil {
+		return fmt.Errorf("GetByIDForUpdate: %w", err)
+	}
+	if got.Renewals != 2 || !got.DueDate.Equal(due) || got.LoanType != models.LoanTypeOvernight {
+		return fmt.Errorf("after two renewals: renewals=%d due=%v type=%s, want 2, %v and OVERNIGHT", got.Renewals, got.DueDate, got.LoanType, due)
+	}
+
+	active, err := r.Checkouts.ListActive(nil)
+	if err != nil {
+		return fmt.Errorf("ListActive: %w", err)
+	}
+	for _, c := range active {
+		if c.ID != checkout.ID {
+			continue
+		}
+		if c.User.Name != user.Name || c.BookCopy.Book.Title != book.Title {
+			return fmt.Errorf("ListActive preloads: user %q book %q, want %q and %q", c.User.Name, c.BookCopy.Book.Title, user.Name, book.Title)
+		}
+		if err := r.Checkouts.MarkReturned(nil, checkout.ID, time.Now().UTC(), 0); err != nil {
+			return fmt.Errorf("MarkReturned: %w", err)
+		}
+		active, err = r.Checkouts.ListActive(nil)
+		if err != nil {
+			return fmt.Errorf("ListActive: %w", err)
+		}
+		if containsCheckout(active, checkout.ID) {
+			return errors.New("ListActive still lists a returned checkout")
+		}
+		return nil
+	}
+	return errors.New("ListActive is missing the active checkout")
+}
+
+// checkTerms covers the term repository. Terms are placed in a random far
+// future year so the check can run against a database that already has terms.
+func checkTerms(r *repositories.Repositories) error {
+	year := 3000 + rand.Intn(5000)
+	day := func(month time.Month, d int) time.Time { return time.Date(year, month, d, 0, 0, 0, 0, time.UTC) }
+
+	term := &models.Term{Name: "repotest term", StartDate: day(time.March, 1), EndDate: day(time.March, 31)}
+	if err := r.Terms.Create(nil, term); err != nil {
+		return fmt.Errorf("Create: %w", err)
+	}
+	defer r.Terms.Delete(nil, term.ID)
+
+	for _, d := range []time.Time{day(time.March, 1), day(time.March, 15), day(time.March, 31)} {
+		got, err := r.Terms.FindByDate(nil, d)
+		if err != nil || got.ID != term.ID {
+			return fmt.Errorf("FindByDate(%s) = %v, %v; want the term", d.Format("2006-01-02"), got, err)
+		}
+	}
+	_, err := r.Terms.FindByDate(nil, day(time.April, 1))
+	if err := expectNotFound("FindByDate after the term", err); err != nil {
+		return err
+	}
+
+	term.EndDate = day(time.April, 30)
+	if err := r.Terms.Update(nil, term); err != nil {
+		return fmt.Errorf("Update: %w", err)
+	}
+	if got, err := r.Terms.FindByDate(nil, day(time.April, 1)); err != nil || got.ID != term.ID {
+		return fmt.Errorf("FindByDate after extending the term = %v, %v; want the term", got, err)
+	}
+	if err := expectNotFound("Update(unknown)", r.Terms.Update(nil, &models.Term{ID: uuid.New(), Name: "x", StartDate: term.StartDate, EndDate: term.EndDate})); err != nil {
+		return err
+	}
+	if err := r.Terms.Delete(nil, term.ID); err != nil {
+		return fmt.Errorf("Delete: %w", err)
+	}
+	return expectNotFound("Delete twice", r.Terms.Delete(nil, term.ID))
+}
+
+// checkCourses covers the course repository: unique codes, entries replaced
+// as a whole and listed by position, and the cascades from courses to reading
+// lists to entries and from terms to courses.
+func checkCourses(r *repositories.Repositories) error {
+	year := 3000 + rand.Intn(5000)
+	term := &models.Term{Name: "repotest term", StartDate: time.Date(year, time.May, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(year, time.May, 31, 0, 0, 0, 0, time.UTC)}
+	if err := r.Terms.Create(nil, term); err != nil {
+		return fmt.Errorf("create term: %w", err)
+	}
+	defer r.Terms.Delete(nil, term.ID)
+
+	code := "RT" + strings.ToUpper(uuid.NewString()[:8])
+	course := &models.Course{Code: code, Title: "repotest course", TermID: &term.ID}
+	if err := r.Courses.Create(nil, course); err != nil {
+		return fmt.Errorf("Create: %w", err)
+	}
+	defer r.Courses.Delete(nil, course.ID)
+	if err := r.Courses.Create(nil, &models.Course{Code: code, Title: "duplicate"}); !errors.Is(err, repositories.ErrUniqueViolation) {
+		return fmt.Errorf("duplicate code: want ErrUniqueViolation, got %v", err)
+	}
+	courses, err := r.Courses.List(nil)
+	if err != nil {
+		return fmt.Errorf("List: %w", err)
+	}
+	found := false
+	for i, c := range courses {
+		if i > 0 && courses[i-1].Code > c.Code {
+			return fmt.Errorf("List not ordered by code: %q before %q", courses[i-1].Code, c.Code)
+		}
+		found = found || c.ID == course.ID
+	}
+	if !found {
+		return fmt.Errorf("List does not include the new course")
+	}
+
+	list := &models.ReadingList{CourseID: course.ID, Title: "Week 1"}
+	if err := r.Courses.CreateReadingList(nil, list); err != nil {
+		return fmt.Errorf("CreateReadingList: %w", err)
+	}
+	if lists, err := r.Courses.ListReadingLists(nil, course.ID); err != nil || len(lists) != 1 || lists[0].ID != list.ID {
+		return fmt.Errorf("ListReadingLists = %v, %v; want the new list", lists, err)
+	}
+
+	first, _, err := newBook(r, 2)
+	if err != nil {
+		return err
+	}
+	second, _, err := newBook(r, 1)
+	if err != nil {
+		return err
+	}
+	entries := []models.ReadingListEntry{
+		{ReadingListID: list.ID, BookID: first.ID, Position: 2, Note: "chapters 1-3"},
+		{ReadingListID: list.ID, BookID: second.ID, Position: 1, Required: true},
+	}
+	if err := r.Courses.ReplaceEntries(nil, list.ID, entries); err != nil {
+		return fmt.Errorf("ReplaceEntries: %w", err)
+	}
+	got, err := r.Courses.ListEntries(nil, list.ID)
+	if err != nil {
+		return fmt.Errorf("ListEntries: %w", err)
+	}
+	if len(got) != 2 || got[0].BookID != second.ID || !got[0].Required || got[1].BookID != first.ID || got[1].Note != "chapters 1-3" {
+		return fmt.Errorf("ListEntries = %+v, want the second book then the first", got)
+	}
+	if got[0].Book.Title != second.Title {
+		return fmt.Errorf("ListEntries did not populate Book: %+v", got[0].Book)
+	}
+	clash := []models.ReadingListEntry{
+		{ReadingListID: list.ID, BookID: first.ID, Position: 1},
+		{ReadingListID: list.ID, BookID: second.ID, Position: 1},
+	}
+	if err := r.Courses.ReplaceEntries(nil, list.ID, clash); !errors.Is(err, repositories.ErrUniqueViolation) {
+		return fmt.Errorf("duplicate position: want ErrUniqueViolation, got %v", err)
+	}
+	if err := r.Courses.ReplaceEntries(nil, list.ID, entries[:1]); err != nil {
+		return fmt.Errorf("ReplaceEntries: %w", err)
+	}
+	if got, err := r.Courses.ListEntries(nil, list.ID); err != nil || len(got) != 1 || got[0].BookID != first.ID {
+		return fmt.Errorf("ListEntries after replacing = %v, %v; want only the first book", got, err)
+	}
+
+	copies, err := r.BookCopies.ListByBooks(nil, []uuid.UUID{first.ID, second.ID})
+	if err != nil {
+		return fmt.Errorf("ListByBooks: %w", err)
+	}
+	if len(copies) != 3 {
+		return fmt.Errorf("ListByBooks returned %d copies, want 3", len(copies))
+	}
+
+	if err := r.Terms.Delete(nil, term.ID); err != nil {
+		return fmt.Errorf("delete term: %w", err)
+	}
+	if c, err := r.Courses.GetByID(nil, course.ID); err != nil || c.TermID != nil {
+		return fmt.Errorf("course after deleting its term = %v, %v; want TermID nil", c, err)
+	}
+
+	if err := r.Courses.Delete(nil, course.ID); err != nil {
+		return fmt.Errorf("Delete: %w", err)
+	}
+	_, err = r.Courses.GetReadingList(nil, list.ID)
+	if err := expectNotFound("GetReadingList after deleting the course", err); err != nil {
+		return err
+	}
+	if got, err := r.Courses.ListEntries(nil, list.ID); err != nil || len(got) != 0 {
+		return fmt.Errorf("ListEntries after deleting the course = %v, %v; want none", got, err)
+	}
+	return expectNotFound("Delete twice", r.Courses.Delete(nil, course.ID))
+}
+
+// checkBranchCalendar covers the branch repository: hours are replaced as a
+// whole, closures are deduplicated on insert and listed by inclusive range.
+// checkISBNAndBarcodes covers the unique ISBN and barcode indexes and the
+// lookups bulk import relies on.
+func checkISBNAndBarcodes(r *repositories.Repositories) error {
+	isbn := randomISBN()
+	book := &models.Book{Title: "repotest " + uuid.NewString(), Author: "repotest", ISBN: &isbn}
+	if err := r.Books.Create(nil, book); err != nil {
+		return fmt.Errorf("create book: %w", err)
+	}
+	dup := &models.Book{Title: "repotest " + uuid.NewString(), Author: "repotest", ISBN: &isbn}
+	if err := r.Books.Create(nil, dup); !errors.Is(err, repositories.ErrUniqueViolation) {
+		return fmt.Errorf("duplicate ISBN: want ErrUniqueViolation, got %v", err)
+	}
+	// Books without an ISBN do not collide with each other.
+	if _, _, err := newBook(r, 0); err != nil {
+		return err
+	}
+	if _, _, err := newBook(r, 0); err != nil {
+		return err
+	}
+
+	found, err := r.Books.FindByISBNs(nil, []string{isbn, randomISBN()})
+	if err != nil {
+		return fmt.Errorf("FindByISBNs: %w", err)
+	}
+	if len(found) != 1 || found[0].ID != book.ID {
+		return fmt.Errorf("FindByISBNs returned %d books, want only %s", len(found), book.ID)
+	}
+	if found, err := r.Books.FindByISBNs(nil, nil); err != nil || len(found) != 0 {
+		return fmt.Errorf("FindByISBNs(none) = %d books, err %v; want none", len(found), err)
+	}
+
+	barcode := "RT" + uuid.NewString()
+	labelled := &models.BookCopy{BookID: book.ID, Status: models.BookCopyStatusAvailable, Barcode: &barcode}
+	if err := r.BookCopies.Create(nil, labelled); err != nil {
+		return fmt.Errorf("create copy: %w", err)
+	}
+	err = r.BookCopies.Create(nil, &models.BookCopy{BookID: book.ID, Status: models.BookCopyStatusAvailable, Barcode: &barcode})
+	if !errors.Is(err, repositories.ErrUniqueViolation) {
+		return fmt.Errorf("duplicate barcode: want ErrUniqueViolation, got %v", err)
+	}
+	copies, err := r.BookCopies.FindByBarcodes(nil, []string{barcode, "RT" + uuid.NewString()})
+	if err != nil {
+		return fmt.Errorf("FindByBarcodes: %w", err)
+	}
+	if len(copies) != 1 || copies[0].ID != labelled.ID {
+		return fmt.Errorf("FindByBarcodes returned %d copies, want only %s", len(copies), labelled.ID)
+	}
+	return nil
+}
+
+// checkEachWithCopies covers the streaming iteration exports use: title
+// order, each book's copies grouped with it, books without copies, and an
+// error from the callback stopping the walk.
+func checkEachWithCopies(r *repositories.Repositories) error {
+	prefix := "repotest each " + uuid.NewString()
+	second := &models.Book{Title: prefix + " b", Author: "repotest"}
+	first := &models.Book{Title: prefix + " a", Author: "repotest"}
+	for _, b := range []*models.Book{second, first} {
+		if err := r.Books.Create(nil, b); err != nil {
+			return fmt.Errorf("create book: %w", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := r.BookCopies.Create(nil, &models.BookCopy{BookID: second.ID, Status: models.BookCopyStatusAvailable}); err != nil {
+			return fmt.Errorf("create copy: %w", err)
+		}
+	}
+
+	var order []uuid.UUID
+	counts := map[uuid.UUID]int{}
+	err := r.Books.EachWithCopies(nil, func(book models.Book, copies []models.BookCopy) error {
+		for i, c := range copies {
+			if c.BookID != book.ID {
+				return fmt.Errorf("book %s was given copy %s of book %s", book.ID, c.ID, c.BookID)
+			}
+			if i > 0 && c.ID.String() <= copies[i-1].ID.String() {
+				return fmt.Errorf("copies of book %s are not in ID order", book.ID)
+			}
+		}
+		if book.ID == first.ID || book.ID == second.ID {
+			order = append(order, book.ID)
+			counts[book.ID] = len(copies)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("EachWithCopies: %w", err)
+	}
+	if len(order) != 2 || order[0] != first.ID || order[1] != second.ID {
+		return fmt.Errorf("EachWithCopies visited %v, want %s then %s", order, first.ID, second.ID)
+	}
+	if counts[first.ID] != 0 || counts[second.ID] != 3 {
+		return fmt.Errorf("EachWithCopies gave %d and %d copies, want 0 and 3", counts[first.ID], counts[second.ID])
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = r.Books.EachWithCopies(nil, func(models.Book, []models.BookCopy) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		return fmt.Errorf("callback error: got %v after %d calls, want stop after 1", err, calls)
+	}
+	return nil
+}
+
+func checkBranchCalendar(r *repositories.Repositories) error {
+	branch := &models.Branch{Name: "repotest " + uuid.NewString(), Timezone: "Europe/Berlin"}
+	if err := r.Branches.Create(nil, branch); err != nil {
+		return fmt.Errorf("create branch: %w", err)
+	}
+	got, err := r.Branches.GetByID(nil, branch.ID)
+	if err != nil {
+		return fmt.Errorf("get branch: %w", err)
+	}
+	if got.Timezone != "Europe/Berlin" {
+		return fmt.Errorf("timezone = %q, want Europe/Berlin", got.Timezone)
+	}
+	_, err = r.Branches.GetByID(nil, uuid.New())
+	if err := expectNotFound("unknown branch", err); err != nil {
+		return err
+	}
+
+	hours := func(days ...int) []models.OpeningHours {
+		var out []models.OpeningHours
+		for _, d := range days {
+			out = append(out, models.OpeningHours{BranchID: branch.ID, Weekday: d, Opens: "09:00", Closes: "17:00"})
+		}
+		return out
+	}
+	if err := r.Branches.ReplaceOpeningHours(nil, branch.ID, hours(3, 1, 2)); err != nil {
+		return fmt.Errorf("replace hours: %w", err)
+	}
+	if err := r.Branches.ReplaceOpeningHours(nil, branch.ID, hours(5, 4)); err != nil {
+		return fmt.Errorf("replace hours again: %w", err)
+	}
+	listed, err := r.Branches.ListOpeningHours(nil, branch.ID)
+	if err != nil {
+		return fmt.Errorf("list hours: %w", err)
+	}
+	if len(listed) != 2 || listed[0].Weekday != 4 || listed[1].Weekday != 5 {
+		return fmt.Errorf("hours after replace = %+v, want weekdays 4 and 5", listed)
+	}
+	err = r.Transactor.Transaction(func(tx repositories.Tx) error {
+		return r.Branches.ReplaceOpeningHours(tx, branch.ID, hours(1, 1))
+	})
+	if !errors.Is(err, repositories.ErrUniqueViolation) {
+		return fmt.Errorf("duplicate weekday: want ErrUniqueViolation, got %v", err)
+	}
+
+	day := func(s string) time.Time {
+		t, _ := time.Parse("2006-01-02", s)
+		return t
+	}
+	closure := func(date string) models.Closure {
+		return models.Closure{BranchID: branch.ID, Date: day(date), Reason: "repotest"}
+	}
+	added, err := r.Branches.AddClosures(nil, []models.Closure{closure("2026-12-25"), closure("2026-12-24"), closure("2027-01-01")})
+	if err != nil || added != 3 {
+		return fmt.Errorf("add closures: added=%d err=%v, want 3", added, err)
+	}
+	added, err = r.Branches.AddClosures(nil, []models.Closure{closure("2026-12-25"), closure("2026-12-31")})
+	if err != nil || added != 1 {
+		return fmt.Errorf("add overlapping closures: added=%d err=%v, want 1", added, err)
+	}
+	closures, err := r.Branches.ListClosures(nil, branch.ID, day("2026-12-24"), day("2026-12-31"))
+	if err != nil {
+		return fmt.Errorf("list closures: %w", err)
+	}
+	var dates []string
+	for _, c := range closures {
+		dates = append(dates, c.Date.UTC().Format("2006-01-02"))
+	}
+	if want := "2026-12-24 2026-12-25 2026-12-31"; strings.Join(dates, " ") != want {
+		return fmt.Errorf("closures in range = %v, want %s", dates, want)
+	}
+	if err := r.Branches.DeleteClosure(nil, branch.ID, day("2026-12-24")); err != nil {
+		return fmt.Errorf("delete closure: %w", err)
+	}
+	return expectNotFound("deleting a closure twice", r.Branches.DeleteClosure(nil, branch.ID, day("2026-12-24")))
+}
+
+// checkCopyBranch covers assigning a copy to a branch and back.
+func checkCopyBranch(r *repositories.Repositories) error {
+	_, copies, err := newBook(r, 1)
+	if err != nil {
+		return err
+	}
+	branch := &models.Branch{Name: "repotest " + uuid.NewString()}
+	if err := r.Branches.Create(nil, branch); err != nil {
+		return fmt.Errorf("create branch: %w", err)
+	}
+	if branch.Timezone != "UTC" {
+		return fmt.Errorf("default timezone = %q, want UTC", branch.Timezone)
+	}
+	if err := r.BookCopies.SetBranch(nil, copies[0].ID, &branch.ID); err != nil {
+		return fmt.Errorf("set branch: %w", err)
+	}
+	copy, err := r.BookCopies.GetByID(nil, copies[0].ID)
+	if err != nil {
+		return fmt.Errorf("get copy: %w", err)
+	}
+	if copy.BranchID == nil || *copy.BranchID != branch.ID {
+		return fmt.Errorf("copy branch = %v, want %s", copy.BranchID, branch.ID)
+	}
+	locked, err := r.BookCopies.FindAvailableForUpdate(nil, copy.BookID)
+	if err != nil {
+		return fmt.Errorf("find available: %w", err)
+	}
+	if locked.BranchID == nil || *locked.BranchID != branch.ID {
+		return fmt.Errorf("FindAvailableForUpdate branch = %v, want %s", locked.BranchID, branch.ID)
+	}
+	if err := r.BookCopies.SetBranch(nil, copy.ID, nil); err != nil {
+		return fmt.Errorf("clear branch: %w", err)
+	}
+	if copy, err = r.BookCopies.GetByID(nil, copy.ID); err != nil || copy.BranchID != nil {
+		return fmt.Errorf("copy branch after clearing = %v (err %v), want none", copy.BranchID, err)
+	}
+	_, err = r.BookCopies.GetByID(nil, uuid.New())
+	return expectNotFound("unknown copy", err)
+}
+
+// checkCheckoutCommitsReservation checks out a book with no copy left: the
+// reservation CheckoutBook returns must be committed, with its hold counted,
+// rather than rolled back behind an ErrNoAvailableCopy. With reservations
+// disabled nothing is queued.
+func checkCheckoutCommitsReservation(r *repositories.Repositories) error {
+	book, _, err := newBook(r, 0)
+	if err != nil {
+		return err
+	}
+	user, err := newUser(r, "queued")
+	if err != nil {
+		return err
+	}
+
+	checkout, res, err := newService(r, clock.System(), services.DefaultPolicy()).CheckoutBook(book.ID, user.ID)
+	if err != nil || checkout != nil || res == nil {
+		return fmt.Errorf("CheckoutBook: checkout=%v reservation=%v err=%v, want a reservation", checkout, res, err)
+	}
+	stored, err := r.Reservations.GetByBookAndUser(nil, book.ID, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetByBookAndUser: %w", err)
+	}
+	if stored.ID != res.ID || stored.QueuePosition != 1 {
+		return fmt.Errorf("stored reservation = %+v, want %s at position 1", stored, res.ID)
+	}
+	got, err := r.Books.GetByID(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("GetByID: %w", err)
+	}
+	if got.Holds != 1 {
+		return fmt.Errorf("holds = %d after the reservation, want 1", got.Holds)
+	}
+
+	closed := services.DefaultPolicy()
+	closed.ReservationsEnabled = false
+	other, err := newUser(r, "not queued")
+	if err != nil {
+		return err
+	}
+	if _, _, err := newService(r, clock.System(), closed).CheckoutBook(book.ID, other.ID); !errors.Is(err, services.ErrReservationsDisabled) {
+		return fmt.Errorf("CheckoutBook with reservations disabled: want ErrReservationsDisabled, got %v", err)
+	}
+	_, err = r.Reservations.GetByBookAndUser(nil, book.ID, other.ID)
+	return expectNotFound("reservation with reservations disabled", err)
+}
+
+// checkServiceFlow runs the service's checkout → reservation → return →
+// auto-checkout sequence on top of the backend.
+func checkServiceFlow(r *repositories.Repositories) error {
+	svc := newService(r, clock.System(), services.DefaultPolicy())
+
+	book, err := svc.CreateBook("repotest "+uuid.NewString(), "repotest", 1)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+	alice, err := svc.CreateUser("repotest service", models.UserRoleStudent)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+	bob, err := svc.CreateUser("repotest service", models.UserRoleStudent)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+
+	checkout, res, err := svc.CheckoutBook(book.ID, alice.ID)
+	if err != nil || checkout == nil || res != nil {
+		return fmt.Errorf("first CheckoutBook: checkout=%v reservation=%v err=%v, want a checkout", checkout, res, err)
+	}
+	checkout2, res, err := svc.CheckoutBook(book.ID, bob.ID)
+	if err != nil || checkout2 != nil || res == nil {
+		return fmt.Errorf("second CheckoutBook: checkout=%v reservation=%v err=%v, want a reservation", checkout2, res, err)
+	}
+	if _, _, err := svc.CheckoutBook(book.ID, bob.ID); !errors.Is(err, services.ErrDuplicateReservation) {
+		return fmt.Errorf("repeat CheckoutBook: want ErrDuplicateReservation, got %v", err)
+	}
+
+	if _, err := svc.ReturnCheckout(checkout.ID); err != nil {
+		return fmt.Errorf("ReturnCheckout: %w", err)
+	}
+	if _, err := svc.ReturnCheckout(checkout.ID); !errors.Is(err, services.ErrCheckoutAlreadyReturned) {
+		return fmt.Errorf("repeat ReturnCheckout: want ErrCheckoutAlreadyReturned, got %v", err)
+	}
+
+	bobs, err := svc.ListUserCheckouts(bob.ID)
+	if err != nil {
+		return fmt.Errorf("ListUserCheckouts: %w", err)
+	}
+	if len(bobs) != 1 || bobs[0].ReturnedAt != nil {
+		return fmt.Errorf("reserving user has %d checkouts after return, want 1 active (auto-checkout)", len(bobs))
+	}
+	queue, err := svc.ListReservationsForBook(book.ID)
+	if err != nil {
+		return fmt.Errorf("ListReservationsForBook: %w", err)
+	}
+	if len(queue) != 0 {
+		return fmt.Errorf("%d reservations left after auto-checkout, want 0", len(queue))
+	}
+	return nil
+}
+
+// checkOverdueReturn drives the service with a fake clock: a book kept 20 days
+// on a 14-day loan must show up as 6 days overdue and be fined accordingly.
+func checkOverdueReturn(r *repositories.Repositories) error {
+	clk := clock.NewFake(time.Now())
+	policy := services.DefaultPolicy()
+	svc := newService(r, clk, policy)
+
+	book, err := svc.CreateBook("repotest "+uuid.NewString(), "repotest", 1)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+	user, err := svc.CreateUser("repotest overdue", models.UserRoleStudent)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+	checkout, _, err := svc.CheckoutBook(book.ID, user.ID)
+	if err != nil || checkout == nil {
+		return fmt.Errorf("CheckoutBook: checkout=%v err=%v", checkout, err)
+	}
+	if want := clk.Now().UTC().AddDate(0, 0, policy.LoanPeriodDays); !checkout.DueDate.Equal(want) {
+		return fmt.Errorf("due date %s, want %s", checkout.DueDate, want)
+	}
+
+	clk.Advance(20 * 24 * time.Hour)
+	wantDays := 20 - policy.LoanPeriodDays
+
+	report, err := svc.ListOverdueCheckouts()
+	if err != nil {
+		return fmt.Errorf("ListOverdueCheckouts: %w", err)
+	}
+	found := false
+	for _, o := range report {
+		if o.ID != checkout.ID {
+			continue
+		}
+		found = true
+		if o.DaysOverdue != wantDays || o.AccruedFine != wantDays*policy.FinePerDay {
+			return fmt.Errorf("overdue report: %d days / fine %d, want %d / %d", o.DaysOverdue, o.AccruedFine, wantDays, wantDays*policy.FinePerDay)
+		}
+	}
+	if !found {
+		return errors.New("checkout missing from overdue report")
+	}
+
+	returned, err := svc.ReturnCheckout(checkout.ID)
+	if err != nil {
+		return fmt.Errorf("ReturnCheckout: %w", err)
+	}
+	if returned.FineAmount != wantDays*policy.FinePerDay {
+		return fmt.Errorf("fine on return = %d, want %d", returned.FineAmount, wantDays*policy.FinePerDay)
+	}
+	if returned.ReturnedAt == nil || returned.ReturnedAt.Sub(clk.Now()).Abs() > time.Second {
+		return fmt.Errorf("returned_at = %v, want the fake clock's %v", returned.ReturnedAt, clk.Now())
+	}
+	return nil
+}
+
+func containsCheckout(list []models.Checkout, id uuid.UUID) bool {
+	for _, c := range list {
+		if c.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBranchDueDatesAndFines drives the calendar-aware service on a fake
+// clock. The branch (Europe/Berlin) opens Monday to Friday 09:00-17:00.
+//
+// A loan taken on Friday 2 January 2026 is due 14 days later on Friday the
+// 16th, which is a closure, so the due date rolls to Monday the 19th at
+// closing time. Returned on Monday the 26th, it is late on Tue 20, Thu 22,
+// Fri 23 and Mon 26: the weekend and the imported closure on the 21st are
+// not charged.
+func checkBranchDueDatesAndFines(r *repositories.Repositories) error {
+	clk := clock.NewFake(time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC))
+	policy := services.DefaultPolicy()
+	svc := newService(r, clk, policy)
+
+	branch, err := svc.CreateBranch("repotest "+uuid.NewString(), "Europe/Berlin")
+	if err != nil {
+		return fmt.Errorf("CreateBranch: %w", err)
+	}
+	if _, err := svc.CreateBranch("repotest", "Mars/Olympus_Mons"); !errors.Is(err, services.ErrInvalidTimezone) {
+		return fmt.Errorf("CreateBranch with bad zone: want ErrInvalidTimezone, got %v", err)
+	}
+	var week []models.OpeningHours
+	for d := 1; d <= 5; d++ {
+		week = append(week, models.OpeningHours{Weekday: d, Opens: "09:00", Closes: "17:00"})
+	}
+	if _, err := svc.SetOpeningHours(branch.ID, week); err != nil {
+		return fmt.Errorf("SetOpeningHours: %w", err)
+	}
+	bad := []models.OpeningHours{{Weekday: 1, Opens: "17:00", Closes: "09:00"}}
+	if _, err := svc.SetOpeningHours(branch.ID, bad); !errors.Is(err, services.ErrInvalidOpeningHours) {
+		return fmt.Errorf("SetOpeningHours with closes before opens: want ErrInvalidOpeningHours, got %v", err)
+	}
+	if _, err := svc.AddClosure(branch.ID, time.Date(2026, 1, 16, 0, 0, 0, 0, time.UTC), "Staff training"); err != nil {
+		return fmt.Errorf("AddClosure: %w", err)
+	}
+	if _, err := svc.AddClosure(branch.ID, time.Date(2026, 1, 16, 0, 0, 0, 0, time.UTC), ""); !errors.Is(err, services.ErrClosureExists) {
+		return fmt.Errorf("repeat AddClosure: want ErrClosureExists, got %v", err)
+	}
+
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:christmas@repotest",
+		"DTSTART;VALUE=DATE:20251225",
+		"RRULE:FREQ=YEARLY",
+		"SUMMARY:Christmas Day",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:stocktake@repotest",
+		"DTSTART;VALUE=DATE:20260121",
+		"SUMMARY:Stocktake",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+	added, err := svc.ImportClosures(branch.ID, strings.NewReader(ics))
+	if err != nil {
+		return fmt.Errorf("ImportClosures: %w", err)
+	}
+	// Christmas 2025 through 2030 (five years ahead of the clock) plus the stocktake.
+	if added != 7 {
+		return fmt.Errorf("ImportClosures added %d closures, want 7", added)
+	}
+	if added, err := svc.ImportClosures(branch.ID, strings.NewReader(ics)); err != nil || added != 0 {
+		return fmt.Errorf("repeat ImportClosures: added=%d err=%v, want 0", added, err)
+	}
+	if _, err := svc.ImportClosures(branch.ID, strings.NewReader("BEGIN:VEVENT\r\nDTSTART:2026\r\n")); !errors.Is(err, services.ErrInvalidICal) {
+		return fmt.Errorf("ImportClosures of a broken file: want ErrInvalidICal, got %v", err)
+	}
+
+	book, err := svc.CreateBook("repotest "+uuid.NewString(), "repotest", 1)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+	copy, err := r.BookCopies.FindAvailableForUpdate(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("find copy: %w", err)
+	}
+	if _, err := svc.AssignCopyBranch(copy.ID, &branch.ID, 0); err != nil {
+		return fmt.Errorf("AssignCopyBranch: %w", err)
+	}
+	user, err := svc.CreateUser("repotest calendar", models.UserRoleStudent)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+
+	checkout, _, err := svc.CheckoutBook(book.ID, user.ID)
+	if err != nil || checkout == nil {
+		return fmt.Errorf("CheckoutBook: checkout=%v err=%v", checkout, err)
+	}
+	if want := time.Date(2026, 1, 19, 16, 0, 0, 0, time.UTC); !checkout.DueDate.Equal(want) {
+		return fmt.Errorf("due date %s, want %s (Monday 17:00 Berlin)", checkout.DueDate.UTC(), want)
+	}
+
+	clk.Set(time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC))
+	const wantDays = 4
+	report, err := svc.ListOverdueCheckouts()
+	if err != nil {
+		return fmt.Errorf("ListOverdueCheckouts: %w", err)
+	}
+	found := false
+	for _, o := range report {
+		if o.ID == checkout.ID {
+			found = true
+			if o.DaysOverdue != wantDays {
+				return fmt.Errorf("overdue report: %d days, want %d open days", o.DaysOverdue, wantDays)
+			}
+		}
+	}
+	if !found {
+		return errors.New("checkout missing from overdue report")
+	}
+	returned, err := svc.ReturnCheckout(checkout.ID)
+	if err != nil {
+		return fmt.Errorf("ReturnCheckout: %w", err)
+	}
+	if returned.FineAmount != wantDays*policy.FinePerDay {
+		return fmt.Errorf("fine on return = %d, want %d", returned.FineAmount, wantDays*policy.FinePerDay)
+	}
+	return nil
+}
+
+// checkTermEndAndRenewals drives term-end capping and renewals on a fake clock
+// in the middle of a term running 10-20 January of a random far future year.
+func checkTermEndAndRenewals(r *repositories.Repositories) error {
+	year := 3000 + rand.Intn(5000)
+	clk := clock.NewFake(time.Date(year, time.January, 15, 10, 0, 0, 0, time.UTC))
+	policy := services.DefaultPolicy()
+	svc := newService(r, clk, policy)
+
+	term, err := svc.CreateTerm("repotest term", time.Date(year, time.January, 10, 0, 0, 0, 0, time.UTC), time.Date(year, time.January, 20, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return fmt.Errorf("CreateTerm: %w", err)
+	}
+	defer svc.DeleteTerm(term.ID)
+	if _, err := svc.CreateTerm("repotest overlap", time.Date(year, time.January, 20, 0, 0, 0, 0, time.UTC), time.Date(year, time.February, 1, 0, 0, 0, 0, time.UTC)); !errors.Is(err, services.ErrTermOverlap) {
+		return fmt.Errorf("overlapping CreateTerm: want ErrTermOverlap, got %v", err)
+	}
+
+	student, err := svc.CreateUser("repotest student", models.UserRoleStudent)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+	librarian, err := svc.CreateUser("repotest librarian", models.UserRoleLibrarian)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+	book, err := svc.CreateBook("repotest "+uuid.NewString(), "repotest", 2)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+
+	studentLoan, _, err := svc.CheckoutBook(book.ID, student.ID)
+	if err != nil || studentLoan == nil {
+		return fmt.Errorf("student CheckoutBook: checkout=%v err=%v", studentLoan, err)
+	}
+	if want := time.Date(year, time.January, 20, 23, 59, 59, 0, time.UTC); !studentLoan.DueDate.Equal(want) {
+		return fmt.Errorf("student due date %s, want the end of term %s", studentLoan.DueDate, want)
+	}
+	staffLoan, _, err := svc.CheckoutBook(book.ID, librarian.ID)
+	if err != nil || staffLoan == nil {
+		return fmt.Errorf("librarian CheckoutBook: checkout=%v err=%v", staffLoan, err)
+	}
+	if want := clk.Now().AddDate(0, 0, policy.LoanPeriodDays); !staffLoan.DueDate.Equal(want) {
+		return fmt.Errorf("librarian due date %s, want %s (not capped)", staffLoan.DueDate, want)
+	}
+
+	report, err := svc.TermEndReport(&term.ID)
+	if err != nil {
+		return fmt.Errorf("TermEndReport: %w", err)
+	}
+	flags := map[uuid.UUID]bool{}
+	for _, l := range report.Loans {
+		flags[l.ID] = l.DueAfterTermEnd
+	}
+	if after, ok := flags[studentLoan.ID]; !ok || after {
+		return fmt.Errorf("term-end report: student loan listed=%v due_after_term_end=%v, want listed and false", ok, after)
+	}
+	if after, ok := flags[staffLoan.ID]; !ok || !after {
+		return fmt.Errorf("term-end report: librarian loan listed=%v due_after_term_end=%v, want listed and true", ok, after)
+	}
+
+	if _, err := svc.RenewCheckout(studentLoan.ID); !errors.Is(err, services.ErrRenewalNotExtended) {
+		return fmt.Errorf("student RenewCheckout at term end: want ErrRenewalNotExtended, got %v", err)
+	}
+	for i := 1; i <= policy.MaxRenewals; i++ {
+		clk.Advance(24 * time.Hour)
+		renewed, err := svc.RenewCheckout(staffLoan.ID)
+		if err != nil {
+			return fmt.Errorf("RenewCheckout #%d: %w", i, err)
+		}
+		if want := clk.Now().AddDate(0, 0, policy.LoanPeriodDays); renewed.Renewals != i || !renewed.DueDate.Equal(want) {
+			return fmt.Errorf("after renewal #%d: renewals=%d due=%s, want %d and %s", i, renewed.Renewals, renewed.DueDate, i, want)
+		}
+	}
+	if _, err := svc.RenewCheckout(staffLoan.ID); !errors.Is(err, services.ErrRenewalLimitReached) {
+		return fmt.Errorf("RenewCheckout past the limit: want ErrRenewalLimitReached, got %v", err)
+	}
+
+	// A queued reader blocks the student's renewal; an overdue loan cannot be renewed at all.
+	waiting, err := svc.CreateUser("repotest waiting", models.UserRoleStudent)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+	if _, res, err := svc.CheckoutBook(book.ID, waiting.ID); err != nil || res == nil {
+		return fmt.Errorf("CheckoutBook with no copy left: reservation=%v err=%v", res, err)
+	}
+	if _, err := svc.RenewCheckout(studentLoan.ID); !errors.Is(err, services.ErrRenewalBlocked) {
+		return fmt.Errorf("RenewCheckout with a queue: want ErrRenewalBlocked, got %v", err)
+	}
+	clk.Set(time.Date(year, time.January, 21, 9, 0, 0, 0, time.UTC))
+	if _, err := svc.RenewCheckout(studentLoan.ID); !errors.Is(err, services.ErrCheckoutOverdue) {
+		return fmt.Errorf("overdue RenewCheckout: want ErrCheckoutOverdue, got %v", err)
+	}
+	return nil
+}
+
+// checkHourlyLoans runs SHORT and OVERNIGHT loans against a branch open
+// Monday to Friday 09:00-17:00 UTC: due times stop at closing time or fall at
+// the next opening, and fines count the open hours late.
+func checkHourlyLoans(r *repositories.Repositories) error {
+	clk := clock.NewFake(time.Date(2026, 3, 4, 15, 30, 0, 0, time.UTC)) // Wednesday
+	policy := services.DefaultPolicy()
+	svc := newService(r, clk, policy)
+
+	branch, err := svc.CreateBranch("repotest "+uuid.NewString(), "UTC")
+	if err != nil {
+		return fmt.Errorf("CreateBranch: %w", err)
+	}
+	var week []models.OpeningHours
+	for d := 1; d <= 5; d++ {
+		week = append(week, models.OpeningHours{Weekday: d, Opens: "09:00", Closes: "17:00"})
+	}
+	if _, err := svc.SetOpeningHours(branch.ID, week); err != nil {
+		return fmt.Errorf("SetOpeningHours: %w", err)
+	}
+	// A librarian, so that no academic term in the database caps the loans.
+	user, err := svc.CreateUser("repotest hourly", models.UserRoleLibrarian)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+
+	newLoanBook := func(lt models.LoanType, hours int) (*models.Book, error) {
+		book, err := svc.CreateBook("repotest "+uuid.NewString(), "repotest", 1)
+		if err != nil {
+			return nil, fmt.Errorf("CreateBook: %w", err)
+		}
+		if book, err = svc.SetBookLoanType(book.ID, lt, hours, 0); err != nil {
+			return nil, fmt.Errorf("SetBookLoanType(%s, %d): %w", lt, hours, err)
+		}
+		copy, err := r.BookCopies.FindAvailableForUpdate(nil, book.ID)
+		if err != nil {
+			return nil, fmt.Errorf("find copy: %w", err)
+		}
+		if _, err := svc.AssignCopyBranch(copy.ID, &branch.ID, 0); err != nil {
+			return nil, fmt.Errorf("AssignCopyBranch: %w", err)
+		}
+		return book, nil
+	}
+	checkout := func(book *models.Book, wantDue time.Time) (*models.Checkout, error) {
+		c, _, err := svc.CheckoutBook(book.ID, user.ID)
+		if err != nil || c == nil {
+			return nil, fmt.Errorf("CheckoutBook: checkout=%v err=%v", c, err)
+		}
+		if c.LoanType != book.LoanType || !c.DueDate.Equal(wantDue) {
+			return nil, fmt.Errorf("%s loan due %s, want %s", c.LoanType, c.DueDate.UTC(), wantDue)
+		}
+		return c, nil
+	}
+
+	short, err := newLoanBook(models.LoanTypeShort, 2)
+	if err != nil {
+		return err
+	}
+	for _, bad := range []struct {
+		lt    models.LoanType
+		hours int
+	}{{models.LoanTypeShort, 0}, {models.LoanTypeStandard, 2}, {"WEEKLY", 0}} {
+		if _, err := svc.SetBookLoanType(short.ID, bad.lt, bad.hours, 0); !errors.Is(err, services.ErrInvalidLoanType) {
+			return fmt.Errorf("SetBookLoanType(%q, %d): want ErrInvalidLoanType, got %v", bad.lt, bad.hours, err)
+		}
+	}
+
+	// 15:30 + 2h runs past closing: due at 17:00.
+	loan, err := checkout(short, time.Date(2026, 3, 4, 17, 0, 0, 0, time.UTC))
+	if err != nil {
+		return err
+	}
+	// Back Thursday 10:10: 1h10m of opening hours late, charged as 2 hours.
+	clk.Set(time.Date(2026, 3, 5, 10, 10, 0, 0, time.UTC))
+	const wantHours = 2
+	report, err := svc.ListOverdueCheckouts()
+	if err != nil {
+		return fmt.Errorf("ListOverdueCheckouts: %w", err)
+	}
+	found := false
+	for _, o := range report {
+		if o.ID == loan.ID {
+			found = true
+			if o.HoursOverdue != wantHours || o.DaysOverdue != 0 || o.AccruedFine != wantHours*policy.FinePerHour {
+				return fmt.Errorf("overdue report: %d h / %d d / fine %d, want %d h / 0 d / %d", o.HoursOverdue, o.DaysOverdue, o.AccruedFine, wantHours, wantHours*policy.FinePerHour)
+			}
+		}
+	}
+	if !found {
+		return errors.New("short loan missing from overdue report")
+	}
+	returned, err := svc.ReturnCheckout(loan.ID)
+	if err != nil {
+		return fmt.Errorf("ReturnCheckout: %w", err)
+	}
+	if returned.FineAmount != wantHours*policy.FinePerHour {
+		return fmt.Errorf("fine on return = %d, want %d", returned.FineAmount, wantHours*policy.FinePerHour)
+	}
+
+	// Renewing a short loan runs another two hours from now.
+	loan, err = checkout(short, time.Date(2026, 3, 5, 12, 10, 0, 0, time.UTC))
+	if err != nil {
+		return err
+	}
+	clk.Set(time.Date(2026, 3, 5, 11, 0, 0, 0, time.UTC))
+	renewed, err := svc.RenewCheckout(loan.ID)
+	if err != nil {
+		return fmt.Errorf("RenewCheckout: %w", err)
+	}
+	if want := time.Date(2026, 3, 5, 13, 0, 0, 0, time.UTC); !renewed.DueDate.Equal(want) || renewed.LoanType != models.LoanTypeShort {
+		return fmt.Errorf("renewed short loan: %s due %s, want SHORT due %s", renewed.LoanType, renewed.DueDate.UTC(), want)
+	}
+	if _, err := svc.ReturnCheckout(loan.ID); err != nil {
+		return fmt.Errorf("ReturnCheckout: %w", err)
+	}
+
+	// Overnight from Friday afternoon: due when the branch opens on Monday.
+	overnight, err := newLoanBook(models.LoanTypeOvernight, 0)
+	if err != nil {
+		return err
+	}
+	clk.Set(time.Date(2026, 3, 6, 16, 0, 0, 0, time.UTC))
+	loan, err = checkout(overnight, time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		return err
+	}
+	clk.Set(time.Date(2026, 3, 9, 9, 20, 0, 0, time.UTC))
+	returned, err = svc.ReturnCheckout(loan.ID)
+	if err != nil {
+		return fmt.Errorf("ReturnCheckout: %w", err)
+	}
+	if returned.FineAmount != policy.FinePerHour {
+		return fmt.Errorf("overnight fine 20 minutes late = %d, want %d", returned.FineAmount, policy.FinePerHour)
+	}
+	return nil
+}
+
+// checkCourseReserves covers the availability view of a reading list and
+// moving its books into course reserves until the end of the course's term.
+func checkCourseReserves(r *repositories.Repositories) error {
+	year := 3000 + rand.Intn(5000)
+	clk := clock.NewFake(time.Date(year, time.January, 15, 10, 0, 0, 0, time.UTC))
+	svc := newService(r, clk, services.DefaultPolicy())
+
+	term, err := svc.CreateTerm("repotest term", time.Date(year, time.January, 10, 0, 0, 0, 0, time.UTC), time.Date(year, time.January, 20, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return fmt.Errorf("CreateTerm: %w", err)
+	}
+	defer svc.DeleteTerm(term.ID)
+	course, err := svc.CreateCourse("RT"+strings.ToUpper(uuid.NewString()[:8]), "repotest course", &term.ID)
+	if err != nil {
+		return fmt.Errorf("CreateCourse: %w", err)
+	}
+	defer svc.DeleteCourse(course.ID)
+	list, err := svc.CreateReadingList(course.ID, "Core texts")
+	if err != nil {
+		return fmt.Errorf("CreateReadingList: %w", err)
+	}
+
+	// A librarian, so that the term does not cap the loans.
+	user, err := svc.CreateUser("repotest lecturer", models.UserRoleLibrarian)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+	textbook, err := svc.CreateBook("repotest "+uuid.NewString(), "repotest", 2)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+	overnight, err := svc.CreateBook("repotest "+uuid.NewString(), "repotest", 1)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+	if _, err := svc.SetBookLoanType(overnight.ID, models.LoanTypeOvernight, 0, 0); err != nil {
+		return fmt.Errorf("SetBookLoanType: %w", err)
+	}
+
+	dup := []models.ReadingListEntry{{BookID: textbook.ID}, {BookID: textbook.ID}}
+	if _, err := svc.SetReadingListEntries(list.ID, dup); !errors.Is(err, services.ErrInvalidReadingList) {
+		return fmt.Errorf("duplicate entries: want ErrInvalidReadingList, got %v", err)
+	}
+	detail, err := svc.SetReadingListEntries(list.ID, []models.ReadingListEntry{
+		{BookID: textbook.ID, Required: true},
+		{BookID: overnight.ID, Note: "background"},
+	})
+	if err != nil {
+		return fmt.Errorf("SetReadingListEntries: %w", err)
+	}
+	if len(detail.Entries) != 2 || detail.Entries[0].Position != 1 || detail.Entries[1].Position != 2 {
+		return fmt.Errorf("entries = %+v, want positions 1 and 2 in the given order", detail.Entries)
+	}
+
+	if c, _, err := svc.CheckoutBook(textbook.ID, user.ID); err != nil || c == nil {
+		return fmt.Errorf("CheckoutBook: checkout=%v err=%v", c, err)
+	}
+	avail, err := svc.ReadingListAvailability(list.ID)
+	if err != nil {
+		return fmt.Errorf("ReadingListAvailability: %w", err)
+	}
+	if a := avail.Entries[0]; a.TotalCopies != 2 || a.Available != 1 || a.CheckedOut != 1 || a.LoanType != models.LoanTypeStandard {
+		return fmt.Errorf("textbook availability = %+v, want 2 copies, 1 available, 1 out, STANDARD", a)
+	}
+	if a := avail.Entries[1]; a.TotalCopies != 1 || a.Available != 1 || a.LoanType != models.LoanTypeOvernight {
+		return fmt.Errorf("overnight book availability = %+v, want 1 available OVERNIGHT copy", a)
+	}
+
+	if _, err := svc.ReserveReadingList(list.ID, models.LoanTypeStandard, 0); !errors.Is(err, services.ErrInvalidLoanType) {
+		return fmt.Errorf("STANDARD reserve: want ErrInvalidLoanType, got %v", err)
+	}
+	res, err := svc.ReserveReadingList(list.ID, models.LoanTypeShort, 4)
+	if err != nil {
+		return fmt.Errorf("ReserveReadingList: %w", err)
+	}
+	if len(res.Reserved) != 1 || res.Reserved[0].ID != textbook.ID || len(res.Skipped) != 1 || res.Skipped[0].ID != overnight.ID {
+		return fmt.Errorf("ReserveReadingList reserved %d and skipped %d books, want the textbook reserved and the overnight book skipped", len(res.Reserved), len(res.Skipped))
+	}
+	if until := res.Reserved[0].LoanTypeUntil; until == nil || !until.Equal(term.EndDate) {
+		return fmt.Errorf("reserved until %v, want the end of term %s", until, term.EndDate.Format("2006-01-02"))
+	}
+
+	c, _, err := svc.CheckoutBook(textbook.ID, user.ID)
+	if err != nil || c == nil {
+		return fmt.Errorf("CheckoutBook on reserve: checkout=%v err=%v", c, err)
+	}
+	if want := clk.Now().Add(4 * time.Hour); c.LoanType != models.LoanTypeShort || !c.DueDate.Equal(want) {
+		return fmt.Errorf("reserve loan is %s due %s, want SHORT due %s", c.LoanType, c.DueDate, want)
+	}
+
+	clk.Set(time.Date(year, time.January, 21, 10, 0, 0, 0, time.UTC))
+	avail, err = svc.ReadingListAvailability(list.ID)
+	if err != nil {
+		return fmt.Errorf("ReadingListAvailability: %w", err)
+	}
+	if lt := avail.Entries[0].LoanType; lt != models.LoanTypeStandard {
+		return fmt.Errorf("textbook lends as %s after the term, want STANDARD", lt)
+	}
+	if _, err := svc.ReserveReadingList(list.ID, models.LoanTypeShort, 4); !errors.Is(err, services.ErrTermEnded) {
+		return fmt.Errorf("reserve after the term: want ErrTermEnded, got %v", err)
+	}
+	return nil
+}
+
+// checkBulkImport covers ImportBooks: validation, ISBN normalisation and
+// dedupe against the file and the catalogue, barcode conflicts and copy
+// counts, for both file formats.
+func checkBulkImport(r *repositories.Repositories) error {
+	svc := newService(r, clock.System(), services.DefaultPolicy())
+
+	existing := randomISBN()
+	if err := r.Books.Create(nil, &models.Book{Title: "repotest " + uuid.NewString(), Author: "repotest", ISBN: &existing}); err != nil {
+		return fmt.Errorf("create book: %w", err)
+	}
+	isbn := randomISBN()
+	hyphenated := isbn[:3] + "-" + isbn[3:5] + "-" + isbn[5:]
+	tag := uuid.NewString()[:8]
+	takenBarcode := "RT" + uuid.NewString()
+	if _, copies, err := newBook(r, 1); err != nil {
+		return err
+	} else if err := r.BookCopies.Create(nil, &models.BookCopy{BookID: copies[0].BookID, Status: models.BookCopyStatusAvailable, Barcode: &takenBarcode}); err != nil {
+		return fmt.Errorf("create copy: %w", err)
+	}
+
+	csv := "title,author,isbn,copies,barcodes\n" +
+		"repotest A " + tag + ",Author," + hyphenated + ",3,RT" + tag + "-1;RT" + tag + "-2\n" + // line 2: created
+		"repotest B " + tag + ",Author," + isbn + ",1,\n" + // line 3: repeats line 2
+		"repotest C " + tag + ",Author," + existing + ",,\n" + // line 4: in the catalogue
+		"repotest D " + tag + ",Author,not-an-isbn,,\n" + // line 5: invalid ISBN
+		",Author,,,\n" + // line 6: no title
+		"repotest E " + tag + ",Author,,1,RT" + tag + "-1\n" + // line 7: barcode repeats line 2
+		"repotest F " + tag + ",Author,,,RT" + tag + "-3;RT" + tag + "-3\n" + // line 8: barcode twice
+		"repotest G " + tag + ",Author,,1,RT" + tag + "-4;RT" + tag + "-5\n" + // line 9: too few copies
+		"repotest H " + tag + ",Author,,," + takenBarcode + "\n" + // line 10: barcode in use
+		"repotest I " + tag + ",Author,,,\n" // line 11: created, one copy
+	report, err := svc.ImportBooks(catalog.FormatCSV, strings.NewReader(csv))
+	if err != nil {
+		return fmt.Errorf("ImportBooks(csv): %w", err)
+	}
+	want := []services.ImportStatus{
+		services.ImportCreated, services.ImportSkipped, services.ImportSkipped, services.ImportFailed, services.ImportFailed,
+		services.ImportFailed, services.ImportFailed, services.ImportFailed, services.ImportFailed, services.ImportCreated,
+	}
+	if len(report.Results) != len(want) {
+		return fmt.Errorf("csv import reported %d rows, want %d", len(report.Results), len(want))
+	}
+	for i, row := range report.Results {
+		if row.Line != i+2 || row.Status != want[i] {
+			return fmt.Errorf("csv result %d = line %d %s (%s), want line %d %s", i, row.Line, row.Status, row.Reason, i+2, want[i])
+		}
+	}
+	if report.Created != 2 || report.Skipped != 2 || report.Failed != 6 {
+		return fmt.Errorf("csv totals = %d/%d/%d, want 2 created, 2 skipped, 6 failed", report.Created, report.Skipped, report.Failed)
+	}
+
+	created := report.Results[0]
+	if created.ISBN != isbn || created.BookID == nil {
+		return fmt.Errorf("created row = %+v, want ISBN %s and a book ID", created, isbn)
+	}
+	book, err := r.Books.GetByID(nil, *created.BookID)
+	if err != nil {
+		return fmt.Errorf("GetByID: %w", err)
+	}
+	if book.TotalCopies != 3 || book.ISBN == nil || *book.ISBN != isbn {
+		return fmt.Errorf("imported book has %d copies and ISBN %v, want 3 and %s", book.TotalCopies, book.ISBN, isbn)
+	}
+	copies, err := r.BookCopies.FindByBarcodes(nil, []string{"RT" + tag + "-1", "RT" + tag + "-2"})
+	if err != nil {
+		return fmt.Errorf("FindByBarcodes: %w", err)
+	}
+	if len(copies) != 2 || copies[0].BookID != book.ID || copies[1].BookID != book.ID {
+		return fmt.Errorf("found %d barcoded copies of the imported book, want 2", len(copies))
+	}
+
+	// JSON Lines, with the ISBN-10 form of an ISBN that is now in the
+	// catalogue and a malformed line that must not stop the import.
+	isbn10 := "0306406152"
+	jsonl := `{"title":"repotest J ` + tag + `","author":"Author","isbn":"` + isbn + `"}` + "\n" +
+		"{not json\n" +
+		`{"title":"repotest K ` + tag + `","author":"Author","isbn":"` + isbn10 + `","copies":0}` + "\n"
+	report, err = svc.ImportBooks(catalog.FormatJSONL, bytes.NewBufferString(jsonl))
+	if err != nil {
+		return fmt.Errorf("ImportBooks(jsonl): %w", err)
+	}
+	if len(report.Results) != 3 {
+		return fmt.Errorf("jsonl import reported %d rows, want 3", len(report.Results))
+	}
+	if row := report.Results[0]; row.Status != services.ImportSkipped || row.BookID == nil || *row.BookID != book.ID {
+		return fmt.Errorf("jsonl line 1 = %+v, want SKIPPED pointing at %s", row, book.ID)
+	}
+	if row := report.Results[1]; row.Line != 2 || row.Status != services.ImportFailed {
+		return fmt.Errorf("jsonl line 2 = %+v, want FAILED", row)
+	}
+	// 0-306-40615-2 may already be in a shared database from an earlier run.
+	if row := report.Results[2]; row.ISBN != "9780306406157" || row.Status == services.ImportFailed {
+		return fmt.Errorf("jsonl line 3 = %+v, want ISBN 9780306406157 created or skipped", row)
+	}
+
+	if _, err := svc.ImportBooks(catalog.FormatCSV, strings.NewReader("name,writer\nx,y\n")); !errors.Is(err, services.ErrInvalidImport) {
+		return fmt.Errorf("missing columns: want ErrInvalidImport, got %v", err)
+	}
+	return nil
+}
+
+// checkMARC imports a MARCXML record with ISBD punctuation and holdings, and
+// exports the book again as ISO 2709. The descriptive fields must survive
+// storage on every backend.
+func checkMARC(r *repositories.Repositories) error {
+	svc := newService(r, clock.System(), services.DefaultPolicy())
+
+	branchName := "repotest " + uuid.NewString()
+	branch, err := svc.CreateBranch(branchName, "UTC")
+	if err != nil {
+		return fmt.Errorf("CreateBranch: %w", err)
+	}
+	isbn := randomISBN()
+	tag := "RT" + uuid.NewString()[:8]
+	in := `<collection xmlns="http://www.loc.gov/MARC21/slim"><record>
+  <datafield tag="020" ind1=" " ind2=" "><subfield code="a">` + isbn + ` (pbk.)</subfield></datafield>
+  <datafield tag="100" ind1="1" ind2=" "><subfield code="a">Martin, Robert C.,</subfield></datafield>
+  <datafield tag="245" ind1="1" ind2="0"><subfield code="a">Clean code :</subfield><subfield code="b">a handbook /</subfield></datafield>
+  <datafield tag="250" ind1=" " ind2=" "><subfield code="a">1st ed.</subfield></datafield>
+  <datafield tag="264" ind1=" " ind2="1"><subfield code="b">Prentice Hall,</subfield><subfield code="c">[2009].</subfield></datafield>
+  <datafield tag="650" ind1=" " ind2="0"><subfield code="a">Software engineering</subfield><subfield code="x">Handbooks.</subfield></datafield>
+  <datafield tag="852" ind1=" " ind2=" "><subfield code="8">1</subfield><subfield code="b">` + strings.ToUpper(branchName) + `</subfield></datafield>
+  <datafield tag="876" ind1=" " ind2=" "><subfield code="8">1</subfield><subfield code="p">` + tag + `-1</subfield></datafield>
+  <datafield tag="876" ind1=" " ind2=" "><subfield code="8">1</subfield><subfield code="p">` + tag + `-2</subfield></datafield>
+</record></collection>`
+	report, err := svc.ImportBooks(catalog.FormatMARCXML, strings.NewReader(in))
+	if err != nil {
+		return fmt.Errorf("ImportBooks(marcxml): %w", err)
+	}
+	if len(report.Results) != 1 || report.Results[0].Status != services.ImportCreated {
+		return fmt.Errorf("marcxml import = %+v, want one CREATED record", report.Results)
+	}
+	book, err := r.Books.GetByID(nil, *report.Results[0].BookID)
+	if err != nil {
+		return fmt.Errorf("GetByID: %w", err)
+	}
+	want := models.Book{
+		Title: "Clean code: a handbook", Author: "Robert C. Martin",
+		Edition: "1st ed.", Publisher: "Prentice Hall", Published: "[2009]",
+	}
+	if book.Title != want.Title || book.Author != want.Author || book.Edition != want.Edition ||
+		book.Publisher != want.Publisher || book.Published != want.Published {
+		return fmt.Errorf("imported book = %q by %q, %q, %q, %q; want %q by %q, %q, %q, %q",
+			book.Title, book.Author, book.Edition, book.Publisher, book.Published,
+			want.Title, want.Author, want.Edition, want.Publisher, want.Published)
+	}
+	if len(book.Subjects) != 1 || book.Subjects[0] != "Software engineering--Handbooks" {
+		return fmt.Errorf("subjects = %q, want [Software engineering--Handbooks]", book.Subjects)
+	}
+	copies, err := r.BookCopies.ListByBooks(nil, []uuid.UUID{book.ID})
+	if err != nil {
+		return fmt.Errorf("ListByBooks: %w", err)
+	}
+	for _, c := range copies {
+		if c.BranchID == nil || *c.BranchID != branch.ID || c.Barcode == nil {
+			return fmt.Errorf("imported copy %+v, want a barcode and branch %s", c, branch.ID)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := svc.ExportBookMARC(book.ID, catalog.FormatMARC, &out); err != nil {
+		return fmt.Errorf("ExportBookMARC: %w", err)
+	}
+	rec, err := marc.NewReader(&out).Next()
+	if err != nil {
+		return fmt.Errorf("reading the export: %w", err)
+	}
+	if f := rec.FieldsByTag("020"); len(f) != 1 || f[0].First('a') != isbn {
+		return fmt.Errorf("exported 020 = %+v, want $a %s", f, isbn)
+	}
+	if f := rec.FieldsByTag("245"); len(f) != 1 || f[0].First('a') != want.Title {
+		return fmt.Errorf("exported 245 = %+v, want $a %q", f, want.Title)
+	}
+	if f := rec.FieldsByTag("852"); len(f) != 2 || f[0].First('b') != branchName {
+		return fmt.Errorf("exported 852 = %+v, want two holdings at %q", f, branchName)
+	}
+	if err := svc.ExportBookMARC(uuid.New(), catalog.FormatMARC, &out); !errors.Is(err, services.ErrBookNotFound) {
+		return fmt.Errorf("unknown book: want ErrBookNotFound, got %v", err)
+	}
+	return nil
+}
+
+// checkCatalogueExport exports the catalogue as CSV, JSON Lines and Dublin
+// Core and checks one book's copy and availability counts in each.
+func checkCatalogueExport(r *repositories.Repositories) error {
+	svc := newService(r, clock.System(), services.DefaultPolicy())
+
+	book, _, err := newBook(r, 2)
+	if err != nil {
+		return err
+	}
+	user, err := svc.CreateUser("repotest "+uuid.NewString(), models.UserRoleStudent)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+	if _, _, err := svc.CheckoutBook(book.ID, user.ID); err != nil {
+		return fmt.Errorf("CheckoutBook: %w", err)
+	}
+
+	export := func(format catalog.Format) (string, error) {
+		var out bytes.Buffer
+		if err := svc.ExportCatalogue(format, &out); err != nil {
+			return "", fmt.Errorf("ExportCatalogue(%s): %w", format, err)
+		}
+		for _, line := range strings.Split(out.String(), "\n") {
+			if strings.Contains(line, book.ID.String()) {
+				return line, nil
+			}
+		}
+		return "", fmt.Errorf("ExportCatalogue(%s) left out book %s", format, book.ID)
+	}
+
+	line, err := export(catalog.FormatCSV)
+	if err != nil {
+		return err
+	}
+	if want := book.ID.String() + "," + book.Title + ",repotest,,,,,,2,1,"; line != want {
+		return fmt.Errorf("csv row = %q, want %q", line, want)
+	}
+	line, err = export(catalog.FormatJSONL)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(line, `"copies":2,"available":1`) {
+		return fmt.Errorf("jsonl record = %s, want 2 copies with 1 available", line)
+	}
+
+	var out bytes.Buffer
+	if err := svc.ExportCatalogue(catalog.FormatDC, &out); err != nil {
+		return fmt.Errorf("ExportCatalogue(dc): %w", err)
+	}
+	dc := out.String()
+	i := strings.Index(dc, "urn:uuid:"+book.ID.String())
+	if i < 0 || !strings.Contains(dc[strings.LastIndex(dc[:i], "<oai_dc:dc"):i], "1 of 2 copies available") {
+		return fmt.Errorf("dc export has no record for %s saying 1 of 2 copies available", book.ID)
+	}
+
+	if err := svc.ExportCatalogue("pdf", &out); !errors.Is(err, services.ErrUnknownExportFormat) {
+		return fmt.Errorf("pdf: want ErrUnknownExportFormat, got %v", err)
+	}
+	return nil
+}
+
+// checkListChanged covers the datestamp paging OAI-PMH harvesting uses: books
+// come in (UpdatedAt, ID) order, the cursor resumes after the last one, until
+// is exclusive, and circulation changes leave UpdatedAt alone.
+func checkListChanged(r *repositories.Repositories) error {
+	var ours []models.Book
+	for i := 0; i < 3; i++ {
+		book, _, err := newBook(r, 0)
+		if err != nil {
+			return err
+		}
+		stored, err := r.Books.GetByID(nil, book.ID)
+		if err != nil {
+			return fmt.Errorf("GetByID: %w", err)
+		}
+		if stored.UpdatedAt.IsZero() {
+			return fmt.Errorf("book %s was created without UpdatedAt", book.ID)
+		}
+		ours = append(ours, *stored)
+	}
+	sort.Slice(ours, func(i, j int) bool {
+		if !ours[i].UpdatedAt.Equal(ours[j].UpdatedAt) {
+			return ours[i].UpdatedAt.Before(ours[j].UpdatedAt)
+		}
+		return ours[i].ID.String() < ours[j].ID.String()
+	})
+	first := ours[0]
+
+	if err := r.Books.IncrementTotalCopies(nil, first.ID, 1); err != nil {
+		return fmt.Errorf("IncrementTotalCopies: %w", err)
+	}
+	if err := r.Books.SetLoanType(nil, first.ID, models.LoanTypeShort, 2, nil); err != nil {
+		return fmt.Errorf("SetLoanType: %w", err)
+	}
+	if got, err := r.Books.GetByID(nil, first.ID); err != nil || !got.UpdatedAt.Equal(first.UpdatedAt) {
+		return fmt.Errorf("circulation changes moved UpdatedAt from %v to %v (err %v)", first.UpdatedAt, got.UpdatedAt, err)
+	}
+
+	// Page one book at a time from the first of ours until all are seen.
+	want := map[uuid.UUID]bool{}
+	for _, b := range ours {
+		want[b.ID] = true
+	}
+	var seen []uuid.UUID
+	var after *repositories.BookCursor
+	for len(seen) < len(ours) {
+		page, err := r.Books.ListChanged(nil, &first.UpdatedAt, nil, after, 1)
+		if err != nil {
+			return fmt.Errorf("ListChanged: %w", err)
+		}
+		if len(page) == 0 {
+			return fmt.Errorf("ListChanged ran out after %v, want %d books", seen, len(ours))
+		}
+		b := page[0]
+		if after != nil && (b.UpdatedAt.Before(after.UpdatedAt) || b.UpdatedAt.Equal(after.UpdatedAt) && b.ID.String() <= after.ID.String()) {
+			return fmt.Errorf("ListChanged returned %s at %v after the cursor %+v", b.ID, b.UpdatedAt, *after)
+		}
+		if want[b.ID] {
+			seen = append(seen, b.ID)
+		}
+		after = &repositories.BookCursor{UpdatedAt: b.UpdatedAt, ID: b.ID}
+	}
+	for i, b := range ours {
+		if seen[i] != b.ID {
+			return fmt.Errorf("ListChanged order %v, want the books in (UpdatedAt, ID) order", seen)
+		}
+	}
+
+	page, err := r.Books.ListChanged(nil, nil, &first.UpdatedAt, nil, 1000)
+	if err != nil {
+		return fmt.Errorf("ListChanged(until): %w", err)
+	}
+	for _, b := range page {
+		if want[b.ID] {
+			return fmt.Errorf("ListChanged(until %v) returned %s changed at %v; until is exclusive", first.UpdatedAt, b.ID, b.UpdatedAt)
+		}
+	}
+	return nil
+}
+
+// checkBookSearch covers the catalogue search SRU runs on: case-insensitive
+// contained and whole matches on each field, masking characters next to
+// literal LIKE wildcards, not over books without subjects or an ISBN, and
+// title-ordered paging with the full count.
+func checkBookSearch(r *repositories.Repositories) error {
+	tag := strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+	isbn := randomISBN()
+	messiah := &models.Book{Title: "Repotest " + tag + " Dune Messiah", Author: "Frank Herbert", ISBN: &isbn,
+		Subjects: []string{"Science Fiction", tag + "-Desert"}}
+	ice := &models.Book{Title: "Repotest " + tag + " 100% Pure_Ice", Author: `Ann "Q" O'Brien`,
+		Subjects: []string{"Poetry", "Arts & crafts", `"Found" <verse>`}}
+	children := &models.Book{Title: "Repotest " + tag + " Children of Dune", Author: "Frank Herbert"}
+	for _, b := range []*models.Book{messiah, ice, children} {
+		if err := r.Books.Create(nil, b); err != nil {
+			return fmt.Errorf("create book: %w", err)
+		}
+	}
+
+	match := func(field repositories.BookField, pattern string, whole bool) *repositories.BookQuery {
+		return &repositories.BookQuery{Op: repositories.QueryMatch, Field: field, Pattern: pattern, Whole: whole}
+	}
+	ours := func(q *repositories.BookQuery) *repositories.BookQuery {
+		return &repositories.BookQuery{Op: repositories.QueryAnd, Left: match(repositories.BookFieldTitle, tag, false), Right: q}
+	}
+	not := func(q *repositories.BookQuery) *repositories.BookQuery {
+		return &repositories.BookQuery{Op: repositories.QueryNot, Left: q}
+	}
+	cases := []struct {
+		name string
+		q    *repositories.BookQuery
+		want []*models.Book
+	}{
+		{"title contains", ours(match(repositories.BookFieldTitle, "DUNE", false)), []*models.Book{children, messiah}},
+		{"title masked", ours(match(repositories.BookFieldTitle, "dune?messiah", false)), []*models.Book{messiah}},
+		{"title literal wildcards", ours(match(repositories.BookFieldTitle, "100% pure_ice", false)), []*models.Book{ice}},
+		{"title escaped mask", ours(match(repositories.BookFieldTitle, `pure\?ice`, false)), nil},
+		{"percent is literal", ours(match(repositories.BookFieldTitle, "dune%", false)), nil},
+		{"author whole", ours(match(repositories.BookFieldAuthor, "frank herbert", true)), []*models.Book{children, messiah}},
+		{"author part is not whole", ours(match(repositories.BookFieldAuthor, "frank", true)), nil},
+		{"author with quotes", ours(match(repositories.BookFieldAuthor, `"q" o'b*`, false)), []*models.Book{ice}},
+		{"not subject", ours(not(match(repositories.BookFieldSubject, "science fiction", true))), []*models.Book{ice, children}},
+		{"subject whole", match(repositories.BookFieldSubject, tag+"-DESERT", true), []*models.Book{messiah}},
+		{"subject part is not whole", match(repositories.BookFieldSubject, tag+"-des", true), nil},
+		{"subject contains", match(repositories.BookFieldSubject, tag+"-des", false), []*models.Book{messiah}},
+		{"subject with ampersand", ours(match(repositories.BookFieldSubject, "arts & crafts", true)), []*models.Book{ice}},
+		{"subject part with ampersand", ours(match(repositories.BookFieldSubject, "s & c", false)), []*models.Book{ice}},
+		{"subject with quotes and brackets", ours(match(repositories.BookFieldSubject, `"found" <verse>`, true)), []*models.Book{ice}},
+		{"isbn", match(repositories.BookFieldISBN, isbn, true), []*models.Book{messiah}},
+		{"not isbn", ours(not(match(repositories.BookFieldISBN, isbn, true))), []*models.Book{ice, children}},
+		{"or", ours(&repositories.BookQuery{Op: repositories.QueryOr,
+			Left: match(repositories.BookFieldSubject, "poetry", true), Right: match(repositories.BookFieldTitle, "children", false)}), []*models.Book{ice, children}},
+	}
+	for _, c := range cases {
+		books, total, err := r.Books.Search(nil, c.q, 0, 10)
+		if err != nil {
+			return fmt.Errorf("Search(%s): %w", c.name, err)
+		}
+		var got, want []string
+		for _, b := range books {
+			got = append(got, b.Title)
+		}
+		for _, b := range c.want {
+			want = append(want, b.Title)
+		}
+		if strings.Join(got, "|") != strings.Join(want, "|") || total != int64(len(want)) {
+			return fmt.Errorf("Search(%s) = %q (total %d), want %q", c.name, got, total, want)
+		}
+	}
+
+	all := match(repositories.BookFieldTitle, tag, false)
+	page, total, err := r.Books.Search(nil, all, 1, 1)
+	if err != nil || total != 3 || len(page) != 1 || page[0].ID != children.ID {
+		return fmt.Errorf("Search(offset 1, limit 1) = %d books (total %d, err %v), want %s of 3", len(page), total, err, children.ID)
+	}
+	if page, total, err := r.Books.Search(nil, all, 0, 0); err != nil || total != 3 || len(page) != 0 {
+		return fmt.Errorf("Search(limit 0) = %d books (total %d, err %v), want none of 3", len(page), total, err)
+	}
+	return nil
+}
+
+// checkActiveByCopy finds a copy's open checkout, and none once it is
+// returned.
+func checkCheckoutsByBook(r *repositories.Repositories) error {
+	user, err := newUser(r, "list-by-book")
+	if err != nil {
+		return err
+	}
+	book, copies, err := newBook(r, 2)
+	if err != nil {
+		return err
+	}
+	_, others, err := newBook(r, 1)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var want []uuid.UUID
+	for i, copyID := range []uuid.UUID{copies[1].ID, copies[0].ID, others[0].ID} {
+		at := now.Add(time.Duration(i) * time.Hour)
+		checkout := &models.Checkout{BookCopyID: copyID, UserID: user.ID, CheckoutAt: at, DueDate: at.AddDate(0, 0, 14)}
+		if err := r.Checkouts.Create(nil, checkout); err != nil {
+			return fmt.Errorf("create checkout: %w", err)
+		}
+		if i == 0 {
+			if err := r.Checkouts.MarkReturned(nil, checkout.ID, at.Add(time.Minute), 0); err != nil {
+				return fmt.Errorf("MarkReturned: %w", err)
+			}
+		}
+		if copyID != others[0].ID {
+			want = append(want, checkout.ID)
+		}
+	}
+
+	got, err := r.Checkouts.ListByBook(nil, book.ID)
+	if err != nil {
+		return fmt.Errorf("ListByBook: %w", err)
+	}
+	if len(got) != len(want) {
+		return fmt.Errorf("ListByBook returned %d checkouts, want %d", len(got), len(want))
+	}
+	for i, c := range got {
+		if c.ID != want[i] || c.BookCopy.BookID != book.ID {
+			return fmt.Errorf("ListByBook[%d] = %s of book %s, want %s of %s", i, c.ID, c.BookCopy.BookID, want[i], book.ID)
+		}
+	}
+	if got[0].ReturnedAt == nil || got[1].ReturnedAt != nil {
+		return errors.New("ListByBook must return both returned and active checkouts")
+	}
+	return nil
+}
+
+func checkActiveByCopy(r *repositories.Repositories) error {
+	user, err := newUser(r, "active-by-copy")
+	if err != nil {
+		return err
+	}
+	_, copies, err := newBook(r, 1)
+	if err != nil {
+		return err
+	}
+	copyID := copies[0].ID
+	if _, err := r.Checkouts.GetActiveByCopy(nil, copyID); !errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("GetActiveByCopy before checkout: err = %v, want ErrNotFound", err)
+	}
+	if _, err := r.BookCopies.GetByIDForUpdate(nil, uuid.New()); !errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("BookCopies.GetByIDForUpdate(unknown): err = %v, want ErrNotFound", err)
+	}
+
+	now := time.Now().UTC()
+	checkout := &models.Checkout{BookCopyID: copyID, UserID: user.ID, CheckoutAt: now, DueDate: now.AddDate(0, 0, 14)}
+	if err := r.Checkouts.Create(nil, checkout); err != nil {
+		return fmt.Errorf("create checkout: %w", err)
+	}
+	err = r.Transactor.Transaction(func(tx repositories.Tx) error {
+		if _, err := r.BookCopies.GetByIDForUpdate(tx, copyID); err != nil {
+			return fmt.Errorf("BookCopies.GetByIDForUpdate: %w", err)
+		}
+		got, err := r.Checkouts.GetActiveByCopy(tx, copyID)
+		if err != nil {
+			return fmt.Errorf("GetActiveByCopy: %w", err)
+		}
+		if got.ID != checkout.ID || got.BookCopy.ID != copyID {
+			return fmt.Errorf("GetActiveByCopy = checkout %s with copy %s, want %s with %s", got.ID, got.BookCopy.ID, checkout.ID, copyID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := r.Checkouts.MarkReturned(nil, checkout.ID, now, 0); err != nil {
+		return fmt.Errorf("MarkReturned: %w", err)
+	}
+	if _, err := r.Checkouts.GetActiveByCopy(nil, copyID); !errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("GetActiveByCopy after return: err = %v, want ErrNotFound", err)
+	}
+	return nil
+}
+
+// checkPayments lists a user's payments oldest first, and only theirs.
+func checkPayments(r *repositories.Repositories) error {
+	payer, err := newUser(r, "payer")
+	if err != nil {
+		return err
+	}
+	other, err := newUser(r, "other payer")
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, p := range []models.Payment{
+		{UserID: payer.ID, Amount: 30, Reference: "second", PaidAt: now},
+		{UserID: payer.ID, Amount: 20, Reference: "first", PaidAt: now.Add(-time.Hour)},
+		{UserID: other.ID, Amount: 5, PaidAt: now},
+	} {
+		if err := r.Payments.Create(nil, &p); err != nil {
+			return fmt.Errorf("create payment %d: %w", i, err)
+		}
+		if p.ID == uuid.Nil {
+			return fmt.Errorf("payment %d created without an ID", i)
+		}
+	}
+
+	payments, err := r.Payments.ListByUser(nil, payer.ID)
+	if err != nil {
+		return fmt.Errorf("ListByUser: %w", err)
+	}
+	if len(payments) != 2 || payments[0].Reference != "first" || payments[1].Reference != "second" || payments[1].Amount != 30 {
+		return fmt.Errorf("ListByUser = %+v, want the payer's two payments oldest first", payments)
+	}
+
+	last, err := r.Payments.LastPaidAt(nil, []uuid.UUID{payer.ID, uuid.New()})
+	if err != nil {
+		return fmt.Errorf("LastPaidAt: %w", err)
+	}
+	if len(last) != 1 || !last[payer.ID].Equal(now) {
+		return fmt.Errorf("LastPaidAt = %v, want only the payer at %v", last, now)
+	}
+
+	// PayFines locks the payer before reading the balance.
+	err = r.Transactor.Transaction(func(tx repositories.Tx) error {
+		got, err := r.Users.GetByIDForUpdate(tx, payer.ID)
+		if err != nil {
+			return fmt.Errorf("Users.GetByIDForUpdate: %w", err)
+		}
+		if got.Name != payer.Name {
+			return fmt.Errorf("Users.GetByIDForUpdate = %+v, want %+v", got, payer)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.Users.GetByIDForUpdate(nil, uuid.New())
+	return expectNotFound("Users.GetByIDForUpdate(unknown)", err)
+}
+
+// checkOAIHarvest harvests through the OAI-PMH provider two records a page,
+// following resumption tokens, and fetches one record. A withdrawn book is
+// then harvested and fetched as a deleted record, until it is restored.
+func checkOAIHarvest(r *repositories.Repositories) error {
+	svc := newService(r, clock.System(), services.DefaultPolicy())
+	p := &oai.Provider{
+		Repository: oai.Repository{Name: "repotest", Identifier: "repotest.example", AdminEmail: "repotest@repotest.example"},
+		Books:      svc,
+		PageSize:   2,
+	}
+
+	var ids []string
+	var bookIDs []uuid.UUID
+	from := time.Now().UTC().Add(-time.Second)
+	for i := 0; i < 3; i++ {
+		book, _, err := newBook(r, 1)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, "oai:repotest.example:"+book.ID.String())
+		bookIDs = append(bookIDs, book.ID)
+	}
+
+	identifierRe := regexp.MustCompile(`<identifier>([^<]+)</identifier>`)
+	tokenRe := regexp.MustCompile(`<resumptionToken cursor="\d+"(?:>([^<]*)</resumptionToken>|/>)`)
+	seen := map[string]int{}
+	args := url.Values{"verb": {"ListIdentifiers"}, "metadataPrefix": {"oai_dc"}, "from": {from.Format("2006-01-02T15:04:05Z")}}
+	for pages := 0; ; pages++ {
+		out, err := p.Serve("http://repotest.example/oai", args)
+		if err != nil {
+			return fmt.Errorf("ListIdentifiers: %w", err)
+		}
+		body := string(out)
+		if strings.Contains(body, "<error") {
+			return fmt.Errorf("ListIdentifiers page %d: %s", pages, body)
+		}
+		for _, m := range identifierRe.FindAllStringSubmatch(body, -1) {
+			seen[m[1]]++
+		}
+		m := tokenRe.FindStringSubmatch(body)
+		if m == nil || m[1] == "" {
+			if pages == 0 {
+				return fmt.Errorf("first page of 2 had no resumption token:\n%s", body)
+			}
+			break
+		}
+		args = url.Values{"verb": {"ListIdentifiers"}, "resumptionToken": {m[1]}}
+	}
+	for _, id := range ids {
+		if seen[id] != 1 {
+			return fmt.Errorf("harvest returned %s %d times, want once", id, seen[id])
+		}
+	}
+
+	out, err := p.Serve("http://repotest.example/oai", url.Values{"verb": {"GetRecord"}, "metadataPrefix": {"marc21"}, "identifier": {ids[0]}})
+	if err != nil {
+		return fmt.Errorf("GetRecord: %w", err)
+	}
+	if !strings.Contains(string(out), `<controlfield tag="001">`+strings.TrimPrefix(ids[0], "oai:repotest.example:")) {
+		return fmt.Errorf("GetRecord(marc21) has no 001 for %s:\n%s", ids[0], out)
+	}
+	out, err = p.Serve("http://repotest.example/oai", url.Values{"verb": {"GetRecord"}, "metadataPrefix": {"oai_dc"}, "identifier": {"oai:repotest.example:" + uuid.NewString()}})
+	if err != nil || !strings.Contains(string(out), `code="idDoesNotExist"`) {
+		return fmt.Errorf("GetRecord(unknown) = %s, %v; want idDoesNotExist", out, err)
+	}
+
+	out, err = p.Serve("http://repotest.example/oai", url.Values{"verb": {"Identify"}})
+	if err != nil || !strings.Contains(string(out), "<deletedRecord>transient</deletedRecord>") {
+		return fmt.Errorf("Identify = %s, %v; want deletedRecord transient", out, err)
+	}
+	if _, err := svc.DeleteBook(bookIDs[1], false, 0); err != nil {
+		return fmt.Errorf("DeleteBook: %w", err)
+	}
+	deleted := regexp.MustCompile(`<header status="deleted">\s*<identifier>` + regexp.QuoteMeta(ids[1]) + `</identifier>`)
+	listed := 0
+	args = url.Values{"verb": {"ListRecords"}, "metadataPrefix": {"oai_dc"}, "from": {from.Format("2006-01-02T15:04:05Z")}}
+	for {
+		out, err := p.Serve("http://repotest.example/oai", args)
+		if err != nil {
+			return fmt.Errorf("ListRecords: %w", err)
+		}
+		listed += len(deleted.FindAllString(string(out), -1))
+		m := tokenRe.FindStringSubmatch(string(out))
+		if m == nil || m[1] == "" {
+			break
+		}
+		args = url.Values{"verb": {"ListRecords"}, "resumptionToken": {m[1]}}
+	}
+	if listed != 1 {
+		return fmt.Errorf("harvest after withdrawal listed %s as deleted %d times, want once", ids[1], listed)
+	}
+	out, err = p.Serve("http://repotest.example/oai", url.Values{"verb": {"GetRecord"}, "metadataPrefix": {"oai_dc"}, "identifier": {ids[1]}})
+	if err != nil || !deleted.Match(out) || strings.Contains(string(out), "<metadata>") {
+		return fmt.Errorf("GetRecord(withdrawn) = %s, %v; want a deleted header and no metadata", out, err)
+	}
+	if _, err := svc.RestoreBook(bookIDs[1]); err != nil {
+		return fmt.Errorf("RestoreBook: %w", err)
+	}
+	out, err = p.Serve("http://repotest.example/oai", url.Values{"verb": {"GetRecord"}, "metadataPrefix": {"oai_dc"}, "identifier": {ids[1]}})
+	if err != nil || strings.Contains(string(out), `status="deleted"`) || !strings.Contains(string(out), "<metadata>") {
+		return fmt.Errorf("GetRecord(restored) = %s, %v; want the record back", out, err)
+	}
+	return nil
+}
+
+// checkIntegrity breaks each invariant the integrity checker covers with
+// direct repository writes, then expects CheckIntegrity to report the damage,
+// repair it and find nothing on a second run. Orphaned reservations are only
+// planted on backends without foreign keys.
+func checkIntegrity(r *repositories.Repositories) error {
+	svc := newService(r, clock.System(), services.DefaultPolicy())
+
+	// A copy marked out with no checkout, and a lent copy marked available.
+	shelved, shelvedCopies, err := newBook(r, 2)
+	if err != nil {
+		return err
+	}
+	if err := r.BookCopies.UpdateStatus(nil, shelvedCopies[0].ID, models.BookCopyStatusCheckedOut); err != nil {
+		return fmt.Errorf("UpdateStatus: %w", err)
+	}
+	lent, _, err := newBook(r, 1)
+	if err != nil {
+		return err
+	}
+	user, err := newUser(r, "repotest integrity")
+	if err != nil {
+		return err
+	}
+	checkout, _, err := svc.CheckoutBook(lent.ID, user.ID)
+	if err != nil {
+		return fmt.Errorf("CheckoutBook: %w", err)
+	}
+	if err := r.BookCopies.UpdateStatus(nil, checkout.BookCopyID, models.BookCopyStatusAvailable); err != nil {
+		return fmt.Errorf("UpdateStatus: %w", err)
+	}
+	// total_copies drift.
+	if err := r.Books.IncrementTotalCopies(nil, shelved.ID, 3); err != nil {
+		return fmt.Errorf("IncrementTotalCopies: %w", err)
+	}
+	// A queue at positions 2, 5, 9.
+	queued, _, err := newBook(r, 0)
+	if err != nil {
+		return err
+	}
+	var queue []uuid.UUID
+	for _, pos := range []int{2, 5, 9} {
+		u, err := newUser(r, "repotest integrity queue")
+		if err != nil {
+			return err
+		}
+		res := &models.Reservation{BookID: queued.ID, UserID: u.ID, QueuePosition: pos}
+		if err := r.Reservations.Create(nil, res); err != nil {
+			return fmt.Errorf("create reservation: %w", err)
+		}
+		queue = append(queue, res.ID)
+	}
+	orphan := &models.Reservation{BookID: queued.ID, UserID: uuid.New(), QueuePosition: 20}
+	if err := r.Reservations.Create(nil, orphan); err != nil {
+		orphan = nil
+	}
+
+	ours := func(report *services.IntegrityReport) map[services.IntegrityIssueKind]int {
+		kinds := map[services.IntegrityIssueKind]int{}
+		for _, issue := range report.Issues {
+			if issue.BookID == shelved.ID || issue.BookID == lent.ID || issue.BookID == queued.ID {
+				kinds[issue.Kind]++
+			}
+		}
+		return kinds
+	}
+	want := map[services.IntegrityIssueKind]int{
+		services.IssueCopyStatus:   2,
+		services.IssueTotalCopies:  1,
+		services.IssueQueueGap:     1,
+		services.IssueAvailability: 1, // the raw reservations were never counted as holds
+	}
+	if orphan != nil {
+		want[services.IssueOrphanedReservation] = 1
+	}
+
+	report, err := svc.CheckIntegrity(false)
+	if err != nil {
+		return fmt.Errorf("CheckIntegrity: %w", err)
+	}
+	if got := ours(report); fmt.Sprint(got) != fmt.Sprint(want) {
+		return fmt.Errorf("CheckIntegrity found %v, want %v", got, want)
+	}
+	if copy, err := r.BookCopies.GetByID(nil, shelvedCopies[0].ID); err != nil || copy.Status != models.BookCopyStatusCheckedOut {
+		return fmt.Errorf("a check without repair changed copy %s (err %v)", shelvedCopies[0].ID, err)
+	}
+
+	report, err = svc.CheckIntegrity(true)
+	if err != nil {
+		return fmt.Errorf("CheckIntegrity(repair): %w", err)
+	}
+	if got := ours(report); fmt.Sprint(got) != fmt.Sprint(want) {
+		return fmt.Errorf("CheckIntegrity(repair) found %v, want %v", got, want)
+	}
+	for _, issue := range report.Issues {
+		if !issue.Repaired {
+			return fmt.Errorf("issue %+v was not repaired", issue)
+		}
+	}
+
+	for copyID, status := range map[uuid.UUID]models.BookCopyStatus{
+		shelvedCopies[0].ID: models.BookCopyStatusAvailable,
+		checkout.BookCopyID: models.BookCopyStatusCheckedOut,
+	} {
+		if copy, err := r.BookCopies.GetByID(nil, copyID); err != nil || copy.Status != status {
+			return fmt.Errorf("copy %s after repair: want %s (err %v)", copyID, status, err)
+		}
+	}
+	if book, err := r.Books.GetByID(nil, shelved.ID); err != nil || book.TotalCopies != 2 {
+		return fmt.Errorf("book %s after repair: want total_copies 2 (err %v)", shelved.ID, err)
+	}
+	got, err := r.Reservations.ListByBook(nil, queued.ID)
+	if err != nil {
+		return fmt.Errorf("ListByBook: %w", err)
+	}
+	if len(got) != len(queue) {
+		return fmt.Errorf("queue after repair has %d reservations, want %d", len(got), len(queue))
+	}
+	for i, res := range got {
+		if res.ID != queue[i] || res.QueuePosition != i+1 {
+			return fmt.Errorf("queue after repair: %s at %d, want %s at %d", res.ID, res.QueuePosition, queue[i], i+1)
+		}
+	}
+
+	report, err = svc.CheckIntegrity(false)
+	if err != nil {
+		return fmt.Errorf("CheckIntegrity: %w", err)
+	}
+	if got := ours(report); len(got) != 0 {
+		return fmt.Errorf("CheckIntegrity after repair found %v", got)
+	}
+	return nil
+}
+
+// checkSRU searches through the SRU provider in both versions: CQL
+// booleans and relations, paging with nextRecordPosition, both record
+// schemas, explain, and diagnostics for bad queries.
+func checkSRU(r *repositories.Repositories) error {
+	svc := newService(r, clock.System(), services.DefaultPolicy())
+	p := &sru.Provider{Title: "repotest", Books: svc}
+
+	tag := strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+	isbn := randomISBN()
+	var books []*models.Book
+	for i, title := range []string{"Alpha", "Beta", "Gamma"} {
+		b := &models.Book{Title: "repotest " + tag + " " + title, Author: "repotest sru", Subjects: []string{tag + " shelf " + strconv.Itoa(i%2)}}
+		if i == 1 {
+			b.ISBN = &isbn
+		}
+		if err := r.Books.Create(nil, b); err != nil {
+			return fmt.Errorf("create book: %w", err)
+		}
+		books = append(books, b)
+	}
+
+	positionRe := regexp.MustCompile(`<(?:srw|sru):recordPosition>(\d+)<`)
+	serve := func(args url.Values) (string, error) {
+		out, err := p.Serve("http://repotest.example/sru", args)
+		if err != nil {
+			return "", fmt.Errorf("Serve(%v): %w", args, err)
+		}
+		return string(out), nil
+	}
+	search := func(query string, want ...*models.Book) error {
+		body, err := serve(url.Values{"version": {"1.2"}, "operation": {"searchRetrieve"}, "query": {query}})
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(body, fmt.Sprintf("<srw:numberOfRecords>%d<", len(want))) {
+			return fmt.Errorf("query %q: want %d records:\n%s", query, len(want), body)
+		}
+		for _, b := range want {
+			if !strings.Contains(body, "urn:uuid:"+b.ID.String()) {
+				return fmt.Errorf("query %q: %s missing:\n%s", query, b.Title, body)
+			}
+		}
+		return nil
+	}
+	for _, c := range []struct {
+		query string
+		want  []*models.Book
+	}{
+		{`title = "` + tag + ` beta"`, books[1:2]},
+		{tag + ` not dc.title any "alpha gamma"`, books[1:2]},
+		{`(dc.subject == "` + tag + ` shelf 0" or bath.isbn = ` + isbn[:3] + "-" + isbn[3:] + `) and author all "SRU repotest"`, books},
+		{`dc.title all "` + tag + ` g*a"`, books[2:3]},
+		{`title = ` + tag + ` and subject <> "` + tag + ` shelf 0"`, books[1:2]},
+	} {
+		if err := search(c.query, c.want...); err != nil {
+			return err
+		}
+	}
+
+	// Page through in SRU 2.0, two records at a time, as MARCXML.
+	args := url.Values{"query": {"title=" + tag}, "maximumRecords": {"2"}, "recordSchema": {"marcxml"}}
+	body, err := serve(args)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(body, "<sru:numberOfRecords>3<") || !strings.Contains(body, "<sru:nextRecordPosition>3<") ||
+		!strings.Contains(body, `<controlfield tag="001">`+books[0].ID.String()) {
+		return fmt.Errorf("first 2.0 page:\n%s", body)
+	}
+	args.Set("startRecord", "3")
+	if body, err = serve(args); err != nil {
+		return err
+	}
+	positions := positionRe.FindAllStringSubmatch(body, -1)
+	if len(positions) != 1 || positions[0][1] != "3" || strings.Contains(body, "nextRecordPosition") {
+		return fmt.Errorf("last 2.0 page:\n%s", body)
+	}
+
+	if body, err = serve(url.Values{"version": {"1.2"}, "operation": {"explain"}}); err != nil {
+		return err
+	}
+	if !strings.Contains(body, "<srw:explainResponse") || !strings.Contains(body, `<name set="bath">isbn</name>`) {
+		return fmt.Errorf("explain:\n%s", body)
+	}
+
+	for query, code := range map[string]string{
+		`title = "unterminated`:     "10",
+		`publisher = x`:             "16",
+		`title within x`:            "19",
+		`title = x prox y`:          "37",
+		`title = x sortBy dc.title`: "80",
+	} {
+		body, err := serve(url.Values{"version": {"1.2"}, "operation": {"searchRetrieve"}, "query": {query}})
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(body, "<uri>info:srw/diagnostic/1/"+code+"</uri>") {
+			return fmt.Errorf("query %q: want diagnostic %s:\n%s", query, code, body)
+		}
+	}
+	return nil
+}
+
+// checkSIP2 runs the SIP2 server on a loopback port and drives it like a
+// self-checkout kiosk: login, status, checkout, item information, renewal,
+// an overdue checkin with a fine, fee payments and a checkin that fills a
+// reservation, plus checksum errors, resends and a session that skips login.
+func checkSIP2(r *repositories.Repositories) error {
+	clk := clock.NewFake(time.Now())
+	policy := services.DefaultPolicy()
+	svc := newService(r, clk, policy)
+
+	book, _, err := newBook(r, 0)
+	if err != nil {
+		return err
+	}
+	barcode := "SIP" + strings.ReplaceAll(uuid.NewString(), "-", "")[:20]
+	if err := r.BookCopies.Create(nil, &models.BookCopy{BookID: book.ID, Status: models.BookCopyStatusAvailable, Barcode: &barcode}); err != nil {
+		return fmt.Errorf("create copy: %w", err)
+	}
+	alice, err := svc.CreateUser("repotest sip2 alice", models.UserRoleStudent)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+	bob, err := svc.CreateUser("repotest sip2 bob", models.UserRoleStudent)
+	if err != nil {
+		return fmt.Errorf("CreateUser: %w", err)
+	}
+
+	srv := sip2.NewServer(svc, clk, sip2.Config{
+		LoginUser: "kiosk", LoginPassword: "kiosk-secret", InstitutionID: "repotest", Currency: "USD", IdleTimeout: time.Minute,
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	kiosk, err := dialSIP2(ln.Addr().String())
+	if err != nil {
+		return err
+	}
+	defer kiosk.conn.Close()
+	now := func() string { return sip2.Timestamp(clk.Now()) }
+	expect := func(resp *sip2.Message, err error, id string, fixed map[int]string, fields map[string]string) error {
+		if err != nil {
+			return err
+		}
+		if resp.ID != id {
+			return fmt.Errorf("response %s%s, want message %s", resp.ID, resp.Fixed, id)
+		}
+		for at, want := range fixed {
+			if got := resp.Fixed[at : at+len(want)]; got != want {
+				return fmt.Errorf("%s fixed field at %d = %q, want %q (AF %q)", id, at, got, want, resp.Get("AF"))
+			}
+		}
+		for code, want := range fields {
+			if got := resp.Get(code); got != want {
+				return fmt.Errorf("%s field %s = %q, want %q (AF %q)", id, code, got, want, resp.Get("AF"))
+			}
+		}
+		return nil
+	}
+	patron := func(u *models.User) string { return "AA" + u.ID.String() + "|" }
+	item := "AB" + barcode + "|"
+
+	// Login and status.
+	resp, err := kiosk.send("9300CNkiosk|COwrong|CPdesk|")
+	if err := expect(resp, err, "94", map[int]string{0: "0"}, nil); err != nil {
+		return err
+	}
+	resp, err = kiosk.send("9300CNkiosk|COkiosk-secret|CPdesk|")
+	if err := expect(resp, err, "94", map[int]string{0: "1"}, nil); err != nil {
+		return err
+	}
+	status, err := kiosk.send("9900402.00")
+	if err := expect(status, err, "98", map[int]string{0: "YYYY", 30: "2.00"}, map[string]string{"AO": "repotest"}); err != nil {
+		return err
+	}
+	if bx := status.Get("BX"); len(bx) != 16 || bx[2] != 'Y' || bx[14] != 'Y' {
+		return fmt.Errorf("98 BX = %q, want checkin and renew supported", bx)
+	}
+
+	// A corrupted message is answered with 96; 97 repeats the last response.
+	corrupt, err := kiosk.raw("9900402.00AY5AZ0000\r")
+	if err := expect(corrupt, err, "96", nil, nil); err != nil {
+		return err
+	}
+	resent, err := kiosk.raw("97\r")
+	if err := expect(resent, err, "98", nil, nil); err != nil {
+		return err
+	}
+	if resent.Seq != status.Seq || resent.Get("BX") != status.Get("BX") {
+		return fmt.Errorf("97 resent %+v, want the last 98 %+v", resent, status)
+	}
+
+	// Patron status of a known and an unknown patron.
+	resp, err = kiosk.send("23001" + now() + "AOrepotest|" + patron(alice) + "AC|AD|")
+	if err := expect(resp, err, "24", map[int]string{0: "    "}, map[string]string{"BL": "Y", "AE": alice.Name, "BV": "0", "BH": "USD"}); err != nil {
+		return err
+	}
+	resp, err = kiosk.send("23001" + now() + "AOrepotest|AA" + uuid.NewString() + "|")
+	if err := expect(resp, err, "24", map[int]string{0: "YYYY"}, map[string]string{"BL": "N"}); err != nil {
+		return err
+	}
+
+	// Checkout, then item information shows the loan.
+	resp, err = kiosk.send("11NN" + now() + now() + "AOrepotest|" + patron(alice) + item + "AC|")
+	if err := expect(resp, err, "12", map[int]string{0: "1N", 3: "Y"}, map[string]string{"AJ": book.Title}); err != nil {
+		return err
+	}
+	if want := sip2.Timestamp(clk.Now().AddDate(0, 0, policy.LoanPeriodDays)); resp.Get("AH") != want {
+		return fmt.Errorf("12 due date %q, want %q", resp.Get("AH"), want)
+	}
+	resp, err = kiosk.send("17" + now() + "AOrepotest|" + item)
+	if err := expect(resp, err, "18", map[int]string{0: "04"}, map[string]string{"AJ": book.Title, "CF": "0", "CK": "001"}); err != nil {
+		return err
+	}
+	resp, err = kiosk.send("11NN" + now() + now() + "AOrepotest|" + patron(bob) + item)
+	if err := expect(resp, err, "12", map[int]string{0: "0N", 3: "N"}, nil); err != nil {
+		return err
+	}
+
+	// Renew outright, and by checking the item out again with renewal policy Y.
+	clk.Advance(24 * time.Hour)
+	resp, err = kiosk.send("29NN" + now() + now() + "AOrepotest|" + patron(bob) + item)
+	if err := expect(resp, err, "30", map[int]string{0: "0N"}, map[string]string{"AF": "Item is checked out to another patron"}); err != nil {
+		return err
+	}
+	resp, err = kiosk.send("29NN" + now() + now() + "AOrepotest|" + patron(alice) + item)
+	if err := expect(resp, err, "30", map[int]string{0: "1Y"}, map[string]string{"AH": sip2.Timestamp(clk.Now().AddDate(0, 0, policy.LoanPeriodDays))}); err != nil {
+		return err
+	}
+	clk.Advance(24 * time.Hour)
+	resp, err = kiosk.send("11YN" + now() + now() + "AOrepotest|" + patron(alice) + item)
+	if err := expect(resp, err, "12", map[int]string{0: "1Y"}, map[string]string{"AH": sip2.Timestamp(clk.Now().AddDate(0, 0, policy.LoanPeriodDays))}); err != nil {
+		return err
+	}
+
+	// Keep it 3 days past the due date, then check it in.
+	clk.Advance(time.Duration(policy.LoanPeriodDays+3) * 24 * time.Hour)
+	fine := 3 * policy.FinePerDay
+	resp, err = kiosk.send("23001" + now() + "AOrepotest|" + patron(alice))
+	if err := expect(resp, err, "24", map[int]string{6: "Y"}, nil); err != nil {
+		return err
+	}
+	resp, err = kiosk.send("09N" + now() + now() + "APdesk|AOrepotest|" + item + "AC|")
+	if err := expect(resp, err, "10", map[int]string{0: "1Y", 3: "N"}, map[string]string{"AA": alice.ID.String()}); err != nil {
+		return err
+	}
+	if want := fmt.Sprintf("Fine charged: %d USD", fine); resp.Get("AF") != want {
+		return fmt.Errorf("10 screen message %q, want %q", resp.Get("AF"), want)
+	}
+	resp, err = kiosk.send("09N" + now() + now() + "APdesk|AOrepotest|" + item)
+	if err := expect(resp, err, "10", map[int]string{0: "0"}, map[string]string{"AF": "Item is not checked out"}); err != nil {
+		return err
+	}
+
+	// Pay the fine in two parts; paying more than is owed is refused.
+	feePaid := func(amount, currency string) string {
+		return "37" + now() + "0100" + currency + "BV" + amount + "|AOrepotest|" + patron(alice) + "BKtxn-" + amount + "|"
+	}
+	resp, err = kiosk.send(feePaid(strconv.Itoa(fine-10)+".00", "USD"))
+	if err := expect(resp, err, "38", map[int]string{0: "Y"}, map[string]string{"BK": "txn-" + strconv.Itoa(fine-10) + ".00"}); err != nil {
+		return err
+	}
+	resp, err = kiosk.send(feePaid("11", "USD"))
+	if err := expect(resp, err, "38", map[int]string{0: "N"}, map[string]string{"AF": "Payment exceeds the amount owed"}); err != nil {
+		return err
+	}
+	resp, err = kiosk.send(feePaid("10", "EUR"))
+	if err := expect(resp, err, "38", map[int]string{0: "N"}, nil); err != nil {
+		return err
+	}
+	resp, err = kiosk.send(feePaid("10", "USD"))
+	if err := expect(resp, err, "38", map[int]string{0: "Y"}, nil); err != nil {
+		return err
+	}
+	account, err := svc.GetPatronAccount(alice.ID)
+	if err != nil {
+		return fmt.Errorf("GetPatronAccount: %w", err)
+	}
+	if account.Fines != fine || account.Paid != fine || account.Balance != 0 || account.CheckedOut != 0 {
+		return fmt.Errorf("account after payments = %+v, want fines and payments of %d and nothing owed", *account, fine)
+	}
+
+	// A checkin that fills Bob's reservation raises the hold alert.
+	resp, err = kiosk.send("11NN" + now() + now() + "AOrepotest|" + patron(alice) + item)
+	if err := expect(resp, err, "12", map[int]string{0: "1"}, nil); err != nil {
+		return err
+	}
+	if _, res, err := svc.CheckoutBook(book.ID, bob.ID); err != nil || res == nil {
+		return fmt.Errorf("CheckoutBook for Bob: reservation=%v err=%v", res, err)
+	}
+	resp, err = kiosk.send("17" + now() + "AOrepotest|" + item)
+	if err := expect(resp, err, "18", nil, map[string]string{"CF": "1"}); err != nil {
+		return err
+	}
+	resp, err = kiosk.send("09N" + now() + now() + "APdesk|AOrepotest|" + item)
+	if err := expect(resp, err, "10", map[int]string{0: "1", 3: "Y"}, map[string]string{"CV": "01"}); err != nil {
+		return err
+	}
+	if next, err := svc.GetActiveCheckout(resolveCopy(svc, barcode)); err != nil || next.UserID != bob.ID {
+		return fmt.Errorf("after the hold checkin the copy is with %v (err %v), want Bob", next, err)
+	}
+
+	resp, err = kiosk.send("17" + now() + "AOrepotest|ABno-such-item|")
+	if err := expect(resp, err, "18", map[int]string{0: "01"}, map[string]string{"AF": "Unknown item"}); err != nil {
+		return err
+	}
+	resp, err = kiosk.send("35" + now() + "AOrepotest|" + patron(alice))
+	if err := expect(resp, err, "36", map[int]string{0: "Y"}, nil); err != nil {
+		return err
+	}
+
+	// A kiosk that has not logged in is disconnected.
+	stranger, err := dialSIP2(ln.Addr().String())
+	if err != nil {
+		return err
+	}
+	defer stranger.conn.Close()
+	if resp, err := stranger.send("23001" + now() + "AOrepotest|" + patron(alice)); err == nil {
+		return fmt.Errorf("unauthenticated Patron Status answered with %s%s", resp.ID, resp.Fixed)
+	}
+	return nil
+}
+
+func resolveCopy(svc services.LibraryService, barcode string) uuid.UUID {
+	copy, err := svc.FindCopy(barcode)
+	if err != nil {
+		return uuid.Nil
+	}
+	return copy.ID
+}
+
+// sip2Client is a scripted kiosk connection.
+type sip2Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+	seq  int
+}
+
+func dialSIP2(addr string) (*sip2Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("dial SIP2 server: %w", err)
+	}
+	return &sip2Client{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// send appends the next sequence number and the checksum to body, sends it
+// and checks that the response echoes the sequence number.
+func (c *sip2Client) send(body string) (*sip2.Message, error) {
+	seq := c.seq % 10
+	c.seq++
+	msg := fmt.Sprintf("%sAY%dAZ", body, seq)
+	resp, err := c.raw(msg + sip2.Checksum(msg) + "\r")
+	if err != nil {
+		return nil, err
+	}
+	if resp.Seq != seq {
+		return nil, fmt.Errorf("response %s carries sequence number %d, want %d", resp.ID, resp.Seq, seq)
+	}
+	return resp, nil
+}
+
+func (c *sip2Client) raw(msg string) (*sip2.Message, error) {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.conn.Write([]byte(msg)); err != nil {
+		return nil, fmt.Errorf("send %q: %w", msg, err)
+	}
+	line, err := c.r.ReadString('\r')
+	if err != nil {
+		return nil, fmt.Errorf("response to %q: %w", msg, err)
+	}
+	resp, err := sip2.Parse(line)
+	if err != nil {
+		return nil, fmt.Errorf("response %q: %w", line, err)
+	}
+	return resp, nil
+}
+
+func checkReservationQueueCompaction(r *repositories.Repositories) error {
+	svc := newService(r, clock.System(), services.DefaultPolicy())
+
+	book, _, err := newBook(r, 1)
+	if err != nil {
+		return err
+	}
+	var users []*models.User
+	for i := 0; i < 4; i++ {
+		u, err := newUser(r, "queue compaction")
+		if err != nil {
+			return err
+		}
+		users = append(users, u)
+	}
+	checkout, _, err := svc.CheckoutBook(book.ID, users[0].ID)
+	if err != nil {
+		return fmt.Errorf("CheckoutBook: %w", err)
+	}
+	var queue []uuid.UUID
+	for _, u := range users[1:] {
+		_, res, err := svc.CheckoutBook(book.ID, u.ID)
+		if err != nil {
+			return fmt.Errorf("CheckoutBook(queued): %w", err)
+		}
+		queue = append(queue, res.ID)
+	}
+
+	// Cancelling the second reservation moves the third up to second place.
+	if err := svc.CancelReservation(queue[1]); err != nil {
+		return fmt.Errorf("CancelReservation: %w", err)
+	}
+	if err := expectQueue(r, book.ID, queue[0], queue[2]); err != nil {
+		return fmt.Errorf("after CancelReservation: %w", err)
+	}
+	if err := expectPlace(svc, users[3].ID, book, 2, 2); err != nil {
+		return err
+	}
+	if err := svc.CancelReservation(queue[1]); !errors.Is(err, services.ErrReservationNotFound) {
+		return fmt.Errorf("CancelReservation(cancelled): want ErrReservationNotFound, got %v", err)
+	}
+
+	// The return hands the copy to the head of the queue; the last reader is
+	// now first in line.
+	if _, err := svc.ReturnCheckout(checkout.ID); err != nil {
+		return fmt.Errorf("ReturnCheckout: %w", err)
+	}
+	if err := expectQueue(r, book.ID, queue[2]); err != nil {
+		return fmt.Errorf("after ReturnCheckout: %w", err)
+	}
+	if err := expectPlace(svc, users[3].ID, book, 1, 1); err != nil {
+		return err
+	}
+
+	if _, err := svc.ListUserReservations(uuid.New()); !errors.Is(err, services.ErrUserNotFound) {
+		return fmt.Errorf("ListUserReservations(unknown user): want ErrUserNotFound, got %v", err)
+	}
+	return nil
+}
+
+// checkHeldCopies runs with auto-checkout disabled: a returned copy waits on
+// the shelf for the head of the queue, whose checkout fulfils their
+// reservation, while anyone else asking for it is queued or refused.
+func checkHeldCopies(r *repositories.Repositories) error {
+	policy := services.DefaultPolicy()
+	policy.AutoCheckoutOnReturn = false
+	svc := newService(r, clock.System(), policy)
+
+	book, _, err := newBook(r, 1)
+	if err != nil {
+		return err
+	}
+	var users []*models.User
+	for _, name := range []string{"held alice", "held bob", "held carol"} {
+		u, err := newUser(r, name)
+		if err != nil {
+			return err
+		}
+		users = append(users, u)
+	}
+	alice, bob, carol := users[0], users[1], users[2]
+
+	checkout, _, err := svc.CheckoutBook(book.ID, alice.ID)
+	if err != nil {
+		return fmt.Errorf("CheckoutBook(alice): %w", err)
+	}
+	_, bobRes, err := svc.CheckoutBook(book.ID, bob.ID)
+	if err != nil || bobRes == nil {
+		return fmt.Errorf("CheckoutBook(bob): reservation %v (err %v), want one", bobRes, err)
+	}
+	if _, err := svc.ReturnCheckout(checkout.ID); err != nil {
+		return fmt.Errorf("ReturnCheckout: %w", err)
+	}
+
+	// Carol is not queued, so the copy on the shelf is not hers: she queues.
+	got, carolRes, err := svc.CheckoutBook(book.ID, carol.ID)
+	if err != nil || got != nil || carolRes == nil {
+		return fmt.Errorf("CheckoutBook(carol): checkout %v, reservation %v (err %v), want a reservation", got, carolRes, err)
+	}
+	if _, _, err := svc.CheckoutBook(book.ID, carol.ID); !errors.Is(err, services.ErrCopyOnHold) {
+		return fmt.Errorf("CheckoutBook(carol again): want ErrCopyOnHold, got %v", err)
+	}
+
+	// Bob, at the head, takes the copy and leaves the queue.
+	got, res, err := svc.CheckoutBook(book.ID, bob.ID)
+	if err != nil || got == nil || res != nil {
+		return fmt.Errorf("CheckoutBook(bob at the head): checkout %v, reservation %v (err %v), want a checkout", got, res, err)
+	}
+	if err := expectQueue(r, book.ID, carolRes.ID); err != nil {
+		return fmt.Errorf("after the head's checkout: %w", err)
+	}
+	counts, err := svc.GetBook(book.ID)
+	if err != nil {
+		return fmt.Errorf("GetBook: %w", err)
+	}
+	if counts.AvailableCopies != 0 || counts.CheckedOutCopies != 1 || counts.Holds != 1 {
+		return fmt.Errorf("counts %d/%d/%d, want 0 available, 1 checked out, 1 hold",
+			counts.AvailableCopies, counts.CheckedOutCopies, counts.Holds)
+	}
+	return nil
+}
+
+// expectPlace checks that a user's only reservation is for book, at the given
+// place in a queue of the given length.
+func expectPlace(svc services.LibraryService, userID uuid.UUID, book *models.Book, place, length int) error {
+	mine, err := svc.ListUserReservations(userID)
+	if err != nil {
+		return fmt.Errorf("ListUserReservations: %w", err)
+	}
+	if len(mine) != 1 {
+		return fmt.Errorf("ListUserReservations returned %d reservations, want 1", len(mine))
+	}
+	got := mine[0]
+	if got.BookID != book.ID || got.Title != book.Title || got.PlaceInLine != place || got.QueueLength != length {
+		return fmt.Errorf("ListUserReservations: %q place %d of %d, want %q place %d of %d",
+			got.Title, got.PlaceInLine, got.QueueLength, book.Title, place, length)
+	}
+	return nil
+}
+
+func checkReservationEstimates(r *repositories.Repositories) error {
+	clk := clock.NewFake(time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC))
+	policy := services.DefaultPolicy()
+	svc := newService(r, clk, policy)
+	loan := time.Duration(policy.LoanPeriodDays) * 24 * time.Hour
+	day := 24 * time.Hour
+
+	// Librarians, so that no term caps a due date.
+	var users []*models.User
+	for i := 0; i < 6; i++ {
+		u, err := svc.CreateUser("repotest estimates", models.UserRoleLibrarian)
+		if err != nil {
+			return fmt.Errorf("CreateUser: %w", err)
+		}
+		users = append(users, u)
+	}
+	book, err := svc.CreateBook("repotest "+uuid.NewString(), "repotest", 2)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+
+	// One loan returned two days late makes the book's average lateness two days.
+	first, _, err := svc.CheckoutBook(book.ID, users[0].ID)
+	if err != nil {
+		return fmt.Errorf("CheckoutBook: %w", err)
+	}
+	clk.Advance(loan + 2*day)
+	if _, err := svc.ReturnCheckout(first.ID); err != nil {
+		return fmt.Errorf("ReturnCheckout: %w", err)
+	}
+
+	// Both copies go out now and are expected back two days after they fall due.
+	start := clk.Now().UTC()
+	for _, u := range users[:2] {
+		if _, _, err := svc.CheckoutBook(book.ID, u.ID); err != nil {
+			return fmt.Errorf("CheckoutBook: %w", err)
+		}
+	}
+	back := start.Add(loan + 2*day)
+	want := []time.Time{back, back, back.Add(loan + 2*day)}
+	var last *services.QueuedReservation
+	for _, u := range users[2:5] {
+		_, res, err := svc.CheckoutBook(book.ID, u.ID)
+		if err != nil || res == nil {
+			return fmt.Errorf("CheckoutBook(queued): reservation=%v err=%v", res, err)
+		}
+		last = res
+	}
+	if last.EstimatedAvailableAt == nil || !last.EstimatedAvailableAt.Equal(want[2]) {
+		return fmt.Errorf("CheckoutBook: reservation estimated at %v, want %s", last.EstimatedAvailableAt, want[2])
+	}
+	queue, err := svc.ListReservationsForBook(book.ID)
+	if err != nil {
+		return fmt.Errorf("ListReservationsForBook: %w", err)
+	}
+	if len(queue) != len(want) {
+		return fmt.Errorf("ListReservationsForBook returned %d reservations, want %d", len(queue), len(want))
+	}
+	for i, res := range queue {
+		if res.EstimatedAvailableAt == nil || !res.EstimatedAvailableAt.Equal(want[i]) {
+			return fmt.Errorf("reservation %d estimated at %v, want %s", i+1, res.EstimatedAvailableAt, want[i])
+		}
+	}
+	mine, err := svc.ListUserReservations(users[3].ID)
+	if err != nil {
+		return fmt.Errorf("ListUserReservations: %w", err)
+	}
+	if len(mine) != 1 || mine[0].EstimatedAvailableAt == nil || !mine[0].EstimatedAvailableAt.Equal(want[1]) {
+		return fmt.Errorf("ListUserReservations: want one reservation estimated at %s", want[1])
+	}
+
+	// A copy overdue beyond the usual lateness is expected back any moment.
+	clk.Advance(loan + 3*day)
+	queue, err = svc.ListReservationsForBook(book.ID)
+	if err != nil {
+		return fmt.Errorf("ListReservationsForBook: %w", err)
+	}
+	if now := clk.Now().UTC(); queue[0].EstimatedAvailableAt == nil || !queue[0].EstimatedAvailableAt.Equal(now) {
+		return fmt.Errorf("overdue: head estimated at %v, want now (%s)", queue[0].EstimatedAvailableAt, now)
+	}
+
+	if err := checkLongQueueEstimate(r); err != nil {
+		return err
+	}
+
+	// Without copies there is nothing to estimate from.
+	empty, err := svc.CreateBook("repotest "+uuid.NewString(), "repotest", 0)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+	_, res, err := svc.CheckoutBook(empty.ID, users[5].ID)
+	if err != nil || res == nil {
+		return fmt.Errorf("CheckoutBook(no copies): reservation=%v err=%v", res, err)
+	}
+	if res.EstimatedAvailableAt != nil {
+		return fmt.Errorf("no copies: reservation estimated at %s, want none", res.EstimatedAvailableAt)
+	}
+	return nil
+}
+
+// checkLongQueueEstimate queues three users behind a 200-day loan, so that
+// the last is expected to get the copy well beyond the closures a single
+// loan's calendar would load, and checks that a closure on that day still
+// moves the estimate.
+func checkLongQueueEstimate(r *repositories.Repositories) error {
+	clk := clock.NewFake(time.Date(2031, 3, 3, 10, 0, 0, 0, time.UTC))
+	policy := services.DefaultPolicy()
+	policy.LoanPeriodDays = 200
+	svc := newService(r, clk, policy)
+
+	branch, err := svc.CreateBranch("repotest "+uuid.NewString(), "UTC")
+	if err != nil {
+		return fmt.Errorf("CreateBranch: %w", err)
+	}
+	var week []models.OpeningHours
+	for d := 0; d <= 6; d++ {
+		week = append(week, models.OpeningHours{Weekday: d, Opens: "09:00", Closes: "17:00"})
+	}
+	if _, err := svc.SetOpeningHours(branch.ID, week); err != nil {
+		return fmt.Errorf("SetOpeningHours: %w", err)
+	}
+	book, err := svc.CreateBook("repotest "+uuid.NewString(), "repotest", 1)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+	copies, err := r.BookCopies.ListByBooks(nil, []uuid.UUID{book.ID})
+	if err != nil || len(copies) != 1 {
+		return fmt.Errorf("ListByBooks: %d copies, %v", len(copies), err)
+	}
+	if _, err := svc.AssignCopyBranch(copies[0].ID, &branch.ID, 0); err != nil {
+		return fmt.Errorf("AssignCopyBranch: %w", err)
+	}
+	for i := 0; i < 4; i++ {
+		u, err := svc.CreateUser("repotest long queue", models.UserRoleLibrarian)
+		if err != nil {
+			return fmt.Errorf("CreateUser: %w", err)
+		}
+		if _, _, err := svc.CheckoutBook(book.ID, u.ID); err != nil {
+			return fmt.Errorf("CheckoutBook %d: %w", i, err)
+		}
+	}
+
+	queue, err := svc.ListReservationsForBook(book.ID)
+	if err != nil || len(queue) != 3 || queue[2].EstimatedAvailableAt == nil {
+		return fmt.Errorf("ListReservationsForBook = %d reservations, %v; want 3 estimated", len(queue), err)
+	}
+	lastDay := queue[2].EstimatedAvailableAt.UTC().Truncate(24 * time.Hour)
+	if lastDay.Sub(clk.Now()) < time.Duration(policy.LoanPeriodDays+366)*24*time.Hour {
+		return fmt.Errorf("last reservation estimated at %s, want it beyond one loan's calendar", lastDay.Format("2006-01-02"))
+	}
+	if _, err := svc.AddClosure(branch.ID, lastDay, "Stocktake"); err != nil {
+		return fmt.Errorf("AddClosure: %w", err)
+	}
+	queue, err = svc.ListReservationsForBook(book.ID)
+	if err != nil {
+		return fmt.Errorf("ListReservationsForBook: %w", err)
+	}
+	if at := queue[2].EstimatedAvailableAt; at == nil || at.Before(lastDay.Add(24*time.Hour)) {
+		return fmt.Errorf("last reservation estimated at %v after closing %s, want a later day", at, lastDay.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// checkAvailabilityCounts follows a book's counts through checkout,
+// reservation, cancellation and return, then corrupts them and checks that
+// ReconcileAvailability restores them.
+func checkAvailabilityCounts(r *repositories.Repositories) error {
+	svc := newService(r, clock.System(), services.DefaultPolicy())
+
+	book, err := svc.CreateBook("repotest "+uuid.NewString(), "repotest", 1)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+	expect := func(step string, want repositories.Availability) error {
+		got, err := r.Books.GetByID(nil, book.ID)
+		if err != nil {
+			return fmt.Errorf("%s: GetByID: %w", step, err)
+		}
+		if have := (repositories.Availability{Available: got.AvailableCopies, CheckedOut: got.CheckedOutCopies, Holds: got.Holds}); have != want {
+			return fmt.Errorf("%s: counts %+v, want %+v", step, have, want)
+		}
+		return nil
+	}
+	if err := expect("after CreateBook", repositories.Availability{Available: 1}); err != nil {
+		return err
+	}
+	if _, err := svc.AddBookCopy(book.ID); err != nil {
+		return fmt.Errorf("AddBookCopy: %w", err)
+	}
+	var users []*models.User
+	for i := 0; i < 4; i++ {
+		u, err := newUser(r, "availability")
+		if err != nil {
+			return err
+		}
+		users = append(users, u)
+	}
+	var checkouts []*models.Checkout
+	for _, u := range users[:2] {
+		checkout, _, err := svc.CheckoutBook(book.ID, u.ID)
+		if err != nil {
+			return fmt.Errorf("CheckoutBook: %w", err)
+		}
+		checkouts = append(checkouts, checkout)
+	}
+	var holds []*services.QueuedReservation
+	for _, u := range users[2:] {
+		_, res, err := svc.CheckoutBook(book.ID, u.ID)
+		if err != nil || res == nil {
+			return fmt.Errorf("CheckoutBook(queued): reservation %v, err %v", res, err)
+		}
+		holds = append(holds, res)
+	}
+	if err := expect("after checkouts and holds", repositories.Availability{CheckedOut: 2, Holds: 2}); err != nil {
+		return err
+	}
+	if err := svc.CancelReservation(holds[1].ID); err != nil {
+		return fmt.Errorf("CancelReservation: %w", err)
+	}
+	if err := expect("after CancelReservation", repositories.Availability{CheckedOut: 2, Holds: 1}); err != nil {
+		return err
+	}
+	// The first return goes straight to the remaining hold.
+	if _, err := svc.ReturnCheckout(checkouts[0].ID); err != nil {
+		return fmt.Errorf("ReturnCheckout: %w", err)
+	}
+	if err := expect("after return to a hold", repositories.Availability{CheckedOut: 2}); err != nil {
+		return err
+	}
+	if _, err := svc.ReturnCheckout(checkouts[1].ID); err != nil {
+		return fmt.Errorf("ReturnCheckout: %w", err)
+	}
+	if err := expect("after return to the shelf", repositories.Availability{Available: 1, CheckedOut: 1}); err != nil {
+		return err
+	}
+
+	if err := r.Books.SetAvailability(nil, book.ID, repositories.Availability{Available: 7, Holds: 3}); err != nil {
+		return fmt.Errorf("SetAvailability: %w", err)
+	}
+	corrected, err := svc.ReconcileAvailability()
+	if err != nil {
+		return fmt.Errorf("ReconcileAvailability: %w", err)
+	}
+	if corrected < 1 {
+		return fmt.Errorf("ReconcileAvailability corrected %d books, want at least 1", corrected)
+	}
+	return expect("after ReconcileAvailability", repositories.Availability{Available: 1, CheckedOut: 1})
+}
+
+// checkCatalogueCache serves book reads from the cache until a write through
+// the service invalidates them. Writes straight to the repositories stand in
+// for another server's.
+func checkCatalogueCache(r *repositories.Repositories) error {
+	base := newService(r, clock.System(), services.DefaultPolicy())
+	svc := services.NewCachingService(base, cache.NewLRU(100), time.Minute)
+
+	tag := "cache" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	titled := &repositories.BookQuery{Op: repositories.QueryMatch, Field: repositories.BookFieldTitle, Pattern: tag}
+	book, err := svc.CreateBook(tag+" one", "repotest", 1)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+	if _, total, err := svc.SearchBooks(titled, 0, 10); err != nil || total != 1 {
+		return fmt.Errorf("SearchBooks: %d matches (err %v), want 1", total, err)
+	}
+	if got, err := svc.GetBook(book.ID); err != nil || got.AvailableCopies != 1 {
+		return fmt.Errorf("GetBook: %+v (err %v), want 1 available", got, err)
+	}
+
+	// Unseen while cached, seen by a consistent read.
+	if err := r.Books.SetAvailability(nil, book.ID, repositories.Availability{Available: 5}); err != nil {
+		return fmt.Errorf("SetAvailability: %w", err)
+	}
+	if got, err := svc.GetBook(book.ID); err != nil || got.AvailableCopies != 1 {
+		return fmt.Errorf("GetBook after a write around the cache: %+v (err %v), want the cached 1 available", got, err)
+	}
+	if got, err := svc.WithConsistentReads().GetBook(book.ID); err != nil || got.AvailableCopies != 5 {
+		return fmt.Errorf("consistent GetBook: %+v (err %v), want 5 available", got, err)
+	}
+
+	// A checkout through the service invalidates book details and searches.
+	user, err := newUser(r, "catalogue cache")
+	if err != nil {
+		return err
+	}
+	if _, _, err := svc.CheckoutBook(book.ID, user.ID); err != nil {
+		return fmt.Errorf("CheckoutBook: %w", err)
+	}
+	if got, err := svc.GetBook(book.ID); err != nil || got.AvailableCopies != 4 || got.CheckedOutCopies != 1 {
+		return fmt.Errorf("GetBook after CheckoutBook: %+v (err %v), want 4 available and 1 checked out", got, err)
+	}
+	if _, err := svc.CreateBook(tag+" two", "repotest", 0); err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+	if _, total, err := svc.SearchBooks(titled, 0, 10); err != nil || total != 2 {
+		return fmt.Errorf("SearchBooks after CreateBook: %d matches (err %v), want 2", total, err)
+	}
+	books, err := svc.ListBooks()
+	if err != nil {
+		return fmt.Errorf("ListBooks: %w", err)
+	}
+	if !slices.ContainsFunc(books, func(b models.Book) bool { return b.ID == book.ID && b.CheckedOutCopies == 1 }) {
+		return fmt.Errorf("ListBooks is missing book %s with its checkout", book.ID)
+	}
+	if _, err := svc.GetBook(uuid.New()); !errors.Is(err, services.ErrBookNotFound) {
+		return fmt.Errorf("GetBook(unknown): want ErrBookNotFound, got %v", err)
+	}
+	return nil
+}
+
+// checkRecordVersions covers optimistic concurrency: records start at
+// version 1, edits increment it, an edit naming a stale version is refused
+// without effect, and circulation leaves versions alone.
+func checkRecordVersions(r *repositories.Repositories) error {
+	svc := newService(r, clock.System(), services.DefaultPolicy())
+
+	user, err := newUser(r, "record versions")
+	if err != nil {
+		return err
+	}
+	if user.Version != 1 {
+		return fmt.Errorf("new user: version %d, want 1", user.Version)
+	}
+	book, err := svc.CreateBook("Record Versions", "repotest", 1)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+	if book.Version != 1 {
+		return fmt.Errorf("CreateBook: version %d, want 1", book.Version)
+	}
+
+	// Unconditional, then conditional on the current version.
+	if book, err = svc.SetBookLoanType(book.ID, models.LoanTypeShort, 4, 0); err != nil || book.Version != 2 {
+		return fmt.Errorf("SetBookLoanType: %+v (err %v), want version 2", book, err)
+	}
+	if book, err = svc.SetBookLoanType(book.ID, models.LoanTypeOvernight, 0, 2); err != nil || book.Version != 3 {
+		return fmt.Errorf("SetBookLoanType(ifVersion 2): %+v (err %v), want version 3", book, err)
+	}
+	if _, err := svc.SetBookLoanType(book.ID, models.LoanTypeStandard, 0, 2); !errors.Is(err, services.ErrVersionMismatch) {
+		return fmt.Errorf("SetBookLoanType(stale ifVersion): want ErrVersionMismatch, got %v", err)
+	}
+	if got, err := svc.GetBook(book.ID); err != nil || got.Version != 3 || got.LoanType != models.LoanTypeOvernight {
+		return fmt.Errorf("GetBook after a refused edit: %+v (err %v), want version 3 still OVERNIGHT", got, err)
+	}
+	if _, err := svc.SetBookLoanType(uuid.New(), models.LoanTypeStandard, 0, 1); !errors.Is(err, services.ErrBookNotFound) {
+		return fmt.Errorf("SetBookLoanType(unknown): want ErrBookNotFound, got %v", err)
+	}
+
+	// Copies version independently of their book.
+	copies, err := r.BookCopies.ListByBooks(nil, []uuid.UUID{book.ID})
+	if err != nil || len(copies) != 1 {
+		return fmt.Errorf("ListByBooks: %d copies (err %v), want 1", len(copies), err)
+	}
+	copy := copies[0]
+	if copy.Version != 1 {
+		return fmt.Errorf("new copy: version %d, want 1", copy.Version)
+	}
+	branch, err := svc.CreateBranch("Versions "+uuid.NewString()[:8], "UTC")
+	if err != nil {
+		return fmt.Errorf("CreateBranch: %w", err)
+	}
+	moved, err := svc.AssignCopyBranch(copy.ID, &branch.ID, 1)
+	if err != nil || moved.Version != 2 {
+		return fmt.Errorf("AssignCopyBranch(ifVersion 1): %+v (err %v), want version 2", moved, err)
+	}
+	if _, err := svc.AssignCopyBranch(copy.ID, nil, 1); !errors.Is(err, services.ErrVersionMismatch) {
+		return fmt.Errorf("AssignCopyBranch(stale ifVersion): want ErrVersionMismatch, got %v", err)
+	}
+	if got, err := r.BookCopies.GetByID(nil, copy.ID); err != nil || got.BranchID == nil || *got.BranchID != branch.ID {
+		return fmt.Errorf("copy after a refused move: %+v (err %v), want it still at branch %s", got, err, branch.ID)
+	}
+
+	// Circulation is not an edit.
+	checkout, _, err := svc.CheckoutBook(book.ID, user.ID)
+	if err != nil {
+		return fmt.Errorf("CheckoutBook: %w", err)
+	}
+	if _, err := svc.ReturnCheckout(checkout.ID); err != nil {
+		return fmt.Errorf("ReturnCheckout: %w", err)
+	}
+	if got, err := svc.GetBook(book.ID); err != nil || got.Version != 3 {
+		return fmt.Errorf("GetBook after a loan: %+v (err %v), want version 3", got, err)
+	}
+	if got, err := r.BookCopies.GetByID(nil, copy.ID); err != nil || got.Version != 2 {
+		return fmt.Errorf("copy after a loan: %+v (err %v), want version 2", got, err)
+	}
+	return nil
+}
+
+// checkBookDeletion covers editing a book's record, withdrawing it while loans
+// and reservations refer to it, restoring it and purging it for good.
+func checkBookDeletion(r *repositories.Repositories) error {
+	clk := clock.NewFake(time.Now())
+	policy := services.DefaultPolicy()
+	svc := newService(r, clk, policy)
+
+	book, err := svc.CreateBook("repotest "+uuid.NewString(), "repotest", 1)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+
+	// Edits change only the fields given and bump the version.
+	title, isbn := "Deletion "+uuid.NewString(), randomISBN()
+	subjects := []string{"Libraries", " Weeding "}
+	edited, err := svc.UpdateBook(book.ID, services.BookChanges{Title: &title, ISBN: &isbn, Subjects: &subjects}, 1)
+	if err != nil {
+		return fmt.Errorf("UpdateBook: %w", err)
+	}
+	if edited.Title != title || edited.Author != "repotest" || edited.ISBN == nil || *edited.ISBN != isbn ||
+		len(edited.Subjects) != 2 || edited.Subjects[1] != "Weeding" || edited.Version != 2 {
+		return fmt.Errorf("UpdateBook: %+v, want the new title, ISBN and trimmed subjects at version 2", edited)
+	}
+	if _, err := svc.UpdateBook(book.ID, services.BookChanges{Title: &title}, 1); !errors.Is(err, services.ErrVersionMismatch) {
+		return fmt.Errorf("UpdateBook(stale ifVersion): want ErrVersionMismatch, got %v", err)
+	}
+	blank := "  "
+	if _, err := svc.UpdateBook(book.ID, services.BookChanges{Title: &blank}, 0); !errors.Is(err, services.ErrInvalidBook) {
+		return fmt.Errorf("UpdateBook(blank title): want ErrInvalidBook, got %v", err)
+	}
+	other, err := svc.CreateBook("repotest "+uuid.NewString(), "repotest", 1)
+	if err != nil {
+		return fmt.Errorf("CreateBook: %w", err)
+	}
+	if _, err := svc.UpdateBook(other.ID, services.BookChanges{ISBN: &isbn}, 0); !errors.Is(err, services.ErrISBNTaken) {
+		return fmt.Errorf("UpdateBook(taken ISBN): want ErrISBNTaken, got %v", err)
+	}
+
+	// A book on loan cannot be withdrawn.
+	alice, err := newUser(r, "deletion alice")
+	if err != nil {
+		return err
+	}
+	bob, err := newUser(r, "deletion bob")
+	if err != nil {
+		return err
+	}
+	checkout, _, err := svc.CheckoutBook(book.ID, alice.ID)
+	if err != nil {
+		return fmt.Errorf("CheckoutBook: %w", err)
+	}
+	if _, err := svc.DeleteBook(book.ID, false, 0); !errors.Is(err, services.ErrBookOnLoan) {
+		return fmt.Errorf("DeleteBook(on loan): want ErrBookOnLoan, got %v", err)
+	}
+	clk.Advance(time.Duration(policy.LoanPeriodDays+3) * 24 * time.Hour)
+	if returned, err := svc.ReturnCheckout(checkout.ID); err != nil || returned.FineAmount == 0 {
+		return fmt.Errorf("ReturnCheckout: %+v (err %v), want a fine", returned, err)
+	}
+
+	// Withdrawing cancels the queue and hides the book until it is restored.
+	res := &models.Reservation{BookID: book.ID, UserID: bob.ID, QueuePosition: 1, CreatedAt: clk.Now()}
+	if err := r.Reservations.Create(nil, res); err != nil {
+		return fmt.Errorf("Reservations.Create: %w", err)
+	}
+	if err := r.Books.AdjustAvailability(nil, book.ID, repositories.Availability{Holds: 1}); err != nil {
+		return fmt.Errorf("AdjustAvailability: %w", err)
+	}
+	deletion, err := svc.DeleteBook(book.ID, false, 0)
+	if err != nil {
+		return fmt.Errorf("DeleteBook: %w", err)
+	}
+	if deletion.Purged || len(deletion.Cancelled) != 1 || deletion.Cancelled[0].ID != res.ID {
+		return fmt.Errorf("DeleteBook: %+v, want a withdrawal cancelling reservation %s", deletion, res.ID)
+	}
+	if _, err := svc.GetBook(book.ID); !errors.Is(err, services.ErrBookNotFound) {
+		return fmt.Errorf("GetBook(withdrawn): want ErrBookNotFound, got %v", err)
+	}
+	books, err := svc.ListBooks()
+	if err != nil {
+		return fmt.Errorf("ListBooks: %w", err)
+	}
+	for _, b := range books {
+		if b.ID == book.ID {
+			return errors.New("ListBooks lists a withdrawn book")
+		}
+	}
+	q := &services.BookQuery{Op: repositories.QueryMatch, Field: repositories.BookFieldTitle, Pattern: title, Whole: true}
+	if found, total, err := svc.SearchBooks(q, 0, 10); err != nil || total != 0 || len(found) != 0 {
+		return fmt.Errorf("SearchBooks(withdrawn title): %d of %d (err %v), want none", len(found), total, err)
+	}
+	if _, _, err := svc.CheckoutBook(book.ID, alice.ID); !errors.Is(err, services.ErrBookNotFound) {
+		return fmt.Errorf("CheckoutBook(withdrawn): want ErrBookNotFound, got %v", err)
+	}
+	if err := r.Books.AdjustAvailability(nil, book.ID, repositories.Availability{Holds: 1}); !errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("AdjustAvailability(withdrawn): want ErrNotFound, got %v", err)
+	}
+	if _, err := svc.DeleteBook(book.ID, false, 0); !errors.Is(err, services.ErrBookNotFound) {
+		return fmt.Errorf("DeleteBook(withdrawn again): want ErrBookNotFound, got %v", err)
+	}
+
+	restored, err := svc.RestoreBook(book.ID)
+	if err != nil {
+		return fmt.Errorf("RestoreBook: %w", err)
+	}
+	if restored.Title != title || restored.Holds != 0 || restored.AvailableCopies != 1 {
+		return fmt.Errorf("RestoreBook: %+v, want the edited book with one copy available and no holds", restored)
+	}
+	if queue, err := r.Reservations.ListByBook(nil, book.ID); err != nil || len(queue) != 0 {
+		return fmt.Errorf("reservations after restore: %d (err %v), want the cancelled one to stay cancelled", len(queue), err)
+	}
+
+	// Purging keeps a fined loan's history, so it is refused until the fine
+	// is gone; a book without loans purges with its copies.
+	if _, err := svc.DeleteBook(book.ID, true, 0); !errors.Is(err, services.ErrBookHasFines) {
+		return fmt.Errorf("DeleteBook(purge, fined loan): want ErrBookHasFines, got %v", err)
+	}
+	copies, err := r.BookCopies.ListByBooks(nil, []uuid.UUID{other.ID})
+	if err != nil || len(copies) != 1 {
+		return fmt.Errorf("ListByBooks: %d copies (err %v), want 1", len(copies), err)
+	}
+	if deletion, err := svc.DeleteBook(other.ID, true, other.Version); err != nil || !deletion.Purged {
+		return fmt.Errorf("DeleteBook(purge): %+v (err %v)", deletion, err)
+	}
+	if _, err := r.Books.GetAnyForUpdate(nil, other.ID); !errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("GetAnyForUpdate(purged): want ErrNotFound, got %v", err)
+	}
+	if _, err := r.BookCopies.GetByID(nil, copies[0].ID); !errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("copy of a purged book: want ErrNotFound, got %v", err)
+	}
+	if err := r.Books.AdjustAvailability(nil, uuid.New(), repositories.Availability{Holds: 1}); !errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("AdjustAvailability(unknown): want ErrNotFound, got %v", err)
+	}
+	return nil
+}
+
+// checkFineRecompute recomputes two on-time returns stored with a wrong fine:
+// a dry run and another user's scope leave them alone, and a payment made
+// after one of them was returned settles it.
+func checkFineRecompute(r *repositories.Repositories) error {
+	svc := newService(r, clock.System(), services.DefaultPolicy())
+	now := time.Now().UTC().Truncate(time.Second)
+	var users []*models.User
+	var checkouts []*models.Checkout
+	for _, name := range []string{"recompute", "recompute payer"} {
+		user, err := newUser(r, name)
+		if err != nil {
+			return err
+		}
+		_, copies, err := newBook(r, 1)
+		if err != nil {
+			return err
+		}
+		c := newCheckout(copies[0].ID, user.ID, now.Add(time.Hour))
+		c.LoanType = models.LoanTypeStandard
+		if err := r.Checkouts.Create(nil, c); err != nil {
+			return fmt.Errorf("Create: %w", err)
+		}
+		if err := r.Checkouts.MarkReturned(nil, c.ID, now, 99); err != nil {
+			return fmt.Errorf("MarkReturned: %w", err)
+		}
+		users, checkouts = append(users, user), append(checkouts, c)
+	}
+	if err := r.Payments.Create(nil, &models.Payment{UserID: users[1].ID, Amount: 99, PaidAt: now.Add(time.Minute)}); err != nil {
+		return fmt.Errorf("create payment: %w", err)
+	}
+	fineOf := func(i int) int {
+		got, err := r.Checkouts.GetByIDForUpdate(nil, checkouts[i].ID)
+		if err != nil {
+			return -1
+		}
+		return got.FineAmount
+	}
+
+	dry, err := svc.RecomputeFines(services.FineScope{UserID: &users[0].ID, DryRun: true})
+	if err != nil {
+		return fmt.Errorf("dry run: %w", err)
+	}
+	if dry.Updated != 0 || len(dry.Changes) != 1 || dry.Changes[0].CheckoutID != checkouts[0].ID || dry.Changes[0].NewFine != 0 || dry.Changes[0].Delta != -99 {
+		return fmt.Errorf("dry run = %+v, want one change of -99 and nothing updated", dry)
+	}
+	if fine := fineOf(0); fine != 99 {
+		return fmt.Errorf("fine = %d after a dry run, want 99", fine)
+	}
+
+	later := now.Add(time.Hour)
+	if none, err := svc.RecomputeFines(services.FineScope{UserID: &users[0].ID, ReturnedSince: &later}); err != nil || len(none.Changes) != 0 {
+		return fmt.Errorf("recompute of later returns = %+v, %v; want no changes", none, err)
+	}
+
+	settled, err := svc.RecomputeFines(services.FineScope{UserID: &users[1].ID})
+	if err != nil {
+		return fmt.Errorf("recompute of the payer: %w", err)
+	}
+	if settled.Updated != 0 || settled.Settled != 1 || len(settled.Changes) != 1 || !settled.Changes[0].Settled {
+		return fmt.Errorf("recompute of the payer = %+v, want one settled change", settled)
+	}
+	if fine := fineOf(1); fine != 99 {
+		return fmt.Errorf("settled fine = %d, want it left at 99", fine)
+	}
+
+	done, err := svc.RecomputeFines(services.FineScope{CheckoutID: &checkouts[0].ID})
+	if err != nil {
+		return fmt.Errorf("recompute of one checkout: %w", err)
+	}
+	if done.Updated != 1 || done.Settled != 0 {
+		return fmt.Errorf("recompute of one checkout = %+v, want it updated", done)
+	}
+	if fine := fineOf(0); fine != 0 {
+		return fmt.Errorf("fine = %d after recompute, want 0", fine)
+	}
+	return nil
+}
+
+// conflictingTransactor runs each transaction through Transactor, then rolls
+// back the first failures of them with a serialization failure, as PostgreSQL
+// would at commit, and calls between before the next attempt.
+type conflictingTransactor struct {
+	repositories.Transactor
+	failures int
+	between  func()
+}
+
+func (c *conflictingTransactor) TransactionWith(opts repositories.TxOptions, fn func(tx repositories.Tx) error) error {
+	err := c.Transactor.TransactionWith(opts, func(tx repositories.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if c.failures > 0 {
+			return &pgconn.PgError{Code: "40001"}
+		}
+		return nil
+	})
+	if c.failures > 0 {
+		c.failures--
+		c.between()
+	}
+	return err
+}
+
+// checkCheckoutRetry fails a checkout of a book that is out at commit once
+// and, before it is run again, has the copy returned: the retry must lend it
+// and report only the checkout, not the rolled-back reservation.
+func checkCheckoutRetry(r *repositories.Repositories) error {
+	book, _, err := newBook(r, 1)
+	if err != nil {
+		return err
+	}
+	user, err := newUser(r, "retried")
+	if err != nil {
+		return err
+	}
+	holder, err := newUser(r, "holder")
+	if err != nil {
+		return err
+	}
+	direct := newService(r, clock.System(), services.DefaultPolicy())
+	held, _, err := direct.CheckoutBook(book.ID, holder.ID)
+	if err != nil || held == nil {
+		return fmt.Errorf("holder's CheckoutBook: checkout=%v err=%v", held, err)
+	}
+	var returnErr error
+	conflicting := &conflictingTransactor{Transactor: r.Transactor, failures: 1, between: func() {
+		_, returnErr = direct.ReturnCheckout(held.ID)
+	}}
+	stubbed := *r
+	stubbed.Transactor = conflicting
+	policy := services.DefaultPolicy()
+	policy.TxRetry = repositories.RetryPolicy{MaxAttempts: 3}
+	svc := newService(&stubbed, clock.System(), policy)
+
+	checkout, res, err := svc.CheckoutBook(book.ID, user.ID)
+	if returnErr != nil {
+		return fmt.Errorf("ReturnCheckout between attempts: %w", returnErr)
+	}
+	if err != nil || checkout == nil || res != nil {
+		return fmt.Errorf("retried CheckoutBook: checkout=%v reservation=%v err=%v, want only a checkout", checkout, res, err)
+	}
+	if err := expectQueue(r, book.ID); err != nil {
+		return fmt.Errorf("first attempt's reservation not rolled back: %w", err)
+	}
+	want := repositories.TxStats{Name: "checkout", Runs: 1, Attempts: 2, Retries: 1, SerializationFailures: 1}
+	if got := svc.TransactionStats(); len(got) != 1 || got[0] != want {
+		return fmt.Errorf("TransactionStats = %+v, want %+v", got, want)
+	}
+	return nil
+}
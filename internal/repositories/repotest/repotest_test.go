@@ -0,0 +1,63 @@
+package repotest_test
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"library/internal/bootstrap"
+	"library/internal/config"
+	"library/internal/repositories"
+	"library/internal/repositories/repotest"
+)
+
+// TestMain silences service and SQL logging, which drowns out the report, and
+// expected constraint violations, unless VERBOSE is set.
+func TestMain(m *testing.M) {
+	if os.Getenv("VERBOSE") == "" {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+func TestMemory(t *testing.T) {
+	run(t, repositories.NewMemoryRepositories())
+}
+
+// TestSQLite runs the suite against a temporary database file, which doubles
+// as its own replica so that reads routed through Transactor.ReadOnly are
+// covered too. PostgreSQL is left to scripts/storage_conformance.go, which
+// needs DATABASE_URL.
+func TestSQLite(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.SQLitePath = filepath.Join(t.TempDir(), "library.db")
+	db, err := bootstrap.OpenSQLite(cfg)
+	if err != nil {
+		t.Fatalf("open SQLite: %v", err)
+	}
+	if os.Getenv("VERBOSE") == "" {
+		db = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	run(t, repositories.NewGormRepositories(db, db))
+}
+
+// run runs every check against repos as a subtest, in the order of Checks.
+func run(t *testing.T, repos *repositories.Repositories) {
+	for _, c := range repotest.Checks {
+		t.Run(c.Name, func(t *testing.T) {
+			if err := c.Run(repos); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package repositories
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ─── Isolation ────────────────────────────────────────────────────────────────
+
+// Isolation is the isolation level a transaction runs at.
+type Isolation int
+
+const (
+	// IsolationReadCommitted is the database default. The service relies on
+	// explicit row locks (SELECT … FOR UPDATE) for its invariants.
+	IsolationReadCommitted Isolation = iota
+
+	// IsolationSerializable makes PostgreSQL abort any transaction whose
+	// outcome could differ from some serial order (SQLSTATE 40001). Such
+	// transactions must be retried, which is what TxRunner is for.
+	IsolationSerializable
+)
+
+// TxOptions configures a single transaction started with
+// Transactor.TransactionWith.
+type TxOptions struct {
+	Isolation Isolation
+}
+
+// ─── Conflict Detection ───────────────────────────────────────────────────────
+
+// PostgreSQL SQLSTATEs of the transient conflicts TxRunner retries.
+const (
+	sqlstateSerializationFailure = "40001"
+	sqlstateDeadlockDetected     = "40P01"
+	sqlstateUniqueViolation      = "23505"
+)
+
+// queuePositionIndex is the unique index two reservations appended to the same
+// queue at once collide on; the loser computed its position before the
+// winner's insert was visible.
+const queuePositionIndex = "uniq_book_queue_position"
+
+// conflictKind classifies err as a serialization failure, a deadlock or a
+// queue position collision by inspecting the PostgreSQL error it wraps. It
+// returns "" for any other error, including every SQLite and memory storage
+// error: those backends serialise writers, so none of these conflicts can
+// happen there.
+//
+// A collision is retried as a whole transaction because PostgreSQL aborts the
+// transaction on the failed insert; nothing more can run in it.
+func conflictKind(err error) string {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return ""
+	}
+	switch pgErr.Code {
+	case sqlstateSerializationFailure:
+		return "serialization_failure"
+	case sqlstateDeadlockDetected:
+		return "deadlock"
+	case sqlstateUniqueViolation:
+		if pgErr.ConstraintName == queuePositionIndex {
+			return "queue_collision"
+		}
+	}
+	return ""
+}
+
+// ─── Retrying Runner ──────────────────────────────────────────────────────────
+
+// RetryPolicy bounds how often and how quickly TxRunner retries a transaction.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a transaction is run before its
+	// conflict is returned to the caller; 1 disables retries.
+	MaxAttempts int
+
+	// BaseDelay is the backoff ceiling before the first retry; it doubles with
+	// each further attempt up to MaxDelay. The actual wait is drawn uniformly
+	// from [0, ceiling) so that transactions which collided once do not
+	// collide again in lockstep.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy returns the built-in retry policy.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   10 * time.Millisecond,
+		MaxDelay:    500 * time.Millisecond,
+	}
+}
+
+// backoff returns the jittered wait before the given retry (1 for the first).
+func (p RetryPolicy) backoff(retry int, rnd func(int64) int64) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < retry && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, p.MaxDelay)
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rnd(int64(ceiling)))
+}
+
+// TxStats counts the transactions a TxRunner ran under one name.
+type TxStats struct {
+	Name string `json:"name"`
+	// Runs is the number of Run calls; Attempts includes every retry.
+	Runs     int64 `json:"runs"`
+	Attempts int64 `json:"attempts"`
+	// Retries counts the conflicts that were followed by another attempt;
+	// the rest of SerializationFailures + Deadlocks + QueueCollisions are
+	// Exhausted runs.
+	Retries               int64 `json:"retries"`
+	SerializationFailures int64 `json:"serialization_failures"`
+	Deadlocks             int64 `json:"deadlocks"`
+	QueueCollisions       int64 `json:"queue_collisions"`
+	// Exhausted counts runs that still conflicted on their last attempt.
+	Exhausted int64 `json:"exhausted"`
+}
+
+// TxRunner runs transactions through a Transactor and runs them again when they
+// fail with a serialization failure, a deadlock or a reservation queue position
+// collision, recording how often that happens per transaction name.
+//
+// fn may be called several times, each time with a fresh transaction whose
+// earlier writes were rolled back, so it must reset any result it captures
+// rather than accumulate into it.
+type TxRunner struct {
+	txm    Transactor
+	policy RetryPolicy
+
+	mu    sync.Mutex
+	rnd   *rand.Rand
+	stats map[string]*TxStats
+}
+
+// NewTxRunner returns a TxRunner that retries according to policy.
+func NewTxRunner(txm Transactor, policy RetryPolicy) *TxRunner {
+	return &TxRunner{
+		txm:    txm,
+		policy: policy,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		stats:  make(map[string]*TxStats),
+	}
+}
+
+// Run calls fn in a transaction started with opts, retrying conflicts. name
+// identifies the transaction in Stats and the log. Any other error, or a
+// conflict on the final attempt, is returned unchanged.
+func (r *TxRunner) Run(name string, opts TxOptions, fn func(tx Tx) error) error {
+	r.record(name, func(s *TxStats) { s.Runs++ })
+	attempts := max(r.policy.MaxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		r.record(name, func(s *TxStats) { s.Attempts++ })
+		err := r.txm.TransactionWith(opts, fn)
+		kind := conflictKind(err)
+		if kind == "" {
+			return err
+		}
+		r.record(name, func(s *TxStats) {
+			switch kind {
+			case "deadlock":
+				s.Deadlocks++
+			case "queue_collision":
+				s.QueueCollisions++
+			default:
+				s.SerializationFailures++
+			}
+		})
+		if attempt == attempts {
+			r.record(name, func(s *TxStats) { s.Exhausted++ })
+			log.Printf("[WARN] TxRunner: %s failed with %s on attempt %d/%d, giving up", name, kind, attempt, attempts)
+			return err
+		}
+
+		var wait time.Duration
+		r.record(name, func(s *TxStats) {
+			s.Retries++
+			wait = r.policy.backoff(attempt, r.rnd.Int63n) // rnd is guarded by mu too
+		})
+		log.Printf("[INFO] TxRunner: %s failed with %s on attempt %d/%d, retrying in %s", name, kind, attempt, attempts, wait)
+		time.Sleep(wait)
+	}
+}
+
+func (r *TxRunner) record(name string, update func(s *TxStats)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.stats[name]
+	if !ok {
+		s = &TxStats{Name: name}
+		r.stats[name] = s
+	}
+	update(s)
+}
+
+// Stats returns a snapshot of the counters of every transaction name run so
+// far, sorted by name.
+func (r *TxRunner) Stats() []TxStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]TxStats, 0, len(r.stats))
+	for _, s := range r.stats {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// stubTransactor fails the first len(errs) transactions with errs, in order,
+// and commits every one after that. It never calls fn.
+type stubTransactor struct {
+	errs  []error
+	calls int
+}
+
+func (s *stubTransactor) Transaction(fn func(tx Tx) error) error {
+	return s.TransactionWith(TxOptions{}, fn)
+}
+
+func (s *stubTransactor) TransactionWith(_ TxOptions, _ func(tx Tx) error) error {
+	s.calls++
+	if s.calls <= len(s.errs) {
+		return s.errs[s.calls-1]
+	}
+	return nil
+}
+
+func (s *stubTransactor) ReadOnly() Tx { return nil }
+
+var (
+	serializationFailure = &pgconn.PgError{Code: "40001"}
+	deadlock             = &pgconn.PgError{Code: "40P01"}
+	queueCollision       = &pgconn.PgError{Code: "23505", ConstraintName: "uniq_book_queue_position"}
+	duplicateReservation = &pgconn.PgError{Code: "23505", ConstraintName: "uniq_user_book_reservation"}
+)
+
+// quickRetries retries up to three times without waiting.
+var quickRetries = RetryPolicy{MaxAttempts: 3}
+
+func TestTxRunnerRetriesConflicts(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		err  error
+		want TxStats
+	}{
+		{"serialization failure", serializationFailure, TxStats{SerializationFailures: 1}},
+		{"deadlock", deadlock, TxStats{Deadlocks: 1}},
+		{"queue collision", queueCollision, TxStats{QueueCollisions: 1}},
+		// translateError wraps the driver error; the runner must still see it.
+		{"wrapped", fmt.Errorf("%w: %w", ErrUniqueViolation, queueCollision), TxStats{QueueCollisions: 1}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			runner := NewTxRunner(&stubTransactor{errs: []error{c.err}}, quickRetries)
+			if err := runner.Run("checkout", TxOptions{}, func(Tx) error { return nil }); err != nil {
+				t.Fatalf("Run = %v, want the retry to commit", err)
+			}
+			want := c.want
+			want.Name, want.Runs, want.Attempts, want.Retries = "checkout", 1, 2, 1
+			if got := runner.Stats(); len(got) != 1 || got[0] != want {
+				t.Fatalf("Stats = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestTxRunnerGivesUp(t *testing.T) {
+	stub := &stubTransactor{errs: []error{serializationFailure, deadlock, serializationFailure, serializationFailure}}
+	runner := NewTxRunner(stub, quickRetries)
+	err := runner.Run("return", TxOptions{}, func(Tx) error { return nil })
+	if !errors.Is(err, serializationFailure) {
+		t.Fatalf("Run = %v, want the last conflict", err)
+	}
+	if stub.calls != 3 {
+		t.Fatalf("%d attempts, want MaxAttempts (3)", stub.calls)
+	}
+	want := TxStats{Name: "return", Runs: 1, Attempts: 3, Retries: 2, SerializationFailures: 2, Deadlocks: 1, Exhausted: 1}
+	if got := runner.Stats(); len(got) != 1 || got[0] != want {
+		t.Fatalf("Stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestTxRunnerReturnsOtherErrors(t *testing.T) {
+	for _, err := range []error{duplicateReservation, &pgconn.PgError{Code: "23503"}, ErrNotFound} {
+		stub := &stubTransactor{errs: []error{err}}
+		runner := NewTxRunner(stub, quickRetries)
+		if got := runner.Run("checkout", TxOptions{}, func(Tx) error { return nil }); got != err {
+			t.Fatalf("Run = %v, want %v unchanged", got, err)
+		}
+		want := TxStats{Name: "checkout", Runs: 1, Attempts: 1}
+		if got := runner.Stats(); stub.calls != 1 || len(got) != 1 || got[0] != want {
+			t.Fatalf("%v: %d attempts, Stats = %+v; want one attempt and %+v", err, stub.calls, got, want)
+		}
+	}
+}
+
+func TestBackoffCeiling(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	ceilings := []time.Duration{10, 20, 40, 50, 50, 50, 50, 50, 50}
+	for i, ceiling := range ceilings {
+		ceiling *= time.Millisecond
+		var asked int64
+		highest := func(n int64) int64 {
+			asked = n
+			return n - 1
+		}
+		got := p.backoff(i+1, highest)
+		if time.Duration(asked) != ceiling || got >= ceiling {
+			t.Fatalf("retry %d: drew from [0, %s) and waited %s, want [0, %s)", i+1, time.Duration(asked), got, ceiling)
+		}
+	}
+	if got := (RetryPolicy{}).backoff(1, func(int64) int64 { panic("drew without a ceiling") }); got != 0 {
+		t.Fatalf("zero policy waited %s, want 0", got)
+	}
+}
@@ -0,0 +1,182 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ─── Transaction Abstraction ──────────────────────────────────────────────────
+
+// Tx is a handle to an open storage transaction. The service obtains one from a
+// Transactor and passes it to every repository call that must take part in the
+// transaction. Passing a nil Tx runs the call on the repository's default
+// connection, outside any transaction.
+//
+// A Tx is only valid for the backend that created it: a GORM repository will
+// panic if handed a memory transaction and vice versa.
+type Tx interface {
+	isTx()
+}
+
+// Transactor runs a unit of work inside a storage transaction.
+type Transactor interface {
+	// Transaction calls fn with an open transaction. It commits if fn returns
+	// nil and rolls back (discarding every write made through tx) otherwise;
+	// fn's error is returned unchanged.
+	Transaction(fn func(tx Tx) error) error
+
+	// TransactionWith is Transaction with explicit options. Backends that
+	// already serialise their transactions (SQLite, memory) ignore the
+	// isolation level; they are serializable regardless.
+	TransactionWith(opts TxOptions, fn func(tx Tx) error) error
+
+	// ReadOnly returns a handle for reads made outside any transaction that
+	// a read replica may serve, or nil, meaning the primary, when there is
+	// none. Replicas lag behind the primary, so what was just committed may
+	// not be visible through it yet. Never pass it to a call that writes or
+	// locks rows.
+	ReadOnly() Tx
+}
+
+// ─── Errors ───────────────────────────────────────────────────────────────────
+
+var (
+	// ErrNotFound is returned by single-row lookups when no row matches. It is
+	// gorm.ErrRecordNotFound so existing errors.Is checks keep working.
+	ErrNotFound = gorm.ErrRecordNotFound
+
+	// ErrUniqueViolation wraps errors caused by a unique index rejecting a write
+	// (uniq_active_checkout, uniq_user_book_reservation, uniq_book_queue_position).
+	ErrUniqueViolation = errors.New("unique constraint violation")
+)
+
+// translateError wraps unique-violation errors from db's dialect in
+// ErrUniqueViolation, keeping the driver's error in the chain. The dialect's own error
+// translator does the matching (PostgreSQL SQLSTATE 23505; SQLite extended
+// codes SQLITE_CONSTRAINT_UNIQUE and SQLITE_CONSTRAINT_PRIMARYKEY).
+func translateError(db *gorm.DB, err error) error {
+	if err == nil {
+		return nil
+	}
+	if t, ok := db.Dialector.(gorm.ErrorTranslator); ok && errors.Is(t.Translate(err), gorm.ErrDuplicatedKey) {
+		return fmt.Errorf("%w: %w", ErrUniqueViolation, err)
+	}
+	return err
+}
+
+// forUpdate is a scope that adds SELECT … FOR UPDATE row locks. SQLite has no
+// row locks; it gets the same guarantee because every SQLite transaction takes
+// the database write lock when it begins (see bootstrap.OpenSQLite), so the
+// clause is left out there.
+func forUpdate(db *gorm.DB) *gorm.DB {
+	if db.Dialector.Name() == "sqlite" {
+		return db
+	}
+	return db.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+// skipLocked is forUpdate with SKIP LOCKED: rows another transaction has
+// locked are left out of the result instead of waited for. SQLite is left
+// alone for the same reason as in forUpdate; nothing is ever locked there.
+func skipLocked(db *gorm.DB) *gorm.DB {
+	if db.Dialector.Name() == "sqlite" {
+		return db
+	}
+	return db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+}
+
+// ─── GORM Transactions ────────────────────────────────────────────────────────
+
+// gormTx is an open transaction or, from ReadOnly, a replica connection.
+type gormTx struct {
+	db *gorm.DB
+}
+
+func (*gormTx) isTx() {}
+
+type gormTransactor struct {
+	db       *gorm.DB
+	replicas []*gorm.DB
+	next     atomic.Uint64
+}
+
+// NewGormTransactor returns a Transactor backed by db.Transaction whose
+// ReadOnly handles take turns among replicas.
+func NewGormTransactor(db *gorm.DB, replicas ...*gorm.DB) Transactor {
+	return &gormTransactor{db: db, replicas: replicas}
+}
+
+func (t *gormTransactor) Transaction(fn func(tx Tx) error) error {
+	return t.TransactionWith(TxOptions{}, fn)
+}
+
+func (t *gormTransactor) TransactionWith(opts TxOptions, fn func(tx Tx) error) error {
+	var sqlOpts []*sql.TxOptions
+	if opts.Isolation == IsolationSerializable && t.db.Dialector.Name() != "sqlite" {
+		sqlOpts = append(sqlOpts, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	}
+	return t.db.Transaction(func(db *gorm.DB) error {
+		return fn(&gormTx{db: db})
+	}, sqlOpts...)
+}
+
+func (t *gormTransactor) ReadOnly() Tx {
+	if len(t.replicas) == 0 {
+		return nil
+	}
+	n := t.next.Add(1) - 1
+	return &gormTx{db: t.replicas[n%uint64(len(t.replicas))]}
+}
+
+// conn returns the connection a GORM repository should use for tx: the
+// transaction's or replica's own handle, or fallback when tx is nil.
+func conn(tx Tx, fallback *gorm.DB) *gorm.DB {
+	if tx == nil {
+		return fallback
+	}
+	gtx, ok := tx.(*gormTx)
+	if !ok {
+		panic(fmt.Sprintf("repositories: GORM repository used with foreign transaction %T", tx))
+	}
+	return gtx.db
+}
+
+// ─── Repository Sets ──────────────────────────────────────────────────────────
+
+// Repositories bundles one implementation of every repository interface with
+// the Transactor whose transactions they understand.
+type Repositories struct {
+	Transactor   Transactor
+	Users        UserRepository
+	Books        BookRepository
+	BookCopies   BookCopyRepository
+	Checkouts    CheckoutRepository
+	Reservations ReservationRepository
+	Branches     BranchRepository
+	Terms        TermRepository
+	Courses      CourseRepository
+	Payments     PaymentRepository
+}
+
+// NewGormRepositories returns the PostgreSQL-backed repositories for db.
+// Reads the service routes through Transactor.ReadOnly go to replicas, if
+// any are given.
+func NewGormRepositories(db *gorm.DB, replicas ...*gorm.DB) *Repositories {
+	return &Repositories{
+		Transactor:   NewGormTransactor(db, replicas...),
+		Users:        NewUserRepository(db),
+		Books:        NewBookRepository(db),
+		BookCopies:   NewBookCopyRepository(db),
+		Checkouts:    NewCheckoutRepository(db),
+		Reservations: NewReservationRepository(db),
+		Branches:     NewBranchRepository(db),
+		Terms:        NewTermRepository(db),
+		Courses:      NewCourseRepository(db),
+		Payments:     NewPaymentRepository(db),
+	}
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"library/internal/models"
+	"library/internal/repositories"
+)
+
+// PatronAccount summarises a user's loans and fines. Fines is the total
+// charged on returned checkouts; fines still accruing on overdue loans are
+// charged when the book comes back, so they are counted in Overdue only.
+type PatronAccount struct {
+	User       models.User `json:"user"`
+	CheckedOut int         `json:"checked_out"`
+	Overdue    int         `json:"overdue"`
+	Fines      int         `json:"fines"`
+	Paid       int         `json:"paid"`
+	Balance    int         `json:"balance"`
+}
+
+// ─── Copy Circulation ─────────────────────────────────────────────────────────
+
+// FindCopy looks a copy up by the identifier printed on it: its barcode or,
+// for copies without one, its ID.
+func (s *libraryService) FindCopy(item string) (*models.BookCopy, error) {
+	item = strings.TrimSpace(item)
+	if item == "" {
+		return nil, ErrCopyNotFound
+	}
+	copies, err := s.bookCopyRepo.FindByBarcodes(nil, []string{item})
+	if err != nil {
+		return nil, err
+	}
+	if len(copies) > 0 {
+		return &copies[0], nil
+	}
+	copyID, err := uuid.Parse(item)
+	if err != nil {
+		return nil, ErrCopyNotFound
+	}
+	copy, err := s.bookCopyRepo.GetByID(nil, copyID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrCopyNotFound
+		}
+		return nil, err
+	}
+	return copy, nil
+}
+
+// CheckoutCopy lends the copy in the user's hands, as opposed to CheckoutBook,
+// which picks any available copy of a book. A copy left on the shelf while
+// users are queued for the book (auto-checkout disabled) may only go to the
+// head of the queue, whose reservation it fulfils. It runs as a "checkout"
+// transaction, with the same isolation and retries as CheckoutBook.
+func (s *libraryService) CheckoutCopy(copyID, userID uuid.UUID) (*models.Checkout, error) {
+	var result *models.Checkout
+
+	err := s.runCirculation("checkout", func(tx repositories.Tx) error {
+		// A retried attempt must not report the previous attempt's result.
+		result = nil
+
+		user, err := s.userRepo.GetByID(tx, userID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		copy, err := s.bookCopyRepo.GetByIDForUpdate(tx, copyID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
+				return ErrCopyNotFound
+			}
+			return err
+		}
+		if copy.Status != models.BookCopyStatusAvailable {
+			return ErrAlreadyCheckedOut
+		}
+		book, err := s.getBook(tx, copy.BookID)
+		if err != nil {
+			return err
+		}
+
+		res, err := s.reservationRepo.GetNextForBook(tx, copy.BookID)
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			return err
+		}
+		if err == nil && res != nil {
+			if res.UserID != userID {
+				log.Printf("[INFO] CheckoutCopy: copy %s is held for reservation %s (user %s)", copyID, res.ID, res.UserID)
+				return ErrCopyOnHold
+			}
+			if err := s.reservationRepo.Dequeue(tx, res.ID); err != nil {
+				return err
+			}
+			if err := s.bookRepo.AdjustAvailability(tx, copy.BookID, repositories.Availability{Holds: -1}); err != nil {
+				return err
+			}
+			log.Printf("[INFO] CheckoutCopy: reservation %s fulfilled by copy %s", res.ID, copyID)
+		}
+
+		checkout, err := s.lendCopy(tx, copy, book, user)
+		if err != nil {
+			log.Printf("[ERROR] CheckoutCopy: failed to lend copy %s: %v", copyID, err)
+			return err
+		}
+		result = checkout
+		log.Printf("[INFO] CheckoutCopy: %s checkout created (id=%s) for user %s / copy %s, due %s", checkout.LoanType, checkout.ID, userID, copyID, checkout.DueDate.Format(time.RFC3339))
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("[ERROR] CheckoutCopy: transaction failed for copy %s / user %s: %v", copyID, userID, err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetActiveCheckout returns the copy's checkout that has not been returned yet.
+func (s *libraryService) GetActiveCheckout(copyID uuid.UUID) (*models.Checkout, error) {
+	checkout, err := s.checkoutRepo.GetActiveByCopy(nil, copyID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrCheckoutNotFound
+		}
+		return nil, err
+	}
+	return checkout, nil
+}
+
+// ─── Patron Accounts ──────────────────────────────────────────────────────────
+
+// GetPatronAccount returns the user's loan counts and fine balance.
+func (s *libraryService) GetPatronAccount(userID uuid.UUID) (*PatronAccount, error) {
+	var account *PatronAccount
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		var err error
+		account, err = s.patronAccount(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *libraryService) patronAccount(tx repositories.Tx, userID uuid.UUID) (*PatronAccount, error) {
+	user, err := s.userRepo.GetByID(tx, userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	checkouts, err := s.checkoutRepo.ListByUser(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := s.paymentRepo.ListByUser(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	account := &PatronAccount{User: *user}
+	now := s.now()
+	for _, c := range checkouts {
+		if c.ReturnedAt != nil {
+			account.Fines += c.FineAmount
+			continue
+		}
+		account.CheckedOut++
+		if now.After(c.DueDate) {
+			account.Overdue++
+		}
+	}
+	for _, p := range payments {
+		account.Paid += p.Amount
+	}
+	account.Balance = account.Fines - account.Paid
+	return account, nil
+}
+
+// PayFines records a payment of amount towards the user's outstanding fines.
+// A payment may settle the balance but not exceed it. The user's row is
+// locked before the balance is read, so two payments made at once from
+// different kiosks cannot both pass the check.
+func (s *libraryService) PayFines(userID uuid.UUID, amount int, reference string) (*models.Payment, error) {
+	reference = strings.TrimSpace(reference)
+	if amount <= 0 || len(reference) > 64 {
+		return nil, ErrInvalidPayment
+	}
+	var payment *models.Payment
+
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		if _, err := s.userRepo.GetByIDForUpdate(tx, userID); err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		account, err := s.patronAccount(tx, userID)
+		if err != nil {
+			return err
+		}
+		if amount > account.Balance {
+			log.Printf("[WARN] PayFines: payment of %d from user %s exceeds balance %d", amount, userID, account.Balance)
+			return ErrOverpayment
+		}
+		payment = &models.Payment{UserID: userID, Amount: amount, Reference: reference, PaidAt: s.now()}
+		if err := s.paymentRepo.Create(tx, payment); err != nil {
+			return err
+		}
+		log.Printf("[INFO] PayFines: payment %s of %d recorded for user %s, balance now %d", payment.ID, amount, userID, account.Balance-amount)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"library/internal/catalog"
+	"library/internal/models"
+	"library/internal/repositories"
+)
+
+// ─── Book Records ─────────────────────────────────────────────────────────────
+
+// BookChanges is an edit of a book's catalogue record for UpdateBook. Nil
+// fields are left as they are; an empty ISBN removes the book's ISBN.
+type BookChanges struct {
+	Title     *string
+	Author    *string
+	ISBN      *string
+	Edition   *string
+	Publisher *string
+	Published *string
+	Subjects  *[]string
+}
+
+// BookDeletion is the outcome of DeleteBook.
+type BookDeletion struct {
+	BookID uuid.UUID `json:"book_id"`
+	// Purged is true if the book is gone for good, false if it was withdrawn
+	// and can be restored.
+	Purged bool `json:"purged"`
+	// Cancelled lists the reservations the deletion cancelled, so that the
+	// users who were waiting can be told.
+	Cancelled []models.Reservation `json:"cancelled_reservations"`
+}
+
+// UpdateBook applies changes to a book's catalogue record and returns the
+// book. A non-zero ifVersion must be the book's current version. The edit
+// counts as a change for OAI-PMH harvesters.
+func (s *libraryService) UpdateBook(bookID uuid.UUID, changes BookChanges, ifVersion int) (*models.Book, error) {
+	var book *models.Book
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		current, err := s.getBookForUpdate(tx, bookID)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(current.Version, ifVersion); err != nil {
+			return err
+		}
+		if err := applyBookChanges(current, changes); err != nil {
+			return err
+		}
+		if err := s.bookRepo.UpdateDetails(tx, current); err != nil {
+			if isUniqueViolation(err) {
+				return ErrISBNTaken
+			}
+			return err
+		}
+		book, err = s.bookRepo.GetByID(tx, bookID)
+		return err
+	})
+	if err != nil {
+		log.Printf("[ERROR] UpdateBook: failed to update book %s: %v", bookID, err)
+		return nil, err
+	}
+	log.Printf("[INFO] UpdateBook: book %s updated to version %d", bookID, book.Version)
+	return book, nil
+}
+
+// applyBookChanges copies changes into book and validates the result as
+// ImportBooks validates a record.
+func applyBookChanges(book *models.Book, changes BookChanges) error {
+	set := func(field *string, value *string) {
+		if value != nil {
+			*field = strings.TrimSpace(*value)
+		}
+	}
+	set(&book.Title, changes.Title)
+	set(&book.Author, changes.Author)
+	set(&book.Edition, changes.Edition)
+	set(&book.Publisher, changes.Publisher)
+	set(&book.Published, changes.Published)
+	if changes.Subjects != nil {
+		book.Subjects = nil
+		for _, subject := range *changes.Subjects {
+			if subject = strings.TrimSpace(subject); subject != "" {
+				book.Subjects = append(book.Subjects, subject)
+			}
+		}
+	}
+	if changes.ISBN != nil {
+		book.ISBN = nil
+		if raw := strings.TrimSpace(*changes.ISBN); raw != "" {
+			isbn, err := catalog.NormalizeISBN(raw)
+			if err != nil {
+				return ErrInvalidBook
+			}
+			book.ISBN = &isbn
+		}
+	}
+
+	switch {
+	case book.Title == "", utf8.RuneCountInString(book.Title) > 255,
+		book.Author == "", utf8.RuneCountInString(book.Author) > 255,
+		utf8.RuneCountInString(book.Edition) > 255,
+		utf8.RuneCountInString(book.Publisher) > 255,
+		utf8.RuneCountInString(book.Published) > 64:
+		return ErrInvalidBook
+	}
+	for _, subject := range book.Subjects {
+		if utf8.RuneCountInString(subject) > 255 {
+			return ErrInvalidBook
+		}
+	}
+	return nil
+}
+
+// DeleteBook withdraws a book or, with purge, deletes it for good. Either is
+// refused while a copy is checked out, and a purge also while any of the
+// book's past loans carries a fine. A non-zero ifVersion must be the book's
+// current version.
+//
+// Withdrawing keeps the book, its copies and its loan history; the book just
+// stops being found, and RestoreBook brings it back. Purging deletes the book
+// with its copies, their returned loans and its reading list entries, and may
+// be applied to a withdrawn book. Either way the reservation queue is
+// cancelled and returned, so that the waiting users can be told.
+func (s *libraryService) DeleteBook(bookID uuid.UUID, purge bool, ifVersion int) (*BookDeletion, error) {
+	result := &BookDeletion{BookID: bookID, Purged: purge}
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		result.Cancelled = []models.Reservation{}
+
+		book, err := s.bookRepo.GetAnyForUpdate(tx, bookID)
+		if errors.Is(err, repositories.ErrNotFound) || (err == nil && book.DeletedAt.Valid && !purge) {
+			return ErrBookNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(book.Version, ifVersion); err != nil {
+			return err
+		}
+
+		// The book row is locked, and every checkout adjusts the book's
+		// counts before it commits, so no loan can start behind this check.
+		checkouts, err := s.checkoutRepo.ListByBook(tx, bookID)
+		if err != nil {
+			return err
+		}
+		for _, c := range checkouts {
+			if c.ReturnedAt == nil {
+				return ErrBookOnLoan
+			}
+			if purge && c.FineAmount > 0 {
+				return ErrBookHasFines
+			}
+		}
+
+		queue, err := s.reservationRepo.ListByBook(tx, bookID)
+		if err != nil {
+			return err
+		}
+		for _, res := range queue {
+			if err := s.reservationRepo.Delete(tx, res.ID); err != nil {
+				return err
+			}
+			result.Cancelled = append(result.Cancelled, res)
+		}
+		if len(queue) > 0 && !book.DeletedAt.Valid {
+			if err := s.bookRepo.AdjustAvailability(tx, bookID, repositories.Availability{Holds: -len(queue)}); err != nil {
+				return err
+			}
+		}
+
+		if !purge {
+			return s.bookRepo.Withdraw(tx, bookID, s.now())
+		}
+		if err := s.checkoutRepo.DeleteByBook(tx, bookID); err != nil {
+			return err
+		}
+		return s.bookRepo.Delete(tx, bookID)
+	})
+	if err != nil {
+		log.Printf("[ERROR] DeleteBook: failed to delete book %s (purge=%t): %v", bookID, purge, err)
+		return nil, err
+	}
+	for _, res := range result.Cancelled {
+		log.Printf("[INFO] DeleteBook: reservation %s of user %s cancelled", res.ID, res.UserID)
+	}
+	log.Printf("[INFO] DeleteBook: book %s deleted (purge=%t), %d reservations cancelled", bookID, purge, len(result.Cancelled))
+	return result, nil
+}
+
+// RestoreBook returns a withdrawn book to the catalogue with its copies. Its
+// cancelled reservations stay cancelled. Restoring a book that is not
+// withdrawn returns it unchanged.
+func (s *libraryService) RestoreBook(bookID uuid.UUID) (*models.Book, error) {
+	var book *models.Book
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		current, err := s.bookRepo.GetAnyForUpdate(tx, bookID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
+				return ErrBookNotFound
+			}
+			return err
+		}
+		if current.DeletedAt.Valid {
+			if err := s.bookRepo.Restore(tx, bookID, s.now()); err != nil {
+				return err
+			}
+		}
+		book, err = s.bookRepo.GetByID(tx, bookID)
+		return err
+	})
+	if err != nil {
+		log.Printf("[ERROR] RestoreBook: failed to restore book %s: %v", bookID, err)
+		return nil, err
+	}
+	log.Printf("[INFO] RestoreBook: book %s restored", bookID)
+	return book, nil
+}
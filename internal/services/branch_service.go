@@ -0,0 +1,400 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"library/internal/calendar"
+	"library/internal/models"
+	"library/internal/repositories"
+)
+
+const (
+	// ICalExpandYears is how far ahead yearly recurring closures in an imported
+	// iCalendar file are expanded.
+	ICalExpandYears = 5
+
+	// maxCalendarDays is the longest range GetBranchCalendar will return.
+	maxCalendarDays = 366
+
+	// calendarLookaheadDays bounds how far past the loan period a due date may
+	// be rolled forward; closures are loaded that far ahead.
+	calendarLookaheadDays = 366
+)
+
+// BranchCalendar is a branch with its weekly opening hours and the closures
+// within a requested date range.
+type BranchCalendar struct {
+	Branch   models.Branch         `json:"branch"`
+	Hours    []models.OpeningHours `json:"opening_hours"`
+	Closures []models.Closure      `json:"closures"`
+}
+
+// ─── Branch Management ────────────────────────────────────────────────────────
+
+// CreateBranch registers a branch. An empty timezone means UTC.
+func (s *libraryService) CreateBranch(name, timezone string) (*models.Branch, error) {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return nil, ErrInvalidTimezone
+	}
+	branch := &models.Branch{Name: name, Timezone: timezone}
+	if err := s.branchRepo.Create(nil, branch); err != nil {
+		log.Printf("[ERROR] CreateBranch: failed to create branch %q: %v", name, err)
+		return nil, err
+	}
+	log.Printf("[INFO] CreateBranch: created branch %q (id=%s, tz=%s)", name, branch.ID, timezone)
+	return branch, nil
+}
+
+// ListBranches returns all branches ordered by name.
+func (s *libraryService) ListBranches() ([]models.Branch, error) {
+	return s.branchRepo.List(s.reads())
+}
+
+// GetBranchCalendar returns the branch, its weekly hours and its closures dated
+// from..to inclusive.
+func (s *libraryService) GetBranchCalendar(branchID uuid.UUID, from, to time.Time) (*BranchCalendar, error) {
+	if to.Before(from) || to.Sub(from) > maxCalendarDays*24*time.Hour {
+		return nil, ErrInvalidDateRange
+	}
+	branch, err := s.getBranch(nil, branchID)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := s.branchRepo.ListOpeningHours(nil, branchID)
+	if err != nil {
+		return nil, err
+	}
+	closures, err := s.branchRepo.ListClosures(nil, branchID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &BranchCalendar{
+		Branch:   *branch,
+		Hours:    emptyIfNil(hours),
+		Closures: emptyIfNil(closures),
+	}, nil
+}
+
+// SetOpeningHours replaces the weekly schedule of a branch. An empty schedule
+// means the branch is open every day except its closures.
+func (s *libraryService) SetOpeningHours(branchID uuid.UUID, hours []models.OpeningHours) ([]models.OpeningHours, error) {
+	seen := make(map[int]bool, len(hours))
+	for i := range hours {
+		h := &hours[i]
+		if h.Weekday < 0 || h.Weekday > 6 || seen[h.Weekday] {
+			return nil, ErrInvalidOpeningHours
+		}
+		seen[h.Weekday] = true
+		opens, err := calendar.ParseClock(h.Opens)
+		if err != nil {
+			return nil, ErrInvalidOpeningHours
+		}
+		closes, err := calendar.ParseClock(h.Closes)
+		if err != nil || closes <= opens {
+			return nil, ErrInvalidOpeningHours
+		}
+		h.BranchID = branchID
+	}
+
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		if _, err := s.getBranch(tx, branchID); err != nil {
+			return err
+		}
+		return s.branchRepo.ReplaceOpeningHours(tx, branchID, hours)
+	})
+	if err != nil {
+		log.Printf("[ERROR] SetOpeningHours: failed for branch %s: %v", branchID, err)
+		return nil, err
+	}
+	log.Printf("[INFO] SetOpeningHours: branch %s now open %d day(s) a week", branchID, len(hours))
+	return s.branchRepo.ListOpeningHours(nil, branchID)
+}
+
+// AddClosure closes a branch on one date.
+func (s *libraryService) AddClosure(branchID uuid.UUID, date time.Time, reason string) (*models.Closure, error) {
+	if date.IsZero() {
+		return nil, ErrInvalidClosure
+	}
+	closure := models.Closure{
+		BranchID: branchID,
+		Date:     utcDate(date),
+		Reason:   strings.TrimSpace(reason),
+	}
+
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		if _, err := s.getBranch(tx, branchID); err != nil {
+			return err
+		}
+		added, err := s.branchRepo.AddClosures(tx, []models.Closure{closure})
+		if err != nil {
+			return err
+		}
+		if added == 0 {
+			return ErrClosureExists
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] AddClosure: branch %s closed on %s", branchID, closure.Date.Format("2006-01-02"))
+	return &closure, nil
+}
+
+// DeleteClosure reopens a branch on a date it was closed.
+func (s *libraryService) DeleteClosure(branchID uuid.UUID, date time.Time) error {
+	if _, err := s.getBranch(nil, branchID); err != nil {
+		return err
+	}
+	if err := s.branchRepo.DeleteClosure(nil, branchID, utcDate(date)); err != nil {
+		return err
+	}
+	log.Printf("[INFO] DeleteClosure: branch %s reopened on %s", branchID, date.Format("2006-01-02"))
+	return nil
+}
+
+// ImportClosures reads the events of an iCalendar file as closures of the
+// branch, interpreted in the branch time zone. Yearly recurring events are
+// expanded ICalExpandYears ahead. Dates the branch is already closed on are
+// skipped; the number of closures added is returned.
+func (s *libraryService) ImportClosures(branchID uuid.UUID, ical io.Reader) (int, error) {
+	branch, err := s.getBranch(nil, branchID)
+	if err != nil {
+		return 0, err
+	}
+	loc, err := time.LoadLocation(branch.Timezone)
+	if err != nil {
+		return 0, err
+	}
+
+	events, err := calendar.ParseICal(ical, loc, s.now().AddDate(ICalExpandYears, 0, 0))
+	if err != nil {
+		log.Printf("[WARN] ImportClosures: rejected file for branch %s: %v", branchID, err)
+		return 0, err
+	}
+
+	seen := make(map[time.Time]bool, len(events))
+	closures := make([]models.Closure, 0, len(events))
+	for _, ev := range events {
+		if seen[ev.Date] {
+			continue
+		}
+		seen[ev.Date] = true
+		closures = append(closures, models.Closure{
+			BranchID: branchID,
+			Date:     ev.Date,
+			Reason:   truncate(ev.Summary, 255),
+		})
+	}
+
+	var added int
+	err = s.txm.Transaction(func(tx repositories.Tx) error {
+		added, err = s.branchRepo.AddClosures(tx, closures)
+		return err
+	})
+	if err != nil {
+		log.Printf("[ERROR] ImportClosures: failed to store closures for branch %s: %v", branchID, err)
+		return 0, err
+	}
+	log.Printf("[INFO] ImportClosures: branch %s: %d event day(s), %d new closure(s)", branchID, len(closures), added)
+	return added, nil
+}
+
+// AssignCopyBranch moves a copy to a branch, or detaches it from any branch
+// when branchID is nil. Loans already running keep their due date; fines for
+// them follow the new branch's calendar. A non-zero ifVersion must be the
+// copy's current version.
+func (s *libraryService) AssignCopyBranch(copyID uuid.UUID, branchID *uuid.UUID, ifVersion int) (*models.BookCopy, error) {
+	var copy *models.BookCopy
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		current, err := s.bookCopyRepo.GetByIDForUpdate(tx, copyID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
+				return ErrCopyNotFound
+			}
+			return err
+		}
+		if err := checkVersion(current.Version, ifVersion); err != nil {
+			return err
+		}
+		if branchID != nil {
+			if _, err := s.getBranch(tx, *branchID); err != nil {
+				return err
+			}
+		}
+		if err := s.bookCopyRepo.SetBranch(tx, copyID, branchID); err != nil {
+			return err
+		}
+		copy, err = s.bookCopyRepo.GetByID(tx, copyID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] AssignCopyBranch: copy %s assigned to branch %s", copyID, branchLabel(branchID))
+	return copy, nil
+}
+
+// ─── Calendar Helpers ─────────────────────────────────────────────────────────
+
+func (s *libraryService) getBranch(tx repositories.Tx, branchID uuid.UUID) (*models.Branch, error) {
+	branch, err := s.branchRepo.GetByID(tx, branchID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrBranchNotFound
+		}
+		return nil, err
+	}
+	return branch, nil
+}
+
+// calendars builds branch calendars on demand and caches them for the duration
+// of one service call. Closures are loaded for a window wide enough to cover
+// every fine between from and to and every due date computed at to.
+type calendars struct {
+	s        *libraryService
+	tx       repositories.Tx
+	from, to time.Time
+	byBranch map[uuid.UUID]*calendar.Calendar
+}
+
+func (s *libraryService) newCalendars(tx repositories.Tx, from, to time.Time) *calendars {
+	return &calendars{
+		s:        s,
+		tx:       tx,
+		from:     utcDate(from).AddDate(0, 0, -1),
+		to:       utcDate(to).AddDate(0, 0, s.policy.LoanPeriodDays+calendarLookaheadDays+1),
+		byBranch: map[uuid.UUID]*calendar.Calendar{},
+	}
+}
+
+// forCopy returns the calendar of the copy's branch, or nil for a copy that
+// belongs to no branch.
+func (c *calendars) forCopy(copy *models.BookCopy) (*calendar.Calendar, error) {
+	if copy.BranchID == nil {
+		return nil, nil
+	}
+	id := *copy.BranchID
+	if cal, ok := c.byBranch[id]; ok {
+		return cal, nil
+	}
+
+	branch, err := c.s.branchRepo.GetByID(c.tx, id)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := c.s.branchRepo.ListOpeningHours(c.tx, id)
+	if err != nil {
+		return nil, err
+	}
+	closures, err := c.s.branchRepo.ListClosures(c.tx, id, c.from, c.to)
+	if err != nil {
+		return nil, err
+	}
+	cal, err := calendar.New(*branch, hours, closures)
+	if err != nil {
+		return nil, err
+	}
+	c.byBranch[id] = cal
+	return cal, nil
+}
+
+// dueDate returns the due date of a loan of book starting now. Without a
+// calendar a STANDARD loan is simply LoanPeriodDays later, a SHORT loan
+// LoanHours later and an OVERNIGHT loan one day later.
+func (s *libraryService) dueDate(cal *calendar.Calendar, book *models.Book, now time.Time) time.Time {
+	switch loanType(book, now) {
+	case models.LoanTypeShort:
+		d := time.Duration(book.LoanHours) * time.Hour
+		if cal == nil {
+			return now.Add(d)
+		}
+		return cal.ShortLoanDue(now, d).UTC()
+	case models.LoanTypeOvernight:
+		if cal == nil {
+			return now.AddDate(0, 0, 1)
+		}
+		return cal.NextOpening(now).UTC()
+	}
+	if cal == nil {
+		return now.AddDate(0, 0, s.policy.LoanPeriodDays)
+	}
+	return cal.DueDate(now, s.policy.LoanPeriodDays).UTC()
+}
+
+// fine returns how late a loan due at due and returned (or evaluated) at at
+// is, and the fine for it. Hourly loans are charged per started hour, other
+// loans per day; late is in the same unit. Without a calendar every hour or
+// calendar day counts, otherwise only those the branch is open.
+func (s *libraryService) fine(cal *calendar.Calendar, lt models.LoanType, due, at time.Time) (late, fine int) {
+	if hourly(lt) {
+		if cal == nil {
+			late = calendar.CeilHours(at.Sub(due))
+		} else {
+			late = cal.OpenHoursLate(due, at)
+		}
+		return late, late * s.policy.FinePerHour
+	}
+	if cal == nil {
+		return daysOverdue(due, at), calculateFine(due, at, s.policy.FinePerDay)
+	}
+	late = cal.OpenDaysLate(due, at)
+	return late, late * s.policy.FinePerDay
+}
+
+// loanType returns the loan type book lends under at now, treating an unset
+// one, or one whose LoanTypeUntil day (in UTC) has passed, as STANDARD.
+func loanType(book *models.Book, now time.Time) models.LoanType {
+	if book.LoanType == "" {
+		return models.LoanTypeStandard
+	}
+	if book.LoanTypeUntil != nil && utcDate(now).After(*book.LoanTypeUntil) {
+		return models.LoanTypeStandard
+	}
+	return book.LoanType
+}
+
+// hourly reports whether loans of type lt are fined per hour.
+func hourly(lt models.LoanType) bool {
+	return lt == models.LoanTypeShort || lt == models.LoanTypeOvernight
+}
+
+// utcDate returns midnight UTC of t's date, the form closure dates are stored in.
+func utcDate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func emptyIfNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func branchLabel(id *uuid.UUID) string {
+	if id == nil {
+		return "none"
+	}
+	return id.String()
+}
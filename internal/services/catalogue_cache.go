@@ -0,0 +1,219 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"library/internal/cache"
+	"library/internal/catalog"
+	"library/internal/models"
+)
+
+// ─── Catalogue Cache ──────────────────────────────────────────────────────────
+
+// generationKey holds the catalogue's current generation, a random token
+// that prefixes every other key. Invalidating deletes it, so every entry
+// stored under the old token becomes unreachable at once and ages out of the
+// cache on its own, without anything having to find it.
+const generationKey = "catalogue:generation"
+
+// cachingService is a LibraryService whose catalogue reads, ListBooks,
+// GetBook and SearchBooks, are answered from a cache. Every method that can
+// change what they return invalidates the whole catalogue once it is done.
+//
+// Misses are loaded from the primary through primary, never from a replica:
+// the first read after an invalidation would otherwise be free to cache a
+// lagging replica's counts for the whole TTL. The cache already takes the
+// catalogue reads off the database, so little is lost.
+type cachingService struct {
+	LibraryService
+	primary LibraryService
+	cache   cache.Cache
+	ttl     time.Duration
+}
+
+// NewCachingService returns svc with its catalogue reads cached in c for at
+// most ttl. Writes made through the returned service invalidate the cache;
+// writes that bypass it, such as another server's when c is in-process, show
+// up once the entries they made stale expire.
+func NewCachingService(svc LibraryService, c cache.Cache, ttl time.Duration) LibraryService {
+	return &cachingService{LibraryService: svc, primary: svc.WithConsistentReads(), cache: c, ttl: ttl}
+}
+
+func (s *cachingService) ListBooks() ([]models.Book, error) {
+	var books []models.Book
+	err := s.cached("books", &books, func() (any, error) {
+		return s.primary.ListBooks()
+	})
+	return books, err
+}
+
+func (s *cachingService) GetBook(bookID uuid.UUID) (*models.Book, error) {
+	var book *models.Book
+	err := s.cached("book:"+bookID.String(), &book, func() (any, error) {
+		return s.primary.GetBook(bookID)
+	})
+	return book, err
+}
+
+// searchPage is a cached SearchBooks result.
+type searchPage struct {
+	Books []models.Book `json:"books"`
+	Total int64         `json:"total"`
+}
+
+func (s *cachingService) SearchBooks(q *BookQuery, offset, limit int) ([]models.Book, int64, error) {
+	query, err := json.Marshal(q)
+	if err != nil {
+		return nil, 0, err
+	}
+	sum := sha256.Sum256(query)
+	key := fmt.Sprintf("search:%s:%d:%d", hex.EncodeToString(sum[:]), offset, limit)
+
+	var page searchPage
+	err = s.cached(key, &page, func() (any, error) {
+		books, total, err := s.primary.SearchBooks(q, offset, limit)
+		return searchPage{Books: books, Total: total}, err
+	})
+	return page.Books, page.Total, err
+}
+
+// WithConsistentReads bypasses the cache as well as the replicas: an entry
+// may predate a write committed by another server.
+func (s *cachingService) WithConsistentReads() LibraryService {
+	return s.LibraryService.WithConsistentReads()
+}
+
+// cached decodes the entry stored under key into out or, on a miss, calls
+// load and stores its result. Errors are returned, not cached. An entry that
+// cannot be decoded is treated as a miss.
+func (s *cachingService) cached(key string, out any, load func() (any, error)) error {
+	key = "catalogue:" + s.generation() + ":" + key
+	if data, ok := s.cache.Get(key); ok {
+		if err := json.Unmarshal(data, out); err == nil {
+			return nil
+		}
+		log.Printf("[WARN] cachingService: discarding undecodable entry %s", key)
+	}
+
+	v, err := load()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.cache.Set(key, data, s.ttl)
+	return json.Unmarshal(data, out)
+}
+
+// generation returns the current generation token, starting a new one if
+// there is none. Two readers starting one at once each store their own;
+// the loser's entries are only unreachable, never wrong.
+func (s *cachingService) generation() string {
+	if gen, ok := s.cache.Get(generationKey); ok {
+		return string(gen)
+	}
+	gen := uuid.NewString()
+	s.cache.Set(generationKey, []byte(gen), 0)
+	return gen
+}
+
+// invalidate starts a new generation. It runs after the write has committed
+// and misses load from the primary, so a reader that sees the new generation
+// also sees the write; a reader still loading under the old one stores an
+// entry nobody will look up.
+func (s *cachingService) invalidate() {
+	s.cache.Delete(generationKey)
+}
+
+// ─── Invalidating Writes ──────────────────────────────────────────────────────
+
+// Each of these can change a book's record, its counts or the set of books.
+// They invalidate even when they fail, since some, such as ImportBooks, may
+// have committed part of their work first.
+
+func (s *cachingService) CreateBook(title, author string, totalCopies int) (*models.Book, error) {
+	defer s.invalidate()
+	return s.LibraryService.CreateBook(title, author, totalCopies)
+}
+
+func (s *cachingService) AddBookCopy(bookID uuid.UUID) (*models.BookCopy, error) {
+	defer s.invalidate()
+	return s.LibraryService.AddBookCopy(bookID)
+}
+
+func (s *cachingService) AddBookCopies(bookID uuid.UUID, count int) ([]models.BookCopy, error) {
+	defer s.invalidate()
+	return s.LibraryService.AddBookCopies(bookID, count)
+}
+
+func (s *cachingService) SetBookLoanType(bookID uuid.UUID, loanType models.LoanType, loanHours, ifVersion int) (*models.Book, error) {
+	defer s.invalidate()
+	return s.LibraryService.SetBookLoanType(bookID, loanType, loanHours, ifVersion)
+}
+
+func (s *cachingService) UpdateBook(bookID uuid.UUID, changes BookChanges, ifVersion int) (*models.Book, error) {
+	defer s.invalidate()
+	return s.LibraryService.UpdateBook(bookID, changes, ifVersion)
+}
+
+func (s *cachingService) DeleteBook(bookID uuid.UUID, purge bool, ifVersion int) (*BookDeletion, error) {
+	defer s.invalidate()
+	return s.LibraryService.DeleteBook(bookID, purge, ifVersion)
+}
+
+func (s *cachingService) RestoreBook(bookID uuid.UUID) (*models.Book, error) {
+	defer s.invalidate()
+	return s.LibraryService.RestoreBook(bookID)
+}
+
+func (s *cachingService) ImportBooks(format catalog.Format, r io.Reader) (*ImportReport, error) {
+	defer s.invalidate()
+	return s.LibraryService.ImportBooks(format, r)
+}
+
+func (s *cachingService) CheckoutBook(bookID, userID uuid.UUID) (*models.Checkout, *QueuedReservation, error) {
+	defer s.invalidate()
+	return s.LibraryService.CheckoutBook(bookID, userID)
+}
+
+func (s *cachingService) CheckoutCopy(copyID, userID uuid.UUID) (*models.Checkout, error) {
+	defer s.invalidate()
+	return s.LibraryService.CheckoutCopy(copyID, userID)
+}
+
+func (s *cachingService) ReturnCheckout(checkoutID uuid.UUID) (*models.Checkout, error) {
+	defer s.invalidate()
+	return s.LibraryService.ReturnCheckout(checkoutID)
+}
+
+func (s *cachingService) CancelReservation(reservationID uuid.UUID) error {
+	defer s.invalidate()
+	return s.LibraryService.CancelReservation(reservationID)
+}
+
+func (s *cachingService) ReserveReadingList(listID uuid.UUID, loanType models.LoanType, loanHours int) (*CourseReserveResult, error) {
+	defer s.invalidate()
+	return s.LibraryService.ReserveReadingList(listID, loanType, loanHours)
+}
+
+func (s *cachingService) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	if repair {
+		defer s.invalidate()
+	}
+	return s.LibraryService.CheckIntegrity(repair)
+}
+
+func (s *cachingService) ReconcileAvailability() (int, error) {
+	defer s.invalidate()
+	return s.LibraryService.ReconcileAvailability()
+}
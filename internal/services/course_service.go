@@ -0,0 +1,411 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"library/internal/models"
+	"library/internal/repositories"
+)
+
+// ReadingListDetail is a reading list with its course and its entries in
+// order.
+type ReadingListDetail struct {
+	models.ReadingList
+	Course  models.Course             `json:"course"`
+	Entries []models.ReadingListEntry `json:"entries"`
+}
+
+// ReadingListAvailability reports, for every entry of a reading list, how many
+// copies of the book the library holds and how many are on the shelf now.
+type ReadingListAvailability struct {
+	ReadingList models.ReadingList  `json:"reading_list"`
+	Entries     []EntryAvailability `json:"entries"`
+}
+
+// EntryAvailability is the copy status of one reading list entry. LoanType is
+// the type the book currently lends under.
+type EntryAvailability struct {
+	BookID       uuid.UUID       `json:"book_id"`
+	Title        string          `json:"title"`
+	Author       string          `json:"author"`
+	Position     int             `json:"position"`
+	Required     bool            `json:"required"`
+	Note         string          `json:"note"`
+	LoanType     models.LoanType `json:"loan_type"`
+	LoanHours    int             `json:"loan_hours,omitempty"`
+	TotalCopies  int             `json:"total_copies"`
+	Available    int             `json:"available"`
+	CheckedOut   int             `json:"checked_out"`
+	Reservations int             `json:"reservations"`
+}
+
+// CourseReserveResult lists the books ReserveReadingList moved into course
+// reserves, and those it left alone because they already have a permanent
+// SHORT or OVERNIGHT loan type.
+type CourseReserveResult struct {
+	Term     models.Term   `json:"term"`
+	Until    time.Time     `json:"until"`
+	Reserved []models.Book `json:"reserved"`
+	Skipped  []models.Book `json:"skipped"`
+}
+
+// ─── Course Management ────────────────────────────────────────────────────────
+
+// CreateCourse adds a course, optionally taught in termID.
+func (s *libraryService) CreateCourse(code, title string, termID *uuid.UUID) (*models.Course, error) {
+	code = strings.TrimSpace(code)
+	title = strings.TrimSpace(title)
+	if code == "" || len(code) > 32 || title == "" || len(title) > 255 {
+		return nil, ErrInvalidCourse
+	}
+	course := &models.Course{Code: code, Title: title, TermID: termID}
+
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		if termID != nil {
+			if _, err := s.getTerm(tx, *termID); err != nil {
+				return err
+			}
+		}
+		if err := s.courseRepo.Create(tx, course); err != nil {
+			if isUniqueViolation(err) {
+				return ErrCourseExists
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] CreateCourse: created course %s %q (id=%s)", course.Code, course.Title, course.ID)
+	return course, nil
+}
+
+// ListCourses returns all courses ordered by code.
+func (s *libraryService) ListCourses() ([]models.Course, error) {
+	return s.courseRepo.List(s.reads())
+}
+
+// DeleteCourse removes a course with its reading lists. Books already moved
+// into course reserves keep their loan type until the reserve period ends.
+func (s *libraryService) DeleteCourse(courseID uuid.UUID) error {
+	if err := s.courseRepo.Delete(nil, courseID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrCourseNotFound
+		}
+		return err
+	}
+	log.Printf("[INFO] DeleteCourse: deleted course %s", courseID)
+	return nil
+}
+
+// ─── Reading Lists ────────────────────────────────────────────────────────────
+
+// CreateReadingList adds an empty reading list to a course.
+func (s *libraryService) CreateReadingList(courseID uuid.UUID, title string) (*models.ReadingList, error) {
+	title = strings.TrimSpace(title)
+	if title == "" || len(title) > 255 {
+		return nil, ErrInvalidReadingList
+	}
+	list := &models.ReadingList{CourseID: courseID, Title: title}
+
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		if _, err := s.getCourse(tx, courseID); err != nil {
+			return err
+		}
+		return s.courseRepo.CreateReadingList(tx, list)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] CreateReadingList: created reading list %q for course %s (id=%s)", list.Title, courseID, list.ID)
+	return list, nil
+}
+
+// ListReadingLists returns a course's reading lists ordered by title.
+func (s *libraryService) ListReadingLists(courseID uuid.UUID) ([]models.ReadingList, error) {
+	if _, err := s.getCourse(nil, courseID); err != nil {
+		return nil, err
+	}
+	lists, err := s.courseRepo.ListReadingLists(nil, courseID)
+	if err != nil {
+		return nil, err
+	}
+	return emptyIfNil(lists), nil
+}
+
+// GetReadingList returns a reading list with its course and entries.
+func (s *libraryService) GetReadingList(listID uuid.UUID) (*ReadingListDetail, error) {
+	return s.readingListDetail(nil, listID)
+}
+
+// SetReadingListEntries replaces the entries of a reading list. Entries are
+// kept in the order given and numbered from 1; any Position passed in is
+// ignored. Every book must exist and appear only once.
+func (s *libraryService) SetReadingListEntries(listID uuid.UUID, entries []models.ReadingListEntry) (*ReadingListDetail, error) {
+	seen := make(map[uuid.UUID]bool, len(entries))
+	rows := make([]models.ReadingListEntry, 0, len(entries))
+	for i, e := range entries {
+		if seen[e.BookID] {
+			return nil, ErrInvalidReadingList
+		}
+		seen[e.BookID] = true
+		rows = append(rows, models.ReadingListEntry{
+			ReadingListID: listID,
+			BookID:        e.BookID,
+			Position:      i + 1,
+			Required:      e.Required,
+			Note:          strings.TrimSpace(e.Note),
+		})
+	}
+
+	var detail *ReadingListDetail
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		if _, err := s.getReadingList(tx, listID); err != nil {
+			return err
+		}
+		for _, e := range rows {
+			if _, err := s.getBook(tx, e.BookID); err != nil {
+				return err
+			}
+		}
+		if err := s.courseRepo.ReplaceEntries(tx, listID, rows); err != nil {
+			return err
+		}
+		var err error
+		detail, err = s.readingListDetail(tx, listID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] SetReadingListEntries: reading list %s now has %d entries", listID, len(rows))
+	return detail, nil
+}
+
+// DeleteReadingList removes a reading list and its entries.
+func (s *libraryService) DeleteReadingList(listID uuid.UUID) error {
+	if err := s.courseRepo.DeleteReadingList(nil, listID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrReadingListNotFound
+		}
+		return err
+	}
+	log.Printf("[INFO] DeleteReadingList: deleted reading list %s", listID)
+	return nil
+}
+
+// ReadingListAvailability counts the copies of every listed book by status,
+// together with the length of its reservation queue.
+func (s *libraryService) ReadingListAvailability(listID uuid.UUID) (*ReadingListAvailability, error) {
+	rd := s.reads()
+	list, err := s.getReadingList(rd, listID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.courseRepo.ListEntries(rd, listID)
+	if err != nil {
+		return nil, err
+	}
+	bookIDs := make([]uuid.UUID, 0, len(entries))
+	for _, e := range entries {
+		bookIDs = append(bookIDs, e.BookID)
+	}
+	copies, err := s.bookCopyRepo.ListByBooks(rd, bookIDs)
+	if err != nil {
+		return nil, err
+	}
+	byBook := make(map[uuid.UUID][]models.BookCopy, len(entries))
+	for _, c := range copies {
+		byBook[c.BookID] = append(byBook[c.BookID], c)
+	}
+	queues, err := s.reservationRepo.CountByBooks(rd, bookIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	result := &ReadingListAvailability{ReadingList: *list, Entries: make([]EntryAvailability, 0, len(entries))}
+	for _, e := range entries {
+		a := EntryAvailability{
+			BookID:       e.BookID,
+			Title:        e.Book.Title,
+			Author:       e.Book.Author,
+			Position:     e.Position,
+			Required:     e.Required,
+			Note:         e.Note,
+			LoanType:     loanType(&e.Book, now),
+			TotalCopies:  len(byBook[e.BookID]),
+			Reservations: queues[e.BookID],
+		}
+		if a.LoanType == models.LoanTypeShort {
+			a.LoanHours = e.Book.LoanHours
+		}
+		for _, c := range byBook[e.BookID] {
+			switch c.Status {
+			case models.BookCopyStatusAvailable:
+				a.Available++
+			case models.BookCopyStatusCheckedOut:
+				a.CheckedOut++
+			}
+		}
+		result.Entries = append(result.Entries, a)
+	}
+	return result, nil
+}
+
+// ReserveReadingList moves every book on a reading list into course reserves:
+// it lends as loanType (SHORT for loanHours, or OVERNIGHT) until the last day
+// of the course's term, or of the current term for a course without one, and
+// as STANDARD afterwards. Books that already have a permanent SHORT or
+// OVERNIGHT loan type are skipped; a book already on reserve keeps the later
+// of its two end dates. Running loans keep their due date.
+func (s *libraryService) ReserveReadingList(listID uuid.UUID, loanType models.LoanType, loanHours int) (*CourseReserveResult, error) {
+	switch loanType {
+	case models.LoanTypeShort:
+		if loanHours < 1 || loanHours > MaxShortLoanHours {
+			return nil, ErrInvalidLoanType
+		}
+	case models.LoanTypeOvernight:
+		if loanHours != 0 {
+			return nil, ErrInvalidLoanType
+		}
+	default:
+		return nil, ErrInvalidLoanType
+	}
+
+	result := &CourseReserveResult{Reserved: []models.Book{}, Skipped: []models.Book{}}
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		list, err := s.getReadingList(tx, listID)
+		if err != nil {
+			return err
+		}
+		term, err := s.courseTerm(tx, list.CourseID)
+		if err != nil {
+			return err
+		}
+		today := utcDate(s.now())
+		if term.EndDate.Before(today) {
+			return ErrTermEnded
+		}
+		result.Term = *term
+		result.Until = term.EndDate
+
+		entries, err := s.courseRepo.ListEntries(tx, listID)
+		if err != nil {
+			return err
+		}
+		// Lock every book before deciding, in ID order so that two lists
+		// sharing books cannot deadlock, and decide from the locked rows: the
+		// preloaded ones may predate a concurrent loan type change.
+		ids := make([]uuid.UUID, 0, len(entries))
+		for _, e := range entries {
+			ids = append(ids, e.BookID)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+		locked := make(map[uuid.UUID]*models.Book, len(ids))
+		for _, id := range ids {
+			book, err := s.getBookForUpdate(tx, id)
+			if errors.Is(err, ErrBookNotFound) {
+				// Withdrawn since the entries were read.
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			locked[id] = book
+		}
+		for _, e := range entries {
+			book, ok := locked[e.BookID]
+			if !ok {
+				continue
+			}
+			if book.LoanTypeUntil == nil && book.LoanType != "" && book.LoanType != models.LoanTypeStandard {
+				result.Skipped = append(result.Skipped, *book)
+				continue
+			}
+			until := term.EndDate
+			if book.LoanTypeUntil != nil && book.LoanTypeUntil.After(until) {
+				until = *book.LoanTypeUntil
+			}
+			if err := s.bookRepo.SetLoanType(tx, book.ID, loanType, loanHours, &until); err != nil {
+				return err
+			}
+			updated, err := s.bookRepo.GetByID(tx, book.ID)
+			if err != nil {
+				return err
+			}
+			result.Reserved = append(result.Reserved, *updated)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] ReserveReadingList: %d books of reading list %s on %s reserve until %s (%d skipped)",
+		len(result.Reserved), listID, loanType, result.Until.Format("2006-01-02"), len(result.Skipped))
+	return result, nil
+}
+
+// ─── Course Helpers ───────────────────────────────────────────────────────────
+
+func (s *libraryService) getCourse(tx repositories.Tx, courseID uuid.UUID) (*models.Course, error) {
+	course, err := s.courseRepo.GetByID(tx, courseID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrCourseNotFound
+		}
+		return nil, err
+	}
+	return course, nil
+}
+
+func (s *libraryService) getReadingList(tx repositories.Tx, listID uuid.UUID) (*models.ReadingList, error) {
+	list, err := s.courseRepo.GetReadingList(tx, listID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrReadingListNotFound
+		}
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *libraryService) readingListDetail(tx repositories.Tx, listID uuid.UUID) (*ReadingListDetail, error) {
+	list, err := s.getReadingList(tx, listID)
+	if err != nil {
+		return nil, err
+	}
+	course, err := s.getCourse(tx, list.CourseID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.courseRepo.ListEntries(tx, listID)
+	if err != nil {
+		return nil, err
+	}
+	return &ReadingListDetail{ReadingList: *list, Course: *course, Entries: emptyIfNil(entries)}, nil
+}
+
+// courseTerm returns the term a course is taught in, falling back to the term
+// in progress for courses not tied to one.
+func (s *libraryService) courseTerm(tx repositories.Tx, courseID uuid.UUID) (*models.Term, error) {
+	course, err := s.getCourse(tx, courseID)
+	if err != nil {
+		return nil, err
+	}
+	if course.TermID != nil {
+		return s.getTerm(tx, *course.TermID)
+	}
+	term, err := s.termRepo.FindByDate(tx, utcDate(s.now()))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, ErrNoCurrentTerm
+	}
+	return term, err
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"library/internal/catalog"
+	"library/internal/marc"
+	"library/internal/models"
+	"library/internal/repositories"
+)
+
+// ─── Catalogue Export ─────────────────────────────────────────────────────────
+
+// ExportBookMARC writes one book with its copies as a MARC record in the
+// given format (marc or marcxml). Nothing is written if the book is unknown
+// or, in ISO 2709, too large to encode.
+func (s *libraryService) ExportBookMARC(bookID uuid.UUID, format catalog.Format, w io.Writer) error {
+	if format != catalog.FormatMARC && format != catalog.FormatMARCXML {
+		return fmt.Errorf("%w %q (want marc or marcxml)", ErrUnknownExportFormat, format)
+	}
+	rd := s.reads()
+	book, err := s.getBook(rd, bookID)
+	if err != nil {
+		return err
+	}
+	copies, err := s.bookCopyRepo.ListByBooks(rd, []uuid.UUID{bookID})
+	if err != nil {
+		return err
+	}
+	branches, err := s.branchNames(rd)
+	if err != nil {
+		return err
+	}
+	if format == catalog.FormatMARC {
+		if _, err := marc.Marshal(catalog.MARCRecord(*book, copies, branches)); err != nil {
+			return err
+		}
+	}
+
+	cw, err := catalog.NewWriter(w, format, branches)
+	if err != nil {
+		return err
+	}
+	if err := cw.Write(*book, copies); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// ExportCatalogue writes every book with its copies in the given format,
+// streaming them from the repository one book at a time so the catalogue is
+// never held in memory. In ISO 2709, a book too large for one record is left
+// out and logged.
+func (s *libraryService) ExportCatalogue(format catalog.Format, w io.Writer) error {
+	rd := s.reads()
+	branches, err := s.branchNames(rd)
+	if err != nil {
+		return err
+	}
+	cw, err := catalog.NewWriter(w, format, branches)
+	if errors.Is(err, catalog.ErrUnknownFormat) {
+		return fmt.Errorf("%w %q (want csv, jsonl, dc, marc or marcxml)", ErrUnknownExportFormat, format)
+	}
+	if err != nil {
+		return err
+	}
+
+	written, skipped := 0, 0
+	err = s.bookRepo.EachWithCopies(rd, func(book models.Book, copies []models.BookCopy) error {
+		err := cw.Write(book, copies)
+		if errors.Is(err, marc.ErrRecordTooLong) {
+			log.Printf("[WARN] ExportCatalogue: book %s left out: %v", book.ID, err)
+			skipped++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		written++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+	log.Printf("[INFO] ExportCatalogue: wrote %d books as %s (%d left out)", written, format, skipped)
+	return nil
+}
+
+// ─── Harvesting ───────────────────────────────────────────────────────────────
+
+// BookCursor is a position in ListChangedBooks order.
+type BookCursor = repositories.BookCursor
+
+// GetBook returns a book by ID.
+func (s *libraryService) GetBook(bookID uuid.UUID) (*models.Book, error) {
+	return s.getBook(nil, bookID)
+}
+
+// GetAnyBook is GetBook that also finds a withdrawn book, whose DeletedAt is
+// then set, so that OAI-PMH can report its record as deleted.
+func (s *libraryService) GetAnyBook(bookID uuid.UUID) (*models.Book, error) {
+	book, err := s.bookRepo.GetAny(nil, bookID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, ErrBookNotFound
+	}
+	return book, err
+}
+
+// ListChangedBooks returns up to limit books whose catalogue record changed
+// in [from, until), oldest change first, starting after the cursor. Nil bounds
+// and a nil cursor are unbounded. Withdrawing and restoring a book count as
+// changes, and withdrawn books are included with DeletedAt set.
+//
+// Unlike the other lists it reads the primary. OAI-PMH harvesters ask next
+// time for changes from this response's date on, so a change a lagging
+// replica has not seen yet would be missed by them for good.
+func (s *libraryService) ListChangedBooks(from, until *time.Time, after *BookCursor, limit int) ([]models.Book, error) {
+	if limit < 1 {
+		return nil, nil
+	}
+	return s.bookRepo.ListChanged(nil, from, until, after, limit)
+}
+
+// ─── Search ───────────────────────────────────────────────────────────────────
+
+// BookQuery is a catalogue search, as SearchBooks takes it.
+type BookQuery = repositories.BookQuery
+
+// SearchBooks returns the books matching q in title order, skipping offset of
+// them and returning at most limit, with the number that match in all. A nil
+// query matches every book.
+func (s *libraryService) SearchBooks(q *BookQuery, offset, limit int) ([]models.Book, int64, error) {
+	return s.bookRepo.Search(s.reads(), q, max(offset, 0), limit)
+}
+
+// branchNames maps every branch ID to its name, for holdings.
+func (s *libraryService) branchNames(tx repositories.Tx) (map[uuid.UUID]string, error) {
+	branches, err := s.branchRepo.List(tx)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uuid.UUID]string, len(branches))
+	for _, b := range branches {
+		names[b.ID] = b.Name
+	}
+	return names, nil
+}
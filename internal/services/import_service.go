@@ -0,0 +1,387 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"library/internal/catalog"
+	"library/internal/models"
+	"library/internal/repositories"
+)
+
+const (
+	// ImportBatchSize is the number of records ImportBooks writes per
+	// transaction.
+	ImportBatchSize = 500
+
+	// MaxImportCopies is the most copies one imported record may create.
+	MaxImportCopies = 1000
+)
+
+// ImportStatus is the outcome of one imported record.
+type ImportStatus string
+
+const (
+	ImportCreated ImportStatus = "CREATED"
+	ImportSkipped ImportStatus = "SKIPPED"
+	ImportFailed  ImportStatus = "FAILED"
+)
+
+// ImportReport is the outcome of ImportBooks: one result per record, in file
+// order, and the totals. Error is set when the file could not be read to the
+// end; the records before it were still imported.
+type ImportReport struct {
+	Rows    int         `json:"rows"`
+	Created int         `json:"created"`
+	Skipped int         `json:"skipped"`
+	Failed  int         `json:"failed"`
+	Error   string      `json:"error,omitempty"`
+	Results []ImportRow `json:"results"`
+}
+
+// ImportRow is the outcome of one record. BookID is the created book or, for
+// a skipped record, the book already holding its ISBN.
+type ImportRow struct {
+	Line   int          `json:"line"`
+	Status ImportStatus `json:"status"`
+	BookID *uuid.UUID   `json:"book_id,omitempty"`
+	ISBN   string       `json:"isbn,omitempty"`
+	Title  string       `json:"title,omitempty"`
+	Reason string       `json:"reason,omitempty"`
+}
+
+// ─── Bulk Import ──────────────────────────────────────────────────────────────
+
+// ImportBooks streams a CSV, JSON Lines or MARC catalogue file into the
+// catalogue. Every valid record creates a book and its copies the way
+// CreateBook does, giving the first copies the barcodes and branches of the
+// record's holdings. Records whose ISBN
+// is already in the catalogue, or appeared earlier in the file, are skipped;
+// invalid records and records reusing a barcode fail. Records are written in
+// transactions of ImportBatchSize; if a batch cannot be committed, its records
+// are retried one at a time so that only the offending ones fail.
+func (s *libraryService) ImportBooks(format catalog.Format, r io.Reader) (*ImportReport, error) {
+	reader, err := catalog.NewReader(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	branches, err := s.branchRepo.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	imp := &bookImport{
+		s:           s,
+		report:      &ImportReport{Results: []ImportRow{}},
+		branches:    make(map[string]uuid.UUID, len(branches)),
+		isbnLine:    map[string]int{},
+		barcodeLine: map[string]int{},
+	}
+	for _, b := range branches {
+		imp.branches[strings.ToLower(b.Name)] = b.ID
+	}
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *catalog.RowError
+		if errors.As(err, &rowErr) {
+			imp.result(ImportRow{Line: rowErr.Line, Status: ImportFailed, Reason: rowErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			// Keep what was read so far; the report says where reading stopped.
+			imp.report.Error = err.Error()
+			log.Printf("[WARN] ImportBooks: reading stopped: %v", err)
+			break
+		}
+		if err := imp.add(rec); err != nil {
+			return nil, err
+		}
+	}
+	if err := imp.flush(); err != nil {
+		return nil, err
+	}
+
+	report := imp.report
+	sort.SliceStable(report.Results, func(i, j int) bool { return report.Results[i].Line < report.Results[j].Line })
+	report.Rows = len(report.Results)
+	for _, row := range report.Results {
+		switch row.Status {
+		case ImportCreated:
+			report.Created++
+		case ImportSkipped:
+			report.Skipped++
+		case ImportFailed:
+			report.Failed++
+		}
+	}
+	log.Printf("[INFO] ImportBooks: %d rows: %d created, %d skipped, %d failed", report.Rows, report.Created, report.Skipped, report.Failed)
+	return report, nil
+}
+
+// bookImport carries the state of one ImportBooks call: the results so far,
+// the records waiting for the next batch, branch IDs by lower-case name, and
+// the ISBNs and barcodes already seen in the file.
+type bookImport struct {
+	s           *libraryService
+	report      *ImportReport
+	pending     []importItem
+	branches    map[string]uuid.UUID
+	isbnLine    map[string]int
+	barcodeLine map[string]int
+}
+
+// importItem is a validated record ready to be written.
+type importItem struct {
+	row      ImportRow
+	book     models.Book
+	copies   []models.BookCopy
+	barcodes []string
+}
+
+func (imp *bookImport) result(row ImportRow) {
+	imp.report.Results = append(imp.report.Results, row)
+}
+
+// add validates rec and queues it, writing a batch once enough are queued.
+func (imp *bookImport) add(rec catalog.Record) error {
+	item, reason := imp.validate(rec)
+	if reason != "" {
+		item.row.Status = ImportFailed
+		item.row.Reason = reason
+		imp.result(item.row)
+		return nil
+	}
+
+	if item.row.ISBN != "" {
+		if line, seen := imp.isbnLine[item.row.ISBN]; seen {
+			item.row.Status = ImportSkipped
+			item.row.Reason = fmt.Sprintf("ISBN repeats line %d", line)
+			imp.result(item.row)
+			return nil
+		}
+	}
+	for _, b := range item.barcodes {
+		if line, seen := imp.barcodeLine[b]; seen {
+			item.row.Status = ImportFailed
+			item.row.Reason = fmt.Sprintf("barcode %q is already used on line %d", b, line)
+			imp.result(item.row)
+			return nil
+		}
+	}
+	if item.row.ISBN != "" {
+		imp.isbnLine[item.row.ISBN] = rec.Line
+	}
+	for _, b := range item.barcodes {
+		imp.barcodeLine[b] = rec.Line
+	}
+
+	imp.pending = append(imp.pending, item)
+	if len(imp.pending) >= ImportBatchSize {
+		return imp.flush()
+	}
+	return nil
+}
+
+// validate checks a record on its own and returns the reason it cannot be
+// imported, or "".
+func (imp *bookImport) validate(rec catalog.Record) (importItem, string) {
+	item := importItem{
+		row: ImportRow{Line: rec.Line, Title: rec.Title},
+		book: models.Book{
+			Title:     rec.Title,
+			Author:    rec.Author,
+			Edition:   rec.Edition,
+			Publisher: rec.Publisher,
+			Published: rec.Published,
+			Subjects:  rec.Subjects,
+			LoanType:  models.LoanTypeStandard,
+		},
+	}
+	switch {
+	case rec.Title == "":
+		return item, "title is required"
+	case utf8.RuneCountInString(rec.Title) > 255:
+		return item, "title is longer than 255 characters"
+	case rec.Author == "":
+		return item, "author is required"
+	case utf8.RuneCountInString(rec.Author) > 255:
+		return item, "author is longer than 255 characters"
+	case utf8.RuneCountInString(rec.Edition) > 255:
+		return item, "edition is longer than 255 characters"
+	case utf8.RuneCountInString(rec.Publisher) > 255:
+		return item, "publisher is longer than 255 characters"
+	case utf8.RuneCountInString(rec.Published) > 64:
+		return item, "published is longer than 64 characters"
+	}
+	for _, subject := range rec.Subjects {
+		if utf8.RuneCountInString(subject) > 255 {
+			return item, fmt.Sprintf("subject %q is longer than 255 characters", subject)
+		}
+	}
+	if rec.ISBN != "" {
+		isbn, err := catalog.NormalizeISBN(rec.ISBN)
+		if err != nil {
+			return item, fmt.Sprintf("invalid ISBN %q", rec.ISBN)
+		}
+		item.row.ISBN = isbn
+		item.book.ISBN = &isbn
+	}
+
+	copies := 1
+	switch {
+	case rec.Copies != nil:
+		copies = *rec.Copies
+	case len(rec.Holdings) > 0:
+		copies = len(rec.Holdings)
+	}
+	if copies < 0 || copies > MaxImportCopies {
+		return item, fmt.Sprintf("copies must be between 0 and %d", MaxImportCopies)
+	}
+	if copies < len(rec.Holdings) {
+		return item, fmt.Sprintf("%d holdings for %d copies", len(rec.Holdings), copies)
+	}
+
+	item.copies = make([]models.BookCopy, copies)
+	var unknown []string
+	for i, h := range rec.Holdings {
+		if h.Barcode != "" {
+			if len(h.Barcode) > 64 {
+				return item, fmt.Sprintf("barcode %q is longer than 64 characters", h.Barcode)
+			}
+			if slices.Contains(item.barcodes, h.Barcode) {
+				return item, fmt.Sprintf("barcode %q appears twice", h.Barcode)
+			}
+			barcode := h.Barcode
+			item.barcodes = append(item.barcodes, barcode)
+			item.copies[i].Barcode = &barcode
+		}
+		if h.Branch != "" {
+			if id, ok := imp.branches[strings.ToLower(h.Branch)]; ok {
+				item.copies[i].BranchID = &id
+			} else if !slices.Contains(unknown, h.Branch) {
+				unknown = append(unknown, h.Branch)
+			}
+		}
+	}
+	// An unknown branch is not worth losing the record over.
+	if len(unknown) > 0 {
+		item.row.Reason = fmt.Sprintf("unknown branch %q; copies left without a branch", strings.Join(unknown, `", "`))
+	}
+	return item, ""
+}
+
+// flush writes the queued records in one transaction, falling back to one
+// transaction per record if the batch fails.
+func (imp *bookImport) flush() error {
+	if len(imp.pending) == 0 {
+		return nil
+	}
+	batch := imp.pending
+	imp.pending = nil
+
+	rows, err := imp.s.importBatch(batch)
+	if err == nil {
+		imp.report.Results = append(imp.report.Results, rows...)
+		return nil
+	}
+	log.Printf("[WARN] ImportBooks: batch of %d records from line %d failed, retrying one by one: %v", len(batch), batch[0].row.Line, err)
+	for _, item := range batch {
+		rows, err := imp.s.importBatch([]importItem{item})
+		if err != nil {
+			row := item.row
+			row.Status = ImportFailed
+			if isUniqueViolation(err) {
+				row.Reason = "ISBN or barcode is already in use"
+			} else {
+				row.Reason = fmt.Sprintf("could not be saved: %v", err)
+			}
+			imp.result(row)
+			continue
+		}
+		imp.report.Results = append(imp.report.Results, rows...)
+	}
+	return nil
+}
+
+// importBatch writes batch in a single transaction and returns a result for
+// every record. Records whose ISBN or barcodes are already in the catalogue
+// are skipped or failed without writing anything.
+func (s *libraryService) importBatch(batch []importItem) ([]ImportRow, error) {
+	var isbns, barcodes []string
+	for _, item := range batch {
+		if item.book.ISBN != nil {
+			isbns = append(isbns, *item.book.ISBN)
+		}
+		barcodes = append(barcodes, item.barcodes...)
+	}
+
+	var rows []ImportRow
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		rows = make([]ImportRow, 0, len(batch))
+		existing, err := s.bookRepo.FindByISBNs(tx, isbns)
+		if err != nil {
+			return err
+		}
+		byISBN := make(map[string]uuid.UUID, len(existing))
+		for _, b := range existing {
+			byISBN[*b.ISBN] = b.ID
+		}
+		labelled, err := s.bookCopyRepo.FindByBarcodes(tx, barcodes)
+		if err != nil {
+			return err
+		}
+		taken := make(map[string]bool, len(labelled))
+		for _, c := range labelled {
+			taken[*c.Barcode] = true
+		}
+
+		for _, item := range batch {
+			row := item.row
+			if id, ok := byISBN[row.ISBN]; ok && row.ISBN != "" {
+				row.Status = ImportSkipped
+				row.BookID = &id
+				row.Reason = "ISBN is already in the catalogue"
+				rows = append(rows, row)
+				continue
+			}
+			if b := firstTaken(item.barcodes, taken); b != "" {
+				row.Status = ImportFailed
+				row.Reason = fmt.Sprintf("barcode %q is already in use", b)
+				rows = append(rows, row)
+				continue
+			}
+			book := item.book
+			if err := s.insertBook(tx, &book, slices.Clone(item.copies)); err != nil {
+				return err
+			}
+			row.Status = ImportCreated
+			row.BookID = &book.ID
+			rows = append(rows, row)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func firstTaken(barcodes []string, taken map[string]bool) string {
+	for _, b := range barcodes {
+		if taken[b] {
+			return b
+		}
+	}
+	return ""
+}
@@ -0,0 +1,506 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"library/internal/models"
+	"library/internal/repositories"
+)
+
+// IntegrityIssueKind names a broken invariant.
+type IntegrityIssueKind string
+
+const (
+	// IssueCopyStatus is a copy whose status disagrees with its checkouts
+	// (invariant I-2): CHECKED_OUT with no active checkout, or AVAILABLE with
+	// one. Repair sets the status the checkouts imply.
+	IssueCopyStatus IntegrityIssueKind = "COPY_STATUS"
+	// IssueTotalCopies is a book whose total_copies differs from the number
+	// of its copies. Repair sets it to the count.
+	IssueTotalCopies IntegrityIssueKind = "TOTAL_COPIES"
+	// IssueOrphanedReservation is a reservation for a book or user that no
+	// longer exists. Repair deletes it.
+	IssueOrphanedReservation IntegrityIssueKind = "ORPHANED_RESERVATION"
+	// IssueQueueGap is a reservation queue whose positions are not 1…n.
+	// Repair renumbers the queue, keeping its order.
+	IssueQueueGap IntegrityIssueKind = "QUEUE_GAP"
+	// IssueAvailability is a book whose available_copies, checked_out_copies
+	// or holds differ from its copies, checkouts and reservations. Repair
+	// sets the counts.
+	IssueAvailability IntegrityIssueKind = "AVAILABILITY"
+)
+
+// IntegrityIssue is one inconsistency found by CheckIntegrity.
+type IntegrityIssue struct {
+	Kind          IntegrityIssueKind `json:"kind"`
+	BookID        uuid.UUID          `json:"book_id"`
+	CopyID        *uuid.UUID         `json:"copy_id,omitempty"`
+	ReservationID *uuid.UUID         `json:"reservation_id,omitempty"`
+	Detail        string             `json:"detail"`
+	Repaired      bool               `json:"repaired"`
+}
+
+// IntegrityReport lists the issues found by one run of CheckIntegrity.
+type IntegrityReport struct {
+	CheckedAt time.Time        `json:"checked_at"`
+	Repair    bool             `json:"repair"`
+	Issues    []IntegrityIssue `json:"issues"`
+}
+
+// ─── Integrity Check ──────────────────────────────────────────────────────────
+
+// CheckIntegrity scans copies, checkouts, books and reservations for
+// inconsistencies the normal flows never create but manual SQL or bugs can:
+// copy statuses that disagree with checkouts, total_copies drift, orphaned
+// reservations, gaps in queue positions and availability counts that have
+// drifted. With repair set, every issue is fixed in the same transaction as
+// the scan, so either all are repaired or, on error, none are.
+func (s *libraryService) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	report := &IntegrityReport{CheckedAt: s.now(), Repair: repair, Issues: []IntegrityIssue{}}
+
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		report.Issues = report.Issues[:0]
+		checks := []func(repositories.Tx, bool) ([]IntegrityIssue, error){
+			s.checkCopyStatuses,
+			s.checkTotalCopies,
+			s.checkReservations,
+			s.checkAvailability,
+		}
+		for _, check := range checks {
+			issues, err := check(tx, repair)
+			if err != nil {
+				return err
+			}
+			report.Issues = append(report.Issues, issues...)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[ERROR] CheckIntegrity: failed (repair=%t): %v", repair, err)
+		return nil, err
+	}
+
+	if len(report.Issues) == 0 {
+		log.Printf("[INFO] CheckIntegrity: no issues found")
+	} else {
+		log.Printf("[WARN] CheckIntegrity: %d issues found (repair=%t)", len(report.Issues), repair)
+	}
+	return report, nil
+}
+
+// checkCopyStatuses compares every copy's status with its active checkouts.
+// When repairing, each copy is locked and its checkout read again, so a
+// checkout or return running alongside cannot be undone.
+func (s *libraryService) checkCopyStatuses(tx repositories.Tx, repair bool) ([]IntegrityIssue, error) {
+	copies, err := s.bookCopyRepo.List(tx)
+	if err != nil {
+		return nil, err
+	}
+	active, err := s.checkoutRepo.ListActive(tx)
+	if err != nil {
+		return nil, err
+	}
+	onLoan := make(map[uuid.UUID]bool, len(active))
+	for _, c := range active {
+		onLoan[c.BookCopyID] = true
+	}
+
+	var issues []IntegrityIssue
+	for _, copy := range copies {
+		want := models.BookCopyStatusAvailable
+		if onLoan[copy.ID] {
+			want = models.BookCopyStatusCheckedOut
+		}
+		if copy.Status == want {
+			continue
+		}
+		copyID := copy.ID
+		issue := IntegrityIssue{
+			Kind:   IssueCopyStatus,
+			BookID: copy.BookID,
+			CopyID: &copyID,
+			Detail: fmt.Sprintf("copy is %s but should be %s", copy.Status, want),
+		}
+		if repair {
+			if err := s.repairCopyStatus(tx, copy.ID); err != nil {
+				return nil, err
+			}
+			issue.Repaired = true
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+func (s *libraryService) repairCopyStatus(tx repositories.Tx, copyID uuid.UUID) error {
+	copy, err := s.bookCopyRepo.GetByIDForUpdate(tx, copyID)
+	if err != nil {
+		return err
+	}
+	want := models.BookCopyStatusAvailable
+	_, err = s.checkoutRepo.GetActiveByCopy(tx, copyID)
+	switch {
+	case err == nil:
+		want = models.BookCopyStatusCheckedOut
+	case !errors.Is(err, repositories.ErrNotFound):
+		return err
+	}
+	if copy.Status == want {
+		return nil
+	}
+	if err := s.bookCopyRepo.UpdateStatus(tx, copyID, want); err != nil {
+		return err
+	}
+	log.Printf("[INFO] CheckIntegrity: copy %s status %s -> %s", copyID, copy.Status, want)
+	return nil
+}
+
+// checkTotalCopies compares every book's total_copies with its copies.
+func (s *libraryService) checkTotalCopies(tx repositories.Tx, repair bool) ([]IntegrityIssue, error) {
+	books, err := s.bookRepo.List(tx)
+	if err != nil {
+		return nil, err
+	}
+	copies, err := s.bookCopyRepo.List(tx)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uuid.UUID]int, len(books))
+	for _, c := range copies {
+		counts[c.BookID]++
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].ID.String() < books[j].ID.String() })
+
+	var issues []IntegrityIssue
+	for _, book := range books {
+		count := counts[book.ID]
+		if book.TotalCopies == count {
+			continue
+		}
+		issue := IntegrityIssue{
+			Kind:   IssueTotalCopies,
+			BookID: book.ID,
+			Detail: fmt.Sprintf("total_copies is %d but the book has %d copies", book.TotalCopies, count),
+		}
+		if repair {
+			if err := s.repairTotalCopies(tx, book.ID); err != nil {
+				return nil, err
+			}
+			issue.Repaired = true
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// repairTotalCopies locks the book and counts its copies again before
+// correcting total_copies, so a copy added since the scan is not counted
+// twice.
+func (s *libraryService) repairTotalCopies(tx repositories.Tx, bookID uuid.UUID) error {
+	book, err := s.bookRepo.GetByIDForUpdate(tx, bookID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil // deleted since the scan
+		}
+		return err
+	}
+	copies, err := s.bookCopyRepo.ListByBooks(tx, []uuid.UUID{bookID})
+	if err != nil {
+		return err
+	}
+	if book.TotalCopies == len(copies) {
+		return nil
+	}
+	if err := s.bookRepo.IncrementTotalCopies(tx, bookID, len(copies)-book.TotalCopies); err != nil {
+		return err
+	}
+	log.Printf("[INFO] CheckIntegrity: book %s total_copies %d -> %d", bookID, book.TotalCopies, len(copies))
+	return nil
+}
+
+// checkReservations finds reservations whose book or user is gone and
+// queues whose positions are not 1…n once those are removed.
+func (s *libraryService) checkReservations(tx repositories.Tx, repair bool) ([]IntegrityIssue, error) {
+	reservations, err := s.reservationRepo.List(tx)
+	if err != nil {
+		return nil, err
+	}
+	books, err := s.bookRepo.List(tx)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.userRepo.List(tx)
+	if err != nil {
+		return nil, err
+	}
+	bookExists := make(map[uuid.UUID]bool, len(books))
+	for _, b := range books {
+		bookExists[b.ID] = true
+	}
+	userExists := make(map[uuid.UUID]bool, len(users))
+	for _, u := range users {
+		userExists[u.ID] = true
+	}
+
+	var issues []IntegrityIssue
+	queues := map[uuid.UUID][]models.Reservation{}
+	var bookIDs []uuid.UUID
+	for _, res := range reservations {
+		var missing string
+		switch {
+		case !bookExists[res.BookID]:
+			missing = "book"
+		case !userExists[res.UserID]:
+			missing = "user " + res.UserID.String()
+		default:
+			if queues[res.BookID] == nil {
+				bookIDs = append(bookIDs, res.BookID)
+			}
+			queues[res.BookID] = append(queues[res.BookID], res)
+			continue
+		}
+		resID := res.ID
+		issue := IntegrityIssue{
+			Kind:          IssueOrphanedReservation,
+			BookID:        res.BookID,
+			ReservationID: &resID,
+			Detail:        fmt.Sprintf("reservation at position %d refers to a missing %s", res.QueuePosition, missing),
+		}
+		if repair {
+			if err := s.reservationRepo.Delete(tx, res.ID); err != nil {
+				return nil, err
+			}
+			log.Printf("[INFO] CheckIntegrity: orphaned reservation %s deleted", res.ID)
+			issue.Repaired = true
+		}
+		issues = append(issues, issue)
+	}
+
+	for _, bookID := range bookIDs {
+		queue := queues[bookID]
+		gap := false
+		for i, res := range queue {
+			if res.QueuePosition != i+1 {
+				gap = true
+				break
+			}
+		}
+		if !gap {
+			continue
+		}
+		positions := make([]int, len(queue))
+		for i, res := range queue {
+			positions[i] = res.QueuePosition
+		}
+		issue := IntegrityIssue{
+			Kind:   IssueQueueGap,
+			BookID: bookID,
+			Detail: fmt.Sprintf("queue positions are %v, want 1 to %d", positions, len(queue)),
+		}
+		if repair {
+			if err := s.reservationRepo.CompactQueue(tx, bookID); err != nil {
+				return nil, err
+			}
+			log.Printf("[INFO] CheckIntegrity: queue of book %s renumbered 1 to %d", bookID, len(queue))
+			issue.Repaired = true
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// checkAvailability compares every book's availability counts with what the
+// other checks leave behind: copies counted as checked out when they have an
+// active checkout, whatever their status says, and holds counted without
+// orphaned reservations. It therefore reports the same books with and
+// without repair, and runs last so that its repairs see the others'. A repair
+// recounts the book under its row lock, as ReconcileAvailability does, rather
+// than writing the scan's counts, which a checkout or return committed since
+// would have made stale.
+func (s *libraryService) checkAvailability(tx repositories.Tx, repair bool) ([]IntegrityIssue, error) {
+	books, err := s.bookRepo.List(tx)
+	if err != nil {
+		return nil, err
+	}
+	copies, err := s.bookCopyRepo.List(tx)
+	if err != nil {
+		return nil, err
+	}
+	active, err := s.checkoutRepo.ListActive(tx)
+	if err != nil {
+		return nil, err
+	}
+	reservations, err := s.reservationRepo.List(tx)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.userRepo.List(tx)
+	if err != nil {
+		return nil, err
+	}
+	onLoan := make(map[uuid.UUID]bool, len(active))
+	for _, c := range active {
+		onLoan[c.BookCopyID] = true
+	}
+	userExists := make(map[uuid.UUID]bool, len(users))
+	for _, u := range users {
+		userExists[u.ID] = true
+	}
+	want := make(map[uuid.UUID]repositories.Availability, len(books))
+	for _, c := range copies {
+		counts := want[c.BookID]
+		if onLoan[c.ID] {
+			counts.CheckedOut++
+		} else {
+			counts.Available++
+		}
+		want[c.BookID] = counts
+	}
+	for _, res := range reservations {
+		if userExists[res.UserID] {
+			counts := want[res.BookID]
+			counts.Holds++
+			want[res.BookID] = counts
+		}
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].ID.String() < books[j].ID.String() })
+
+	var issues []IntegrityIssue
+	for _, book := range books {
+		got := availability(&book)
+		if got == want[book.ID] {
+			continue
+		}
+		issue := IntegrityIssue{
+			Kind:   IssueAvailability,
+			BookID: book.ID,
+			Detail: fmt.Sprintf("counts are %s but should be %s", formatAvailability(got), formatAvailability(want[book.ID])),
+		}
+		if repair {
+			if err := s.repairAvailability(tx, book.ID); err != nil {
+				return nil, err
+			}
+			issue.Repaired = true
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// repairAvailability locks the book and sets its counts from its copies and
+// queue as they are now. The copy status and reservation repairs have already
+// run in the same transaction, so statuses agree with checkouts and orphaned
+// reservations are gone.
+func (s *libraryService) repairAvailability(tx repositories.Tx, bookID uuid.UUID) error {
+	book, err := s.bookRepo.GetByIDForUpdate(tx, bookID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil // deleted since the scan
+		}
+		return err
+	}
+	want, err := s.countAvailability(tx, bookID)
+	if err != nil {
+		return err
+	}
+	got := availability(book)
+	if got == want {
+		return nil
+	}
+	if err := s.bookRepo.SetAvailability(tx, bookID, want); err != nil {
+		return err
+	}
+	log.Printf("[INFO] CheckIntegrity: book %s availability %s -> %s", bookID, formatAvailability(got), formatAvailability(want))
+	return nil
+}
+
+// ─── Availability Reconciliation ──────────────────────────────────────────────
+
+// ReconcileAvailability recounts every book's available and checked-out
+// copies and holds from its copies and reservations and corrects the counts
+// that have drifted, returning how many books it corrected. Each book is
+// recounted in its own transaction with the book row locked first, so
+// checkouts and returns of that book that commit meanwhile are neither lost
+// nor counted twice, and the rest of the catalogue is never blocked.
+//
+// Unlike CheckIntegrity it trusts copy statuses as they are; run an
+// integrity repair to fix statuses that disagree with checkouts.
+func (s *libraryService) ReconcileAvailability() (int, error) {
+	books, err := s.bookRepo.List(nil)
+	if err != nil {
+		return 0, err
+	}
+	corrected := 0
+	for _, b := range books {
+		err := s.txm.Transaction(func(tx repositories.Tx) error {
+			book, err := s.bookRepo.GetByIDForUpdate(tx, b.ID)
+			if err != nil {
+				if errors.Is(err, repositories.ErrNotFound) {
+					return nil // deleted since the list was read
+				}
+				return err
+			}
+			want, err := s.countAvailability(tx, book.ID)
+			if err != nil {
+				return err
+			}
+			got := availability(book)
+			if got == want {
+				return nil
+			}
+			if err := s.bookRepo.SetAvailability(tx, book.ID, want); err != nil {
+				return err
+			}
+			log.Printf("[WARN] ReconcileAvailability: book %s availability %s -> %s", book.ID, formatAvailability(got), formatAvailability(want))
+			corrected++
+			return nil
+		})
+		if err != nil {
+			log.Printf("[ERROR] ReconcileAvailability: failed for book %s: %v", b.ID, err)
+			return corrected, err
+		}
+	}
+	log.Printf("[INFO] ReconcileAvailability: %d of %d book(s) corrected", corrected, len(books))
+	return corrected, nil
+}
+
+// countAvailability counts a book's available and checked-out copies by
+// status and its holds from its queue. Lock the book first.
+func (s *libraryService) countAvailability(tx repositories.Tx, bookID uuid.UUID) (repositories.Availability, error) {
+	copies, err := s.bookCopyRepo.ListByBooks(tx, []uuid.UUID{bookID})
+	if err != nil {
+		return repositories.Availability{}, err
+	}
+	queue, err := s.reservationRepo.ListByBook(tx, bookID)
+	if err != nil {
+		return repositories.Availability{}, err
+	}
+	want := repositories.Availability{Holds: len(queue)}
+	for _, c := range copies {
+		if c.Status == models.BookCopyStatusAvailable {
+			want.Available++
+		} else {
+			want.CheckedOut++
+		}
+	}
+	return want, nil
+}
+
+// availability returns a book's stored counts.
+func availability(book *models.Book) repositories.Availability {
+	return repositories.Availability{
+		Available:  book.AvailableCopies,
+		CheckedOut: book.CheckedOutCopies,
+		Holds:      book.Holds,
+	}
+}
+
+func formatAvailability(a repositories.Availability) string {
+	return fmt.Sprintf("%d available / %d checked out / %d holds", a.Available, a.CheckedOut, a.Holds)
+}
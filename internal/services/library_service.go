@@ -2,13 +2,18 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"log"
-	"strings"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
-	"gorm.io/gorm"
 
+	"library/internal/calendar"
+	"library/internal/catalog"
+	"library/internal/clock"
+	"library/internal/marc"
 	"library/internal/models"
 	"library/internal/repositories"
 )
@@ -22,13 +27,84 @@ const (
 	// FinePerDay is the fine amount (in currency units) charged per day overdue.
 	// Minimum charged is 1 day (i.e. FinePerDay) even if returned less than 24 h late.
 	FinePerDay = 10
+
+	// MaxRenewals is the number of times a checkout may be renewed.
+	MaxRenewals = 2
+
+	// FinePerHour is the fine charged per started hour overdue on SHORT and
+	// OVERNIGHT loans.
+	FinePerHour = 5
+
+	// MaxShortLoanHours is the longest loan a SHORT book may have.
+	MaxShortLoanHours = 72
 )
 
+// Policy holds the circulation rules and feature switches the service applies.
+// It is normally built from the circulation and features sections of the
+// configuration file; DefaultPolicy reproduces the built-in behaviour.
+type Policy struct {
+	// LoanPeriodDays is the number of days between checkout and due date.
+	LoanPeriodDays int
+
+	// FinePerDay is the fine charged per day overdue: every calendar day for
+	// copies without a branch, only the days the branch is open otherwise.
+	FinePerDay int
+
+	// FinePerHour is the fine charged per started hour overdue on SHORT and
+	// OVERNIGHT loans, counting only the hours the branch is open.
+	FinePerHour int
+
+	// ReservationsEnabled queues a reservation when no copy is available.
+	// When false, CheckoutBook returns ErrReservationsDisabled to the caller.
+	ReservationsEnabled bool
+
+	// AutoCheckoutOnReturn converts the head reservation into a checkout as
+	// soon as a copy is returned.
+	AutoCheckoutOnReturn bool
+
+	// SkipLockedAllocation makes CheckoutBook take an available copy no
+	// concurrent checkout has locked, rather than wait for the lock on the
+	// first available copy.
+	SkipLockedAllocation bool
+
+	// MaxRenewals is how many times a checkout may be renewed.
+	MaxRenewals int
+
+	// CapAtTermEnd keeps the due dates of STUDENT checkouts and renewals
+	// within the academic term in which they are made.
+	CapAtTermEnd bool
+
+	// CirculationIsolation is the isolation level of the CheckoutBook and
+	// ReturnCheckout transactions.
+	CirculationIsolation repositories.Isolation
+
+	// TxRetry bounds how CheckoutBook and ReturnCheckout are re-run after a
+	// serialization failure or deadlock.
+	TxRetry repositories.RetryPolicy
+}
+
+// DefaultPolicy returns the policy matching LoanPeriodDays, FinePerDay,
+// FinePerHour and MaxRenewals with all optional features enabled.
+func DefaultPolicy() Policy {
+	return Policy{
+		LoanPeriodDays:       LoanPeriodDays,
+		FinePerDay:           FinePerDay,
+		FinePerHour:          FinePerHour,
+		ReservationsEnabled:  true,
+		AutoCheckoutOnReturn: true,
+		SkipLockedAllocation: true,
+		MaxRenewals:          MaxRenewals,
+		CapAtTermEnd:         true,
+		CirculationIsolation: repositories.IsolationReadCommitted,
+		TxRetry:              repositories.DefaultRetryPolicy(),
+	}
+}
+
 // ─── Sentinel Errors ──────────────────────────────────────────────────────────
 
 var (
-	// ErrNoAvailableCopy is returned (internally) when all copies of a book are checked
-	// out. It signals CheckoutBook to create a reservation instead.
+	// ErrNoAvailableCopy reports that all copies of a book are checked out. CheckoutBook
+	// does not return it; it queues a reservation (or returns ErrReservationsDisabled).
 	ErrNoAvailableCopy = errors.New("no available copies, reservation created")
 
 	// ErrCheckoutAlreadyReturned is returned when a return is attempted on a checkout
@@ -43,6 +119,10 @@ var (
 	// that is already checked out (should not normally occur given DB constraints).
 	ErrAlreadyCheckedOut = errors.New("book copy is already checked out")
 
+	// ErrReservationsDisabled is returned by CheckoutBook when no copy is available
+	// and the reservations feature is switched off.
+	ErrReservationsDisabled = errors.New("no available copies and reservations are disabled")
+
 	// ErrBookNotFound is returned when the requested book does not exist.
 	ErrBookNotFound = errors.New("book not found")
 
@@ -51,53 +131,363 @@ var (
 
 	// ErrCheckoutNotFound is returned when the referenced checkout does not exist.
 	ErrCheckoutNotFound = errors.New("checkout not found")
+
+	// ErrInvalidRole is returned when a user is created with a role other than
+	// STUDENT or LIBRARIAN.
+	ErrInvalidRole = errors.New("invalid user role")
+
+	// ErrInvalidCopyCount is returned when a bulk copy request asks for fewer
+	// than one copy.
+	ErrInvalidCopyCount = errors.New("copy count must be at least 1")
+
+	// ErrCopyNotFound is returned when the referenced book copy does not exist.
+	ErrCopyNotFound = errors.New("book copy not found")
+
+	// ErrBranchNotFound is returned when the referenced branch does not exist.
+	ErrBranchNotFound = errors.New("branch not found")
+
+	// ErrInvalidTimezone is returned when a branch names a time zone that is not
+	// in the IANA database.
+	ErrInvalidTimezone = errors.New("invalid time zone")
+
+	// ErrInvalidOpeningHours is returned for a malformed weekly schedule: a
+	// weekday outside 0-6, a weekday listed twice, a time that is not HH:MM, or
+	// an interval that does not close after it opens.
+	ErrInvalidOpeningHours = errors.New("invalid opening hours")
+
+	// ErrInvalidClosure is returned for a closure without a valid date.
+	ErrInvalidClosure = errors.New("invalid closure")
+
+	// ErrClosureExists is returned when a branch is already closed on the date.
+	ErrClosureExists = errors.New("branch is already closed on this date")
+
+	// ErrInvalidDateRange is returned when a calendar is requested for a range
+	// that ends before it starts or spans more than a year.
+	ErrInvalidDateRange = errors.New("invalid date range")
+
+	// ErrInvalidICal is returned when an imported iCalendar file cannot be read.
+	ErrInvalidICal = calendar.ErrInvalidICal
+
+	// ErrTermNotFound is returned when the referenced term does not exist.
+	ErrTermNotFound = errors.New("term not found")
+
+	// ErrNoCurrentTerm is returned by the term-end report when no term is given
+	// and none is in progress.
+	ErrNoCurrentTerm = errors.New("no academic term is in progress")
+
+	// ErrInvalidTerm is returned for a term without a name or whose end date
+	// is before its start date.
+	ErrInvalidTerm = errors.New("invalid term")
+
+	// ErrTermOverlap is returned when a term would overlap an existing one.
+	ErrTermOverlap = errors.New("term overlaps an existing term")
+
+	// ErrCheckoutOverdue is returned when renewing a checkout that is already
+	// past its due date; it has to be returned (and the fine paid) instead.
+	ErrCheckoutOverdue = errors.New("checkout is overdue")
+
+	// ErrRenewalLimitReached is returned when a checkout has already been
+	// renewed Policy.MaxRenewals times.
+	ErrRenewalLimitReached = errors.New("renewal limit reached")
+
+	// ErrRenewalBlocked is returned when other users are waiting for the book.
+	ErrRenewalBlocked = errors.New("book has a reservation queue")
+
+	// ErrRenewalNotExtended is returned when a renewal would not move the due
+	// date later, typically because the term ends first.
+	ErrRenewalNotExtended = errors.New("renewal would not extend the due date")
+
+	// ErrInvalidLoanType is returned for a loan type other than STANDARD, SHORT
+	// or OVERNIGHT, or for loan hours that do not fit it: SHORT needs 1 to
+	// MaxShortLoanHours hours, the other types none.
+	ErrInvalidLoanType = errors.New("invalid loan type")
+
+	// ErrCourseNotFound is returned when the requested course does not exist.
+	ErrCourseNotFound = errors.New("course not found")
+
+	// ErrInvalidCourse is returned for a course with an empty code or title.
+	ErrInvalidCourse = errors.New("invalid course")
+
+	// ErrCourseExists is returned when another course already has the code.
+	ErrCourseExists = errors.New("a course with this code already exists")
+
+	// ErrReadingListNotFound is returned when the requested reading list does
+	// not exist.
+	ErrReadingListNotFound = errors.New("reading list not found")
+
+	// ErrInvalidReadingList is returned for a reading list without a title or
+	// with a book listed more than once.
+	ErrInvalidReadingList = errors.New("invalid reading list")
+
+	// ErrTermEnded is returned when moving books into course reserves for a
+	// term that is already over.
+	ErrTermEnded = errors.New("term has already ended")
+
+	// ErrInvalidImport wraps problems that stop a catalogue file from being
+	// imported at all, such as a CSV header without a title column.
+	ErrInvalidImport = catalog.ErrInvalidFile
+
+	// ErrCopyOnHold is returned when checking out a particular copy of a book
+	// that other users are queued for; it goes to the head of the queue.
+	ErrCopyOnHold = errors.New("book copy is held for a reservation")
+
+	// ErrInvalidPayment is returned for a payment that is not a positive
+	// amount or whose reference is longer than 64 characters.
+	ErrInvalidPayment = errors.New("invalid payment")
+
+	// ErrOverpayment is returned when a payment exceeds the user's outstanding
+	// fines.
+	ErrOverpayment = errors.New("payment exceeds outstanding fines")
+
+	// ErrUnknownImportFormat is returned for a catalogue format other than
+	// csv, jsonl, marc or marcxml.
+	ErrUnknownImportFormat = catalog.ErrUnknownFormat
+
+	// ErrUnknownExportFormat is returned for an export format the operation
+	// does not offer.
+	ErrUnknownExportFormat = errors.New("unknown export format")
+
+	// ErrMARCRecordTooLong is returned when a book does not fit in one
+	// ISO 2709 record; MARCXML has no such limit.
+	ErrMARCRecordTooLong = marc.ErrRecordTooLong
+
+	// ErrReservationNotFound is returned when the referenced reservation does
+	// not exist.
+	ErrReservationNotFound = errors.New("reservation not found")
+
+	// ErrVersionMismatch is returned when an edit names a version of the
+	// record other than its current one: someone else changed it since the
+	// caller read it.
+	ErrVersionMismatch = errors.New("record version does not match")
+
+	// ErrInvalidBook is returned by UpdateBook for an empty title or author,
+	// a field that is too long or an invalid ISBN.
+	ErrInvalidBook = errors.New("invalid book")
+
+	// ErrISBNTaken is returned by UpdateBook when another book, withdrawn or
+	// not, already has the ISBN.
+	ErrISBNTaken = errors.New("another book has this ISBN")
+
+	// ErrBookOnLoan is returned when deleting a book one of whose copies is
+	// checked out.
+	ErrBookOnLoan = errors.New("a copy of the book is checked out")
+
+	// ErrBookHasFines is returned when purging a book whose loan history
+	// includes fines, which would disappear from the borrowers' accounts.
+	ErrBookHasFines = errors.New("the book's loans include fines")
 )
 
+// OverdueCheckout is an active checkout past its due date, together with the
+// fine that would be charged if it were returned now. Hourly loans (SHORT and
+// OVERNIGHT) report HoursOverdue instead of DaysOverdue.
+type OverdueCheckout struct {
+	models.Checkout
+	DaysOverdue  int `json:"days_overdue"`
+	HoursOverdue int `json:"hours_overdue,omitempty"`
+	AccruedFine  int `json:"accrued_fine"`
+}
+
+// FineRecomputeBatchSize is the number of checkouts RecomputeFines reads and
+// writes per transaction.
+const FineRecomputeBatchSize = 500
+
+// FineScope selects the returned checkouts RecomputeFines recalculates;
+// unset fields match every checkout. DryRun reports the changes without
+// storing them.
+type FineScope struct {
+	CheckoutID    *uuid.UUID
+	UserID        *uuid.UUID
+	ReturnedSince *time.Time
+	DryRun        bool
+}
+
+// FineRecompute is the outcome of RecomputeFines: every checkout whose fine
+// differs under the current policy, and how many were updated and how many
+// left alone because a payment settled them.
+type FineRecompute struct {
+	DryRun  bool         `json:"dry_run"`
+	Updated int          `json:"updated"`
+	Settled int          `json:"settled"`
+	Changes []FineChange `json:"changes"`
+}
+
+// FineChange is one checkout's fine before and after a recompute. Delta is
+// what the change adds to the user's balance. Settled changes were not
+// stored.
+type FineChange struct {
+	CheckoutID uuid.UUID `json:"checkout_id"`
+	UserID     uuid.UUID `json:"user_id"`
+	OldFine    int       `json:"old_fine"`
+	NewFine    int       `json:"new_fine"`
+	Delta      int       `json:"delta"`
+	Settled    bool      `json:"settled,omitempty"`
+}
+
 // ─── Service Interface ────────────────────────────────────────────────────────
 
 // LibraryService defines the application-level operations of the library system.
 type LibraryService interface {
+	CreateUser(name string, role models.UserRole) (*models.User, error)
+	GetUser(userID uuid.UUID) (*models.User, error)
+	ListUsers() ([]models.User, error)
+
 	CreateBook(title, author string, totalCopies int) (*models.Book, error)
 	AddBookCopy(bookID uuid.UUID) (*models.BookCopy, error)
+	AddBookCopies(bookID uuid.UUID, count int) ([]models.BookCopy, error)
 	ListBooks() ([]models.Book, error)
-
-	CheckoutBook(bookID, userID uuid.UUID) (*models.Checkout, *models.Reservation, error)
+	GetBook(bookID uuid.UUID) (*models.Book, error)
+	GetAnyBook(bookID uuid.UUID) (*models.Book, error)
+	ListChangedBooks(from, until *time.Time, after *BookCursor, limit int) ([]models.Book, error)
+	SearchBooks(q *BookQuery, offset, limit int) ([]models.Book, int64, error)
+	SetBookLoanType(bookID uuid.UUID, loanType models.LoanType, loanHours, ifVersion int) (*models.Book, error)
+	UpdateBook(bookID uuid.UUID, changes BookChanges, ifVersion int) (*models.Book, error)
+	DeleteBook(bookID uuid.UUID, purge bool, ifVersion int) (*BookDeletion, error)
+	RestoreBook(bookID uuid.UUID) (*models.Book, error)
+	ImportBooks(format catalog.Format, r io.Reader) (*ImportReport, error)
+	ExportBookMARC(bookID uuid.UUID, format catalog.Format, w io.Writer) error
+	ExportCatalogue(format catalog.Format, w io.Writer) error
+
+	CheckoutBook(bookID, userID uuid.UUID) (*models.Checkout, *QueuedReservation, error)
 	ReturnCheckout(checkoutID uuid.UUID) (*models.Checkout, error)
+	RenewCheckout(checkoutID uuid.UUID) (*models.Checkout, error)
 
 	ListUserCheckouts(userID uuid.UUID) ([]models.Checkout, error)
-	ListReservationsForBook(bookID uuid.UUID) ([]models.Reservation, error)
+	ListReservationsForBook(bookID uuid.UUID) ([]QueuedReservation, error)
+	ListUserReservations(userID uuid.UUID) ([]UserReservation, error)
+	CancelReservation(reservationID uuid.UUID) error
+
+	ListOverdueCheckouts() ([]OverdueCheckout, error)
+	RecomputeFines(scope FineScope) (*FineRecompute, error)
+	CheckIntegrity(repair bool) (*IntegrityReport, error)
+	ReconcileAvailability() (int, error)
+	TransactionStats() []repositories.TxStats
+
+	// WithConsistentReads returns the service with list and report queries
+	// read from the primary database rather than a replica, so that they see
+	// every write already committed, such as the caller's own checkout.
+	WithConsistentReads() LibraryService
+
+	CreateBranch(name, timezone string) (*models.Branch, error)
+	ListBranches() ([]models.Branch, error)
+	GetBranchCalendar(branchID uuid.UUID, from, to time.Time) (*BranchCalendar, error)
+	SetOpeningHours(branchID uuid.UUID, hours []models.OpeningHours) ([]models.OpeningHours, error)
+	AddClosure(branchID uuid.UUID, date time.Time, reason string) (*models.Closure, error)
+	DeleteClosure(branchID uuid.UUID, date time.Time) error
+	ImportClosures(branchID uuid.UUID, ical io.Reader) (int, error)
+	AssignCopyBranch(copyID uuid.UUID, branchID *uuid.UUID, ifVersion int) (*models.BookCopy, error)
+
+	CreateTerm(name string, start, end time.Time) (*models.Term, error)
+	ListTerms() ([]models.Term, error)
+	UpdateTerm(termID uuid.UUID, name string, start, end time.Time) (*models.Term, error)
+	DeleteTerm(termID uuid.UUID) error
+	TermEndReport(termID *uuid.UUID) (*TermEndReport, error)
+
+	CreateCourse(code, title string, termID *uuid.UUID) (*models.Course, error)
+	ListCourses() ([]models.Course, error)
+	DeleteCourse(courseID uuid.UUID) error
+	CreateReadingList(courseID uuid.UUID, title string) (*models.ReadingList, error)
+	ListReadingLists(courseID uuid.UUID) ([]models.ReadingList, error)
+	GetReadingList(listID uuid.UUID) (*ReadingListDetail, error)
+	SetReadingListEntries(listID uuid.UUID, entries []models.ReadingListEntry) (*ReadingListDetail, error)
+	DeleteReadingList(listID uuid.UUID) error
+	ReadingListAvailability(listID uuid.UUID) (*ReadingListAvailability, error)
+	ReserveReadingList(listID uuid.UUID, loanType models.LoanType, loanHours int) (*CourseReserveResult, error)
+
+	FindCopy(item string) (*models.BookCopy, error)
+	CheckoutCopy(copyID, userID uuid.UUID) (*models.Checkout, error)
+	GetActiveCheckout(copyID uuid.UUID) (*models.Checkout, error)
+	GetPatronAccount(userID uuid.UUID) (*PatronAccount, error)
+	PayFines(userID uuid.UUID, amount int, reference string) (*models.Payment, error)
 }
 
 // ─── Implementation ───────────────────────────────────────────────────────────
 
 type libraryService struct {
-	db              *gorm.DB
+	txm             repositories.Transactor
+	runner          *repositories.TxRunner
+	clock           clock.Clock
+	policy          Policy
 	userRepo        repositories.UserRepository
 	bookRepo        repositories.BookRepository
 	bookCopyRepo    repositories.BookCopyRepository
 	checkoutRepo    repositories.CheckoutRepository
 	reservationRepo repositories.ReservationRepository
+	branchRepo      repositories.BranchRepository
+	termRepo        repositories.TermRepository
+	courseRepo      repositories.CourseRepository
+	paymentRepo     repositories.PaymentRepository
+
+	// consistentReads keeps list and report queries off read replicas.
+	consistentReads bool
 }
 
 // NewLibraryService wires up all dependencies and returns a LibraryService.
+// Every timestamp the service records or compares against — checkout and due
+// dates, returns, fines, report cut-offs — is read from clk.
 func NewLibraryService(
-	db *gorm.DB,
+	txm repositories.Transactor,
+	clk clock.Clock,
+	policy Policy,
 	userRepo repositories.UserRepository,
 	bookRepo repositories.BookRepository,
 	bookCopyRepo repositories.BookCopyRepository,
 	checkoutRepo repositories.CheckoutRepository,
 	reservationRepo repositories.ReservationRepository,
+	branchRepo repositories.BranchRepository,
+	termRepo repositories.TermRepository,
+	courseRepo repositories.CourseRepository,
+	paymentRepo repositories.PaymentRepository,
 ) LibraryService {
 	return &libraryService{
-		db:              db,
+		txm:             txm,
+		runner:          repositories.NewTxRunner(txm, policy.TxRetry),
+		clock:           clk,
+		policy:          policy,
 		userRepo:        userRepo,
 		bookRepo:        bookRepo,
 		bookCopyRepo:    bookCopyRepo,
 		checkoutRepo:    checkoutRepo,
 		reservationRepo: reservationRepo,
+		branchRepo:      branchRepo,
+		termRepo:        termRepo,
+		courseRepo:      courseRepo,
+		paymentRepo:     paymentRepo,
 	}
 }
 
+// ─── User Management ──────────────────────────────────────────────────────────
+
+// CreateUser registers a new STUDENT or LIBRARIAN.
+func (s *libraryService) CreateUser(name string, role models.UserRole) (*models.User, error) {
+	if role != models.UserRoleStudent && role != models.UserRoleLibrarian {
+		return nil, ErrInvalidRole
+	}
+	user := &models.User{Name: name, Role: role}
+	if err := s.userRepo.Create(nil, user); err != nil {
+		log.Printf("[ERROR] CreateUser: failed to create user %q: %v", name, err)
+		return nil, err
+	}
+	log.Printf("[INFO] CreateUser: created %s %q (id=%s)", role, name, user.ID)
+	return user, nil
+}
+
+// GetUser returns a single user.
+func (s *libraryService) GetUser(userID uuid.UUID) (*models.User, error) {
+	user, err := s.userRepo.GetByID(nil, userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// ListUsers returns all users ordered by name.
+func (s *libraryService) ListUsers() ([]models.User, error) {
+	return s.userRepo.List(s.reads())
+}
+
 // ─── Book Management ──────────────────────────────────────────────────────────
 
 // CreateBook creates a book record together with the requested number of physical copies,
@@ -107,72 +497,114 @@ func (s *libraryService) CreateBook(title, author string, totalCopies int) (*mod
 		Title:       title,
 		Author:      author,
 		TotalCopies: 0,
+		LoanType:    models.LoanTypeStandard,
 	}
 
-	err := s.db.Transaction(func(tx *gorm.DB) error {
-		if err := s.bookRepo.Create(tx, book); err != nil {
-			log.Printf("[ERROR] CreateBook: failed to create book record: %v", err)
-			return err
-		}
-		for i := 0; i < totalCopies; i++ {
-			copy := &models.BookCopy{
-				BookID: book.ID,
-				Status: models.BookCopyStatusAvailable,
-			}
-			if err := s.bookCopyRepo.Create(tx, copy); err != nil {
-				log.Printf("[ERROR] CreateBook: failed to create book copy %d: %v", i+1, err)
-				return err
-			}
-		}
-		if err := s.bookRepo.IncrementTotalCopies(tx, book.ID, totalCopies); err != nil {
-			log.Printf("[ERROR] CreateBook: failed to increment total_copies: %v", err)
-			return err
-		}
-		return nil
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		return s.insertBook(tx, book, make([]models.BookCopy, totalCopies))
 	})
 	if err != nil {
+		log.Printf("[ERROR] CreateBook: failed to create book %q: %v", title, err)
 		return nil, err
 	}
-	book.TotalCopies = totalCopies
 	log.Printf("[INFO] CreateBook: created book %q (id=%s) with %d copies", book.Title, book.ID, totalCopies)
 	return book, nil
 }
 
 // AddBookCopy adds a single physical copy to an existing book, updating total_copies atomically.
 func (s *libraryService) AddBookCopy(bookID uuid.UUID) (*models.BookCopy, error) {
+	copies, err := s.AddBookCopies(bookID, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &copies[0], nil
+}
+
+// AddBookCopies adds count physical copies to an existing book in one transaction,
+// updating total_copies by the same amount.
+func (s *libraryService) AddBookCopies(bookID uuid.UUID, count int) ([]models.BookCopy, error) {
+	if count < 1 {
+		return nil, ErrInvalidCopyCount
+	}
+
 	// Validate book exists before opening a transaction.
 	if _, err := s.bookRepo.GetByID(nil, bookID); err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, repositories.ErrNotFound) {
 			return nil, ErrBookNotFound
 		}
 		return nil, err
 	}
 
-	copy := &models.BookCopy{
-		BookID: bookID,
-		Status: models.BookCopyStatusAvailable,
-	}
-	err := s.db.Transaction(func(tx *gorm.DB) error {
-		if err := s.bookCopyRepo.Create(tx, copy); err != nil {
-			log.Printf("[ERROR] AddBookCopy: failed to create copy for book %s: %v", bookID, err)
-			return err
+	copies := make([]models.BookCopy, count)
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		for i := range copies {
+			copies[i] = models.BookCopy{
+				BookID: bookID,
+				Status: models.BookCopyStatusAvailable,
+			}
+			if err := s.bookCopyRepo.Create(tx, &copies[i]); err != nil {
+				log.Printf("[ERROR] AddBookCopies: failed to create copy %d for book %s: %v", i+1, bookID, err)
+				return err
+			}
 		}
-		if err := s.bookRepo.IncrementTotalCopies(tx, bookID, 1); err != nil {
-			log.Printf("[ERROR] AddBookCopy: failed to increment total_copies for book %s: %v", bookID, err)
+		if err := s.bookRepo.IncrementTotalCopies(tx, bookID, count); err != nil {
+			log.Printf("[ERROR] AddBookCopies: failed to increment total_copies for book %s: %v", bookID, err)
 			return err
 		}
-		return nil
+		return s.bookRepo.AdjustAvailability(tx, bookID, repositories.Availability{Available: count})
 	})
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("[INFO] AddBookCopy: added copy %s for book %s", copy.ID, bookID)
-	return copy, nil
+	log.Printf("[INFO] AddBookCopies: added %d copies for book %s", count, bookID)
+	return copies, nil
 }
 
 // ListBooks returns all books in the catalogue.
 func (s *libraryService) ListBooks() ([]models.Book, error) {
-	return s.bookRepo.List(nil)
+	return s.bookRepo.List(s.reads())
+}
+
+// SetBookLoanType changes how long copies of a book may be kept: a STANDARD
+// loan of Policy.LoanPeriodDays, a SHORT loan of loanHours, or an OVERNIGHT
+// loan until the branch next opens. Running loans keep their due date; the new
+// rules apply from their next renewal. The type is set indefinitely, replacing
+// any course reserve period (see ReserveReadingList). A non-zero ifVersion
+// must be the book's current version.
+func (s *libraryService) SetBookLoanType(bookID uuid.UUID, loanType models.LoanType, loanHours, ifVersion int) (*models.Book, error) {
+	switch loanType {
+	case models.LoanTypeShort:
+		if loanHours < 1 || loanHours > MaxShortLoanHours {
+			return nil, ErrInvalidLoanType
+		}
+	case models.LoanTypeStandard, models.LoanTypeOvernight:
+		if loanHours != 0 {
+			return nil, ErrInvalidLoanType
+		}
+	default:
+		return nil, ErrInvalidLoanType
+	}
+
+	var book *models.Book
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		current, err := s.getBookForUpdate(tx, bookID)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(current.Version, ifVersion); err != nil {
+			return err
+		}
+		if err := s.bookRepo.SetLoanType(tx, bookID, loanType, loanHours, nil); err != nil {
+			return err
+		}
+		book, err = s.bookRepo.GetByID(tx, bookID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] SetBookLoanType: book %s is now %s (hours=%d)", bookID, loanType, loanHours)
+	return book, nil
 }
 
 // ─── Checkout ─────────────────────────────────────────────────────────────────
@@ -180,95 +612,143 @@ func (s *libraryService) ListBooks() ([]models.Book, error) {
 // CheckoutBook implements the transactional checkout flow.
 //
 // Happy path: an available copy exists → it is locked (SELECT FOR UPDATE), marked
-// CHECKED_OUT, and a Checkout record is created (14-day loan period).
+// CHECKED_OUT, and a Checkout record is created (14-day loan period, rolled
+// forward to the next day the copy's branch is open and, for students, capped
+// at the end of the current term).
 //
-// No-copy path: all copies are out → a Reservation is inserted in the queue.
+// No-copy path: all copies are out → a Reservation is inserted in the queue and
+// returned with its estimated availability.
+//
+// Held-copy path: users are queued while a copy is on the shelf → only the head
+// of the queue may take it, which fulfils their reservation. Anyone else not
+// yet queued is queued; anyone queued behind the head gets ErrCopyOnHold.
 // Returns (checkout, nil, nil) or (nil, reservation, nil). Any other error is surfaced
 // as (nil, nil, err).
-func (s *libraryService) CheckoutBook(bookID, userID uuid.UUID) (*models.Checkout, *models.Reservation, error) {
+//
+// The transaction runs at Policy.CirculationIsolation and is re-run from the
+// start after a serialization failure or deadlock (see runCirculation).
+func (s *libraryService) CheckoutBook(bookID, userID uuid.UUID) (*models.Checkout, *QueuedReservation, error) {
 	var resultCheckout *models.Checkout
-	var resultReservation *models.Reservation
+	var resultReservation *QueuedReservation
+
+	err := s.runCirculation("checkout", func(tx repositories.Tx) error {
+		// A retried attempt must not report the previous attempt's result.
+		resultCheckout, resultReservation = nil, nil
 
-	err := s.db.Transaction(func(tx *gorm.DB) error {
 		// 1. Validate user exists.
-		if _, err := s.userRepo.GetByID(tx, userID); err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
+		user, err := s.userRepo.GetByID(tx, userID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
 				return ErrUserNotFound
 			}
 			return err
 		}
 
 		// 2. Validate book exists.
-		if _, err := s.bookRepo.GetByID(tx, bookID); err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return ErrBookNotFound
-			}
+		book, err := s.getBook(tx, bookID)
+		if err != nil {
 			return err
 		}
 
-		// 3. Try to lock an available copy (SELECT … FOR UPDATE).
-		copy, err := s.bookCopyRepo.FindAvailableForUpdate(tx, bookID)
-		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				// No copies available — fall through to reservation logic.
-				log.Printf("[INFO] CheckoutBook: no available copies for book %s, checking reservations for user %s", bookID, userID)
-
-				// Check if user already has a reservation for this book.
-				existing, err := s.reservationRepo.GetByBookAndUser(tx, bookID, userID)
-				if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-					return err
-				}
-				if existing != nil {
-					log.Printf("[WARN] CheckoutBook: user %s already has reservation %s for book %s", userID, existing.ID, bookID)
-					return ErrDuplicateReservation
-				}
+		// 3. Try to lock an available copy (see claimAvailableCopy).
+		copy, err := s.claimAvailableCopy(tx, bookID)
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			return err
+		}
 
-				// Create a new reservation with retry on queue_position collision.
-				res, err := s.createReservationWithRetry(tx, bookID, userID)
-				if err != nil {
-					log.Printf("[ERROR] CheckoutBook: failed to create reservation for user %s / book %s: %v", userID, bookID, err)
-					return err
+		// A copy on the shelf while users are queued, because auto-checkout
+		// is disabled or a copy was added since, is held for the head of the
+		// queue, as in CheckoutCopy. The head's checkout fulfils their
+		// reservation; anyone else joins the queue.
+		held := false
+		if copy != nil {
+			head, err := s.reservationRepo.GetNextForBook(tx, bookID)
+			if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+				return err
+			}
+			if err == nil && head != nil {
+				if head.UserID != userID {
+					log.Printf("[INFO] CheckoutBook: copy %s is held for reservation %s (user %s)", copy.ID, head.ID, head.UserID)
+					copy, held = nil, true
+				} else {
+					if err := s.reservationRepo.Dequeue(tx, head.ID); err != nil {
+						return err
+					}
+					if err := s.bookRepo.AdjustAvailability(tx, bookID, repositories.Availability{Holds: -1}); err != nil {
+						return err
+					}
+					log.Printf("[INFO] CheckoutBook: reservation %s fulfilled by copy %s", head.ID, copy.ID)
 				}
-				log.Printf("[INFO] CheckoutBook: reservation created for user %s / book %s at queue position %d (id=%s)", userID, bookID, res.QueuePosition, res.ID)
-				resultReservation = res
-				return ErrNoAvailableCopy
 			}
-			return err
 		}
 
-		// 4. Mark copy as CHECKED_OUT.
-		if err := s.bookCopyRepo.UpdateStatus(tx, copy.ID, models.BookCopyStatusCheckedOut); err != nil {
-			log.Printf("[ERROR] CheckoutBook: failed to mark copy %s as CHECKED_OUT: %v", copy.ID, err)
-			return err
-		}
+		if copy == nil {
+			if !s.policy.ReservationsEnabled {
+				log.Printf("[INFO] CheckoutBook: no available copies for book %s and reservations are disabled", bookID)
+				return ErrReservationsDisabled
+			}
 
-		// 5. Create the Checkout record.
-		now := time.Now().UTC()
-		due := now.AddDate(0, 0, LoanPeriodDays)
+			// No copies available — fall through to reservation logic.
+			log.Printf("[INFO] CheckoutBook: no available copies for book %s, checking reservations for user %s", bookID, userID)
 
-		checkout := &models.Checkout{
-			BookCopyID: copy.ID,
-			UserID:     userID,
-			CheckoutAt: now,
-			DueDate:    due,
-			FineAmount: 0,
+			// Check if user already has a reservation for this book. A user
+			// queued behind someone else for a held copy is told so.
+			existing, err := s.reservationRepo.GetByBookAndUser(tx, bookID, userID)
+			if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+				return err
+			}
+			if existing != nil && held {
+				return ErrCopyOnHold
+			}
+			if existing != nil {
+				log.Printf("[WARN] CheckoutBook: user %s already has reservation %s for book %s", userID, existing.ID, bookID)
+				return ErrDuplicateReservation
+			}
+
+			// Append a reservation to the queue (see createReservation).
+			res, err := s.createReservation(tx, bookID, userID)
+			if err != nil {
+				log.Printf("[ERROR] CheckoutBook: failed to create reservation for user %s / book %s: %v", userID, bookID, err)
+				return err
+			}
+			log.Printf("[INFO] CheckoutBook: reservation created for user %s / book %s at queue position %d (id=%s)", userID, bookID, res.QueuePosition, res.ID)
+			if err := s.bookRepo.AdjustAvailability(tx, bookID, repositories.Availability{Holds: 1}); err != nil {
+				return err
+			}
+			queue, err := s.reservationRepo.ListByBook(tx, bookID)
+			if err != nil {
+				return err
+			}
+			estimates, err := s.estimateQueue(tx, book, queue)
+			if err != nil {
+				return err
+			}
+			resultReservation = &QueuedReservation{Reservation: *res}
+			if i := slices.IndexFunc(queue, func(q models.Reservation) bool { return q.ID == res.ID }); i >= 0 {
+				resultReservation = &estimates[i]
+			}
+			// Commit: the reservation must persist. Returning an error here would roll it back.
+			return nil
 		}
-		if err := s.checkoutRepo.Create(tx, checkout); err != nil {
-			log.Printf("[ERROR] CheckoutBook: failed to create checkout record: %v", err)
+
+		// 4. Mark the copy CHECKED_OUT and create the Checkout record.
+		checkout, err := s.lendCopy(tx, copy, book, user)
+		if err != nil {
+			log.Printf("[ERROR] CheckoutBook: failed to lend copy %s: %v", copy.ID, err)
 			return err
 		}
 		resultCheckout = checkout
-		log.Printf("[INFO] CheckoutBook: checkout created (id=%s) for user %s / copy %s, due %s", checkout.ID, userID, copy.ID, due.Format("2006-01-02"))
+		log.Printf("[INFO] CheckoutBook: %s checkout created (id=%s) for user %s / copy %s, due %s", checkout.LoanType, checkout.ID, userID, copy.ID, checkout.DueDate.Format(time.RFC3339))
 		return nil
 	})
 
 	if err != nil {
-		if errors.Is(err, ErrNoAvailableCopy) {
-			return nil, resultReservation, nil
-		}
 		log.Printf("[ERROR] CheckoutBook: transaction failed for book %s / user %s: %v", bookID, userID, err)
 		return nil, nil, err
 	}
+	if resultReservation != nil {
+		return nil, resultReservation, nil
+	}
 	return resultCheckout, nil, nil
 }
 
@@ -282,16 +762,20 @@ func (s *libraryService) CheckoutBook(bookID, userID uuid.UUID) (*models.Checkou
 //  3. Calculate fine (see calculateFine).
 //  4. Mark checkout as returned.
 //  5. Mark BookCopy AVAILABLE.
-//  6. If a reservation exists for that book, immediately convert it to a new checkout.
+//  6. If a reservation exists for that book, immediately convert it to a new checkout
+//     and move the rest of the queue up one place.
 //  7. Return the updated Checkout.
+//
+// Like CheckoutBook, the transaction runs at Policy.CirculationIsolation and is
+// re-run from step 1 after a serialization failure or deadlock.
 func (s *libraryService) ReturnCheckout(checkoutID uuid.UUID) (*models.Checkout, error) {
 	var updated *models.Checkout
 
-	err := s.db.Transaction(func(tx *gorm.DB) error {
+	err := s.runCirculation("return", func(tx repositories.Tx) error {
 		// Lock the checkout row to prevent concurrent double-returns.
 		checkout, err := s.checkoutRepo.GetByIDForUpdate(tx, checkoutID)
 		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
+			if errors.Is(err, repositories.ErrNotFound) {
 				return ErrCheckoutNotFound
 			}
 			return err
@@ -303,8 +787,13 @@ func (s *libraryService) ReturnCheckout(checkoutID uuid.UUID) (*models.Checkout,
 			return ErrCheckoutAlreadyReturned
 		}
 
-		now := time.Now().UTC()
-		fine := calculateFine(checkout.DueDate, now)
+		now := s.now()
+		cals := s.newCalendars(tx, checkout.DueDate, now)
+		cal, err := cals.forCopy(&checkout.BookCopy)
+		if err != nil {
+			return err
+		}
+		_, fine := s.fine(cal, checkout.LoanType, checkout.DueDate, now)
 		log.Printf("[INFO] ReturnCheckout: returning checkout %s (copy=%s, user=%s), fine=%d", checkoutID, checkout.BookCopyID, checkout.UserID, fine)
 
 		// Mark as returned.
@@ -321,39 +810,59 @@ func (s *libraryService) ReturnCheckout(checkoutID uuid.UUID) (*models.Checkout,
 
 		// BookCopy must be preloaded (done by GetByIDForUpdate) to access BookID.
 		bookID := checkout.BookCopy.BookID
+		if err := s.bookRepo.AdjustAvailability(tx, bookID, repositories.Availability{Available: 1, CheckedOut: -1}); err != nil {
+			return err
+		}
 
 		// Check for waiting reservation.
 		res, err := s.reservationRepo.GetNextForBook(tx, bookID)
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
 			log.Printf("[ERROR] ReturnCheckout: failed to query reservations for book %s: %v", bookID, err)
 			return err
 		}
 
-		if err == nil && res != nil {
+		if err == nil && res != nil && !s.policy.AutoCheckoutOnReturn {
+			log.Printf("[INFO] ReturnCheckout: reservation %s is waiting but auto-checkout is disabled; copy %s left AVAILABLE", res.ID, checkout.BookCopyID)
+		} else if err == nil && res != nil {
 			log.Printf("[INFO] ReturnCheckout: reservation found (id=%s, user=%s, pos=%d), auto-converting to checkout", res.ID, res.UserID, res.QueuePosition)
 
 			// Immediately re-assign the copy to the next reserved user.
 			if err := s.bookCopyRepo.UpdateStatus(tx, checkout.BookCopyID, models.BookCopyStatusCheckedOut); err != nil {
 				return err
 			}
-			if err := s.reservationRepo.Delete(tx, res.ID); err != nil {
+			if err := s.reservationRepo.Dequeue(tx, res.ID); err != nil {
+				return err
+			}
+			if err := s.bookRepo.AdjustAvailability(tx, bookID, repositories.Availability{Available: -1, CheckedOut: 1, Holds: -1}); err != nil {
 				return err
 			}
 
-			now2 := time.Now().UTC()
-			due2 := now2.AddDate(0, 0, LoanPeriodDays)
+			borrower, err := s.userRepo.GetByID(tx, res.UserID)
+			if err != nil {
+				return err
+			}
+			book, err := s.bookRepo.GetByID(tx, bookID)
+			if err != nil {
+				return err
+			}
+			now2 := s.now()
+			due2, err := s.loanDueDate(tx, cal, book, borrower, now2)
+			if err != nil {
+				return err
+			}
 			newCheckout := &models.Checkout{
 				BookCopyID: checkout.BookCopyID,
 				UserID:     res.UserID,
 				CheckoutAt: now2,
 				DueDate:    due2,
 				FineAmount: 0,
+				LoanType:   loanType(book, now2),
 			}
 			if err := s.checkoutRepo.Create(tx, newCheckout); err != nil {
 				log.Printf("[ERROR] ReturnCheckout: failed to create auto-checkout for user %s: %v", res.UserID, err)
 				return err
 			}
-			log.Printf("[INFO] ReturnCheckout: auto-checkout created (id=%s) for reserved user %s, due %s", newCheckout.ID, res.UserID, due2.Format("2006-01-02"))
+			log.Printf("[INFO] ReturnCheckout: auto-checkout created (id=%s) for reserved user %s, due %s", newCheckout.ID, res.UserID, due2.Format(time.RFC3339))
 		}
 
 		// Reload updated checkout to reflect returned_at and fine_amount.
@@ -372,64 +881,409 @@ func (s *libraryService) ReturnCheckout(checkoutID uuid.UUID) (*models.Checkout,
 	return updated, nil
 }
 
+// ─── Renewal ──────────────────────────────────────────────────────────────────
+
+// RenewCheckout extends an active checkout by a new loan period counted from
+// now, with the same loan type, branch calendar and term-end rules as
+// CheckoutBook. The loan type is the book's current one.
+//
+// A checkout cannot be renewed once it is overdue, after Policy.MaxRenewals
+// renewals, while other users are queued for the book, or when the new due
+// date would not be later than the current one.
+func (s *libraryService) RenewCheckout(checkoutID uuid.UUID) (*models.Checkout, error) {
+	var renewed *models.Checkout
+
+	err := s.txm.Transaction(func(tx repositories.Tx) error {
+		checkout, err := s.checkoutRepo.GetByIDForUpdate(tx, checkoutID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
+				return ErrCheckoutNotFound
+			}
+			return err
+		}
+		if checkout.ReturnedAt != nil {
+			return ErrCheckoutAlreadyReturned
+		}
+
+		now := s.now()
+		if now.After(checkout.DueDate) {
+			return ErrCheckoutOverdue
+		}
+		if checkout.Renewals >= s.policy.MaxRenewals {
+			return ErrRenewalLimitReached
+		}
+
+		res, err := s.reservationRepo.GetNextForBook(tx, checkout.BookCopy.BookID)
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			return err
+		}
+		if err == nil && res != nil {
+			log.Printf("[INFO] RenewCheckout: checkout %s not renewed, reservation %s is waiting", checkoutID, res.ID)
+			return ErrRenewalBlocked
+		}
+
+		user, err := s.userRepo.GetByID(tx, checkout.UserID)
+		if err != nil {
+			return err
+		}
+		book, err := s.bookRepo.GetByID(tx, checkout.BookCopy.BookID)
+		if err != nil {
+			return err
+		}
+		cal, err := s.newCalendars(tx, now, now).forCopy(&checkout.BookCopy)
+		if err != nil {
+			return err
+		}
+		due, err := s.loanDueDate(tx, cal, book, user, now)
+		if err != nil {
+			return err
+		}
+		if !due.After(checkout.DueDate) {
+			return ErrRenewalNotExtended
+		}
+
+		if err := s.checkoutRepo.Renew(tx, checkoutID, due, loanType(book, now)); err != nil {
+			log.Printf("[ERROR] RenewCheckout: failed to renew checkout %s: %v", checkoutID, err)
+			return err
+		}
+		reloaded, err := s.checkoutRepo.GetByIDForUpdate(tx, checkoutID)
+		if err != nil {
+			return err
+		}
+		renewed = reloaded
+		log.Printf("[INFO] RenewCheckout: checkout %s renewed (%d/%d), due %s", checkoutID, renewed.Renewals, s.policy.MaxRenewals, due.Format(time.RFC3339))
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("[ERROR] RenewCheckout: transaction failed for checkout %s: %v", checkoutID, err)
+		return nil, err
+	}
+	return renewed, nil
+}
+
 // ─── Queries ──────────────────────────────────────────────────────────────────
 
 // ListUserCheckouts returns all checkout records (active and past) for a user.
 func (s *libraryService) ListUserCheckouts(userID uuid.UUID) ([]models.Checkout, error) {
-	return s.checkoutRepo.ListByUser(nil, userID)
+	return s.checkoutRepo.ListByUser(s.reads(), userID)
+}
+
+// ListReservationsForBook returns all current reservations for a book, ordered by queue_position,
+// each with its estimated availability.
+func (s *libraryService) ListReservationsForBook(bookID uuid.UUID) ([]QueuedReservation, error) {
+	rd := s.reads()
+	book, err := s.getBook(rd, bookID)
+	if err != nil {
+		return nil, err
+	}
+	queue, err := s.reservationRepo.ListByBook(rd, bookID)
+	if err != nil {
+		return nil, err
+	}
+	return s.estimateQueue(rd, book, queue)
+}
+
+// ─── Read Routing ─────────────────────────────────────────────────────────────
+
+func (s *libraryService) WithConsistentReads() LibraryService {
+	c := *s
+	c.consistentReads = true
+	return &c
+}
+
+// reads returns the handle list and report queries run on outside a
+// transaction: a read replica when one is configured and the caller has not
+// asked for consistent reads, otherwise nil for the primary. A call making
+// several queries takes one handle for all of them, so that they see a
+// single replica's state.
+func (s *libraryService) reads() repositories.Tx {
+	if s.consistentReads {
+		return nil
+	}
+	return s.txm.ReadOnly()
+}
+
+// ─── Reports & Maintenance ────────────────────────────────────────────────────
+
+// ListOverdueCheckouts returns every active checkout past its due date, oldest
+// due date first, with the fine that would be charged on return right now.
+func (s *libraryService) ListOverdueCheckouts() ([]OverdueCheckout, error) {
+	now := s.now()
+	rd := s.reads()
+	checkouts, err := s.checkoutRepo.ListOverdue(rd, now)
+	if err != nil {
+		return nil, err
+	}
+	report := make([]OverdueCheckout, 0, len(checkouts))
+	if len(checkouts) == 0 {
+		return report, nil
+	}
+	// Checkouts come oldest due date first, so one closure window covers all.
+	cals := s.newCalendars(rd, checkouts[0].DueDate, now)
+	for _, c := range checkouts {
+		cal, err := cals.forCopy(&c.BookCopy)
+		if err != nil {
+			return nil, err
+		}
+		late, fine := s.fine(cal, c.LoanType, c.DueDate, now)
+		o := OverdueCheckout{Checkout: c, AccruedFine: fine}
+		if hourly(c.LoanType) {
+			o.HoursOverdue = late
+		} else {
+			o.DaysOverdue = late
+		}
+		report = append(report, o)
+	}
+	return report, nil
 }
 
-// ListReservationsForBook returns all current reservations for a book, ordered by queue_position.
-func (s *libraryService) ListReservationsForBook(bookID uuid.UUID) ([]models.Reservation, error) {
-	return s.reservationRepo.ListByBook(nil, bookID)
+// RecomputeFines recalculates fine_amount under the current policy and branch
+// calendars for the returned checkouts in scope and stores the ones that
+// changed. Checkouts are read and written in transactions of
+// FineRecomputeBatchSize, so a recompute of the whole table never holds it
+// all in memory. A fine returned at or before the user's last payment is
+// taken as settled and left as it was; its change is reported with Settled
+// set, so that the balance delta can be dealt with by hand. A dry run
+// reports every change without writing any.
+func (s *libraryService) RecomputeFines(scope FineScope) (*FineRecompute, error) {
+	result := &FineRecompute{DryRun: scope.DryRun, Changes: []FineChange{}}
+	filter := repositories.ReturnedFilter{CheckoutID: scope.CheckoutID, UserID: scope.UserID, Since: scope.ReturnedSince}
+	after := uuid.Nil
+	for {
+		var batch []FineChange
+		var last uuid.UUID
+		var n int
+		err := s.txm.Transaction(func(tx repositories.Tx) error {
+			batch, n = nil, 0
+			checkouts, err := s.checkoutRepo.ListReturned(tx, filter, after, FineRecomputeBatchSize)
+			if err != nil || len(checkouts) == 0 {
+				return err
+			}
+			n, last = len(checkouts), checkouts[len(checkouts)-1].ID
+			from, to := checkouts[0].DueDate, *checkouts[0].ReturnedAt
+			users := map[uuid.UUID]bool{}
+			var userIDs []uuid.UUID
+			for _, c := range checkouts {
+				if c.DueDate.Before(from) {
+					from = c.DueDate
+				}
+				if c.ReturnedAt.After(to) {
+					to = *c.ReturnedAt
+				}
+				if !users[c.UserID] {
+					users[c.UserID] = true
+					userIDs = append(userIDs, c.UserID)
+				}
+			}
+			paid, err := s.paymentRepo.LastPaidAt(tx, userIDs)
+			if err != nil {
+				return err
+			}
+			cals := s.newCalendars(tx, from, to)
+			for _, c := range checkouts {
+				cal, err := cals.forCopy(&c.BookCopy)
+				if err != nil {
+					return err
+				}
+				_, fine := s.fine(cal, c.LoanType, c.DueDate, *c.ReturnedAt)
+				if fine == c.FineAmount {
+					continue
+				}
+				change := FineChange{CheckoutID: c.ID, UserID: c.UserID, OldFine: c.FineAmount, NewFine: fine, Delta: fine - c.FineAmount}
+				if at, ok := paid[c.UserID]; ok && c.FineAmount > 0 && !c.ReturnedAt.After(at) {
+					change.Settled = true
+				} else if !scope.DryRun {
+					if err := s.checkoutRepo.UpdateFine(tx, c.ID, fine); err != nil {
+						log.Printf("[ERROR] RecomputeFines: failed to update fine for checkout %s: %v", c.ID, err)
+						return err
+					}
+					log.Printf("[INFO] RecomputeFines: checkout %s fine %d -> %d", c.ID, c.FineAmount, fine)
+				}
+				batch = append(batch, change)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range batch {
+			if change.Settled {
+				result.Settled++
+			} else if !scope.DryRun {
+				result.Updated++
+			}
+			result.Changes = append(result.Changes, change)
+		}
+		if n < FineRecomputeBatchSize {
+			break
+		}
+		after = last
+	}
+	log.Printf("[INFO] RecomputeFines: %d checkout(s) updated, %d settled, %d change(s), dry run %t",
+		result.Updated, result.Settled, len(result.Changes), scope.DryRun)
+	return result, nil
 }
 
 // ─── Internal Helpers ─────────────────────────────────────────────────────────
 
-// createReservationWithRetry inserts a Reservation into the queue for the given book/user.
-// If a unique-constraint violation occurs on (book_id, queue_position) — possible under
-// concurrent load — the queue position is recalculated and the insert is retried once.
-func (s *libraryService) createReservationWithRetry(tx *gorm.DB, bookID, userID uuid.UUID) (*models.Reservation, error) {
-	nextPos, err := s.reservationRepo.GetNextQueuePosition(tx, bookID)
+// lendCopy marks copy CHECKED_OUT and creates user's checkout of it, due
+// according to the book's loan type and the copy's branch calendar.
+func (s *libraryService) lendCopy(tx repositories.Tx, copy *models.BookCopy, book *models.Book, user *models.User) (*models.Checkout, error) {
+	if err := s.bookCopyRepo.UpdateStatus(tx, copy.ID, models.BookCopyStatusCheckedOut); err != nil {
+		return nil, err
+	}
+	if err := s.bookRepo.AdjustAvailability(tx, copy.BookID, repositories.Availability{Available: -1, CheckedOut: 1}); err != nil {
+		return nil, err
+	}
+	now := s.now()
+	cal, err := s.newCalendars(tx, now, now).forCopy(copy)
+	if err != nil {
+		return nil, err
+	}
+	due, err := s.loanDueDate(tx, cal, book, user, now)
+	if err != nil {
+		return nil, err
+	}
+	checkout := &models.Checkout{
+		BookCopyID: copy.ID,
+		UserID:     user.ID,
+		CheckoutAt: now,
+		DueDate:    due,
+		FineAmount: 0,
+		LoanType:   loanType(book, now),
+	}
+	if err := s.checkoutRepo.Create(tx, checkout); err != nil {
+		return nil, err
+	}
+	return checkout, nil
+}
+
+// now returns the service clock's current time in UTC.
+func (s *libraryService) now() time.Time {
+	return s.clock.Now().UTC()
+}
+
+// insertBook creates book inside tx with one AVAILABLE copy per element of
+// copies, keeping their barcodes and branches, and sets book.TotalCopies and
+// book.AvailableCopies.
+func (s *libraryService) insertBook(tx repositories.Tx, book *models.Book, copies []models.BookCopy) error {
+	book.TotalCopies = 0
+	if err := s.bookRepo.Create(tx, book); err != nil {
+		return err
+	}
+	for i := range copies {
+		copies[i].BookID = book.ID
+		copies[i].Status = models.BookCopyStatusAvailable
+		if err := s.bookCopyRepo.Create(tx, &copies[i]); err != nil {
+			return fmt.Errorf("copy %d: %w", i+1, err)
+		}
+	}
+	if err := s.bookRepo.IncrementTotalCopies(tx, book.ID, len(copies)); err != nil {
+		return err
+	}
+	if err := s.bookRepo.AdjustAvailability(tx, book.ID, repositories.Availability{Available: len(copies)}); err != nil {
+		return err
+	}
+	book.TotalCopies = len(copies)
+	book.AvailableCopies = len(copies)
+	return nil
+}
+
+func (s *libraryService) getBook(tx repositories.Tx, bookID uuid.UUID) (*models.Book, error) {
+	book, err := s.bookRepo.GetByID(tx, bookID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrBookNotFound
+		}
+		return nil, err
+	}
+	return book, nil
+}
+
+// getBookForUpdate is getBook with the book row locked until tx ends.
+func (s *libraryService) getBookForUpdate(tx repositories.Tx, bookID uuid.UUID) (*models.Book, error) {
+	book, err := s.bookRepo.GetByIDForUpdate(tx, bookID)
 	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrBookNotFound
+		}
 		return nil, err
 	}
+	return book, nil
+}
 
+// checkVersion returns ErrVersionMismatch unless ifVersion is 0, meaning
+// any version, or the record's current version. The caller must hold the
+// record's row lock, so that the version cannot move before the edit.
+func checkVersion(current, ifVersion int) error {
+	if ifVersion != 0 && ifVersion != current {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// claimAvailableCopy locks an available copy of a book for checkout, or returns
+// ErrNotFound when none is available.
+//
+// With SkipLockedAllocation the first attempt uses SKIP LOCKED, so concurrent
+// checkouts of a popular book each take a different copy instead of queueing
+// on the lock of the lowest-ID one. An empty result there only means every
+// available copy was locked at that instant, so it falls back to the blocking
+// query: that waits for the holders to finish, re-checks the status of each
+// copy they released, and reports ErrNotFound only when no copy is available
+// at all — the case that should become a reservation.
+func (s *libraryService) claimAvailableCopy(tx repositories.Tx, bookID uuid.UUID) (*models.BookCopy, error) {
+	if s.policy.SkipLockedAllocation {
+		copy, err := s.bookCopyRepo.FindAvailableSkipLocked(tx, bookID)
+		if !errors.Is(err, repositories.ErrNotFound) {
+			return copy, err
+		}
+	}
+	return s.bookCopyRepo.FindAvailableForUpdate(tx, bookID)
+}
+
+// runCirculation runs a checkout, return or cancellation transaction at
+// Policy.CirculationIsolation, re-running it after serialization failures and
+// deadlocks as Policy.TxRetry allows. name labels it in TransactionStats.
+func (s *libraryService) runCirculation(name string, fn func(tx repositories.Tx) error) error {
+	return s.runner.Run(name, repositories.TxOptions{Isolation: s.policy.CirculationIsolation}, fn)
+}
+
+// TransactionStats reports how often circulation transactions have
+// been run and retried since the service started.
+func (s *libraryService) TransactionStats() []repositories.TxStats {
+	return s.runner.Stats()
+}
+
+// createReservation appends a Reservation for the user to the book's queue.
+// Two transactions appending at once can compute the same position; the
+// uniq_book_queue_position index rejects the second insert, which aborts its
+// transaction on PostgreSQL, so the collision is returned and runCirculation
+// runs the whole checkout again.
+func (s *libraryService) createReservation(tx repositories.Tx, bookID, userID uuid.UUID) (*models.Reservation, error) {
+	nextPos, err := s.reservationRepo.GetNextQueuePosition(tx, bookID)
+	if err != nil {
+		return nil, err
+	}
 	res := &models.Reservation{
 		BookID:        bookID,
 		UserID:        userID,
 		QueuePosition: nextPos,
-		CreatedAt:     time.Now().UTC(),
+		CreatedAt:     s.now(),
 	}
-
 	if err := s.reservationRepo.Create(tx, res); err != nil {
 		if isUniqueViolation(err) {
-			log.Printf("[WARN] createReservationWithRetry: queue_position collision at pos %d for book %s, retrying", nextPos, bookID)
-			// Another concurrent goroutine claimed our slot; recalculate and retry once.
-			nextPos, err = s.reservationRepo.GetNextQueuePosition(tx, bookID)
-			if err != nil {
-				return nil, err
-			}
-			res = &models.Reservation{
-				BookID:        bookID,
-				UserID:        userID,
-				QueuePosition: nextPos,
-				CreatedAt:     time.Now().UTC(),
-			}
-			if err := s.reservationRepo.Create(tx, res); err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
+			log.Printf("[WARN] createReservation: queue_position collision at pos %d for book %s", nextPos, bookID)
 		}
+		return nil, err
 	}
 	return res, nil
 }
 
-// isUniqueViolation checks whether a PostgreSQL unique-constraint error occurred.
-// PostgreSQL error code 23505 = unique_violation.
+// isUniqueViolation checks whether a repository reported a unique-constraint error.
 func isUniqueViolation(err error) bool {
-	return err != nil && strings.Contains(err.Error(), "23505")
+	return errors.Is(err, repositories.ErrUniqueViolation)
 }
 
 // ─── Fine Calculation ─────────────────────────────────────────────────────────
@@ -437,22 +1291,28 @@ func isUniqueViolation(err error) bool {
 // calculateFine computes the overdue fine for a returned book.
 //
 // Rules:
-//   - Loan period  : LoanPeriodDays (14 days) from checkout date.
-//   - Fine rate    : FinePerDay (10 currency units) per calendar day overdue.
-//   - Minimum fine : FinePerDay (i.e. at least 1 day) if any overdue time exists.
+//   - Loan period  : Policy.LoanPeriodDays (default 14 days) from checkout date.
+//   - Fine rate    : finePerDay (default FinePerDay, 10 currency units) per calendar day overdue.
+//   - Minimum fine : finePerDay (i.e. at least 1 day) if any overdue time exists.
 //   - No fine      : If returnedAt is on or before dueDate.
 //
 // Calculation uses calendar-day truncation (midnight UTC) to avoid penalising
 // users who return a book the same calendar day as the due date but after the
 // exact checkout time.
-func calculateFine(dueDate, returnedAt time.Time) int {
+func calculateFine(dueDate, returnedAt time.Time, finePerDay int) int {
+	return daysOverdue(dueDate, returnedAt) * finePerDay
+}
+
+// daysOverdue returns the number of chargeable calendar days between dueDate and
+// returnedAt under the rules described on calculateFine (0 if not overdue).
+func daysOverdue(dueDate, returnedAt time.Time) int {
 	// No fine if returned on time.
 	if !returnedAt.After(dueDate) {
 		return 0
 	}
 
 	// Truncate both timestamps to midnight UTC and compute full calendar days overdue.
-	dueMidnight      := dueDate.UTC().Truncate(24 * time.Hour)
+	dueMidnight := dueDate.UTC().Truncate(24 * time.Hour)
 	returnedMidnight := returnedAt.UTC().Truncate(24 * time.Hour)
 
 	daysLate := int(returnedMidnight.Sub(dueMidnight).Hours() / 24)
@@ -462,5 +1322,5 @@ func calculateFine(dueDate, returnedAt time.Time) int {
 		daysLate = 1
 	}
 
-	return daysLate * FinePerDay
+	return daysLate
 }
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"library/internal/models"
+	"library/internal/repositories"
+)
+
+// QueuedReservation is a reservation with the time a copy is expected to be
+// free for it (see estimateQueue); nil when the book has no copies.
+type QueuedReservation struct {
+	models.Reservation
+	EstimatedAvailableAt *time.Time `json:"estimated_available_at"`
+}
+
+// UserReservation is one of a user's reservations together with the user's
+// place in the book's queue: 1 means the next copy returned is theirs.
+type UserReservation struct {
+	QueuedReservation
+	Title       string `json:"title"`
+	PlaceInLine int    `json:"place_in_line"`
+	QueueLength int    `json:"queue_length"`
+}
+
+// ─── Reservation Queue ────────────────────────────────────────────────────────
+
+// ListUserReservations returns a user's reservations, oldest first, each with
+// the user's place in line. The place is counted from the queue itself rather
+// than read from queue_position, so it stays right even for a queue with gaps
+// left by data written before queues were compacted. The reservations and the
+// queues are read by separate statements, so a reservation fulfilled,
+// cancelled or withdrawn with its book in between is left out.
+func (s *libraryService) ListUserReservations(userID uuid.UUID) ([]UserReservation, error) {
+	rd := s.reads()
+	if _, err := s.userRepo.GetByID(rd, userID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	reservations, err := s.reservationRepo.ListByUser(rd, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]UserReservation, 0, len(reservations))
+	for _, res := range reservations {
+		book, err := s.bookRepo.GetByID(rd, res.BookID)
+		if errors.Is(err, repositories.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		queue, err := s.reservationRepo.ListByBook(rd, res.BookID)
+		if err != nil {
+			return nil, err
+		}
+		place := slices.IndexFunc(queue, func(q models.Reservation) bool { return q.ID == res.ID })
+		if place < 0 {
+			continue
+		}
+		estimates, err := s.estimateQueue(rd, book, queue)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, UserReservation{
+			QueuedReservation: estimates[place],
+			Title:             book.Title,
+			PlaceInLine:       place + 1,
+			QueueLength:       len(queue),
+		})
+	}
+	return out, nil
+}
+
+// CancelReservation removes a reservation from its book's queue; everyone
+// behind it moves up one place. It locks the book before the queue, the order
+// checkout, return and deletion take them in, and runs as a "cancel"
+// transaction with the same isolation and retries as they do.
+func (s *libraryService) CancelReservation(reservationID uuid.UUID) error {
+	err := s.runCirculation("cancel", func(tx repositories.Tx) error {
+		res, err := s.reservationRepo.GetByID(tx, reservationID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
+				return ErrReservationNotFound
+			}
+			return err
+		}
+		// A book withdrawn since has no counts left to keep.
+		_, err = s.bookRepo.GetByIDForUpdate(tx, res.BookID)
+		withdrawn := errors.Is(err, repositories.ErrNotFound)
+		if err != nil && !withdrawn {
+			return err
+		}
+		err = s.reservationRepo.Dequeue(tx, reservationID)
+		if errors.Is(err, repositories.ErrNotFound) {
+			// Fulfilled or cancelled since it was read.
+			return ErrReservationNotFound
+		}
+		if err != nil || withdrawn {
+			return err
+		}
+		return s.bookRepo.AdjustAvailability(tx, res.BookID, repositories.Availability{Holds: -1})
+	})
+	if err != nil {
+		log.Printf("[ERROR] CancelReservation: failed to cancel reservation %s: %v", reservationID, err)
+		return err
+	}
+	log.Printf("[INFO] CancelReservation: reservation %s cancelled", reservationID)
+	return nil
+}
+
+// ─── Wait Estimates ───────────────────────────────────────────────────────────
+
+// estimateQueue estimates when a copy will be free for each reservation in a
+// book's queue, given in order.
+//
+// Each copy is expected back at its due date plus the book's average lateness
+// (returned early counts as on time), or now if that has passed or the copy is
+// on the shelf. The queue is then served in order: each reservation takes the
+// copy expected back first, keeps it for a fresh loan under the copy's
+// calendar, and returns it as late as the book's borrowers usually do. Term
+// caps and renewals are ignored, so the estimate is a rough guide.
+func (s *libraryService) estimateQueue(tx repositories.Tx, book *models.Book, queue []models.Reservation) ([]QueuedReservation, error) {
+	out := make([]QueuedReservation, len(queue))
+	for i, res := range queue {
+		out[i].Reservation = res
+	}
+	if len(queue) == 0 {
+		return out, nil
+	}
+	copies, err := s.bookCopyRepo.ListByBooks(tx, []uuid.UUID{book.ID})
+	if err != nil {
+		return nil, err
+	}
+	if len(copies) == 0 {
+		return out, nil
+	}
+	checkouts, err := s.checkoutRepo.ListByBook(tx, book.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var late time.Duration
+	var returned int
+	due := map[uuid.UUID]time.Time{}
+	for _, c := range checkouts {
+		if c.ReturnedAt == nil {
+			due[c.BookCopyID] = c.DueDate
+			continue
+		}
+		late += max(c.ReturnedAt.Sub(c.DueDate), 0)
+		returned++
+	}
+	if returned > 0 {
+		late /= time.Duration(returned)
+	}
+
+	now := s.now()
+	type slot struct {
+		copy *models.BookCopy
+		free time.Time
+	}
+	slots := make([]slot, len(copies))
+	last := now
+	for i := range copies {
+		slots[i] = slot{copy: &copies[i], free: now}
+		if d, ok := due[copies[i].ID]; ok {
+			slots[i].free = later(d.Add(late), now)
+		}
+		last = later(last, slots[i].free)
+	}
+	// Each copy serves at most rounds of the queue's loans, so closures are
+	// loaded from now until the last of them can start.
+	rounds := (len(queue) + len(copies) - 1) / len(copies)
+	loan := time.Duration(max(s.policy.LoanPeriodDays, 1))*24*time.Hour + late
+	cals := s.newCalendars(tx, now, last.Add(time.Duration(rounds)*loan))
+
+	for i := range out {
+		next := 0
+		for j := range slots {
+			if slots[j].free.Before(slots[next].free) {
+				next = j
+			}
+		}
+		at := slots[next].free
+		out[i].EstimatedAvailableAt = &at
+		cal, err := cals.forCopy(slots[next].copy)
+		if err != nil {
+			return nil, err
+		}
+		slots[next].free = s.dueDate(cal, book, at).Add(late)
+	}
+	return out, nil
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"library/internal/calendar"
+	"library/internal/models"
+	"library/internal/repositories"
+)
+
+// TermEndReport lists the loans still outstanding at the end of a term.
+type TermEndReport struct {
+	Term  models.Term   `json:"term"`
+	Loans []TermEndLoan `json:"loans"`
+}
+
+// TermEndLoan is an active checkout with the borrower and title it concerns.
+// DueAfterTermEnd flags loans that will still be out once the term is over,
+// such as librarians' loans or loans made before the term existed.
+type TermEndLoan struct {
+	models.Checkout
+	UserName        string          `json:"user_name"`
+	UserRole        models.UserRole `json:"user_role"`
+	BookID          uuid.UUID       `json:"book_id"`
+	BookTitle       string          `json:"book_title"`
+	DueAfterTermEnd bool            `json:"due_after_term_end"`
+}
+
+// ─── Term Management ──────────────────────────────────────────────────────────
+
+// CreateTerm adds an academic term running from start to end inclusive.
+func (s *libraryService) CreateTerm(name string, start, end time.Time) (*models.Term, error) {
+	term, err := newTerm(uuid.Nil, name, start, end)
+	if err != nil {
+		return nil, err
+	}
+	err = s.txm.Transaction(func(tx repositories.Tx) error {
+		if err := s.checkTermOverlap(tx, term); err != nil {
+			return err
+		}
+		return s.termRepo.Create(tx, term)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] CreateTerm: created term %q %s..%s (id=%s)", term.Name, term.StartDate.Format("2006-01-02"), term.EndDate.Format("2006-01-02"), term.ID)
+	return term, nil
+}
+
+// ListTerms returns all terms ordered by start date.
+func (s *libraryService) ListTerms() ([]models.Term, error) {
+	return s.termRepo.List(s.reads())
+}
+
+// UpdateTerm renames or moves a term. Due dates already set are not changed.
+func (s *libraryService) UpdateTerm(termID uuid.UUID, name string, start, end time.Time) (*models.Term, error) {
+	term, err := newTerm(termID, name, start, end)
+	if err != nil {
+		return nil, err
+	}
+	err = s.txm.Transaction(func(tx repositories.Tx) error {
+		if _, err := s.getTerm(tx, termID); err != nil {
+			return err
+		}
+		if err := s.checkTermOverlap(tx, term); err != nil {
+			return err
+		}
+		return s.termRepo.Update(tx, term)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] UpdateTerm: term %s is now %q %s..%s", termID, term.Name, term.StartDate.Format("2006-01-02"), term.EndDate.Format("2006-01-02"))
+	return term, nil
+}
+
+// DeleteTerm removes a term. Due dates already capped at its end stay as they are.
+func (s *libraryService) DeleteTerm(termID uuid.UUID) error {
+	if err := s.termRepo.Delete(nil, termID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrTermNotFound
+		}
+		return err
+	}
+	log.Printf("[INFO] DeleteTerm: deleted term %s", termID)
+	return nil
+}
+
+// TermEndReport returns every loan still outstanding, oldest due date first,
+// against the given term or, when termID is nil, the term in progress.
+func (s *libraryService) TermEndReport(termID *uuid.UUID) (*TermEndReport, error) {
+	var term *models.Term
+	var err error
+	rd := s.reads()
+	if termID != nil {
+		term, err = s.getTerm(rd, *termID)
+	} else {
+		term, err = s.termRepo.FindByDate(rd, utcDate(s.now()))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrNoCurrentTerm
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	checkouts, err := s.checkoutRepo.ListActive(rd)
+	if err != nil {
+		return nil, err
+	}
+	report := &TermEndReport{Term: *term, Loans: make([]TermEndLoan, 0, len(checkouts))}
+	for _, c := range checkouts {
+		report.Loans = append(report.Loans, TermEndLoan{
+			Checkout:        c,
+			UserName:        c.User.Name,
+			UserRole:        c.User.Role,
+			BookID:          c.BookCopy.BookID,
+			BookTitle:       c.BookCopy.Book.Title,
+			DueAfterTermEnd: c.DueDate.After(termEnd(term, time.UTC)),
+		})
+	}
+	return report, nil
+}
+
+// ─── Term Helpers ─────────────────────────────────────────────────────────────
+
+func newTerm(id uuid.UUID, name string, start, end time.Time) (*models.Term, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || start.IsZero() || end.IsZero() || end.Before(start) {
+		return nil, ErrInvalidTerm
+	}
+	return &models.Term{ID: id, Name: name, StartDate: utcDate(start), EndDate: utcDate(end)}, nil
+}
+
+func (s *libraryService) getTerm(tx repositories.Tx, termID uuid.UUID) (*models.Term, error) {
+	term, err := s.termRepo.GetByID(tx, termID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrTermNotFound
+		}
+		return nil, err
+	}
+	return term, nil
+}
+
+// checkTermOverlap rejects a term sharing any day with another term, so that
+// at most one term is ever in progress.
+func (s *libraryService) checkTermOverlap(tx repositories.Tx, term *models.Term) error {
+	terms, err := s.termRepo.List(tx)
+	if err != nil {
+		return err
+	}
+	for _, t := range terms {
+		if t.ID == term.ID {
+			continue
+		}
+		if !term.StartDate.After(t.EndDate) && !t.StartDate.After(term.EndDate) {
+			log.Printf("[WARN] checkTermOverlap: %q overlaps term %q (id=%s)", term.Name, t.Name, t.ID)
+			return ErrTermOverlap
+		}
+	}
+	return nil
+}
+
+// termEnd returns the last instant of the term's final day in loc.
+func termEnd(term *models.Term, loc *time.Location) time.Time {
+	y, m, d := term.EndDate.UTC().Date()
+	return time.Date(y, m, d, 23, 59, 59, 0, loc)
+}
+
+// loanDueDate returns the due date of a loan (or renewal) of book to user
+// starting now: the due date for the book's loan type, capped at the end of the current term for
+// students when Policy.CapAtTermEnd is set. The current term and its last
+// day are taken in the branch time zone, or in UTC for copies without one.
+func (s *libraryService) loanDueDate(tx repositories.Tx, cal *calendar.Calendar, book *models.Book, user *models.User, now time.Time) (time.Time, error) {
+	due := s.dueDate(cal, book, now)
+	if !s.policy.CapAtTermEnd || user.Role != models.UserRoleStudent {
+		return due, nil
+	}
+
+	loc := time.UTC
+	if cal != nil {
+		loc = cal.Location()
+	}
+	term, err := s.termRepo.FindByDate(tx, utcDate(now.In(loc)))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return due, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	end := termEnd(term, loc)
+	if !due.After(end) {
+		return due, nil
+	}
+	capped := end
+	if cal != nil {
+		// Fall due on the last open day of term, at closing time.
+		if last, ok := cal.LastDueBy(end); ok && last.After(now) {
+			capped = last
+		}
+	}
+	log.Printf("[INFO] loanDueDate: due date for %s capped at end of term %q: %s", user.ID, term.Name, capped.UTC().Format(time.RFC3339))
+	return capped.UTC(), nil
+}
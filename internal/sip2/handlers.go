@@ -0,0 +1,410 @@
+package sip2
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"library/internal/models"
+	"library/internal/services"
+)
+
+// supportedMessages is the BX field of the ACS Status response: one Y or N
+// per message in the order the protocol lists them, from Patron Status
+// Request to Renew All.
+const supportedMessages = "YYYNYYYNYYYNNNYN"
+
+// respond returns the response to req, or nil for a message the server does
+// not support.
+func (s *Server) respond(req *Message, loggedIn bool) *Message {
+	switch req.ID {
+	case "93":
+		return &Message{ID: "94", Fixed: flag01(loggedIn)}
+	case "99":
+		return s.acsStatus()
+	case "23":
+		return s.patronStatus(req)
+	case "11":
+		return s.checkout(req)
+	case "09":
+		return s.checkin(req)
+	case "17":
+		return s.itemInformation(req)
+	case "29":
+		return s.renew(req)
+	case "37":
+		return s.feePaid(req)
+	case "35":
+		return s.endSession(req)
+	}
+	return nil
+}
+
+func (s *Server) now() string {
+	return Timestamp(s.clock.Now())
+}
+
+// acsStatus answers SC Status (99) with ACS Status (98): online, checkin,
+// checkout and renewals allowed, no status updates or offline mode.
+func (s *Server) acsStatus() *Message {
+	resp := &Message{ID: "98", Fixed: "YYYYNN" + "030" + "003" + s.now() + "2.00"}
+	resp.Add("AO", s.cfg.InstitutionID)
+	resp.Add("BX", supportedMessages)
+	return resp
+}
+
+// patronStatus answers Patron Status Request (23) with Patron Status
+// Response (24). An unknown patron has every privilege denied and BL=N.
+func (s *Server) patronStatus(req *Message) *Message {
+	status := []byte("              ")
+	resp := &Message{ID: "24"}
+	user, account := s.patron(req.Get("AA"))
+	if account == nil {
+		copy(status, "YYYY")
+	} else if account.Overdue > 0 {
+		// Too many items overdue.
+		status[6] = 'Y'
+	}
+	resp.Fixed = string(status) + "000" + s.now()
+	resp.Add("AO", s.cfg.InstitutionID)
+	resp.Add("AA", req.Get("AA"))
+	if account == nil {
+		resp.Add("AE", "")
+		resp.Add("BL", "N")
+		resp.Add("AF", "Unknown patron")
+		return resp
+	}
+	resp.Add("AE", user.Name)
+	resp.Add("BL", "Y")
+	resp.Add("BH", s.cfg.Currency)
+	resp.Add("BV", strconv.Itoa(account.Balance))
+	if account.Overdue > 0 {
+		resp.Add("AF", fmt.Sprintf("%d item(s) overdue", account.Overdue))
+	}
+	return resp
+}
+
+// checkout answers Checkout (11) with Checkout Response (12). A kiosk that
+// allows renewals (SC renewal policy Y) may check out an item the patron
+// already has, which renews it.
+func (s *Server) checkout(req *Message) *Message {
+	resp := &Message{ID: "12"}
+	ok, renewal := false, false
+	defer func() {
+		resp.Fixed = flag01(ok) + flag(renewal) + "N" + flag(ok) + s.now()
+	}()
+	resp.Add("AO", s.cfg.InstitutionID)
+	resp.Add("AA", req.Get("AA"))
+	resp.Add("AB", req.Get("AB"))
+
+	user, copy, book, err := s.patronAndItem(req)
+	if err != nil {
+		resp.Add("AJ", "")
+		resp.Add("AF", screenMessage(err))
+		return resp
+	}
+	resp.Add("AJ", book.Title)
+
+	checkout, err := s.svc.CheckoutCopy(copy.ID, user.ID)
+	if errors.Is(err, services.ErrAlreadyCheckedOut) && req.Fixed[0] == 'Y' {
+		if active, aerr := s.svc.GetActiveCheckout(copy.ID); aerr == nil && active.UserID == user.ID {
+			checkout, err = s.svc.RenewCheckout(active.ID)
+			renewal = err == nil
+		}
+	}
+	if err != nil {
+		resp.Add("AH", "")
+		resp.Add("AF", screenMessage(err))
+		return resp
+	}
+	ok = true
+	resp.Add("AH", Timestamp(checkout.DueDate))
+	return resp
+}
+
+// checkin answers Checkin (09) with Checkin Response (10). When the return
+// hands the copy straight to a waiting reservation, the alert flag is set
+// so the kiosk sends the book to the hold shelf.
+func (s *Server) checkin(req *Message) *Message {
+	resp := &Message{ID: "10"}
+	ok, alert := false, false
+	defer func() {
+		resp.Fixed = flag01(ok) + "Y" + "N" + flag(alert) + s.now()
+	}()
+	resp.Add("AO", s.cfg.InstitutionID)
+	resp.Add("AB", req.Get("AB"))
+
+	copy, book, err := s.item(req.Get("AB"))
+	if err != nil {
+		resp.Add("AQ", "")
+		resp.Add("AF", screenMessage(err))
+		return resp
+	}
+	resp.Add("AQ", s.branchName(copy))
+	resp.Add("AJ", book.Title)
+
+	active, err := s.svc.GetActiveCheckout(copy.ID)
+	if err == nil {
+		active, err = s.svc.ReturnCheckout(active.ID)
+	}
+	if err != nil {
+		resp.Add("AF", screenMessage(err))
+		return resp
+	}
+	ok = true
+	resp.Add("AA", active.UserID.String())
+	var messages []string
+	if active.FineAmount > 0 {
+		messages = append(messages, fmt.Sprintf("Fine charged: %d %s", active.FineAmount, s.cfg.Currency))
+	}
+	if next, err := s.svc.GetActiveCheckout(copy.ID); err == nil {
+		alert = true
+		// Alert type 01: hold for this library.
+		resp.Add("CV", "01")
+		messages = append(messages, "Hold for "+next.UserID.String())
+	}
+	if len(messages) > 0 {
+		resp.Add("AF", strings.Join(messages, "; "))
+	}
+	return resp
+}
+
+// itemInformation answers Item Information (17) with Item Information
+// Response (18).
+func (s *Server) itemInformation(req *Message) *Message {
+	resp := &Message{ID: "18"}
+	// Circulation status 01 (other) until the item is found.
+	circulation := "01"
+	defer func() {
+		resp.Fixed = circulation + "00" + "01" + s.now()
+	}()
+
+	copy, book, err := s.item(req.Get("AB"))
+	if err != nil {
+		resp.Add("AB", req.Get("AB"))
+		resp.Add("AJ", "")
+		resp.Add("AF", screenMessage(err))
+		return resp
+	}
+	reservations, err := s.svc.ListReservationsForBook(book.ID)
+	if err != nil {
+		log.Printf("[ERROR] SIP2: listing reservations for book %s: %v", book.ID, err)
+	}
+	resp.Add("CF", strconv.Itoa(len(reservations)))
+	switch copy.Status {
+	case models.BookCopyStatusAvailable:
+		circulation = "03"
+	case models.BookCopyStatusCheckedOut:
+		circulation = "04"
+		if checkout, err := s.svc.GetActiveCheckout(copy.ID); err == nil {
+			resp.Add("AH", Timestamp(checkout.DueDate))
+		}
+	}
+	resp.Add("AB", req.Get("AB"))
+	resp.Add("AJ", book.Title)
+	resp.Add("AQ", s.branchName(copy))
+	// Media type 001: book.
+	resp.Add("CK", "001")
+	return resp
+}
+
+// renew answers Renew (29) with Renew Response (30). Unless the kiosk
+// allows third-party renewals, the item must be checked out to the patron.
+func (s *Server) renew(req *Message) *Message {
+	resp := &Message{ID: "30"}
+	ok := false
+	defer func() {
+		resp.Fixed = flag01(ok) + flag(ok) + "N" + flag(ok) + s.now()
+	}()
+	resp.Add("AO", s.cfg.InstitutionID)
+	resp.Add("AA", req.Get("AA"))
+	resp.Add("AB", req.Get("AB"))
+
+	user, copy, book, err := s.patronAndItem(req)
+	if err != nil {
+		resp.Add("AJ", "")
+		resp.Add("AF", screenMessage(err))
+		return resp
+	}
+	resp.Add("AJ", book.Title)
+
+	checkout, err := s.svc.GetActiveCheckout(copy.ID)
+	if err == nil && checkout.UserID != user.ID && req.Fixed[0] != 'Y' {
+		err = errNotYours
+	}
+	if err == nil {
+		checkout, err = s.svc.RenewCheckout(checkout.ID)
+	}
+	if err != nil {
+		resp.Add("AH", "")
+		resp.Add("AF", screenMessage(err))
+		return resp
+	}
+	ok = true
+	resp.Add("AH", Timestamp(checkout.DueDate))
+	return resp
+}
+
+// feePaid answers Fee Paid (37) with Fee Paid Response (38). Amounts are in
+// whole currency units, as fines are; "5" and "5.00" are both accepted.
+func (s *Server) feePaid(req *Message) *Message {
+	resp := &Message{ID: "38"}
+	accepted := false
+	defer func() {
+		resp.Fixed = flag(accepted) + s.now()
+	}()
+	resp.Add("AO", s.cfg.InstitutionID)
+	resp.Add("AA", req.Get("AA"))
+	resp.Add("BK", req.Get("BK"))
+
+	userID, err := uuid.Parse(req.Get("AA"))
+	if err != nil {
+		resp.Add("AF", screenMessage(services.ErrUserNotFound))
+		return resp
+	}
+	if currency := req.Fixed[22:25]; currency != s.cfg.Currency {
+		resp.Add("AF", "Payments are accepted in "+s.cfg.Currency+" only")
+		return resp
+	}
+	amount, err := parseAmount(req.Get("BV"))
+	if err != nil {
+		resp.Add("AF", screenMessage(services.ErrInvalidPayment))
+		return resp
+	}
+	if _, err := s.svc.PayFines(userID, amount, req.Get("BK")); err != nil {
+		resp.Add("AF", screenMessage(err))
+		return resp
+	}
+	accepted = true
+	return resp
+}
+
+// endSession answers End Patron Session (35) with End Session Response (36).
+// Sessions hold no patron state, so there is nothing to clear.
+func (s *Server) endSession(req *Message) *Message {
+	resp := &Message{ID: "36", Fixed: "Y" + s.now()}
+	resp.Add("AO", s.cfg.InstitutionID)
+	resp.Add("AA", req.Get("AA"))
+	return resp
+}
+
+// ─── Helpers ──────────────────────────────────────────────────────────────────
+
+// errNotYours rejects renewing another patron's loan.
+var errNotYours = errors.New("item is checked out to another patron")
+
+// patron returns the user with the given ID and their account, or nils.
+func (s *Server) patron(id string) (*models.User, *services.PatronAccount) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, nil
+	}
+	account, err := s.svc.GetPatronAccount(userID)
+	if err != nil {
+		if !errors.Is(err, services.ErrUserNotFound) {
+			log.Printf("[ERROR] SIP2: loading account of patron %s: %v", userID, err)
+		}
+		return nil, nil
+	}
+	return &account.User, account
+}
+
+func (s *Server) patronAndItem(req *Message) (*models.User, *models.BookCopy, *models.Book, error) {
+	userID, err := uuid.Parse(req.Get("AA"))
+	if err != nil {
+		return nil, nil, nil, services.ErrUserNotFound
+	}
+	user, err := s.svc.GetUser(userID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	copy, book, err := s.item(req.Get("AB"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return user, copy, book, nil
+}
+
+func (s *Server) item(id string) (*models.BookCopy, *models.Book, error) {
+	copy, err := s.svc.FindCopy(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	book, err := s.svc.GetBook(copy.BookID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return copy, book, nil
+}
+
+// branchName is the name of the copy's branch, or empty.
+func (s *Server) branchName(copy *models.BookCopy) string {
+	if copy.BranchID == nil {
+		return ""
+	}
+	branches, err := s.svc.ListBranches()
+	if err != nil {
+		log.Printf("[ERROR] SIP2: listing branches: %v", err)
+		return ""
+	}
+	for _, b := range branches {
+		if b.ID == *copy.BranchID {
+			return b.Name
+		}
+	}
+	return ""
+}
+
+// parseAmount reads a non-negative amount in whole units, allowing a zero
+// fractional part.
+func parseAmount(s string) (int, error) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	if strings.Trim(frac, "0") != "" {
+		return 0, fmt.Errorf("amount %q is not in whole units", s)
+	}
+	return strconv.Atoi(whole)
+}
+
+// flag01 returns the 1/0 form of b used by the ok fields.
+func flag01(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// screenMessage is the AF text shown to the patron for a failed operation.
+func screenMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return "Unknown patron"
+	case errors.Is(err, services.ErrCopyNotFound), errors.Is(err, services.ErrBookNotFound):
+		return "Unknown item"
+	case errors.Is(err, services.ErrAlreadyCheckedOut):
+		return "Item is already checked out"
+	case errors.Is(err, services.ErrCopyOnHold):
+		return "Item is on hold for another patron"
+	case errors.Is(err, services.ErrCheckoutNotFound), errors.Is(err, services.ErrCheckoutAlreadyReturned):
+		return "Item is not checked out"
+	case errors.Is(err, errNotYours):
+		return "Item is checked out to another patron"
+	case errors.Is(err, services.ErrCheckoutOverdue):
+		return "Item is overdue and must be returned"
+	case errors.Is(err, services.ErrRenewalLimitReached):
+		return "Renewal limit reached"
+	case errors.Is(err, services.ErrRenewalBlocked):
+		return "Item is reserved by another patron"
+	case errors.Is(err, services.ErrRenewalNotExtended):
+		return "Renewal would not extend the due date"
+	case errors.Is(err, services.ErrInvalidPayment):
+		return "Invalid payment amount"
+	case errors.Is(err, services.ErrOverpayment):
+		return "Payment exceeds the amount owed"
+	}
+	log.Printf("[ERROR] SIP2: %v", err)
+	return "Please see library staff"
+}
@@ -0,0 +1,249 @@
+package sip2
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"library/internal/clock"
+	"library/internal/models"
+	"library/internal/services"
+)
+
+// Circulation is the part of the library service the server uses.
+type Circulation interface {
+	GetUser(userID uuid.UUID) (*models.User, error)
+	GetBook(bookID uuid.UUID) (*models.Book, error)
+	ListBranches() ([]models.Branch, error)
+	ListReservationsForBook(bookID uuid.UUID) ([]services.QueuedReservation, error)
+	FindCopy(item string) (*models.BookCopy, error)
+	CheckoutCopy(copyID, userID uuid.UUID) (*models.Checkout, error)
+	GetActiveCheckout(copyID uuid.UUID) (*models.Checkout, error)
+	ReturnCheckout(checkoutID uuid.UUID) (*models.Checkout, error)
+	RenewCheckout(checkoutID uuid.UUID) (*models.Checkout, error)
+	GetPatronAccount(userID uuid.UUID) (*services.PatronAccount, error)
+	PayFines(userID uuid.UUID, amount int, reference string) (*models.Payment, error)
+}
+
+// Config holds the settings of a Server.
+type Config struct {
+	// LoginUser and LoginPassword are the credentials a kiosk must present in
+	// its Login message before anything but SC Status is answered.
+	LoginUser     string
+	LoginPassword string
+	// InstitutionID is sent in the AO field of every response.
+	InstitutionID string
+	// Currency is the ISO 4217 code fines are reported and paid in.
+	Currency string
+	// IdleTimeout closes connections that send nothing for this long.
+	IdleTimeout time.Duration
+}
+
+// maxMessageLen bounds a single message; longer input closes the connection.
+const maxMessageLen = 4096
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("sip2: server closed")
+
+// Server accepts kiosk connections and answers their messages. Every
+// connection is a separate session with its own login.
+type Server struct {
+	svc   Circulation
+	clock clock.Clock
+	cfg   Config
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+}
+
+// NewServer returns a server answering from svc. Transaction dates are read
+// from clk, the clock the service runs on.
+func NewServer(svc Circulation, clk clock.Clock, cfg Config) *Server {
+	return &Server{
+		svc:       svc,
+		clock:     clk,
+		cfg:       cfg,
+		listeners: map[net.Listener]struct{}{},
+		conns:     map[net.Conn]struct{}{},
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln until Close is called, handling each in
+// its own goroutine. It always returns a non-nil error.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, ln)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !s.track(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the listeners, closes every open connection and waits for
+// their sessions to end.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// ─── Sessions ─────────────────────────────────────────────────────────────────
+
+// session is the state of one kiosk connection.
+type session struct {
+	srv      *Server
+	remote   string
+	loggedIn bool
+	// last is the last response sent, repeated on Request ACS Resend.
+	last string
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	sess := &session{srv: s, remote: conn.RemoteAddr().String()}
+	log.Printf("[INFO] SIP2: connection from %s", sess.remote)
+	r := bufio.NewReaderSize(conn, maxMessageLen)
+	for {
+		if s.cfg.IdleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.cfg.IdleTimeout))
+		}
+		line, err := r.ReadSlice('\r')
+		if err != nil {
+			switch {
+			case errors.Is(err, bufio.ErrBufferFull):
+				log.Printf("[WARN] SIP2: %s sent a message longer than %d bytes, closing", sess.remote, maxMessageLen)
+			case errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed):
+			default:
+				log.Printf("[INFO] SIP2: connection from %s ended: %v", sess.remote, err)
+			}
+			return
+		}
+		reply, ok := sess.handle(string(line))
+		if !ok {
+			return
+		}
+		if reply == "" {
+			continue
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			log.Printf("[WARN] SIP2: write to %s failed: %v", sess.remote, err)
+			return
+		}
+	}
+}
+
+// handle answers one raw message. It returns the encoded response, empty
+// when there is none, and false when the connection must be closed.
+func (sess *session) handle(line string) (string, bool) {
+	req, err := Parse(line)
+	if err != nil {
+		// Ask the kiosk to send the message again.
+		log.Printf("[WARN] SIP2: %s: %v", sess.remote, err)
+		return (&Message{ID: "96", Seq: -1}).Encode(), true
+	}
+
+	switch req.ID {
+	case "97":
+		if sess.last == "" {
+			return (&Message{ID: "96", Seq: -1}).Encode(), true
+		}
+		return sess.last, true
+	case "93":
+		sess.loggedIn = sess.login(req)
+	case "99":
+	default:
+		if !sess.loggedIn {
+			log.Printf("[WARN] SIP2: %s sent message %s before logging in, closing", sess.remote, req.ID)
+			return "", false
+		}
+	}
+
+	resp := sess.srv.respond(req, sess.loggedIn)
+	if resp == nil {
+		log.Printf("[WARN] SIP2: %s sent unsupported message %s", sess.remote, req.ID)
+		return "", true
+	}
+	resp.Seq = req.Seq
+	sess.last = resp.Encode()
+	return sess.last, true
+}
+
+func (sess *session) login(req *Message) bool {
+	cfg := sess.srv.cfg
+	user := subtle.ConstantTimeCompare([]byte(req.Get("CN")), []byte(cfg.LoginUser))
+	password := subtle.ConstantTimeCompare([]byte(req.Get("CO")), []byte(cfg.LoginPassword))
+	if user&password != 1 {
+		log.Printf("[WARN] SIP2: login from %s as %q rejected", sess.remote, req.Get("CN"))
+		return false
+	}
+	log.Printf("[INFO] SIP2: %s logged in as %q (location %q)", sess.remote, req.Get("CN"), req.Get("CP"))
+	return true
+}
@@ -0,0 +1,201 @@
+package sru
+
+import (
+	"errors"
+	"strings"
+
+	"library/internal/catalog"
+	"library/internal/cql"
+	"library/internal/repositories"
+	"library/internal/services"
+)
+
+// ─── Indexes ──────────────────────────────────────────────────────────────────
+
+type contextSet struct {
+	name       string
+	identifier string
+}
+
+// contextSets are the CQL context sets the indexes come from.
+var contextSets = []contextSet{
+	{"cql", "info:srw/cql-context-set/1/cql-v1.2"},
+	{"dc", "info:srw/cql-context-set/1/dc-v1.1"},
+	{"bath", "http://zing.z3950.org/cql/bath/2.0/"},
+}
+
+type explainIndex struct {
+	title string
+	names []string
+}
+
+// explainIndexes are the indexes explain advertises, by their qualified
+// names; indexes maps those and their unqualified forms to catalogue fields.
+var explainIndexes = []explainIndex{
+	{"Any field", []string{"cql.serverChoice", "cql.anywhere"}},
+	{"Title", []string{"dc.title"}},
+	{"Author", []string{"dc.creator"}},
+	{"Subject", []string{"dc.subject"}},
+	{"ISBN", []string{"bath.isbn"}},
+}
+
+var anyField = []repositories.BookField{
+	repositories.BookFieldTitle,
+	repositories.BookFieldAuthor,
+	repositories.BookFieldSubject,
+	repositories.BookFieldISBN,
+}
+
+// indexes maps lower-case index names to the fields they search.
+var indexes = map[string][]repositories.BookField{
+	"cql.serverchoice": anyField,
+	"cql.anywhere":     anyField,
+	"dc.title":         {repositories.BookFieldTitle},
+	"title":            {repositories.BookFieldTitle},
+	"dc.creator":       {repositories.BookFieldAuthor},
+	"creator":          {repositories.BookFieldAuthor},
+	"author":           {repositories.BookFieldAuthor},
+	"dc.subject":       {repositories.BookFieldSubject},
+	"subject":          {repositories.BookFieldSubject},
+	"bath.isbn":        {repositories.BookFieldISBN},
+	"isbn":             {repositories.BookFieldISBN},
+}
+
+// ─── Translation ──────────────────────────────────────────────────────────────
+
+// translate parses a CQL query into a catalogue search.
+//
+// Terms match anywhere in a field: "=" and "adj" look for the term as a
+// phrase, "all" and "any" for all or any of its words, and "==" and "exact"
+// compare the whole field (one subject, for subjects), as does "<>", which
+// matches books that are not equal. ISBNs are always compared whole, after
+// normalisation. "*" and "?" in a term mask any run of characters or any one
+// character.
+func translate(query string) (*services.BookQuery, error) {
+	q, err := cql.Parse(query)
+	var serr *cql.SyntaxError
+	if errors.As(err, &serr) {
+		return nil, diagnosticf(10, query, "query syntax error: %s at position %d", serr.Msg, serr.Pos)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(q.SortBy) > 0 {
+		return nil, diagnosticf(80, "", "sorting is not supported")
+	}
+	return translateNode(q.Root)
+}
+
+func translateNode(n cql.Node) (*services.BookQuery, error) {
+	switch n := n.(type) {
+	case *cql.Boolean:
+		if len(n.Modifiers) > 0 {
+			return nil, diagnosticf(46, n.Modifiers[0].Name, "boolean modifiers are not supported")
+		}
+		left, err := translateNode(n.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := translateNode(n.Right)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case "and":
+			return combine(repositories.QueryAnd, left, right), nil
+		case "or":
+			return combine(repositories.QueryOr, left, right), nil
+		case "not":
+			return combine(repositories.QueryAnd, left, negate(right)), nil
+		}
+		return nil, diagnosticf(37, n.Op, "boolean %q is not supported", n.Op)
+	case *cql.Clause:
+		return translateClause(n)
+	}
+	return nil, diagnosticf(1, "", "unexpected query node %T", n)
+}
+
+func translateClause(c *cql.Clause) (*services.BookQuery, error) {
+	fields, ok := indexes[strings.ToLower(c.Index)]
+	if !ok {
+		return nil, diagnosticf(16, c.Index, "index %q is not supported", c.Index)
+	}
+	if len(c.Relation.Modifiers) > 0 {
+		return nil, diagnosticf(20, c.Relation.Modifiers[0].Name, "relation modifiers are not supported")
+	}
+	term := strings.Join(strings.Fields(c.Term), " ")
+	if term == "" {
+		return nil, diagnosticf(27, "", "empty terms are not supported")
+	}
+	for i := 0; i < len(term); i++ {
+		switch term[i] {
+		case '\\':
+			i++
+		case '^':
+			return nil, diagnosticf(28, "^", "the anchoring character ^ is not supported")
+		}
+	}
+
+	var words []string
+	whole, negated := false, false
+	switch c.Relation.Name {
+	case "=", "adj", "scr":
+		words = []string{term}
+	case "all", "any":
+		words = strings.Fields(term)
+	case "==", "exact":
+		words, whole = []string{term}, true
+	case "<>":
+		words, whole, negated = []string{term}, true, true
+	default:
+		return nil, diagnosticf(19, c.Relation.Name, "relation %q is not supported", c.Relation.Name)
+	}
+
+	// Each word must match in one of the fields; "any" needs one word only.
+	var q *services.BookQuery
+	for _, word := range words {
+		var match *services.BookQuery
+		for _, field := range fields {
+			match = combine(repositories.QueryOr, match, matchField(field, word, whole))
+		}
+		op := repositories.QueryAnd
+		if c.Relation.Name == "any" {
+			op = repositories.QueryOr
+		}
+		q = combine(op, q, match)
+	}
+	if negated {
+		q = negate(q)
+	}
+	return q, nil
+}
+
+// matchField matches one field with a term. ISBNs are matched whole, in
+// their normalised form when the term is a valid ISBN and otherwise with
+// separators removed.
+func matchField(field repositories.BookField, term string, whole bool) *services.BookQuery {
+	if field == repositories.BookFieldISBN {
+		if isbn, err := catalog.NormalizeISBN(term); err == nil {
+			term = isbn
+		} else {
+			term = strings.NewReplacer("-", "", " ", "").Replace(term)
+		}
+		whole = true
+	}
+	return &services.BookQuery{Op: repositories.QueryMatch, Field: field, Pattern: term, Whole: whole}
+}
+
+// combine joins two queries with op, either of which may be nil.
+func combine(op repositories.BookQueryOp, left, right *services.BookQuery) *services.BookQuery {
+	switch {
+	case left == nil:
+		return right
+	case right == nil:
+		return left
+	}
+	return &services.BookQuery{Op: op, Left: left, Right: right}
+}
+
+func negate(q *services.BookQuery) *services.BookQuery {
+	return &services.BookQuery{Op: repositories.QueryNot, Left: q}
+}
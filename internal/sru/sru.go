@@ -0,0 +1,397 @@
+// Package sru is an SRU (Search/Retrieve via URL) server for the catalogue.
+// It answers the explain and searchRetrieve operations of SRU 1.2 and 2.0,
+// translating CQL queries on title, author, subject and ISBN into catalogue
+// searches and returning Dublin Core or MARCXML records a page at a time.
+//
+// Problems with a request are reported as SRU diagnostics inside a normal
+// response, never as HTTP errors.
+package sru
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"library/internal/catalog"
+	"library/internal/marc"
+	"library/internal/models"
+	"library/internal/services"
+)
+
+const (
+	// DefaultMaximumRecords is the page size when a request names none.
+	DefaultMaximumRecords = 10
+	// MaxMaximumRecords caps the page size a request may ask for.
+	MaxMaximumRecords = 100
+
+	explainSchema = "http://explain.z3950.org/dtd/2.0/"
+)
+
+// Catalogue is the part of the library service the server reads.
+type Catalogue interface {
+	SearchBooks(q *services.BookQuery, offset, limit int) ([]models.Book, int64, error)
+}
+
+// Provider answers SRU requests.
+type Provider struct {
+	// Title names the database in explain responses.
+	Title string
+	Books Catalogue
+}
+
+// ─── Versions ─────────────────────────────────────────────────────────────────
+
+// version holds what differs between the SRU 1.2 and 2.0 response formats.
+type version struct {
+	number string
+	// prefix and namespace are the response elements' namespace.
+	prefix    string
+	namespace string
+	// diagnostics is the namespace of diagnostic elements.
+	diagnostics string
+	// escaping is the name of the parameter and element choosing between
+	// records as XML and records as escaped strings.
+	escaping string
+}
+
+var (
+	version12 = version{
+		number:      "1.2",
+		prefix:      "srw",
+		namespace:   "http://www.loc.gov/zing/srw/",
+		diagnostics: "http://www.loc.gov/zing/srw/diagnostic/",
+		escaping:    "recordPacking",
+	}
+	version20 = version{
+		number:      "2.0",
+		prefix:      "sru",
+		namespace:   "http://docs.oasis-open.org/ns/search-ws/sruResponse",
+		diagnostics: "http://docs.oasis-open.org/ns/search-ws/diagnostic",
+		escaping:    "recordXMLEscaping",
+	}
+)
+
+// ─── Record Schemas ───────────────────────────────────────────────────────────
+
+type recordSchema struct {
+	name       string
+	identifier string
+	title      string
+	write      func(w io.Writer, book models.Book, indent string) error
+}
+
+var recordSchemas = []recordSchema{
+	{
+		name:       "dc",
+		identifier: "info:srw/schema/1/dc-v1.1",
+		title:      "Dublin Core",
+		write:      catalog.WriteSRUDublinCore,
+	},
+	{
+		name:       "marcxml",
+		identifier: "info:srw/schema/1/marcxml-v1.1",
+		title:      "MARCXML",
+		write: func(w io.Writer, book models.Book, indent string) error {
+			return marc.WriteXMLRecord(w, catalog.MARCRecord(book, nil, nil), indent)
+		},
+	},
+}
+
+// schemaByName returns the record schema a recordSchema parameter names, by
+// short name or identifier; dc when it is empty.
+func schemaByName(name string) (recordSchema, error) {
+	if name == "" {
+		return recordSchemas[0], nil
+	}
+	for _, s := range recordSchemas {
+		if strings.EqualFold(s.name, name) || s.identifier == name {
+			return s, nil
+		}
+	}
+	return recordSchema{}, diagnosticf(66, name, "record schema %q is not supported (want dc or marcxml)", name)
+}
+
+// ─── Diagnostics ──────────────────────────────────────────────────────────────
+
+// diagnostic is an SRU diagnostic from the info:srw/diagnostic/1 set.
+type diagnostic struct {
+	code    int
+	details string
+	message string
+}
+
+func (d *diagnostic) Error() string { return d.message }
+
+func diagnosticf(code int, details, format string, args ...interface{}) error {
+	return &diagnostic{code: code, details: details, message: fmt.Sprintf(format, args...)}
+}
+
+// ─── Requests ─────────────────────────────────────────────────────────────────
+
+// searchRequest is a checked searchRetrieve request.
+type searchRequest struct {
+	query   *services.BookQuery
+	start   int
+	maximum int
+	schema  recordSchema
+	escape  bool
+}
+
+func parseSearchRequest(v version, args url.Values) (searchRequest, error) {
+	req := searchRequest{start: 1, maximum: DefaultMaximumRecords}
+	if t := args.Get("queryType"); t != "" && t != "cql" {
+		return req, diagnosticf(6, "queryType", "queryType %q is not supported (want cql)", t)
+	}
+	if args.Get("sortKeys") != "" {
+		return req, diagnosticf(80, "", "sorting is not supported")
+	}
+	if s := args.Get("startRecord"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return req, diagnosticf(6, "startRecord", "startRecord must be a positive integer, got %q", s)
+		}
+		req.start = n
+	}
+	if s := args.Get("maximumRecords"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return req, diagnosticf(6, "maximumRecords", "maximumRecords must be a non-negative integer, got %q", s)
+		}
+		req.maximum = min(n, MaxMaximumRecords)
+	}
+	var err error
+	if req.schema, err = schemaByName(args.Get("recordSchema")); err != nil {
+		return req, err
+	}
+	switch packing := args.Get(v.escaping); packing {
+	case "", "xml":
+	case "string":
+		req.escape = true
+	default:
+		return req, diagnosticf(71, packing, "%s %q is not supported (want xml or string)", v.escaping, packing)
+	}
+
+	query := args.Get("query")
+	if strings.TrimSpace(query) == "" {
+		return req, diagnosticf(7, "query", "the query parameter is missing")
+	}
+	req.query, err = translate(query)
+	return req, err
+}
+
+// ─── Responses ────────────────────────────────────────────────────────────────
+
+// Serve answers one request. baseURL is the endpoint's public URL and args
+// the request's query or form arguments. Protocol errors are reported as
+// diagnostics; an error is returned only when the catalogue cannot be read.
+//
+// Requests naming version 1.1 or 1.2 are answered in SRU 1.2 and the rest in
+// SRU 2.0. A request with no operation is a searchRetrieve when it has a
+// query and an explain otherwise, as in SRU 2.0.
+func (p *Provider) Serve(baseURL string, args url.Values) ([]byte, error) {
+	v := version20
+	var verr error
+	switch ver := args.Get("version"); ver {
+	case "", "2.0":
+	case "1.1", "1.2":
+		v = version12
+	default:
+		verr = diagnosticf(5, "2.0", "version %q is not supported (want 1.2 or 2.0)", ver)
+	}
+
+	operation := args.Get("operation")
+	if operation == "" {
+		operation = "explain"
+		if args.Has("query") {
+			operation = "searchRetrieve"
+		}
+	}
+
+	var body bytes.Buffer
+	err := verr
+	switch {
+	case err != nil:
+		operation = "explain"
+	case operation == "explain":
+		err = p.explain(&body, v, baseURL)
+	case operation == "searchRetrieve":
+		err = p.searchRetrieve(&body, v, args)
+	default:
+		err = diagnosticf(4, operation, "operation %q is not supported (want explain or searchRetrieve)", operation)
+		operation = "explain"
+	}
+	var diag *diagnostic
+	if err != nil && !errors.As(err, &diag) {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	fmt.Fprintf(&out, "<%s:%sResponse xmlns:%s=\"%s\">\n", v.prefix, operation, v.prefix, v.namespace)
+	v.element(&out, "  ", "version", v.number)
+	if diag != nil {
+		if operation == "searchRetrieve" {
+			v.element(&out, "  ", "numberOfRecords", "0")
+		}
+		fmt.Fprintf(&out, "  <%s:diagnostics>\n", v.prefix)
+		fmt.Fprintf(&out, "    <diagnostic xmlns=\"%s\">\n", v.diagnostics)
+		fmt.Fprintf(&out, "      <uri>info:srw/diagnostic/1/%d</uri>\n", diag.code)
+		if diag.details != "" {
+			fmt.Fprintf(&out, "      <details>%s</details>\n", escape(diag.details))
+		}
+		fmt.Fprintf(&out, "      <message>%s</message>\n", escape(diag.message))
+		out.WriteString("    </diagnostic>\n")
+		fmt.Fprintf(&out, "  </%s:diagnostics>\n", v.prefix)
+	} else {
+		out.Write(body.Bytes())
+	}
+	fmt.Fprintf(&out, "</%s:%sResponse>\n", v.prefix, operation)
+	return out.Bytes(), nil
+}
+
+func (p *Provider) searchRetrieve(w *bytes.Buffer, v version, args url.Values) error {
+	req, err := parseSearchRequest(v, args)
+	if err != nil {
+		return err
+	}
+	books, total, err := p.Books.SearchBooks(req.query, req.start-1, req.maximum)
+	if err != nil {
+		return err
+	}
+	if total > 0 && int64(req.start) > total {
+		return diagnosticf(61, strconv.Itoa(req.start), "startRecord %d is beyond the %d matching records", req.start, total)
+	}
+
+	v.element(w, "  ", "numberOfRecords", strconv.FormatInt(total, 10))
+	if len(books) > 0 {
+		fmt.Fprintf(w, "  <%s:records>\n", v.prefix)
+		for i, book := range books {
+			if err := p.writeRecord(w, v, req, book, req.start+i); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(w, "  </%s:records>\n", v.prefix)
+	}
+	if next := req.start + len(books); len(books) > 0 && int64(next) <= total {
+		v.element(w, "  ", "nextRecordPosition", strconv.Itoa(next))
+	}
+	if v == version20 {
+		v.element(w, "  ", "resultCountPrecision", "info:srw/vocabulary/resultCountPrecision/1/exact")
+	}
+	return nil
+}
+
+func (p *Provider) writeRecord(w *bytes.Buffer, v version, req searchRequest, book models.Book, position int) error {
+	var data bytes.Buffer
+	indent := "        "
+	if req.escape {
+		indent = ""
+	}
+	if err := req.schema.write(&data, book, indent); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "    <%s:record>\n", v.prefix)
+	v.element(w, "      ", "recordSchema", req.schema.identifier)
+	if req.escape {
+		v.element(w, "      ", v.escaping, "string")
+		v.element(w, "      ", "recordData", data.String())
+	} else {
+		v.element(w, "      ", v.escaping, "xml")
+		fmt.Fprintf(w, "      <%s:recordData>\n", v.prefix)
+		w.Write(data.Bytes())
+		fmt.Fprintf(w, "      </%s:recordData>\n", v.prefix)
+	}
+	v.element(w, "      ", "recordPosition", strconv.Itoa(position))
+	fmt.Fprintf(w, "    </%s:record>\n", v.prefix)
+	return nil
+}
+
+// explain describes the server in a ZeeRex record: where it is, the indexes
+// and relations it searches with, and the record schemas it returns.
+func (p *Provider) explain(w *bytes.Buffer, v version, baseURL string) error {
+	host, port, database := "localhost", "80", "sru"
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		host, port = u.Hostname(), u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		database = strings.TrimPrefix(u.Path, "/")
+	}
+
+	fmt.Fprintf(w, "  <%s:record>\n", v.prefix)
+	v.element(w, "    ", "recordSchema", explainSchema)
+	v.element(w, "    ", v.escaping, "xml")
+	fmt.Fprintf(w, "    <%s:recordData>\n", v.prefix)
+	fmt.Fprintf(w, "      <explain xmlns=\"%s\">\n", explainSchema)
+	fmt.Fprintf(w, "        <serverInfo protocol=\"SRU\" version=\"%s\">\n", v.number)
+	element(w, "          ", "host", host)
+	element(w, "          ", "port", port)
+	element(w, "          ", "database", database)
+	w.WriteString("        </serverInfo>\n")
+	w.WriteString("        <databaseInfo>\n")
+	element(w, "          ", "title", p.Title)
+	w.WriteString("        </databaseInfo>\n")
+
+	w.WriteString("        <indexInfo>\n")
+	for _, set := range contextSets {
+		fmt.Fprintf(w, "          <set name=\"%s\" identifier=\"%s\"/>\n", set.name, set.identifier)
+	}
+	for _, idx := range explainIndexes {
+		w.WriteString("          <index>\n")
+		element(w, "            ", "title", idx.title)
+		w.WriteString("            <map>\n")
+		for _, name := range idx.names {
+			set, index, _ := strings.Cut(name, ".")
+			fmt.Fprintf(w, "              <name set=\"%s\">%s</name>\n", set, index)
+		}
+		w.WriteString("            </map>\n")
+		w.WriteString("          </index>\n")
+	}
+	w.WriteString("        </indexInfo>\n")
+
+	w.WriteString("        <schemaInfo>\n")
+	for _, s := range recordSchemas {
+		fmt.Fprintf(w, "          <schema identifier=\"%s\" name=\"%s\">\n", s.identifier, s.name)
+		element(w, "            ", "title", s.title)
+		w.WriteString("          </schema>\n")
+	}
+	w.WriteString("        </schemaInfo>\n")
+
+	w.WriteString("        <configInfo>\n")
+	fmt.Fprintf(w, "          <default type=\"numberOfRecords\">%d</default>\n", DefaultMaximumRecords)
+	fmt.Fprintf(w, "          <setting type=\"maximumRecords\">%d</setting>\n", MaxMaximumRecords)
+	for _, rel := range []string{"=", "==", "<>", "adj", "all", "any", "exact"} {
+		fmt.Fprintf(w, "          <supports type=\"relation\">%s</supports>\n", escape(rel))
+	}
+	w.WriteString("        </configInfo>\n")
+	w.WriteString("      </explain>\n")
+	fmt.Fprintf(w, "    </%s:recordData>\n", v.prefix)
+	fmt.Fprintf(w, "  </%s:record>\n", v.prefix)
+	return nil
+}
+
+// ─── Helpers ──────────────────────────────────────────────────────────────────
+
+// element writes a response element in the version's namespace.
+func (v version) element(w *bytes.Buffer, indent, name, value string) {
+	element(w, indent, v.prefix+":"+name, value)
+}
+
+func element(w *bytes.Buffer, indent, name, value string) {
+	fmt.Fprintf(w, "%s<%s>%s</%s>\n", indent, name, escape(value), name)
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
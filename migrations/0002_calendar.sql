@@ -0,0 +1,32 @@
+-- Branches, opening hours and closure dates (holiday calendar).
+
+-- Branches
+CREATE TABLE IF NOT EXISTS branches (
+    id       UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name     VARCHAR(255) NOT NULL,
+    timezone VARCHAR(64)  NOT NULL DEFAULT 'UTC'
+);
+
+-- Weekly opening hours: at most one interval per branch and weekday (0 = Sunday).
+CREATE TABLE IF NOT EXISTS opening_hours (
+    branch_id UUID       NOT NULL REFERENCES branches(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    weekday   INT        NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    opens     VARCHAR(5) NOT NULL,
+    closes    VARCHAR(5) NOT NULL,
+    PRIMARY KEY (branch_id, weekday),
+    CONSTRAINT opening_hours_interval_check CHECK (opens < closes)
+);
+
+-- Closure dates (public holidays, closures imported from iCalendar files).
+CREATE TABLE IF NOT EXISTS closures (
+    branch_id UUID         NOT NULL REFERENCES branches(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    date      DATE         NOT NULL,
+    reason    VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (branch_id, date)
+);
+
+-- Copies belong to at most one branch; copies without a branch keep the
+-- calendar-free behaviour (every day open).
+ALTER TABLE book_copies
+    ADD COLUMN IF NOT EXISTS branch_id UUID NULL REFERENCES branches(id) ON UPDATE CASCADE ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_book_copies_branch_id ON book_copies(branch_id);
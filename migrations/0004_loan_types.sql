@@ -0,0 +1,25 @@
+-- Loan types: standard, short (hourly) and overnight loans.
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'loan_type') THEN
+        CREATE TYPE loan_type AS ENUM ('STANDARD', 'SHORT', 'OVERNIGHT');
+    END IF;
+END$$;
+
+-- Loan rules of a book. loan_hours is the length of a SHORT loan and 0 otherwise.
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS loan_type  loan_type NOT NULL DEFAULT 'STANDARD',
+    ADD COLUMN IF NOT EXISTS loan_hours INT       NOT NULL DEFAULT 0;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'books_loan_hours_check') THEN
+        ALTER TABLE books ADD CONSTRAINT books_loan_hours_check
+            CHECK ((loan_type = 'SHORT' AND loan_hours > 0) OR (loan_type <> 'SHORT' AND loan_hours = 0));
+    END IF;
+END$$;
+
+-- Loan type a checkout was made (or last renewed) under; decides how its fine is charged.
+ALTER TABLE checkouts
+    ADD COLUMN IF NOT EXISTS loan_type loan_type NOT NULL DEFAULT 'STANDARD';
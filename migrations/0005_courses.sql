@@ -0,0 +1,35 @@
+-- Courses, reading lists and course reserves.
+
+-- Courses. term_id is the term the course runs in, if known.
+CREATE TABLE IF NOT EXISTS courses (
+    id      UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    code    VARCHAR(32)  NOT NULL,
+    title   VARCHAR(255) NOT NULL,
+    term_id UUID         NULL REFERENCES terms(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_course_code ON courses(code);
+CREATE INDEX IF NOT EXISTS idx_courses_term_id ON courses(term_id);
+
+-- Reading lists of a course.
+CREATE TABLE IF NOT EXISTS reading_lists (
+    id        UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    course_id UUID         NOT NULL REFERENCES courses(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    title     VARCHAR(255) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_reading_lists_course_id ON reading_lists(course_id);
+
+-- Ordered books on a reading list.
+CREATE TABLE IF NOT EXISTS reading_list_entries (
+    reading_list_id UUID          NOT NULL REFERENCES reading_lists(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    book_id         UUID          NOT NULL REFERENCES books(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    position        INT           NOT NULL CHECK (position >= 1),
+    required        BOOLEAN       NOT NULL DEFAULT FALSE,
+    note            VARCHAR(1000) NOT NULL DEFAULT '',
+    PRIMARY KEY (reading_list_id, book_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_reading_list_position ON reading_list_entries(reading_list_id, position);
+CREATE INDEX IF NOT EXISTS idx_reading_list_entries_book_id ON reading_list_entries(book_id);
+
+-- Last day a book's loan type applies; NULL = indefinitely.
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS loan_type_until DATE NULL;
@@ -0,0 +1,10 @@
+-- Descriptive fields carried by MARC records: edition, imprint and subjects.
+
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS edition   VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS publisher VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS published VARCHAR(64)  NOT NULL DEFAULT '';
+
+-- Subject headings as a JSON array of strings; NULL = none.
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS subjects TEXT NULL;
@@ -0,0 +1,8 @@
+-- When each book's catalogue record last changed, for OAI-PMH selective
+-- harvesting. Existing books count as changed when the migration runs.
+
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT (now() AT TIME ZONE 'utc');
+
+-- Harvests page through books in (updated_at, id) order.
+CREATE INDEX IF NOT EXISTS idx_books_updated_at ON books(updated_at, id);
@@ -0,0 +1,11 @@
+-- Fine payments taken at self-checkout kiosks (SIP2 Fee Paid). A user's
+-- outstanding balance is the fines on their returned checkouts minus these.
+
+CREATE TABLE IF NOT EXISTS payments (
+    id        UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id   UUID        NOT NULL REFERENCES users(id) ON UPDATE CASCADE ON DELETE RESTRICT,
+    amount    INT         NOT NULL CHECK (amount > 0),
+    reference VARCHAR(64) NOT NULL DEFAULT '',
+    paid_at   TIMESTAMP   NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_payments_user_id ON payments(user_id);
@@ -0,0 +1,14 @@
+-- Materialised circulation counts per book, maintained by the service in the
+-- same transaction as every checkout, return, new copy and reservation, so
+-- that book listings can show "3 of 5 available" without counting copies.
+-- holds is the length of the book's reservation queue.
+
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS available_copies   INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS checked_out_copies INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS holds              INT NOT NULL DEFAULT 0;
+
+UPDATE books b SET
+    available_copies   = (SELECT COUNT(*) FROM book_copies c WHERE c.book_id = b.id AND c.status = 'AVAILABLE'),
+    checked_out_copies = (SELECT COUNT(*) FROM book_copies c WHERE c.book_id = b.id AND c.status = 'CHECKED_OUT'),
+    holds              = (SELECT COUNT(*) FROM reservations r WHERE r.book_id = b.id);
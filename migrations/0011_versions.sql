@@ -0,0 +1,7 @@
+-- Record versions for optimistic concurrency: every edit to a user, book or
+-- copy increments its version, and an edit sent with an older one (as an
+-- If-Match ETag) is refused. Existing rows start at version 1.
+
+ALTER TABLE users       ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE books       ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE book_copies ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,7 @@
+-- Withdrawn books: DELETE /books/{id} sets deleted_at instead of removing the
+-- row, and restoring the book clears it again. Queries skip withdrawn books.
+
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+
+CREATE INDEX IF NOT EXISTS idx_books_deleted_at ON books(deleted_at);
@@ -0,0 +1,13 @@
+// Package migrations embeds the SQL migrations shipped with the server.
+//
+// The PostgreSQL migrations in this directory are applied by hand with psql.
+// The SQLite migrations in sqlite/ are applied automatically on startup by
+// bootstrap.OpenSQLite, since a single-file installation has no DBA to run them.
+package migrations
+
+import "embed"
+
+// SQLite holds sqlite/*.sql, applied in file-name order.
+//
+//go:embed sqlite/*.sql
+var SQLite embed.FS
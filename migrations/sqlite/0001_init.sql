@@ -0,0 +1,62 @@
+-- SQLite equivalent of ../0001_init.sql.
+--
+-- Differences from PostgreSQL:
+--   * No enum types: role and status are TEXT with CHECK constraints.
+--   * No uuid_generate_v4(): IDs are assigned by the application; the column
+--     default below only covers rows inserted by hand (e.g. via sqlite3).
+--   * Timestamps are stored as TEXT by the driver and compared as text.
+--
+-- Applied automatically when the server starts with storage: sqlite.
+
+-- Users
+CREATE TABLE IF NOT EXISTS users (
+    id   TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    name VARCHAR(255) NOT NULL,
+    role TEXT         NOT NULL CHECK (role IN ('STUDENT', 'LIBRARIAN'))
+);
+
+-- Books
+CREATE TABLE IF NOT EXISTS books (
+    id           TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    title        VARCHAR(255) NOT NULL,
+    author       VARCHAR(255) NOT NULL,
+    total_copies INT          NOT NULL
+);
+
+-- BookCopies
+CREATE TABLE IF NOT EXISTS book_copies (
+    id      TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    book_id TEXT NOT NULL REFERENCES books(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    status  TEXT NOT NULL,
+    CONSTRAINT book_copies_status_check CHECK (status IN ('AVAILABLE', 'CHECKED_OUT'))
+);
+CREATE INDEX IF NOT EXISTS idx_book_copies_book_id ON book_copies(book_id);
+CREATE INDEX IF NOT EXISTS idx_book_copies_status ON book_copies(status);
+
+-- Checkouts
+CREATE TABLE IF NOT EXISTS checkouts (
+    id           TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    book_copy_id TEXT      NOT NULL REFERENCES book_copies(id) ON UPDATE CASCADE ON DELETE RESTRICT,
+    user_id      TEXT      NOT NULL REFERENCES users(id) ON UPDATE CASCADE ON DELETE RESTRICT,
+    checkout_at  TIMESTAMP NOT NULL,
+    due_date     TIMESTAMP NOT NULL,
+    returned_at  TIMESTAMP NULL,
+    fine_amount  INT       NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_checkouts_book_copy_id ON checkouts(book_copy_id);
+CREATE INDEX IF NOT EXISTS idx_checkouts_user_id ON checkouts(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_active_checkout ON checkouts(book_copy_id) WHERE returned_at IS NULL;
+
+-- Reservations
+CREATE TABLE IF NOT EXISTS reservations (
+    id             TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    book_id        TEXT      NOT NULL REFERENCES books(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    user_id        TEXT      NOT NULL REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    queue_position INT       NOT NULL,
+    created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_reservations_book_id ON reservations(book_id);
+CREATE INDEX IF NOT EXISTS idx_reservations_user_id ON reservations(user_id);
+CREATE INDEX IF NOT EXISTS idx_reservations_queue ON reservations(book_id, queue_position);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_user_book_reservation ON reservations(book_id, user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_book_queue_position ON reservations(book_id, queue_position);
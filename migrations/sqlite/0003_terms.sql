@@ -0,0 +1,14 @@
+-- SQLite equivalent of ../0003_terms.sql.
+
+-- Academic terms. Terms may not overlap; the service enforces this on write.
+CREATE TABLE IF NOT EXISTS terms (
+    id         TEXT PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL,
+    start_date DATE         NOT NULL,
+    end_date   DATE         NOT NULL,
+    CONSTRAINT terms_dates_check CHECK (start_date <= end_date)
+);
+CREATE INDEX IF NOT EXISTS idx_terms_dates ON terms(start_date, end_date);
+
+-- Number of times a checkout has been renewed.
+ALTER TABLE checkouts ADD COLUMN renewals INT NOT NULL DEFAULT 0 CHECK (renewals >= 0);
@@ -0,0 +1,8 @@
+-- SQLite equivalent of ../0004_loan_types.sql.
+
+-- Loan rules of a book. loan_hours is the length of a SHORT loan and 0 otherwise.
+ALTER TABLE books ADD COLUMN loan_type TEXT NOT NULL DEFAULT 'STANDARD' CHECK (loan_type IN ('STANDARD', 'SHORT', 'OVERNIGHT'));
+ALTER TABLE books ADD COLUMN loan_hours INT NOT NULL DEFAULT 0 CHECK ((loan_type = 'SHORT' AND loan_hours > 0) OR (loan_type <> 'SHORT' AND loan_hours = 0));
+
+-- Loan type a checkout was made (or last renewed) under; decides how its fine is charged.
+ALTER TABLE checkouts ADD COLUMN loan_type TEXT NOT NULL DEFAULT 'STANDARD' CHECK (loan_type IN ('STANDARD', 'SHORT', 'OVERNIGHT'));
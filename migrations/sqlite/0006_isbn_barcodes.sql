@@ -0,0 +1,9 @@
+-- SQLite equivalent of ../0006_isbn_barcodes.sql.
+
+-- ISBN-13 of a book, without hyphens; NULL = unknown. Used to deduplicate imports.
+ALTER TABLE books ADD COLUMN isbn VARCHAR(13) NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_book_isbn ON books(isbn);
+
+-- Barcode label of a physical copy; NULL = not labelled.
+ALTER TABLE book_copies ADD COLUMN barcode VARCHAR(64) NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_copy_barcode ON book_copies(barcode);
@@ -0,0 +1,8 @@
+-- SQLite equivalent of ../0007_bibliographic.sql.
+
+ALTER TABLE books ADD COLUMN edition VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE books ADD COLUMN publisher VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE books ADD COLUMN published VARCHAR(64) NOT NULL DEFAULT '';
+
+-- Subject headings as a JSON array of strings; NULL = none.
+ALTER TABLE books ADD COLUMN subjects TEXT NULL;
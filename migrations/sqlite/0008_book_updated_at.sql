@@ -0,0 +1,7 @@
+-- SQLite equivalent of ../0008_book_updated_at.sql. ADD COLUMN cannot take a
+-- non-constant default, so existing books are stamped afterwards.
+
+ALTER TABLE books ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+UPDATE books SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now');
+
+CREATE INDEX IF NOT EXISTS idx_books_updated_at ON books(updated_at, id);
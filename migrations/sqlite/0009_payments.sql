@@ -0,0 +1,10 @@
+-- SQLite equivalent of ../0009_payments.sql.
+
+CREATE TABLE IF NOT EXISTS payments (
+    id        TEXT PRIMARY KEY,
+    user_id   TEXT        NOT NULL REFERENCES users(id) ON UPDATE CASCADE ON DELETE RESTRICT,
+    amount    INT         NOT NULL CHECK (amount > 0),
+    reference VARCHAR(64) NOT NULL DEFAULT '',
+    paid_at   TIMESTAMP   NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_payments_user_id ON payments(user_id);
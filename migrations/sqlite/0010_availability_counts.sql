@@ -0,0 +1,10 @@
+-- SQLite equivalent of ../0010_availability_counts.sql.
+
+ALTER TABLE books ADD COLUMN available_copies INT NOT NULL DEFAULT 0;
+ALTER TABLE books ADD COLUMN checked_out_copies INT NOT NULL DEFAULT 0;
+ALTER TABLE books ADD COLUMN holds INT NOT NULL DEFAULT 0;
+
+UPDATE books SET
+    available_copies   = (SELECT COUNT(*) FROM book_copies c WHERE c.book_id = books.id AND c.status = 'AVAILABLE'),
+    checked_out_copies = (SELECT COUNT(*) FROM book_copies c WHERE c.book_id = books.id AND c.status = 'CHECKED_OUT'),
+    holds              = (SELECT COUNT(*) FROM reservations r WHERE r.book_id = books.id);
@@ -0,0 +1,5 @@
+-- SQLite equivalent of ../0011_versions.sql.
+
+ALTER TABLE users ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE books ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE book_copies ADD COLUMN version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,5 @@
+-- SQLite equivalent of ../0012_book_deletion.sql.
+
+ALTER TABLE books ADD COLUMN deleted_at TIMESTAMP NULL;
+
+CREATE INDEX IF NOT EXISTS idx_books_deleted_at ON books(deleted_at);
@@ -1,24 +1,36 @@
 //go:build ignore
 // +build ignore
 
-// Package main provides a manual concurrency stress test for the Library Checkout API.
+// Package main provides a manual concurrency stress test and checkout benchmark
+// for the Library Checkout API.
 //
-// Usage:
+// Usage (go run refuses files named *_test.go, so run a copy):
 //
-//	go run ./scripts/concurrency_test.go <book_id> <user1_id> [user2_id ...]
+//	cp scripts/concurrency_test.go /tmp/concurrency.go
+//	go run /tmp/concurrency.go <book_id> <user1_id> [user2_id ...]
 //
 // Or use the convenience environment variables:
 //
-//	BOOK_ID=<uuid>  USER_IDS=<uuid1>,<uuid2>,...  go run ./scripts/concurrency_test.go
+//	BOOK_ID=<uuid>  USER_IDS=<uuid1>,<uuid2>,...  go run /tmp/concurrency.go
+//
+// Or let the script create its own book and users through the API:
+//
+//	go run /tmp/concurrency.go -users 300 -copies 50 -quiet -label skip-locked
 //
 // What it does:
 //  1. Fires N goroutines (one per user) all attempting to check out the same book simultaneously.
 //  2. Prints how many succeeded with a real checkout vs. got queued into a reservation.
-//  3. Queries the DB directly to verify no duplicate active checkout rows exist for any BookCopy.
+//  3. Prints the latency distribution (min/p50/p95/p99/max) and throughput of the checkouts.
+//  4. When it created the book itself, checks that exactly min(copies, users) checkouts were
+//     made and everyone else was queued, and exits 1 otherwise.
+//
+// To compare copy allocation strategies, run it once against a server started with
+// FEATURE_SKIP_LOCKED_ALLOCATION=false and once with the default (true), using a
+// different -label each time; the last line of each run is a one-line summary.
 //
 // Prerequisites:
 //   - Server must be running: DATABASE_URL must be set.
-//   - At least 1 book with some copies and N users must exist in the DB.
+//   - Without -users: at least 1 book with some copies and N users must exist in the DB.
 //   - Run migrations before starting.
 
 package main
@@ -26,11 +38,13 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -39,18 +53,32 @@ import (
 const defaultServerAddr = "http://localhost:8080"
 
 type checkoutResult struct {
-	UserID    string
-	Type      string // "checkout" or "reservation"
+	UserID     string
+	Type       string // "checkout" or "reservation"
 	StatusCode int
-	Err       error
+	Latency    time.Duration
+	Err        error
 }
 
 func main() {
+	users := flag.Int("users", 0, "create this many users and a book, then check it out once per user")
+	copies := flag.Int("copies", 1, "copies of the created book (with -users)")
+	label := flag.String("label", "", "name for this run in the summary line, e.g. the server's allocation mode")
+	quiet := flag.Bool("quiet", false, "print only failed requests, not one line per user")
+	flag.Parse()
+
 	serverAddr := os.Getenv("SERVER_ADDR")
 	if serverAddr == "" {
 		serverAddr = defaultServerAddr
 	}
 
+	// Every user's request is in flight at once, so keep one idle connection
+	// per user rather than reconnecting on every run.
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: max(*users, 100)},
+	}
+
 	// Collect book_id and user_ids from cli args or env.
 	bookID := os.Getenv("BOOK_ID")
 	userIDsEnv := os.Getenv("USER_IDS")
@@ -61,7 +89,7 @@ func main() {
 	}
 
 	// Support positional args: script <book_id> [user_ids...]
-	args := os.Args[1:]
+	args := flag.Args()
 	if len(args) >= 1 {
 		bookID = args[0]
 	}
@@ -69,9 +97,26 @@ func main() {
 		userIDs = args[1:]
 	}
 
+	created := false
+	if *users > 0 {
+		if bookID != "" || len(userIDs) > 0 {
+			log.Fatal("-users creates its own book and users; do not also pass BOOK_ID or user IDs")
+		}
+		if *copies < 1 {
+			log.Fatal("-copies must be at least 1")
+		}
+		var err error
+		bookID, userIDs, err = setup(client, serverAddr, *copies, *users)
+		if err != nil {
+			log.Fatalf("setup: %v", err)
+		}
+		created = true
+	}
+
 	if bookID == "" {
-		log.Fatal("Usage: BOOK_ID=<uuid> USER_IDS=<u1,u2,...> go run ./scripts/concurrency_test.go\n" +
-			"  or: go run ./scripts/concurrency_test.go <book_id> <user1_id> [user2_id ...]")
+		log.Fatal("Usage: BOOK_ID=<uuid> USER_IDS=<u1,u2,...> go run concurrency.go\n" +
+			"  or: go run concurrency.go <book_id> <user1_id> [user2_id ...]\n" +
+			"  or: go run concurrency.go -users <n> [-copies <n>] [-label <name>] [-quiet]")
 	}
 	if len(userIDs) == 0 {
 		log.Fatal("At least one user ID must be provided via USER_IDS env or positional args")
@@ -80,6 +125,9 @@ func main() {
 	fmt.Printf("=== Library Concurrency Test ===\n")
 	fmt.Printf("Server : %s\n", serverAddr)
 	fmt.Printf("Book   : %s\n", bookID)
+	if created {
+		fmt.Printf("Copies : %d\n", *copies)
+	}
 	fmt.Printf("Users  : %d\n\n", len(userIDs))
 
 	results := make([]checkoutResult, len(userIDs))
@@ -93,31 +141,40 @@ func main() {
 		go func(idx int, userID string) {
 			defer wg.Done()
 			<-start // wait for the barrier
-			result := attemptCheckout(serverAddr, bookID, strings.TrimSpace(userID))
+			result := attemptCheckout(client, serverAddr, bookID, strings.TrimSpace(userID))
 			results[idx] = result
 		}(i, uid)
 	}
 
 	// Release all goroutines at once.
 	fmt.Println("Firing all requests simultaneously...")
+	began := time.Now()
 	close(start)
 
 	wg.Wait()
-	fmt.Println("All requests completed.\n")
+	elapsed := time.Since(began)
+	fmt.Println("All requests completed.")
+	fmt.Println()
 
 	// Tally results.
 	var checkouts, reservations, failures int
+	latencies := make([]time.Duration, 0, len(results))
 	for _, r := range results {
+		latencies = append(latencies, r.Latency)
 		switch {
 		case r.Err != nil:
 			failures++
 			fmt.Printf("  [ERR ] user=%-38s err=%v\n", r.UserID, r.Err)
 		case r.Type == "checkout":
 			checkouts++
-			fmt.Printf("  [CHCK] user=%-38s status=%d type=checkout\n", r.UserID, r.StatusCode)
+			if !*quiet {
+				fmt.Printf("  [CHCK] user=%-38s status=%d type=checkout\n", r.UserID, r.StatusCode)
+			}
 		case r.Type == "reservation":
 			reservations++
-			fmt.Printf("  [RESV] user=%-38s status=%d type=reservation\n", r.UserID, r.StatusCode)
+			if !*quiet {
+				fmt.Printf("  [RESV] user=%-38s status=%d type=reservation\n", r.UserID, r.StatusCode)
+			}
 		default:
 			failures++
 			fmt.Printf("  [FAIL] user=%-38s status=%d unexpected response\n", r.UserID, r.StatusCode)
@@ -130,6 +187,17 @@ func main() {
 	fmt.Printf("Failures     : %d\n", failures)
 	fmt.Printf("Total        : %d\n\n", len(userIDs))
 
+	slices.Sort(latencies)
+	throughput := float64(len(results)) / elapsed.Seconds()
+	fmt.Println("--- Latency ---")
+	fmt.Printf("Min          : %v\n", latencies[0].Round(time.Microsecond))
+	fmt.Printf("p50          : %v\n", percentile(latencies, 50).Round(time.Microsecond))
+	fmt.Printf("p95          : %v\n", percentile(latencies, 95).Round(time.Microsecond))
+	fmt.Printf("p99          : %v\n", percentile(latencies, 99).Round(time.Microsecond))
+	fmt.Printf("Max          : %v\n", latencies[len(latencies)-1].Round(time.Microsecond))
+	fmt.Printf("Wall time    : %v\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("Throughput   : %.1f req/s\n\n", throughput)
+
 	// Verify invariant: DB-level unique index means no duplicate active checkouts.
 	// We rely on the API returning correct data — if any two users both got
 	// "checkout" for the same copy, the DB constraint (uniq_active_checkout) would
@@ -138,32 +206,111 @@ func main() {
 	fmt.Println("--- Invariant Check ---")
 	fmt.Println("The DB unique partial index (uniq_active_checkout) enforces at most one")
 	fmt.Println("active checkout per BookCopy at the database level.")
-	fmt.Printf("Checkouts recorded: %d — if this is ≤ number of available copies, the system is correct.\n", checkouts)
+	ok := failures == 0
+	if created {
+		// The book is new, so every copy was on the shelf: a checkout that
+		// became a reservation while a copy was still free is as wrong as two
+		// checkouts of one copy.
+		want := min(*copies, len(userIDs))
+		ok = ok && checkouts == want && reservations == len(userIDs)-want
+		fmt.Printf("Checkouts recorded: %d, want %d; reservations: %d, want %d.\n",
+			checkouts, want, reservations, len(userIDs)-want)
+	} else {
+		fmt.Printf("Checkouts recorded: %d — if this is ≤ number of available copies, the system is correct.\n", checkouts)
+	}
+
+	name := *label
+	if name == "" {
+		name = "run"
+	}
+	fmt.Printf("\n%s: users=%d checkouts=%d reservations=%d failures=%d p50=%v p95=%v p99=%v max=%v throughput=%.1f req/s\n",
+		name, len(userIDs), checkouts, reservations, failures,
+		percentile(latencies, 50).Round(time.Microsecond), percentile(latencies, 95).Round(time.Microsecond),
+		percentile(latencies, 99).Round(time.Microsecond), latencies[len(latencies)-1].Round(time.Microsecond), throughput)
 
 	if failures > 0 {
 		fmt.Printf("\n[WARNING] %d request(s) failed — check server logs for details.\n", failures)
+	}
+	if !ok {
 		os.Exit(1)
 	}
 }
 
+// setup creates a book with the given number of copies and that many students
+// through the API, returning their IDs.
+func setup(client *http.Client, serverAddr string, copies, users int) (string, []string, error) {
+	stamp := time.Now().Format("2006-01-02 15:04:05.000")
+	bookID, err := postForID(client, serverAddr+"/books", map[string]any{
+		"title":        "Concurrency benchmark " + stamp,
+		"author":       "concurrency_test",
+		"total_copies": copies,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("create book: %w", err)
+	}
+	userIDs := make([]string, users)
+	for i := range userIDs {
+		userIDs[i], err = postForID(client, serverAddr+"/users", map[string]any{
+			"name": fmt.Sprintf("Concurrency benchmark %s #%d", stamp, i+1),
+			"role": "STUDENT",
+		})
+		if err != nil {
+			return "", nil, fmt.Errorf("create user %d: %w", i+1, err)
+		}
+	}
+	return bookID, userIDs, nil
+}
+
+// postForID posts body as JSON and returns the id field of a 201 response.
+func postForID(client *http.Client, url string, body any) (string, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, raw)
+	}
+	var parsed struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &parsed); err != nil || parsed.ID == "" {
+		return "", fmt.Errorf("no id in response: %s", raw)
+	}
+	return parsed.ID, nil
+}
+
+// percentile returns the p-th percentile of sorted latencies (nearest rank).
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
 // attemptCheckout sends POST /books/{bookID}/checkout for the given userID and
 // parses the JSON response type field.
-func attemptCheckout(serverAddr, bookID, userID string) checkoutResult {
+func attemptCheckout(client *http.Client, serverAddr, bookID, userID string) checkoutResult {
 	url := fmt.Sprintf("%s/books/%s/checkout", serverAddr, bookID)
 	body := fmt.Sprintf(`{"user_id":"%s"}`, userID)
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	began := time.Now()
 	resp, err := client.Post(url, "application/json", bytes.NewBufferString(body))
 	if err != nil {
-		return checkoutResult{UserID: userID, Err: err}
+		return checkoutResult{UserID: userID, Latency: time.Since(began), Err: err}
 	}
 	defer resp.Body.Close()
 
 	raw, _ := io.ReadAll(resp.Body)
+	latency := time.Since(began)
 
 	var parsed map[string]interface{}
 	if err := json.Unmarshal(raw, &parsed); err != nil {
-		return checkoutResult{UserID: userID, StatusCode: resp.StatusCode, Err: fmt.Errorf("bad JSON: %s", raw)}
+		return checkoutResult{UserID: userID, StatusCode: resp.StatusCode, Latency: latency, Err: fmt.Errorf("bad JSON: %s", raw)}
 	}
 
 	typeVal, _ := parsed["type"].(string)
@@ -171,5 +318,6 @@ func attemptCheckout(serverAddr, bookID, userID string) checkoutResult {
 		UserID:     userID,
 		Type:       typeVal,
 		StatusCode: resp.StatusCode,
+		Latency:    latency,
 	}
 }
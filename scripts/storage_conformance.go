@@ -0,0 +1,117 @@
+//go:build ignore
+// +build ignore
+
+// Package main runs the repository conformance suite (internal/repositories/repotest)
+// against every storage backend available in this environment.
+//
+// Usage:
+//
+//	go run ./scripts/storage_conformance.go
+//
+// The in-memory backend and SQLite (in a temporary database file) are always
+// checked. When DATABASE_URL is set the
+// PostgreSQL backend is checked as well; the suite creates its own users and
+// books (named "repotest …"), so point it at a development database that has
+// had migrations applied, never at production.
+//
+// Set VERBOSE=1 to include service logs. Exits non-zero if any backend fails a
+// check.
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"library/internal/bootstrap"
+	"library/internal/config"
+	"library/internal/repositories"
+	"library/internal/repositories/repotest"
+)
+
+// quiet silences GORM's SQL log unless VERBOSE is set; expected constraint
+// violations would otherwise flood the report.
+func quiet(db *gorm.DB) *gorm.DB {
+	if os.Getenv("VERBOSE") != "" {
+		return db
+	}
+	return db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+}
+
+func main() {
+	// Service logging drowns out the report; set VERBOSE=1 to see it.
+	if os.Getenv("VERBOSE") == "" {
+		log.SetOutput(io.Discard)
+	}
+
+	backends := map[string]func() (*repositories.Repositories, error){
+		"memory": func() (*repositories.Repositories, error) {
+			return repositories.NewMemoryRepositories(), nil
+		},
+	}
+	order := []string{"memory", "sqlite"}
+
+	dir, err := os.MkdirTemp("", "library-conformance-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	backends["sqlite"] = func() (*repositories.Repositories, error) {
+		cfg := config.Default().Database
+		cfg.SQLitePath = filepath.Join(dir, "library.db")
+		db, err := bootstrap.OpenSQLite(cfg)
+		if err != nil {
+			return nil, err
+		}
+		// The database doubles as its own replica, so that every check also
+		// covers reads routed through Transactor.ReadOnly.
+		return repositories.NewGormRepositories(quiet(db), quiet(db)), nil
+	}
+
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		backends["postgres"] = func() (*repositories.Repositories, error) {
+			cfg := config.Default().Database
+			cfg.URL = url
+			db, err := bootstrap.OpenDatabase(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return repositories.NewGormRepositories(quiet(db)), nil
+		}
+		order = append(order, "postgres")
+	} else {
+		fmt.Println("DATABASE_URL not set: skipping postgres")
+	}
+
+	failed := false
+	for _, name := range order {
+		fmt.Printf("=== %s\n", name)
+		repos, err := backends[name]()
+		if err != nil {
+			fmt.Printf("FAIL  could not open backend: %v\n", err)
+			failed = true
+			continue
+		}
+		err = repotest.Run(repos, func(check string, err error) {
+			if err != nil {
+				fmt.Printf("FAIL  %s\n      %v\n", check, err)
+			} else {
+				fmt.Printf("ok    %s\n", check)
+			}
+		})
+		if err != nil {
+			failed = true
+		}
+	}
+
+	if failed {
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+}